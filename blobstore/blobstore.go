@@ -0,0 +1,41 @@
+// Package blobstore keeps the content of files attached to notes, on the
+// local filesystem or in an S3 compatible object store.
+package blobstore
+
+import (
+	"NOTESBE/config"
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned by Get when no blob is stored under the key.
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores blobs under keys of slash separated segments. Keys are
+// chosen by the caller and never reused.
+type BlobStore interface {
+	// Put stores the content of r under key. The blob only becomes visible
+	// once r is read to the end; on error nothing is stored.
+	Put(ctx context.Context, key string, r io.Reader) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob, deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// New returns the store selected by attachments.store.
+func New(cfg config.AttachmentConfig) BlobStore {
+
+	if cfg.Store == "s3" {
+		return &S3Store{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+			PathStyle: cfg.S3.PathStyle,
+		}
+	}
+
+	return &LocalStore{Dir: cfg.Dir}
+}
@@ -0,0 +1,62 @@
+package blobstore
+
+import (
+	"NOTESBE/blobstore/s3test"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testStore runs the same checks against every implementation.
+func testStore(t *testing.T, store BlobStore) {
+
+	ctx := context.Background()
+
+	err := store.Put(ctx, "notes/1/a b+c", strings.NewReader("hello"))
+	assert.NoError(t, err)
+
+	rc, err := store.Get(ctx, "notes/1/a b+c")
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	assert.Equal(t, "hello", string(data))
+
+	assert.NoError(t, store.Delete(ctx, "notes/1/a b+c"))
+	assert.NoError(t, store.Delete(ctx, "notes/1/a b+c"), "deleting twice is fine")
+
+	_, err = store.Get(ctx, "notes/1/a b+c")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestLocalStore(t *testing.T) {
+
+	store := &LocalStore{Dir: t.TempDir()}
+	testStore(t, store)
+
+	err := store.Put(context.Background(), "../escape", strings.NewReader("x"))
+	assert.Error(t, err)
+}
+
+func TestS3Store(t *testing.T) {
+
+	mock := s3test.NewServer("notes", "access", "secret")
+	defer mock.Close()
+
+	store := &S3Store{Endpoint: mock.URL, Region: "us-east-1", Bucket: "notes", AccessKey: "access", SecretKey: "secret", PathStyle: true}
+	testStore(t, store)
+
+	err := store.Put(context.Background(), "notes/2/x", strings.NewReader("stored"))
+	assert.NoError(t, err)
+	data, ok := mock.Object("notes/2/x")
+	assert.True(t, ok)
+	assert.Equal(t, "stored", string(data))
+
+	wrong := *store
+	wrong.SecretKey = "guess"
+	err = wrong.Put(context.Background(), "notes/2/y", strings.NewReader("x"))
+	assert.ErrorContains(t, err, "SignatureDoesNotMatch")
+	assert.Equal(t, 1, mock.Len())
+}
@@ -0,0 +1,187 @@
+// Package s3test runs a minimal S3 compatible object store for tests, in
+// the spirit of a local MinIO. It serves PUT, GET and DELETE of objects in a
+// single bucket addressed path style, keeps them in memory and rejects
+// requests whose AWS Signature Version 4 or payload hash does not verify.
+package s3test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type Server struct {
+	*httptest.Server
+
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Region    string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+// NewServer starts a store with an empty bucket that accepts requests
+// signed with accessKey and secretKey for region us-east-1.
+func NewServer(bucket, accessKey, secretKey string) *Server {
+
+	s := &Server{
+		Bucket:    bucket,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		Region:    "us-east-1",
+		objects:   map[string][]byte{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+
+	return s
+}
+
+// Object returns the content stored under key.
+func (s *Server) Object(key string) ([]byte, bool) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.objects[key]
+	return data, ok
+}
+
+// Len is the number of objects in the bucket.
+func (s *Server) Len() int {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.objects)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.Bucket {
+		fail(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		fail(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+
+	if code, message := s.verify(r, body); code != "" {
+		fail(w, http.StatusForbidden, code, message)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		s.objects[key] = body
+		w.Header().Set("ETag", fmt.Sprintf("%q", hex.EncodeToString(sum(body))))
+		w.WriteHeader(http.StatusOK)
+
+	case http.MethodGet:
+		data, ok := s.objects[key]
+		if !ok {
+			fail(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		fail(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource.")
+	}
+}
+
+// verify recomputes the signature of r and returns the code and message of
+// the error to send when it does not match.
+func (s *Server) verify(r *http.Request, body []byte) (string, string) {
+
+	auth := r.Header.Get("Authorization")
+	fields := map[string]string{}
+	for _, field := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		fields[name] = value
+	}
+
+	credential := strings.SplitN(fields["Credential"], "/", 2)
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 ") || len(credential) != 2 {
+		return "AccessDenied", "Missing or malformed Authorization header"
+	}
+	if credential[0] != s.AccessKey {
+		return "InvalidAccessKeyId", "The access key does not exist"
+	}
+
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash != hex.EncodeToString(sum(body)) {
+		return "XAmzContentSHA256Mismatch", "The provided x-amz-content-sha256 header does not match what was computed"
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	scope := credential[1]
+	if len(amzDate) < 8 || scope != amzDate[:8]+"/"+s.Region+"/s3/aws4_request" {
+		return "AuthorizationHeaderMalformed", "The credential scope is wrong"
+	}
+
+	names := strings.Split(fields["SignedHeaders"], ";")
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	fmt.Fprintf(&canonical, "%s\n%s\n%s\n", r.Method, r.URL.EscapedPath(), r.URL.RawQuery)
+	for _, name := range names {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		fmt.Fprintf(&canonical, "%s:%s\n", name, strings.TrimSpace(value))
+	}
+	fmt.Fprintf(&canonical, "\n%s\n%s", strings.Join(names, ";"), payloadHash)
+
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum([]byte(canonical.String())))
+
+	key := mac([]byte("AWS4"+s.SecretKey), amzDate[:8])
+	for _, part := range []string{s.Region, "s3", "aws4_request"} {
+		key = mac(key, part)
+	}
+
+	if !hmac.Equal([]byte(hex.EncodeToString(mac(key, stringToSign))), []byte(fields["Signature"])) {
+		return "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided."
+	}
+
+	return "", ""
+}
+
+func fail(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Error><Code>%s</Code><Message>%s</Message></Error>", code, message)
+}
+
+func sum(data []byte) []byte {
+	h := sha256.Sum256(data)
+	return h[:]
+}
+
+func mac(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
@@ -0,0 +1,829 @@
+// Package client is a typed Go SDK for the Notes API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxRetries = 3
+	defaultBackoff    = 200 * time.Millisecond
+	maxBackoff        = 5 * time.Second
+
+	// tokens expiring within this window are refreshed before use
+	refreshWindow = time.Minute
+)
+
+// ErrNoCredentials is returned when a request needs a token and the client
+// has neither a valid token nor a username/password to obtain one.
+var ErrNoCredentials = errors.New("client: not logged in")
+
+// ErrTwoFactorRequired is returned when an expired token cannot be refreshed
+// because the account needs a second factor; log in again interactively.
+var ErrTwoFactorRequired = errors.New("client: two-factor code required")
+
+// ErrExportPending is returned by DownloadExport while the archive is built.
+var ErrExportPending = errors.New("client: export is still being built")
+
+// APIError is returned for any non 2xx response from the server.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("notes api: %d %s", e.StatusCode, e.Message)
+}
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	maxRetries int
+	backoff    time.Duration
+
+	mu       sync.Mutex
+	username string
+	password string
+	token    string
+	userId   uint64
+	expiry   time.Time
+}
+
+type Option func(*Client)
+
+func WithHTTPClient(c *http.Client) Option {
+	return func(cl *Client) { cl.httpClient = c }
+}
+
+// WithCredentials lets the client log in on demand and refresh expired tokens.
+func WithCredentials(username, password string) Option {
+	return func(cl *Client) {
+		cl.username = username
+		cl.password = password
+	}
+}
+
+// WithToken starts the client with an existing token, e.g. one loaded from
+// disk, or a personal access token.
+func WithToken(token string, userId uint64) Option {
+	return func(cl *Client) { cl.setToken(token, userId) }
+}
+
+// WithRetries sets how many times a request rejected with 429 is retried.
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(cl *Client) {
+		cl.maxRetries = n
+		cl.backoff = backoff
+	}
+}
+
+func New(baseURL string, opts ...Option) *Client {
+
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		maxRetries: defaultMaxRetries,
+		backoff:    defaultBackoff,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Token returns the current token and the id of the user it belongs to.
+func (c *Client) Token() (string, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token, c.userId
+}
+
+func (c *Client) setToken(token string, userId uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+	c.userId = userId
+	c.expiry = tokenExpiry(token)
+}
+
+func (c *Client) Signup(ctx context.Context, username, password string) error {
+	return c.do(ctx, http.MethodPost, "/api/auth/signup", nil, UserReq{UserName: username, PassWord: password}, nil, false)
+}
+
+// Login authenticates and remembers the credentials so the token can be
+// refreshed transparently when it expires. When resp.TwoFactor is set no
+// token was issued yet: call VerifyTwoFactor with resp.Challenge.
+func (c *Client) Login(ctx context.Context, username, password string) (*LoginResp, error) {
+
+	var resp LoginResp
+
+	err := c.do(ctx, http.MethodPost, "/api/auth/login", nil, UserReq{UserName: username, PassWord: password}, &resp, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.TwoFactor {
+		return &resp, nil
+	}
+
+	c.mu.Lock()
+	c.username = username
+	c.password = password
+	c.mu.Unlock()
+
+	c.setToken(resp.Token, resp.UserId)
+
+	return &resp, nil
+}
+
+// VerifyTwoFactor completes a login with a TOTP or recovery code.
+func (c *Client) VerifyTwoFactor(ctx context.Context, challenge, code string) (*LoginResp, error) {
+
+	var resp LoginResp
+
+	err := c.do(ctx, http.MethodPost, "/api/auth/2fa/verify", nil, TwoFactorVerifyReq{Challenge: challenge, Code: code}, &resp, false)
+	if err != nil {
+		return nil, err
+	}
+
+	c.setToken(resp.Token, resp.UserId)
+
+	return &resp, nil
+}
+
+// ChangePassword changes the password of the logged in user and remembers
+// the new one for transparent re-login. The server revokes every token of the
+// user, the current one included.
+func (c *Client) ChangePassword(ctx context.Context, oldPassword, newPassword string) error {
+
+	err := c.do(ctx, http.MethodPost, "/api/auth/password/change", nil, ChangePasswordReq{OldPassword: oldPassword, NewPassword: newPassword}, nil, true)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if c.password != "" {
+		c.password = newPassword
+	}
+	c.mu.Unlock()
+
+	return nil
+}
+
+// ForgotPassword asks for a reset link to be mailed to a verified address.
+func (c *Client) ForgotPassword(ctx context.Context, email string) error {
+	return c.do(ctx, http.MethodPost, "/api/auth/password/forgot", nil, EmailReq{Email: email}, nil, false)
+}
+
+// ResetPassword sets a new password with the token from a reset link.
+func (c *Client) ResetPassword(ctx context.Context, token, password string) error {
+	return c.do(ctx, http.MethodPost, "/api/auth/password/reset", nil, ResetPasswordReq{Token: token, Password: password}, nil, false)
+}
+
+// SetEmail changes the email address, which has to be verified with the
+// token mailed to it before it can be used for password resets.
+func (c *Client) SetEmail(ctx context.Context, email string) error {
+	return c.do(ctx, http.MethodPost, "/api/auth/email", nil, EmailReq{Email: email}, nil, true)
+}
+
+func (c *Client) VerifyEmail(ctx context.Context, token string) error {
+	return c.do(ctx, http.MethodPost, "/api/auth/email/verify", nil, TokenReq{Token: token}, nil, false)
+}
+
+func (c *Client) GetProfile(ctx context.Context) (*Profile, error) {
+
+	var profile Profile
+
+	err := c.do(ctx, http.MethodGet, "/api/me", nil, nil, &profile, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+// UpdateProfile changes the fields set in req and returns the new profile.
+func (c *Client) UpdateProfile(ctx context.Context, req ProfileReq) (*Profile, error) {
+
+	var profile Profile
+
+	err := c.do(ctx, http.MethodPatch, "/api/me", nil, req, &profile, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Username != nil {
+		c.mu.Lock()
+		if c.username != "" {
+			c.username = profile.Username
+		}
+		c.mu.Unlock()
+	}
+
+	return &profile, nil
+}
+
+// DeleteAccount deletes the account and everything it owns. password is
+// ignored for accounts created through OpenID Connect.
+func (c *Client) DeleteAccount(ctx context.Context, password string) error {
+
+	err := c.do(ctx, http.MethodDelete, "/api/me", nil, DeleteAccountReq{Password: password}, nil, true)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.username = ""
+	c.password = ""
+	c.mu.Unlock()
+	c.setToken("", 0)
+
+	return nil
+}
+
+// RequestExport starts building an archive of all personal data of the user.
+func (c *Client) RequestExport(ctx context.Context) (*Export, error) {
+
+	var export Export
+
+	err := c.do(ctx, http.MethodPost, "/api/me/export", nil, nil, &export, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+// DownloadExport writes the zip archive of the export to w, or returns
+// ErrExportPending when it is not built yet.
+func (c *Client) DownloadExport(ctx context.Context, exportId uint64, w io.Writer) error {
+
+	if err := c.ensureToken(ctx); err != nil {
+		return err
+	}
+
+	resp, err := c.send(ctx, http.MethodGet, fmt.Sprintf("/api/me/export/%d", exportId), nil, nil, true)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusAccepted:
+		return ErrExportPending
+	case resp.StatusCode != http.StatusOK:
+		return decodeError(resp)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (c *Client) CreateNote(ctx context.Context, note string) error {
+	return c.do(ctx, http.MethodPost, "/api/notes", nil, NoteReq{Note: note}, nil, true)
+}
+
+func (c *Client) ListNotes(ctx context.Context) ([]Note, error) {
+
+	notes := []Note{}
+
+	err := c.do(ctx, http.MethodGet, "/api/notes", nil, nil, &notes, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
+
+func (c *Client) GetNote(ctx context.Context, noteId uint64) (*Note, error) {
+
+	var note Note
+
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/notes/%d", noteId), nil, nil, &note, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &note, nil
+}
+
+// RenderNote returns the Markdown of a note rendered as sanitized HTML.
+func (c *Client) RenderNote(ctx context.Context, noteId uint64) (string, error) {
+
+	if err := c.ensureToken(ctx); err != nil {
+		return "", err
+	}
+
+	resp, err := c.send(ctx, http.MethodGet, fmt.Sprintf("/api/notes/%d", noteId), url.Values{"render": {"html"}}, nil, true)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", decodeError(resp)
+	}
+
+	html, err := io.ReadAll(resp.Body)
+	return string(html), err
+}
+
+func (c *Client) UpdateNote(ctx context.Context, noteId uint64, note string) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/api/notes/%d", noteId), nil, NoteReq{Note: note}, nil, true)
+}
+
+func (c *Client) DeleteNote(ctx context.Context, noteId uint64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/notes/%d", noteId), nil, nil, nil, true)
+}
+
+// CreateChecklist creates a checklist described by note with an unchecked
+// item for each of the texts.
+func (c *Client) CreateChecklist(ctx context.Context, note string, texts []string) error {
+
+	req := NoteReq{Note: note, Type: "checklist"}
+	for i := range texts {
+		req.Items = append(req.Items, ChecklistItemReq{Text: &texts[i]})
+	}
+
+	return c.do(ctx, http.MethodPost, "/api/notes", nil, req, nil, true)
+}
+
+func (c *Client) ListItems(ctx context.Context, noteId uint64) ([]ChecklistItem, error) {
+
+	items := []ChecklistItem{}
+
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/notes/%d/items", noteId), nil, nil, &items, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// AddItem adds an item at the end of a checklist, or at req.Position.
+func (c *Client) AddItem(ctx context.Context, noteId uint64, req ChecklistItemReq) (*ChecklistItem, error) {
+
+	var item ChecklistItem
+
+	err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/notes/%d/items", noteId), nil, req, &item, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// UpdateItem checks, unchecks, edits or moves an item of a checklist.
+func (c *Client) UpdateItem(ctx context.Context, noteId, itemId uint64, req ChecklistItemReq) (*ChecklistItem, error) {
+
+	var item ChecklistItem
+
+	err := c.do(ctx, http.MethodPatch, fmt.Sprintf("/api/notes/%d/items/%d", noteId, itemId), nil, req, &item, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+func (c *Client) DeleteItem(ctx context.Context, noteId, itemId uint64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/notes/%d/items/%d", noteId, itemId), nil, nil, nil, true)
+}
+
+// ShareNote shares one of the caller's notes with another user.
+func (c *Client) ShareNote(ctx context.Context, noteId, recieverId uint64) error {
+
+	if err := c.ensureToken(ctx); err != nil {
+		return err
+	}
+	_, userId := c.Token()
+
+	req := ShareNoteReq{SenderId: userId, RecieverId: recieverId}
+
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/api/notes/%d/share", noteId), nil, req, nil, true)
+}
+
+// ExportNotes writes the notes the user owns to w as a zip archive of
+// Markdown files, a Markdown stream or JSON, for format zip, md and json.
+func (c *Client) ExportNotes(ctx context.Context, format string, w io.Writer) error {
+
+	if err := c.ensureToken(ctx); err != nil {
+		return err
+	}
+
+	resp, err := c.send(ctx, http.MethodGet, "/api/notes/export", url.Values{"format": {format}}, nil, true)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return decodeError(resp)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// ImportNotes creates notes from data in one of the formats of ExportNotes.
+func (c *Client) ImportNotes(ctx context.Context, format string, data []byte) (*ImportResult, error) {
+
+	if err := c.ensureToken(ctx); err != nil {
+		return nil, err
+	}
+
+	// the format parameter takes precedence over the JSON content type set by send
+	resp, err := c.send(ctx, http.MethodPost, "/api/notes/import", url.Values{"format": {format}}, data, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, decodeError(resp)
+	}
+
+	var result ImportResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// StartImport uploads an Evernote export (source enex) or a Keep Takeout
+// archive (source keep), which the server imports in the background.
+func (c *Client) StartImport(ctx context.Context, source string, data []byte) (*ImportJob, error) {
+
+	if err := c.ensureToken(ctx); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.send(ctx, http.MethodPost, "/api/notes/imports", url.Values{"source": {source}}, data, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, decodeError(resp)
+	}
+
+	var job ImportJob
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (c *Client) GetImportJob(ctx context.Context, jobId uint64) (*ImportJob, error) {
+
+	var job ImportJob
+
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/notes/imports/%d", jobId), nil, nil, &job, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// UploadAttachment attaches data to the note as a file called name.
+func (c *Client) UploadAttachment(ctx context.Context, noteId uint64, name string, data []byte) (*Attachment, error) {
+
+	if err := c.ensureToken(ctx); err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		return nil, err
+	}
+	part.Write(data)
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.sendAs(ctx, http.MethodPost, fmt.Sprintf("/api/notes/%d/attachments", noteId), nil, form.FormDataContentType(), body.Bytes(), true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return nil, decodeError(resp)
+	}
+
+	attachments := []Attachment{}
+	if err := json.NewDecoder(resp.Body).Decode(&attachments); err != nil {
+		return nil, err
+	}
+	if len(attachments) != 1 {
+		return nil, fmt.Errorf("expected one attachment, got %d", len(attachments))
+	}
+
+	return &attachments[0], nil
+}
+
+func (c *Client) ListAttachments(ctx context.Context, noteId uint64) ([]Attachment, error) {
+
+	attachments := []Attachment{}
+
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/notes/%d/attachments", noteId), nil, nil, &attachments, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// DownloadAttachment writes the content of the attachment to w.
+func (c *Client) DownloadAttachment(ctx context.Context, noteId, attachmentId uint64, w io.Writer) error {
+
+	if err := c.ensureToken(ctx); err != nil {
+		return err
+	}
+
+	resp, err := c.send(ctx, http.MethodGet, fmt.Sprintf("/api/notes/%d/attachments/%d", noteId, attachmentId), nil, nil, true)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return decodeError(resp)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (c *Client) DeleteAttachment(ctx context.Context, noteId, attachmentId uint64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/notes/%d/attachments/%d", noteId, attachmentId), nil, nil, nil, true)
+}
+
+func (c *Client) Search(ctx context.Context, query string) ([]Note, error) {
+
+	notes := []Note{}
+
+	err := c.do(ctx, http.MethodGet, "/api/search", url.Values{"query": {query}}, nil, &notes, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
+
+// CreateAccessToken mints a personal access token with the given scopes
+// (notes:read, notes:write, share, search). A zero expiresAt never expires.
+// Requires a login token rather than an access token.
+func (c *Client) CreateAccessToken(ctx context.Context, name string, scopes []string, expiresAt time.Time) (*AccessToken, error) {
+
+	var token AccessToken
+
+	err := c.do(ctx, http.MethodPost, "/api/tokens", nil, AccessTokenReq{Name: name, Scopes: scopes, ExpiresAt: expiresAt}, &token, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (c *Client) ListAccessTokens(ctx context.Context) ([]AccessToken, error) {
+
+	tokens := []AccessToken{}
+
+	err := c.do(ctx, http.MethodGet, "/api/tokens", nil, nil, &tokens, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (c *Client) RevokeAccessToken(ctx context.Context, tokenId uint64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/tokens/%d", tokenId), nil, nil, nil, true)
+}
+
+// do sends a request, retrying on 429 and re-authenticating once on 401 when
+// credentials are available. out may be nil when the body is not needed.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}, auth bool) error {
+
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	if auth {
+		if err := c.ensureToken(ctx); err != nil {
+			return err
+		}
+	}
+
+	resp, err := c.send(ctx, method, path, query, payload, auth)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized && auth && c.canLogin() {
+		resp.Body.Close()
+
+		if err := c.relogin(ctx); err != nil {
+			return err
+		}
+
+		resp, err = c.send(ctx, method, path, query, payload, auth)
+		if err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return decodeError(resp)
+	}
+
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, payload []byte, auth bool) (*http.Response, error) {
+	return c.sendAs(ctx, method, path, query, "application/json", payload, auth)
+}
+
+// sendAs is send with a payload of another content type.
+func (c *Client) sendAs(ctx context.Context, method, path string, query url.Values, contentType string, payload []byte, auth bool) (*http.Response, error) {
+
+	for attempt := 0; ; attempt++ {
+
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		if payload != nil {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		if auth {
+			token, userId := c.Token()
+			req.Header.Set("Authtoken", token)
+			q.Set("userid", strconv.FormatUint(userId, 10))
+		}
+		req.URL.RawQuery = q.Encode()
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= c.maxRetries {
+			return resp, nil
+		}
+
+		wait := retryAfter(resp, c.backoff<<attempt)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) ensureToken(ctx context.Context) error {
+
+	c.mu.Lock()
+	token, expiry := c.token, c.expiry
+	c.mu.Unlock()
+
+	if token != "" && (expiry.IsZero() || time.Until(expiry) > refreshWindow) {
+		return nil
+	}
+
+	if !c.canLogin() {
+		if token != "" {
+			return nil
+		}
+		return ErrNoCredentials
+	}
+
+	return c.relogin(ctx)
+}
+
+func (c *Client) canLogin() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.username != "" && c.password != ""
+}
+
+func (c *Client) relogin(ctx context.Context) error {
+
+	c.mu.Lock()
+	username, password := c.username, c.password
+	c.mu.Unlock()
+
+	resp, err := c.Login(ctx, username, password)
+	if err != nil {
+		return err
+	}
+	if resp.TwoFactor {
+		return ErrTwoFactorRequired
+	}
+
+	return nil
+}
+
+func retryAfter(resp *http.Response, fallback time.Duration) time.Duration {
+
+	if fallback > maxBackoff {
+		fallback = maxBackoff
+	}
+
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return fallback
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+
+	return fallback
+}
+
+func decodeError(resp *http.Response) error {
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	apiErr := &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+
+	var body map[string]string
+	if json.Unmarshal(data, &body) == nil && body["error"] != "" {
+		apiErr.Message = body["error"]
+	}
+
+	return apiErr
+}
+
+// tokenExpiry reads the exp claim of a JWT without verifying it. The zero
+// time is returned when the token is not a JWT or carries no expiry.
+func tokenExpiry(token string) time.Time {
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if json.Unmarshal(data, &claims) != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(claims.Exp, 0)
+}
@@ -0,0 +1,202 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"NOTESBE/repository"
+	repomock "NOTESBE/repository/mocks"
+	"NOTESBE/server"
+	"NOTESBE/utility"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, *repomock.MockRepository) {
+
+	ctrl := gomock.NewController(t)
+	mockrepo := repomock.NewMockRepository(ctrl)
+	mockrepo.EXPECT().GetTokenGeneration(gomock.Any()).Return(0, nil).AnyTimes()
+
+	ts := httptest.NewServer(server.Router(server.NewServer(mockrepo)))
+	t.Cleanup(ts.Close)
+
+	return ts, mockrepo
+}
+
+func TestNotesLifecycle(t *testing.T) {
+
+	ts, mockrepo := newTestServer(t)
+	ctx := context.Background()
+
+	c := New(ts.URL)
+
+	mockrepo.EXPECT().CreateUser(gomock.Any()).Return(nil)
+	err := c.Signup(ctx, "testuser", "testpass")
+	assert.NoError(t, err)
+
+	mockrepo.EXPECT().GetUser(gomock.Any()).Return(uint64(7), nil)
+	login, err := c.Login(ctx, "testuser", "testpass")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(7), login.UserId)
+
+	mockrepo.EXPECT().CreateNote(gomock.Any()).DoAndReturn(func(note *repository.Note) error {
+		assert.Equal(t, uint64(7), note.Userid)
+		assert.Equal(t, "first", note.Note)
+		return nil
+	})
+	err = c.CreateNote(ctx, "first")
+	assert.NoError(t, err)
+
+	mockrepo.EXPECT().GetNotesOfUser(uint64(7)).Return([]repository.Note{{Id: 1, Note: "first", Userid: 7}}, nil)
+	notes, err := c.ListNotes(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, notes, 1)
+	assert.Equal(t, "first", notes[0].Note)
+
+	mockrepo.EXPECT().GetNoteById(uint64(1), uint64(7)).Return(&repository.Note{Id: 1, Note: "first", Userid: 7}, nil)
+	note, err := c.GetNote(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), note.Id)
+
+	mockrepo.EXPECT().UpdateNoteById(uint64(1), uint64(7), "second").Return(nil)
+	err = c.UpdateNote(ctx, 1, "second")
+	assert.NoError(t, err)
+
+	mockrepo.EXPECT().GetNoteById(uint64(1), uint64(7)).Return(&repository.Note{Id: 1, Note: "second", Userid: 7}, nil)
+	mockrepo.EXPECT().ShareNoteToUser(uint64(1), uint64(7), uint64(9)).Return(nil)
+	err = c.ShareNote(ctx, 1, 9)
+	assert.NoError(t, err)
+
+	mockrepo.EXPECT().GetNotesByKey(uint64(7), "second").Return([]repository.Note{{Id: 1, Note: "second", Userid: 7}}, nil)
+	mockrepo.EXPECT().SearchAttachments(uint64(7), "second").Return(nil, nil)
+	found, err := c.Search(ctx, "second")
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+
+	mockrepo.EXPECT().DeleteNoteById(uint64(1), uint64(7)).Return(nil)
+	mockrepo.EXPECT().GetAttachments(uint64(1)).Return(nil, nil)
+	err = c.DeleteNote(ctx, 1)
+	assert.NoError(t, err)
+}
+
+func TestChecklist(t *testing.T) {
+
+	ts, mockrepo := newTestServer(t)
+	ctx := context.Background()
+
+	token, err := (&utility.TokenReq{Id: 7}).CreateJwtToken()
+	assert.NoError(t, err)
+	c := New(ts.URL, WithToken(token.Token, 7))
+
+	mockrepo.EXPECT().CreateChecklist(gomock.Any(), []repository.Checklistitem{{Text: "milk"}}).DoAndReturn(func(note *repository.Note, items []repository.Checklistitem) error {
+		assert.Equal(t, repository.NoteChecklist, note.Kind)
+		note.Id = 2
+		return nil
+	})
+	err = c.CreateChecklist(ctx, "Groceries", []string{"milk"})
+	assert.NoError(t, err)
+
+	checklist := &repository.Note{Id: 2, Note: "Groceries", Userid: 7, Kind: repository.NoteChecklist}
+	mockrepo.EXPECT().GetNoteById(uint64(2), uint64(7)).Return(checklist, nil).Times(2)
+	mockrepo.EXPECT().GetChecklistItem(uint64(5), uint64(2)).Return(&repository.Checklistitem{Id: 5, Noteid: 2, Text: "milk"}, nil)
+	mockrepo.EXPECT().UpdateChecklistItem(gomock.Any()).Return(nil)
+	checked := true
+	item, err := c.UpdateItem(ctx, 2, 5, ChecklistItemReq{Checked: &checked})
+	assert.NoError(t, err)
+	assert.True(t, item.Checked)
+
+	mockrepo.EXPECT().DeleteChecklistItem(uint64(5), uint64(2)).Return(nil)
+	err = c.DeleteItem(ctx, 2, 5)
+	assert.NoError(t, err)
+}
+
+func TestAPIError(t *testing.T) {
+
+	ts, mockrepo := newTestServer(t)
+	ctx := context.Background()
+
+	c := New(ts.URL)
+
+	mockrepo.EXPECT().GetUser(gomock.Any()).Return(uint64(0), errors.New("User does not exist in records"))
+	_, err := c.Login(ctx, "nobody", "secret")
+
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusInternalServerError, apiErr.StatusCode)
+	assert.Equal(t, "User does not exist in records", apiErr.Message)
+
+	_, err = New(ts.URL).ListNotes(ctx)
+	assert.Equal(t, ErrNoCredentials, err)
+}
+
+func TestRefreshOnUnauthorized(t *testing.T) {
+
+	ts, mockrepo := newTestServer(t)
+	ctx := context.Background()
+
+	c := New(ts.URL, WithToken("stale-token", 7), WithCredentials("testuser", "testpass"))
+
+	mockrepo.EXPECT().GetUser(gomock.Any()).Return(uint64(7), nil)
+	mockrepo.EXPECT().GetNotesOfUser(uint64(7)).Return([]repository.Note{}, nil)
+
+	_, err := c.ListNotes(ctx)
+	assert.NoError(t, err)
+
+	token, _ := c.Token()
+	assert.NotEqual(t, "stale-token", token)
+}
+
+func TestRetryOnTooManyRequests(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	mockrepo := repomock.NewMockRepository(ctrl)
+	mockrepo.EXPECT().GetTokenGeneration(gomock.Any()).Return(0, nil).AnyTimes()
+	router := server.Router(server.NewServer(mockrepo))
+
+	var rejected int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&rejected, 1) <= 2 {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		router.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL, WithRetries(3, time.Millisecond))
+
+	mockrepo.EXPECT().CreateUser(gomock.Any()).Return(nil)
+	err := c.Signup(context.Background(), "testuser", "testpass")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&rejected))
+
+	atomic.StoreInt32(&rejected, 0)
+
+	var apiErr *APIError
+	err = New(ts.URL, WithRetries(0, time.Millisecond)).Signup(context.Background(), "testuser", "testpass")
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+}
+
+func TestContextCancelledWhileBackingOff(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := New(ts.URL).Signup(ctx, "testuser", "testpass")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
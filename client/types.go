@@ -0,0 +1,197 @@
+package client
+
+import "time"
+
+type UserReq struct {
+	UserName string `json:"username"`
+	PassWord string `json:"password"`
+}
+
+// LoginResp carries either a token or, for users with two-factor
+// authentication, a challenge to pass to VerifyTwoFactor.
+type LoginResp struct {
+	Token     string `json:"token"`
+	UserId    uint64 `json:"userid"`
+	Challenge string `json:"challenge,omitempty"`
+	TwoFactor bool   `json:"twofactor,omitempty"`
+}
+
+type ChangePasswordReq struct {
+	OldPassword string `json:"oldpassword"`
+	NewPassword string `json:"newpassword"`
+}
+
+type ResetPasswordReq struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type EmailReq struct {
+	Email string `json:"email"`
+}
+
+type TokenReq struct {
+	Token string `json:"token"`
+}
+
+// ProfileReq changes the fields that are not nil.
+type ProfileReq struct {
+	Username    *string `json:"username,omitempty"`
+	Displayname *string `json:"displayname,omitempty"`
+	Email       *string `json:"email,omitempty"`
+	Avatar      *string `json:"avatar,omitempty"`
+	Timezone    *string `json:"timezone,omitempty"`
+	Locale      *string `json:"locale,omitempty"`
+	Defaultsort *string `json:"defaultsort,omitempty"`
+}
+
+type Profile struct {
+	Id            uint64 `json:"id"`
+	Username      string `json:"username"`
+	Displayname   string `json:"displayname"`
+	Email         string `json:"email"`
+	Emailverified bool   `json:"emailverified"`
+	Avatar        string `json:"avatar"`
+	Timezone      string `json:"timezone"`
+	Locale        string `json:"locale"`
+	Defaultsort   string `json:"defaultsort"`
+	TwoFactor     bool   `json:"twofactor"`
+	Oidc          bool   `json:"oidc"`
+}
+
+// Export is a personal data archive. Status is pending, done or failed.
+type Export struct {
+	Id        uint64    `json:"id"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Size      int64     `json:"size,omitempty"`
+	CreatedAt time.Time `json:"createdat"`
+	ExpiresAt time.Time `json:"expiresat,omitempty"`
+}
+
+type DeleteAccountReq struct {
+	Password string `json:"password"`
+}
+
+type TwoFactorVerifyReq struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+// NoteReq creates a note, or with Type "checklist" a checklist with the
+// Items.
+type NoteReq struct {
+	Note  string             `json:"note"`
+	Type  string             `json:"type,omitempty"`
+	Items []ChecklistItemReq `json:"items,omitempty"`
+}
+
+type ShareNoteReq struct {
+	SenderId   uint64 `json:"senderid"`
+	RecieverId uint64 `json:"recieverid"`
+}
+
+// Note is a note or, with Type "checklist", a checklist. Checklists carry
+// their Progress, and their Items when fetched on their own.
+type Note struct {
+	Id        uint64             `json:"id"`
+	Note      string             `json:"note"`
+	Userid    uint64             `json:"userid"`
+	Type      string             `json:"type"`
+	Tags      []string           `json:"tags"`
+	Createdat time.Time          `json:"createdat"`
+	Updatedat time.Time          `json:"updatedat"`
+	Progress  *ChecklistProgress `json:"progress,omitempty"`
+	Items     []ChecklistItem    `json:"items,omitempty"`
+}
+
+// ChecklistItemReq adds an item to a checklist, or changes the fields that
+// are not nil. Duedate is a date like 2024-01-31; "" and 0 clear the due
+// date and the assignee.
+type ChecklistItemReq struct {
+	Text       *string `json:"text,omitempty"`
+	Checked    *bool   `json:"checked,omitempty"`
+	Duedate    *string `json:"duedate,omitempty"`
+	Assigneeid *uint64 `json:"assigneeid,omitempty"`
+	Position   *int    `json:"position,omitempty"`
+}
+
+type ChecklistItem struct {
+	Id         uint64    `json:"id"`
+	NoteId     uint64    `json:"noteid"`
+	Position   int       `json:"position"`
+	Text       string    `json:"text"`
+	Checked    bool      `json:"checked"`
+	Duedate    string    `json:"duedate,omitempty"`
+	Assigneeid uint64    `json:"assigneeid,omitempty"`
+	CreatedAt  time.Time `json:"createdat"`
+	UpdatedAt  time.Time `json:"updatedat"`
+}
+
+type ChecklistProgress struct {
+	Total   int `json:"total"`
+	Checked int `json:"checked"`
+}
+
+type ImportResult struct {
+	Imported int            `json:"imported"`
+	Failed   int            `json:"failed"`
+	Results  []ImportedFile `json:"results"`
+}
+
+// ImportedFile is the outcome for one file, or one entry of a JSON or
+// Markdown stream. Id is the created note, Error is set when none was.
+type ImportedFile struct {
+	File  string `json:"file"`
+	Id    uint64 `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// ImportJob is the progress of an Evernote or Keep import. Status is
+// pending, running, done or failed.
+type ImportJob struct {
+	Id          uint64    `json:"id"`
+	Source      string    `json:"source"`
+	Status      string    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	Progress    int       `json:"progress"`
+	Processed   int       `json:"processed"`
+	Imported    int       `json:"imported"`
+	Failed      int       `json:"failed"`
+	Attachments int       `json:"attachments"`
+	Failures    []string  `json:"failures,omitempty"`
+	CreatedAt   time.Time `json:"createdat"`
+	FinishedAt  time.Time `json:"finishedat,omitempty"`
+}
+
+// Attachment describes a file attached to a note. Mime is the type the
+// server sniffed from the content.
+type Attachment struct {
+	Id        uint64    `json:"id"`
+	NoteId    uint64    `json:"noteid"`
+	Name      string    `json:"name"`
+	Mime      string    `json:"mime"`
+	Size      int64     `json:"size"`
+	Sha256    string    `json:"sha256"`
+	Url       string    `json:"url"`
+	Thumbnail string    `json:"thumbnail,omitempty"`
+	CreatedAt time.Time `json:"createdat"`
+}
+
+type AccessTokenReq struct {
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expiresat"`
+}
+
+// AccessToken describes a personal access token. Token is only set when it
+// was just created.
+type AccessToken struct {
+	Id        uint64    `json:"id"`
+	Name      string    `json:"name"`
+	Token     string    `json:"token,omitempty"`
+	Prefix    string    `json:"prefix"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expiresat"`
+	CreatedAt time.Time `json:"createdat"`
+}
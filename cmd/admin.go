@@ -0,0 +1,539 @@
+package main
+
+import (
+	"NOTESBE/config"
+	"NOTESBE/connection"
+	"NOTESBE/importer"
+	"NOTESBE/repository"
+	"NOTESBE/server"
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/term"
+)
+
+func openDB() (*repository.Database, error) {
+	return connection.InitializeDB()
+}
+
+// openRepository opens the database for the user and notes commands. Tests
+// replace it with a mock.
+var openRepository = func() (repository.Repository, error) {
+	return openDB()
+}
+
+func migrate() error {
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+
+	if err := connection.Migrate(db.DbConn); err != nil {
+		return err
+	}
+
+	fmt.Println("Database schema is up to date")
+	return nil
+}
+
+func reindexSearch() error {
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+
+	if err := connection.Reindex(db.DbConn); err != nil {
+		return err
+	}
+
+	fmt.Println("Search index rebuilt")
+	return nil
+}
+
+func userCommand(args []string) error {
+
+	if len(args) == 0 {
+		return errors.New("usage: user create|disable|reset-password|reset-2fa|list|events")
+	}
+
+	switch args[0] {
+	case "create":
+		return userCreate(args[1:])
+	case "disable":
+		return userDisable(args[1:])
+	case "reset-password":
+		return userResetPassword(args[1:])
+	case "reset-2fa":
+		return userResetTwoFactor(args[1:])
+	case "list":
+		return userList()
+	case "events":
+		return userEvents(args[1:])
+	}
+
+	return fmt.Errorf("unknown user command %q", args[0])
+}
+
+func userCreate(args []string) error {
+
+	flags := flag.NewFlagSet("user create", flag.ExitOnError)
+	fromStdin := flags.Bool("password-stdin", false, "read the password from stdin instead of generating a random one")
+	username, err := parseWithName(flags, args)
+	if err != nil {
+		return err
+	}
+
+	password, generated, err := newPassword(*fromStdin)
+	if err != nil {
+		return err
+	}
+
+	db, err := openRepository()
+	if err != nil {
+		return err
+	}
+
+	user := &repository.User{Username: username, Password: password}
+	if err := db.CreateUser(user); err != nil {
+		return err
+	}
+
+	fmt.Printf("Created user %s with id %d\n", user.Username, user.Id)
+	if generated {
+		fmt.Printf("Password: %s\n", password)
+	}
+
+	return nil
+}
+
+func userDisable(args []string) error {
+
+	flags := flag.NewFlagSet("user disable", flag.ExitOnError)
+	enable := flags.Bool("enable", false, "re-enable the user instead")
+	username, err := parseWithName(flags, args)
+	if err != nil {
+		return err
+	}
+
+	db, err := openRepository()
+	if err != nil {
+		return err
+	}
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+
+	if err := db.SetUserDisabled(user.Id, !*enable); err != nil {
+		return err
+	}
+
+	if *enable {
+		fmt.Printf("Enabled user %s\n", username)
+	} else {
+		fmt.Printf("Disabled user %s\n", username)
+	}
+
+	return nil
+}
+
+func userResetPassword(args []string) error {
+
+	flags := flag.NewFlagSet("user reset-password", flag.ExitOnError)
+	fromStdin := flags.Bool("password-stdin", false, "read the new password from stdin instead of generating a random one")
+	username, err := parseWithName(flags, args)
+	if err != nil {
+		return err
+	}
+
+	password, generated, err := newPassword(*fromStdin)
+	if err != nil {
+		return err
+	}
+
+	db, err := openRepository()
+	if err != nil {
+		return err
+	}
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+
+	if err := db.UpdatePassword(user.Id, password); err != nil {
+		return err
+	}
+
+	fmt.Printf("Password of %s has been reset\n", username)
+	if generated {
+		fmt.Printf("Password: %s\n", password)
+	}
+
+	return nil
+}
+
+// isTerminal and readPassword are replaced in tests.
+var (
+	isTerminal   = term.IsTerminal
+	readPassword = term.ReadPassword
+)
+
+// newPassword returns a random password, or with fromStdin one read from
+// stdin, so that it never shows up in the process list or shell history. On
+// a terminal it is typed twice without echo, piped input is read up to the
+// first newline.
+func newPassword(fromStdin bool) (password string, generated bool, err error) {
+
+	if !fromStdin {
+		return randomPassword(), true, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !isTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", false, err
+		}
+		password = strings.TrimRight(line, "\r\n")
+	} else {
+		var typed [2]string
+		for i, label := range []string{"Password: ", "Repeat password: "} {
+			fmt.Fprint(os.Stderr, label)
+			b, err := readPassword(fd)
+			// the Enter typed after the password was not echoed either
+			fmt.Fprintln(os.Stderr)
+			if err != nil {
+				return "", false, err
+			}
+			typed[i] = string(b)
+		}
+		if typed[0] != typed[1] {
+			return "", false, errors.New("the passwords do not match")
+		}
+		password = typed[0]
+	}
+
+	if password == "" {
+		return "", false, errors.New("the password is empty")
+	}
+
+	return password, false, nil
+}
+
+// userResetTwoFactor turns off two-factor authentication for a user who lost
+// both the authenticator and the recovery codes.
+func userResetTwoFactor(args []string) error {
+
+	flags := flag.NewFlagSet("user reset-2fa", flag.ExitOnError)
+	username, err := parseWithName(flags, args)
+	if err != nil {
+		return err
+	}
+
+	db, err := openRepository()
+	if err != nil {
+		return err
+	}
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+
+	if err := db.DisableTotp(user.Id); err != nil {
+		return err
+	}
+
+	fmt.Printf("Two-factor authentication of %s has been turned off\n", username)
+	return nil
+}
+
+func userList() error {
+
+	db, err := openRepository()
+	if err != nil {
+		return err
+	}
+
+	users, err := db.ListUsers()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tUSERNAME\tDISABLED\t2FA")
+	for _, user := range users {
+		fmt.Fprintf(tw, "%d\t%s\t%t\t%t\n", user.Id, user.Username, user.Disabled, user.Totpenabled)
+	}
+
+	return tw.Flush()
+}
+
+func userEvents(args []string) error {
+
+	flags := flag.NewFlagSet("user events", flag.ExitOnError)
+	limit := flags.Int("n", 50, "number of events to show")
+	username, err := parseWithName(flags, args)
+	if err != nil {
+		return err
+	}
+
+	db, err := openRepository()
+	if err != nil {
+		return err
+	}
+
+	events, err := db.GetAuthEvents(username, *limit)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tEVENT\tIP")
+	for _, event := range events {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", event.Createdat.Format(time.RFC3339), event.Event, event.Ip)
+	}
+
+	return tw.Flush()
+}
+
+func notesCommand(args []string) error {
+
+	if len(args) == 0 {
+		return errors.New("usage: notes export|import")
+	}
+
+	switch args[0] {
+	case "export":
+		return notesExport(args[1:])
+	case "import":
+		return notesImport(args[1:])
+	}
+
+	return fmt.Errorf("unknown notes command %q", args[0])
+}
+
+func notesExport(args []string) error {
+
+	flags := flag.NewFlagSet("notes export", flag.ExitOnError)
+	username := flags.String("user", "", "user whose notes are exported")
+	format := flags.String("format", "json", "zip, md or json")
+	out := flags.String("out", "", "output file, stdout when empty")
+	flags.Parse(args)
+
+	if *username == "" {
+		return errors.New("-user is required")
+	}
+
+	db, err := openRepository()
+	if err != nil {
+		return err
+	}
+
+	user, err := db.GetUserByUsername(*username)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	// only the notes the user owns, as GET /api/notes/export sends them
+	return server.WriteNotesExport(db, w, user.Id, *format)
+}
+
+// notesImport imports an Evernote export or Keep Takeout archive for a user
+// in the foreground, printing the progress.
+func notesImport(args []string) error {
+
+	flags := flag.NewFlagSet("notes import", flag.ExitOnError)
+	username := flags.String("user", "", "user the notes are imported for")
+	source := flags.String("source", "", "enex or keep, from the file extension when empty")
+	file, err := parseWithName(flags, args)
+	if err != nil {
+		return errors.New("usage: notes import -user <username> [-source enex|keep] <file>")
+	}
+
+	if *username == "" {
+		return errors.New("-user is required")
+	}
+	if *source == "" {
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".enex":
+			*source = importer.SourceENEX
+		case ".zip":
+			*source = importer.SourceKeep
+		}
+	}
+	if *source != importer.SourceENEX && *source != importer.SourceKeep {
+		return errors.New("-source must be enex or keep")
+	}
+
+	db, err := openRepository()
+	if err != nil {
+		return err
+	}
+
+	user, err := db.GetUserByUsername(*username)
+	if err != nil {
+		return err
+	}
+
+	job := &repository.Importjob{
+		Userid: user.Id,
+		Source: *source,
+		Status: repository.ImportPending,
+	}
+	if err := db.CreateImportJob(job); err != nil {
+		return err
+	}
+
+	err = importer.Run(db, server.ImportStore(db), job, file, func(job *repository.Importjob) {
+		fmt.Fprintf(os.Stderr, "\r%3d%%  %d imported, %d failed", job.Progress, job.Imported, job.Failed)
+	})
+	fmt.Fprintln(os.Stderr)
+
+	for _, failure := range strings.Split(strings.TrimSpace(job.Failures), "\n") {
+		if failure != "" {
+			fmt.Println("failed:", failure)
+		}
+	}
+	if job.Attachments > 0 {
+		fmt.Printf("%d attachments imported\n", job.Attachments)
+	}
+
+	return err
+}
+
+func configCommand(args []string) error {
+
+	if len(args) == 0 || args[0] != "check" {
+		return errors.New("usage: config check")
+	}
+
+	// config.Load has already validated the configuration before any
+	// command runs, so reaching this point means it is usable.
+	cfg := config.Get()
+
+	fmt.Println("Config file:", cfg.File)
+	fmt.Println("Mode:", cfg.Mode)
+	fmt.Printf("Database: %s@%s:%s/%s (password %s)\n", cfg.Database.User, cfg.Database.Host, cfg.Database.Port, cfg.Database.Name, masked(cfg.Database.Password))
+	fmt.Printf("Listen: %s:%s (tls %t)\n", cfg.Server.Host, cfg.Server.Port, cfg.Server.TLS.CertFile != "")
+	fmt.Printf("Token secret: %s\n", masked(cfg.Token.SecretKey))
+	for _, key := range cfg.Token.Keys {
+		fmt.Printf("Token key %s: %s (active from %s)\n", key.Kid, key.File, key.ActiveFrom.Format(time.RFC3339))
+	}
+
+	fmt.Println("Configuration is valid")
+	return nil
+}
+
+// keysCommand writes a private key for token.keys. The file is created with
+// mode 0600 and never overwritten.
+func keysCommand(args []string) error {
+
+	if len(args) == 0 || args[0] != "generate" {
+		return errors.New("usage: keys generate -out <file> [-alg EdDSA|RS256]")
+	}
+
+	flags := flag.NewFlagSet("keys generate", flag.ExitOnError)
+	alg := flags.String("alg", "EdDSA", "EdDSA or RS256")
+	out := flags.String("out", "", "file to write the PEM private key to")
+	flags.Parse(args[1:])
+
+	if *out == "" {
+		return errors.New("-out is required")
+	}
+
+	var key interface{}
+	var err error
+	switch *alg {
+	case "EdDSA":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case "RS256":
+		key, err = rsa.GenerateKey(rand.Reader, 3072)
+	default:
+		return fmt.Errorf("unknown algorithm %q", *alg)
+	}
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := pem.Encode(file, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %s key to %s\n", *alg, *out)
+	return nil
+}
+
+func masked(secret string) string {
+	if secret == "" {
+		return "not set"
+	}
+	return "set"
+}
+
+// parseWithName parses flags that may appear before or after the single
+// positional name argument.
+func parseWithName(flags *flag.FlagSet, args []string) (string, error) {
+
+	name := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	flags.Parse(args)
+
+	if name == "" && flags.NArg() > 0 {
+		name = flags.Arg(0)
+	}
+
+	if name == "" {
+		return "", fmt.Errorf("usage: %s <username>", flags.Name())
+	}
+
+	return name, nil
+}
+
+func randomPassword() string {
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"NOTESBE/repository"
+	repomock "NOTESBE/repository/mocks"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// withRepository makes the commands use a mock repository.
+func withRepository(t *testing.T) *repomock.MockRepository {
+
+	db := repomock.NewMockRepository(gomock.NewController(t))
+
+	open := openRepository
+	openRepository = func() (repository.Repository, error) { return db, nil }
+	t.Cleanup(func() { openRepository = open })
+
+	return db
+}
+
+// captureStdout returns what run prints.
+func captureStdout(t *testing.T, run func() error) (string, error) {
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	err = run()
+	os.Stdout = stdout
+	w.Close()
+
+	out, _ := io.ReadAll(r)
+	return string(out), err
+}
+
+// withStdin makes os.Stdin read input, as if it was piped in.
+func withStdin(t *testing.T, input string) {
+
+	file := filepath.Join(t.TempDir(), "stdin")
+	os.WriteFile(file, []byte(input), 0o600)
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdin := os.Stdin
+	os.Stdin = f
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		f.Close()
+	})
+}
+
+// withTerminal makes stdin look like a terminal on which passwords are
+// typed without echo.
+func withTerminal(t *testing.T, passwords ...string) {
+
+	terminal, read := isTerminal, readPassword
+	isTerminal = func(fd int) bool { return true }
+	readPassword = func(fd int) ([]byte, error) {
+		if len(passwords) == 0 {
+			return nil, errors.New("no input")
+		}
+		password := passwords[0]
+		passwords = passwords[1:]
+		return []byte(password), nil
+	}
+	t.Cleanup(func() { isTerminal, readPassword = terminal, read })
+}
+
+func TestParseWithName(t *testing.T) {
+
+	for _, args := range [][]string{{"alice", "-n", "5"}, {"-n", "5", "alice"}} {
+		flags := flag.NewFlagSet("user events", flag.ContinueOnError)
+		n := flags.Int("n", 50, "")
+
+		name, err := parseWithName(flags, args)
+		assert.NoError(t, err)
+		assert.Equal(t, "alice", name)
+		assert.Equal(t, 5, *n)
+	}
+
+	_, err := parseWithName(flag.NewFlagSet("user disable", flag.ContinueOnError), nil)
+	assert.EqualError(t, err, "usage: user disable <username>")
+}
+
+func TestUserDisable(t *testing.T) {
+
+	t.Run("disable", func(t *testing.T) {
+
+		db := withRepository(t)
+		db.EXPECT().GetUserByUsername("alice").Return(&repository.User{Id: 4, Username: "alice"}, nil)
+		db.EXPECT().SetUserDisabled(uint64(4), true).Return(nil)
+
+		out, err := captureStdout(t, func() error { return userCommand([]string{"disable", "alice"}) })
+		assert.NoError(t, err)
+		assert.Equal(t, "Disabled user alice\n", out)
+	})
+
+	t.Run("enable", func(t *testing.T) {
+
+		db := withRepository(t)
+		db.EXPECT().GetUserByUsername("alice").Return(&repository.User{Id: 4, Username: "alice", Disabled: true}, nil)
+		db.EXPECT().SetUserDisabled(uint64(4), false).Return(nil)
+
+		out, err := captureStdout(t, func() error { return userCommand([]string{"disable", "-enable", "alice"}) })
+		assert.NoError(t, err)
+		assert.Equal(t, "Enabled user alice\n", out)
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+
+		db := withRepository(t)
+		db.EXPECT().GetUserByUsername("nobody").Return(nil, repository.ErrUserNotFound)
+
+		_, err := captureStdout(t, func() error { return userCommand([]string{"disable", "nobody"}) })
+		assert.ErrorIs(t, err, repository.ErrUserNotFound)
+	})
+}
+
+func TestUserResetPassword(t *testing.T) {
+
+	t.Run("generated", func(t *testing.T) {
+
+		db := withRepository(t)
+		db.EXPECT().GetUserByUsername("alice").Return(&repository.User{Id: 4, Username: "alice"}, nil)
+
+		var password string
+		db.EXPECT().UpdatePassword(uint64(4), gomock.Any()).DoAndReturn(func(userid uint64, p string) error {
+			password = p
+			return nil
+		})
+
+		out, err := captureStdout(t, func() error { return userCommand([]string{"reset-password", "alice"}) })
+		assert.NoError(t, err)
+		assert.Len(t, password, 16)
+		assert.Equal(t, "Password of alice has been reset\nPassword: "+password+"\n", out)
+	})
+
+	t.Run("piped", func(t *testing.T) {
+
+		withStdin(t, "n3w-pass\n")
+
+		db := withRepository(t)
+		db.EXPECT().GetUserByUsername("alice").Return(&repository.User{Id: 4, Username: "alice"}, nil)
+		db.EXPECT().UpdatePassword(uint64(4), "n3w-pass").Return(errors.New("connection refused"))
+
+		_, err := captureStdout(t, func() error { return userCommand([]string{"reset-password", "alice", "-password-stdin"}) })
+		assert.EqualError(t, err, "connection refused")
+	})
+
+	t.Run("terminal", func(t *testing.T) {
+
+		withTerminal(t, "n3w-pass", "n3w-pass")
+
+		db := withRepository(t)
+		db.EXPECT().GetUserByUsername("alice").Return(&repository.User{Id: 4, Username: "alice"}, nil)
+		db.EXPECT().UpdatePassword(uint64(4), "n3w-pass").Return(nil)
+
+		out, err := captureStdout(t, func() error { return userCommand([]string{"reset-password", "-password-stdin", "alice"}) })
+		assert.NoError(t, err)
+		assert.Equal(t, "Password of alice has been reset\n", out, "a typed password is not printed")
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+
+		withTerminal(t, "n3w-pass", "typo")
+		withRepository(t)
+
+		_, err := captureStdout(t, func() error { return userCommand([]string{"reset-password", "alice", "-password-stdin"}) })
+		assert.EqualError(t, err, "the passwords do not match")
+	})
+}
+
+func TestUserCreate(t *testing.T) {
+
+	withStdin(t, "s3cret\n")
+
+	db := withRepository(t)
+	db.EXPECT().CreateUser(gomock.Any()).DoAndReturn(func(user *repository.User) error {
+		assert.Equal(t, "s3cret", user.Password)
+		user.Id = 12
+		return nil
+	})
+
+	out, err := captureStdout(t, func() error { return userCommand([]string{"create", "bob", "-password-stdin"}) })
+	assert.NoError(t, err)
+	assert.Equal(t, "Created user bob with id 12\n", out, "a given password is not printed")
+}
+
+func TestNotesExport(t *testing.T) {
+
+	created := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+
+	db := withRepository(t)
+	db.EXPECT().GetUserByUsername("alice").Return(&repository.User{Id: 4, Username: "alice"}, nil)
+	db.EXPECT().GetNotesOfUser(uint64(4)).Return([]repository.Note{
+		{Id: 1, Userid: 4, Note: "mine", Tags: "home", Createdat: created, Updatedat: created},
+		{Id: 2, Userid: 9, Note: "shared by bob", Createdat: created, Updatedat: created},
+	}, nil)
+
+	out, err := captureStdout(t, func() error { return notesCommand([]string{"export", "-user", "alice"}) })
+	assert.NoError(t, err)
+	assert.NotContains(t, out, "shared by bob", "notes of other users are not exported")
+	assert.NotContains(t, out, "Userid", "internal columns are not exported")
+	assert.JSONEq(t, `[{"id":1,"note":"mine","tags":["home"],"createdat":"2024-03-01T09:00:00Z","updatedat":"2024-03-01T09:00:00Z"}]`, out)
+}
+
+func TestUserCommand(t *testing.T) {
+
+	assert.EqualError(t, userCommand([]string{"rename"}), `unknown user command "rename"`)
+	assert.Error(t, userCommand(nil))
+}
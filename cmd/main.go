@@ -1,27 +1,150 @@
 package main
 
 import (
+	"NOTESBE/config"
 	"NOTESBE/connection"
 	"NOTESBE/server"
+	"NOTESBE/utility"
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
+const usage = `Usage: main [--config file] [--key=value ...] <command> [arguments]
+
+Any configuration key can be set with a flag, e.g. --server.port=9000, or an
+environment variable, e.g. NOTES_SERVER_PORT=9000. Secrets can be read from a
+file named by NOTES_<KEY>_FILE, e.g. NOTES_DATABASE_PASSWORD_FILE.
+
+Commands:
+  serve                                   start the HTTP server (default)
+  migrate                                 create or update the database schema
+  user create <username> [-password-stdin]
+                                          create a user
+  user disable <username> [-enable]       disable (or re-enable) a user
+  user reset-password <username> [-password-stdin]
+  user reset-2fa <username>               turn off two-factor authentication
+  user list                               list users
+  user events <username> [-n 50]          failed logins and lockouts of a user
+  notes export -user <username> [-format json|md|zip] [-out f]
+                                          export the notes a user owns
+  notes import -user <username> <file>    import an Evernote .enex or Keep Takeout .zip
+  reindex-search                          rebuild the full text search indexes
+  config check                            validate the configuration
+  keys generate -out f [-alg EdDSA|RS256] write a new token signing key
+`
+
 func main() {
+
+	args := os.Args[1:]
+
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help" || args[0] == "help") {
+		fmt.Print(usage)
+		return
+	}
+
+	_, args, err := config.Load(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	if len(args) == 0 {
+		args = []string{"serve"}
+	}
+
+	switch args[0] {
+	case "serve":
+		err = serve()
+	case "migrate":
+		err = migrate()
+	case "user":
+		err = userCommand(args[1:])
+	case "notes":
+		err = notesCommand(args[1:])
+	case "reindex-search":
+		err = reindexSearch()
+	case "config":
+		err = configCommand(args[1:])
+	case "keys":
+		err = keysCommand(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func serve() error {
 	fmt.Println("Notes Backend ")
 
 	db, err := connection.InitializeDB()
 	if err != nil {
-		log.Panicln("Error in Connecting to Database:", err)
+		return fmt.Errorf("connecting to database: %w", err)
 	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			utility.Errorln("Error in closing database pool:", err)
+		}
+	}()
 
 	srv := server.NewServer(db)
+	config.OnReload(srv.ApplyConfig)
+	config.Watch()
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	go func() {
+		for range hangup {
+			config.Reload("SIGHUP")
+		}
+	}()
+
+	httpServer, err := server.NewHTTPServer(server.Router(srv))
 	if err != nil {
-		log.Panicln("Error in creating server:", err)
+		return fmt.Errorf("creating http server: %w", err)
+	}
+
+	go srv.IndexPendingAttachments()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go srv.SweepExports(ctx)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		utility.Infoln("Listening on", httpServer.Addr)
+		serveErr <- server.ListenAndServe(httpServer)
+	}()
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	utility.Infoln("Shutting down, draining in-flight requests")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.Get().Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("graceful shutdown: %w", err)
 	}
 
-	mux := server.Router(srv)
-	http.Handle("/", mux)
-	http.ListenAndServe(fmt.Sprintf(":%s", "8081"), mux)
+	utility.Infoln("Server stopped")
+	return nil
 }
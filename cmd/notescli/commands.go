@@ -0,0 +1,849 @@
+package main
+
+import (
+	"NOTESBE/client"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/term"
+)
+
+type app struct {
+	output string
+	stdout io.Writer
+}
+
+// client returns an API client authenticated with the stored token.
+func (a *app) client() (*client.Client, error) {
+
+	creds, err := loadCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	if creds.Token == "" {
+		return nil, errors.New("not logged in, run `notes login <username>` first")
+	}
+
+	return client.New(creds.Server, client.WithToken(creds.Token, creds.UserId)), nil
+}
+
+func cmdLogin(ctx context.Context, a *app, args []string) error {
+
+	creds, err := loadCredentials()
+	if err != nil {
+		return err
+	}
+
+	flags := flag.NewFlagSet("login", flag.ExitOnError)
+	server := flags.String("server", creds.Server, "base URL of the notes server")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("usage: notes login [-server URL] <username>")
+	}
+	username := flags.Arg(0)
+
+	stdin := bufio.NewReader(os.Stdin)
+
+	password := os.Getenv("NOTES_PASSWORD")
+	if password == "" {
+		if password, err = promptPassword(stdin, "Password: "); err != nil {
+			return err
+		}
+	}
+
+	c := client.New(*server)
+
+	resp, err := c.Login(ctx, username, password)
+	if err != nil {
+		return err
+	}
+
+	if resp.TwoFactor {
+		code := os.Getenv("NOTES_OTP")
+		if code == "" {
+			if code, err = prompt(stdin, "Authentication code (or recovery code): "); err != nil {
+				return err
+			}
+		}
+
+		if resp, err = c.VerifyTwoFactor(ctx, resp.Challenge, code); err != nil {
+			return err
+		}
+	}
+
+	err = saveCredentials(&credentials{
+		Server:   *server,
+		Username: username,
+		UserId:   resp.UserId,
+		Token:    resp.Token,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.stdout, "Logged in as %s\n", username)
+	return nil
+}
+
+func prompt(stdin *bufio.Reader, label string) (string, error) {
+
+	fmt.Fprint(os.Stderr, label)
+
+	line, err := stdin.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// isTerminal and readPassword are replaced in tests.
+var (
+	isTerminal   = term.IsTerminal
+	readPassword = term.ReadPassword
+)
+
+// promptPassword is prompt for secrets: on a terminal the input is not
+// echoed. Piped input is read line by line like any other answer.
+func promptPassword(stdin *bufio.Reader, label string) (string, error) {
+
+	fd := int(os.Stdin.Fd())
+	if !isTerminal(fd) {
+		return prompt(stdin, label)
+	}
+
+	fmt.Fprint(os.Stderr, label)
+	password, err := readPassword(fd)
+	// the Enter typed after the password was not echoed either
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	return string(password), nil
+}
+
+func cmdLogout(ctx context.Context, a *app, args []string) error {
+
+	creds, err := loadCredentials()
+	if err != nil {
+		return err
+	}
+
+	creds.Token = ""
+	creds.UserId = 0
+
+	return saveCredentials(creds)
+}
+
+func cmdPasswd(ctx context.Context, a *app, args []string) error {
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	stdin := bufio.NewReader(os.Stdin)
+
+	oldPassword, err := promptPassword(stdin, "Current password: ")
+	if err != nil {
+		return err
+	}
+	newPassword, err := promptPassword(stdin, "New password: ")
+	if err != nil {
+		return err
+	}
+	repeated, err := promptPassword(stdin, "Repeat new password: ")
+	if err != nil {
+		return err
+	}
+	if newPassword == "" || newPassword != repeated {
+		return errors.New("the new passwords do not match")
+	}
+
+	if err := c.ChangePassword(ctx, oldPassword, newPassword); err != nil {
+		return err
+	}
+
+	// the server revoked every token, including the saved one
+	if err := cmdLogout(ctx, a, nil); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(a.stdout, "Password changed, log in again with `notes login <username>`")
+	return nil
+}
+
+func cmdEmail(ctx context.Context, a *app, args []string) error {
+
+	if len(args) != 1 {
+		return errors.New("usage: notes email <address>")
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	if err := c.SetEmail(ctx, args[0]); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.stdout, "Verification link sent to %s\n", args[0])
+	return nil
+}
+
+func cmdMe(ctx context.Context, a *app, args []string) error {
+
+	flags := flag.NewFlagSet("me", flag.ExitOnError)
+	username := flags.String("username", "", "new username")
+	name := flags.String("name", "", "display name")
+	timezone := flags.String("tz", "", "IANA time zone, e.g. Europe/Berlin")
+	locale := flags.String("locale", "", "language tag, e.g. en-US")
+	sort := flags.String("sort", "", "default sort: updated_desc, updated_asc, created_desc or created_asc")
+	flags.Parse(args)
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	req := client.ProfileReq{}
+	changed := false
+	flags.Visit(func(f *flag.Flag) {
+		changed = true
+		switch f.Name {
+		case "username":
+			req.Username = username
+		case "name":
+			req.Displayname = name
+		case "tz":
+			req.Timezone = timezone
+		case "locale":
+			req.Locale = locale
+		case "sort":
+			req.Defaultsort = sort
+		}
+	})
+
+	var profile *client.Profile
+	if changed {
+		profile, err = c.UpdateProfile(ctx, req)
+	} else {
+		profile, err = c.GetProfile(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	if req.Username != nil {
+		creds, err := loadCredentials()
+		if err != nil {
+			return err
+		}
+		creds.Username = profile.Username
+		if err := saveCredentials(creds); err != nil {
+			return err
+		}
+	}
+
+	if a.output == "json" {
+		return a.printJSON(profile)
+	}
+
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Id\t%d\n", profile.Id)
+	fmt.Fprintf(tw, "Username\t%s\n", profile.Username)
+	fmt.Fprintf(tw, "Name\t%s\n", profile.Displayname)
+	fmt.Fprintf(tw, "Email\t%s (verified: %t)\n", profile.Email, profile.Emailverified)
+	fmt.Fprintf(tw, "Time zone\t%s\n", profile.Timezone)
+	fmt.Fprintf(tw, "Locale\t%s\n", profile.Locale)
+	fmt.Fprintf(tw, "Sort\t%s\n", profile.Defaultsort)
+	fmt.Fprintf(tw, "2FA\t%t\n", profile.TwoFactor)
+	return tw.Flush()
+}
+
+func cmdList(ctx context.Context, a *app, args []string) error {
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	notes, err := c.ListNotes(ctx)
+	if err != nil {
+		return err
+	}
+
+	return a.printNotes(notes)
+}
+
+func cmdCat(ctx context.Context, a *app, args []string) error {
+
+	noteId, err := noteIdArg(args)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	note, err := c.GetNote(ctx, noteId)
+	if err != nil {
+		return err
+	}
+
+	if a.output == "json" {
+		return a.printJSON(note)
+	}
+
+	fmt.Fprintln(a.stdout, note.Note)
+	return nil
+}
+
+func cmdNew(ctx context.Context, a *app, args []string) error {
+
+	flags := flag.NewFlagSet("new", flag.ExitOnError)
+	message := flags.String("m", "", "note text, $EDITOR is opened when empty")
+	flags.Parse(args)
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	text := *message
+	if text == "" {
+		text, err = editText("")
+		if err != nil {
+			return err
+		}
+	}
+
+	if strings.TrimSpace(text) == "" {
+		return errors.New("empty note, nothing created")
+	}
+
+	return c.CreateNote(ctx, text)
+}
+
+func cmdEdit(ctx context.Context, a *app, args []string) error {
+
+	noteId, err := noteIdArg(args)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	note, err := c.GetNote(ctx, noteId)
+	if err != nil {
+		return err
+	}
+
+	text, err := editText(note.Note)
+	if err != nil {
+		return err
+	}
+
+	if text == note.Note {
+		fmt.Fprintln(os.Stderr, "No changes")
+		return nil
+	}
+
+	return c.UpdateNote(ctx, noteId, text)
+}
+
+func cmdRemove(ctx context.Context, a *app, args []string) error {
+
+	noteId, err := noteIdArg(args)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	return c.DeleteNote(ctx, noteId)
+}
+
+func cmdShare(ctx context.Context, a *app, args []string) error {
+
+	if len(args) != 2 {
+		return errors.New("usage: notes share <id> <userid>")
+	}
+
+	noteId, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid note id %q", args[0])
+	}
+
+	userId, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid user id %q", args[1])
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	return c.ShareNote(ctx, noteId, userId)
+}
+
+func cmdAttach(ctx context.Context, a *app, args []string) error {
+
+	if len(args) == 0 {
+		return errors.New("usage: notes attach <id> [file]...")
+	}
+
+	noteId, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid note id %q", args[0])
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	attachments := []client.Attachment{}
+
+	if len(args) == 1 {
+		attachments, err = c.ListAttachments(ctx, noteId)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, name := range args[1:] {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		attachment, err := c.UploadAttachment(ctx, noteId, filepath.Base(name), data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		attachments = append(attachments, *attachment)
+	}
+
+	if a.output == "json" {
+		return a.printJSON(attachments)
+	}
+
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSIZE\tTYPE\tNAME")
+	for _, attachment := range attachments {
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%s\n", attachment.Id, attachment.Size, attachment.Mime, attachment.Name)
+	}
+
+	return tw.Flush()
+}
+
+// attachmentArgs parses the note and attachment id of fetch and detach.
+func attachmentArgs(command string, args []string) (uint64, uint64, error) {
+
+	if len(args) != 2 {
+		return 0, 0, fmt.Errorf("usage: notes %s <id> <attachmentid>", command)
+	}
+
+	noteId, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid note id %q", args[0])
+	}
+
+	attachmentId, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid attachment id %q", args[1])
+	}
+
+	return noteId, attachmentId, nil
+}
+
+func cmdFetch(ctx context.Context, a *app, args []string) error {
+
+	flags := flag.NewFlagSet("fetch", flag.ExitOnError)
+	out := flags.String("out", "", "file to write the attachment to, its name by default")
+	flags.Parse(args)
+
+	noteId, attachmentId, err := attachmentArgs("fetch", flags.Args())
+	if err != nil {
+		return err
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		attachments, err := c.ListAttachments(ctx, noteId)
+		if err != nil {
+			return err
+		}
+		for _, attachment := range attachments {
+			if attachment.Id == attachmentId {
+				*out = filepath.Base(attachment.Name)
+			}
+		}
+		if *out == "" {
+			return fmt.Errorf("note %d has no attachment %d", noteId, attachmentId)
+		}
+	}
+
+	file, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := c.DownloadAttachment(ctx, noteId, attachmentId, file); err != nil {
+		os.Remove(*out)
+		return err
+	}
+
+	fmt.Fprintf(a.stdout, "Wrote %s\n", *out)
+	return nil
+}
+
+func cmdDetach(ctx context.Context, a *app, args []string) error {
+
+	noteId, attachmentId, err := attachmentArgs("detach", args)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	return c.DeleteAttachment(ctx, noteId, attachmentId)
+}
+
+func cmdSearch(ctx context.Context, a *app, args []string) error {
+
+	if len(args) == 0 {
+		return errors.New("usage: notes search <query>")
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	notes, err := c.Search(ctx, strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+
+	return a.printNotes(notes)
+}
+
+func cmdExport(ctx context.Context, a *app, args []string) error {
+
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	dir := flags.String("dir", "", "directory to write one file per note, JSON to stdout when empty")
+	format := flags.String("format", "", "write the server export (zip, md or json) to stdout")
+	flags.Parse(args)
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	if *format != "" {
+		return c.ExportNotes(ctx, *format, a.stdout)
+	}
+
+	notes, err := c.ListNotes(ctx)
+	if err != nil {
+		return err
+	}
+
+	if *dir == "" {
+		return a.printJSON(notes)
+	}
+
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return err
+	}
+
+	for _, note := range notes {
+		path := filepath.Join(*dir, fmt.Sprintf("note-%d.md", note.Id))
+		if err := os.WriteFile(path, []byte(note.Note), 0o644); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d notes to %s\n", len(notes), *dir)
+	return nil
+}
+
+// cmdImport uploads files by their extension; a directory is uploaded as a
+// zip archive of the Markdown files in it.
+func cmdImport(ctx context.Context, a *app, args []string) error {
+
+	if len(args) == 0 {
+		return errors.New("usage: notes import <file|dir>...")
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	imported, failed := 0, 0
+
+	for _, arg := range args {
+		format, data, err := importFile(arg)
+		if err != nil {
+			return err
+		}
+
+		result, err := c.ImportNotes(ctx, format, data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", arg, err)
+		}
+
+		imported += result.Imported
+		failed += result.Failed
+
+		if a.output == "json" {
+			if err := a.printJSON(result); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, r := range result.Results {
+			if r.Error != "" {
+				fmt.Fprintf(tw, "%s\t%s\tfailed: %s\n", arg, r.File, r.Error)
+			} else {
+				fmt.Fprintf(tw, "%s\t%s\tnote %d\n", arg, r.File, r.Id)
+			}
+		}
+	}
+
+	if a.output != "json" {
+		tw.Flush()
+		fmt.Fprintf(os.Stderr, "Imported %d notes, %d failed\n", imported, failed)
+	}
+	return nil
+}
+
+func importFile(name string) (string, []byte, error) {
+
+	info, err := os.Stat(name)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if !info.IsDir() {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return "", nil, err
+		}
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".zip":
+			return "zip", data, nil
+		case ".json":
+			return "json", data, nil
+		}
+		return "md", data, nil
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	err = filepath.Walk(name, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".md", ".markdown", ".txt":
+		default:
+			return nil
+		}
+		rel, err := filepath.Rel(name, path)
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		header.Method = zip.Deflate
+		w, err := archive.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err := archive.Close(); err != nil {
+		return "", nil, err
+	}
+
+	return "zip", buf.Bytes(), nil
+}
+
+func cmdTakeout(ctx context.Context, a *app, args []string) error {
+
+	flags := flag.NewFlagSet("takeout", flag.ExitOnError)
+	out := flags.String("out", "notes-takeout.zip", "file to write the archive to")
+	flags.Parse(args)
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	export, err := c.RequestExport(ctx)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	for {
+		err = c.DownloadExport(ctx, export.Id, file)
+		if !errors.Is(err, client.ErrExportPending) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+	if err != nil {
+		os.Remove(*out)
+		return err
+	}
+
+	fmt.Fprintf(a.stdout, "Wrote %s\n", *out)
+	return nil
+}
+
+func (a *app) printNotes(notes []client.Note) error {
+
+	if a.output == "json" {
+		return a.printJSON(notes)
+	}
+
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tOWNER\tUPDATED\tNOTE")
+	for _, note := range notes {
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%s\n", note.Id, note.Userid, note.Updatedat.Local().Format(time.DateTime), summary(note.Note))
+	}
+
+	return tw.Flush()
+}
+
+func (a *app) printJSON(v interface{}) error {
+	enc := json.NewEncoder(a.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func summary(text string) string {
+
+	line := strings.SplitN(strings.TrimSpace(text), "\n", 2)[0]
+
+	if runes := []rune(line); len(runes) > 60 {
+		return string(runes[:57]) + "..."
+	}
+
+	return line
+}
+
+func noteIdArg(args []string) (uint64, error) {
+
+	if len(args) != 1 {
+		return 0, errors.New("expected a single note id")
+	}
+
+	noteId, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid note id %q", args[0])
+	}
+
+	return noteId, nil
+}
+
+// editText opens $EDITOR (vi by default) on a temporary file holding text
+// and returns the saved contents.
+func editText(text string) (string, error) {
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+
+	file, err := os.CreateTemp("", "note-*.md")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.WriteString(text); err != nil {
+		file.Close()
+		return "", err
+	}
+	file.Close()
+
+	parts := strings.Fields(editor)
+	cmd := exec.Command(parts[0], append(parts[1:], file.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor: %w", err)
+	}
+
+	data, err := os.ReadFile(file.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
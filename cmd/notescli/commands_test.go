@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// withStdin makes os.Stdin read input, as if it was piped in.
+func withStdin(t *testing.T, input string) {
+
+	file := filepath.Join(t.TempDir(), "stdin")
+	os.WriteFile(file, []byte(input), 0o600)
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdin := os.Stdin
+	os.Stdin = f
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		f.Close()
+	})
+}
+
+// withTerminal makes stdin look like a terminal on which passwords are
+// typed without echo.
+func withTerminal(t *testing.T, passwords ...string) {
+
+	terminal, read := isTerminal, readPassword
+	isTerminal = func(fd int) bool { return true }
+	readPassword = func(fd int) ([]byte, error) {
+		if len(passwords) == 0 {
+			return nil, errors.New("no input")
+		}
+		password := passwords[0]
+		passwords = passwords[1:]
+		return []byte(password), nil
+	}
+	t.Cleanup(func() { isTerminal, readPassword = terminal, read })
+}
+
+func TestPromptPassword(t *testing.T) {
+
+	t.Run("terminal", func(t *testing.T) {
+
+		withTerminal(t, "s3cret")
+		withStdin(t, "not read\n")
+
+		password, err := promptPassword(bufio.NewReader(os.Stdin), "Password: ")
+		assert.NoError(t, err)
+		assert.Equal(t, "s3cret", password, "the password is read without echo")
+	})
+
+	t.Run("piped", func(t *testing.T) {
+
+		withStdin(t, "s3cret\r\n")
+
+		password, err := promptPassword(bufio.NewReader(os.Stdin), "Password: ")
+		assert.NoError(t, err)
+		assert.Equal(t, "s3cret", password)
+	})
+}
+
+func TestPasswd(t *testing.T) {
+
+	var changes []map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/auth/password/change" {
+			http.NotFound(w, r)
+			return
+		}
+		body := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&body)
+		changes = append(changes, body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	login := func(t *testing.T) string {
+		path := filepath.Join(t.TempDir(), "credentials.json")
+		t.Setenv("NOTES_CREDENTIALS", path)
+		saveCredentials(&credentials{Server: srv.URL, Username: "alice", UserId: 3, Token: "token"})
+		return path
+	}
+
+	t.Run("terminal", func(t *testing.T) {
+
+		login(t)
+		withTerminal(t, "old", "n3w", "n3w")
+
+		var stdout bytes.Buffer
+		err := cmdPasswd(context.Background(), &app{stdout: &stdout}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "old", changes[len(changes)-1]["oldpassword"])
+		assert.Equal(t, "n3w", changes[len(changes)-1]["newpassword"])
+		assert.True(t, strings.HasPrefix(stdout.String(), "Password changed"))
+
+		creds, _ := loadCredentials()
+		assert.Empty(t, creds.Token, "the revoked token is forgotten")
+		assert.Equal(t, "alice", creds.Username)
+	})
+
+	t.Run("piped", func(t *testing.T) {
+
+		login(t)
+		withStdin(t, "old\nn3w\nn3w\n")
+
+		err := cmdPasswd(context.Background(), &app{stdout: &bytes.Buffer{}}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "n3w", changes[len(changes)-1]["newpassword"])
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+
+		login(t)
+		withTerminal(t, "old", "n3w", "typo")
+		sent := len(changes)
+
+		err := cmdPasswd(context.Background(), &app{stdout: &bytes.Buffer{}}, nil)
+		assert.EqualError(t, err, "the new passwords do not match")
+		assert.Len(t, changes, sent)
+
+		creds, _ := loadCredentials()
+		assert.Equal(t, "token", creds.Token)
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+const defaultServer = "http://localhost:8081"
+
+type credentials struct {
+	Server   string `json:"server"`
+	Username string `json:"username"`
+	UserId   uint64 `json:"userid"`
+	Token    string `json:"token"`
+}
+
+// credentialsPath honours NOTES_CREDENTIALS, falling back to
+// $XDG_CONFIG_HOME/notes/credentials.json.
+func credentialsPath() (string, error) {
+
+	if path := os.Getenv("NOTES_CREDENTIALS"); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "notes", "credentials.json"), nil
+}
+
+func loadCredentials() (*credentials, error) {
+
+	path, err := credentialsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &credentials{Server: defaultServer}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	creds := &credentials{}
+	if err := json.Unmarshal(data, creds); err != nil {
+		return nil, err
+	}
+
+	if creds.Server == "" {
+		creds.Server = defaultServer
+	}
+
+	return creds, nil
+}
+
+func saveCredentials(creds *credentials) error {
+
+	path, err := credentialsPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o600)
+}
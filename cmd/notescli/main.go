@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+)
+
+const usage = `Usage: notes [-o table|json] <command> [arguments]
+
+Commands:
+  login [-server URL] <username>   log in and store the token
+  logout                           forget the stored token
+  passwd                           change the password
+  me [-name n] [-tz zone] ...      show or change the profile
+  email <address>                  set the email address used for password resets
+  ls                               list owned and shared notes
+  cat <id>                         print a note
+  new [-m text]                    create a note, opens $EDITOR without -m
+  edit <id>                        edit a note in $EDITOR
+  rm <id>                          delete a note
+  share <id> <userid>              share a note with another user
+  attach <id> [file]...            attach files to a note, or list its attachments
+  fetch [-out file] <id> <attid>   download an attachment
+  detach <id> <attid>              delete an attachment
+  search <query>                   full text search
+  export [-dir path] [-format f]   write every note to a file, or JSON to stdout;
+                                   -format zip|md|json writes the server export
+  import <file|dir>...             create notes from Markdown, JSON or zip files
+  takeout [-out file]              download an archive of all your personal data
+`
+
+type command func(ctx context.Context, app *app, args []string) error
+
+var commands = map[string]command{
+	"login":   cmdLogin,
+	"logout":  cmdLogout,
+	"passwd":  cmdPasswd,
+	"me":      cmdMe,
+	"email":   cmdEmail,
+	"ls":      cmdList,
+	"cat":     cmdCat,
+	"new":     cmdNew,
+	"edit":    cmdEdit,
+	"rm":      cmdRemove,
+	"share":   cmdShare,
+	"attach":  cmdAttach,
+	"fetch":   cmdFetch,
+	"detach":  cmdDetach,
+	"search":  cmdSearch,
+	"export":  cmdExport,
+	"import":  cmdImport,
+	"takeout": cmdTakeout,
+}
+
+func main() {
+
+	flags := flag.NewFlagSet("notes", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	output := flags.String("o", "table", "output format: table or json")
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	cmd, found := commands[flags.Arg(0)]
+	if !found {
+		fmt.Fprintf(os.Stderr, "notes: unknown command %q\n\n", flags.Arg(0))
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "notes: unknown output format %q\n", *output)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	app := &app{output: *output, stdout: os.Stdout}
+
+	if err := cmd(ctx, app, flags.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "notes:", err)
+		os.Exit(1)
+	}
+}
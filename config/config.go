@@ -1,21 +1,633 @@
 package config
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
-func Init() {
-	viper.SetConfigName("config")
+const (
+	envPrefix     = "NOTES"
+	devMode       = "dev"
+	defaultSecret = "my-secret-key"
+)
+
+type Config struct {
+	// File is the config file that was read, empty when none was found.
+	File string `mapstructure:"-"`
+
+	Mode        string           `mapstructure:"mode"`
+	Database    DatabaseConfig   `mapstructure:"database"`
+	Token       TokenConfig      `mapstructure:"token"`
+	Server      ServerConfig     `mapstructure:"server"`
+	RateLimit   RateLimitConfig  `mapstructure:"ratelimit"`
+	Login       LoginConfig      `mapstructure:"login"`
+	OIDC        OIDCConfig       `mapstructure:"oidc"`
+	Mail        MailConfig       `mapstructure:"mail"`
+	Export      ExportConfig     `mapstructure:"export"`
+	Import      ImportConfig     `mapstructure:"import"`
+	Attachments AttachmentConfig `mapstructure:"attachments"`
+	Log         LogConfig        `mapstructure:"log"`
+	Admin       AdminConfig      `mapstructure:"admin"`
+}
+
+type DatabaseConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     string `mapstructure:"port"`
+	Name     string `mapstructure:"name"`
+	User     string `mapstructure:"user"`
+	Password string `mapstructure:"password"`
+	Migrate  bool   `mapstructure:"migrate"`
+}
+
+// TokenConfig configures how tokens are signed. With Keys set tokens are
+// signed asymmetrically and SecretKey, when set, only verifies legacy HS256
+// tokens. Without Keys tokens are signed with SecretKey.
+type TokenConfig struct {
+	SecretKey string        `mapstructure:"secretkey"`
+	Lifetime  time.Duration `mapstructure:"lifetime"`
+	Keys      []TokenKey    `mapstructure:"keys"`
+}
+
+type ServerConfig struct {
+	Host            string        `mapstructure:"host"`
+	Port            string        `mapstructure:"port"`
+	ReadTimeout     time.Duration `mapstructure:"readtimeout"`
+	WriteTimeout    time.Duration `mapstructure:"writetimeout"`
+	IdleTimeout     time.Duration `mapstructure:"idletimeout"`
+	ShutdownTimeout time.Duration `mapstructure:"shutdowntimeout"`
+	TLS             TLSConfig     `mapstructure:"tls"`
+}
+
+type TLSConfig struct {
+	CertFile string `mapstructure:"certfile"`
+	KeyFile  string `mapstructure:"keyfile"`
+}
+
+type RateLimitConfig struct {
+	// Store is "memory" for per-process budgets or "redis" to share them
+	// between replicas. The failed login counters of LoginConfig are kept
+	// in the same store. It is only read at startup.
+	Store    string            `mapstructure:"store"`
+	Redis    RedisConfig       `mapstructure:"redis"`
+	Policies []RateLimitPolicy `mapstructure:"policies"`
+}
+
+type RedisConfig struct {
+	Addr     string `mapstructure:"addr"`
+	Password string `mapstructure:"password"`
+	DB       int    `mapstructure:"db"`
+	Prefix   string `mapstructure:"prefix"`
+}
+
+// RateLimitPolicy gives every client Requests per Period on the routes under
+// Prefix. Clients are identified by user id when authenticated, by IP
+// otherwise. The policy with the longest matching prefix applies.
+type RateLimitPolicy struct {
+	Name     string        `mapstructure:"name"`
+	Prefix   string        `mapstructure:"prefix"`
+	Requests int           `mapstructure:"requests"`
+	Period   time.Duration `mapstructure:"period"`
+}
+
+// Policy returns the policy applying to path, nil when none matches.
+func (c RateLimitConfig) Policy(path string) *RateLimitPolicy {
+
+	var match *RateLimitPolicy
+	for i := range c.Policies {
+		policy := &c.Policies[i]
+		if strings.HasPrefix(path, policy.Prefix) && (match == nil || len(policy.Prefix) > len(match.Prefix)) {
+			match = policy
+		}
+	}
+
+	return match
+}
+
+// LoginConfig controls the protection against password guessing. Failed
+// logins are counted per username and per IP. Once a counter reaches the
+// backoff threshold every further failure blocks the key for BackoffBase,
+// doubling each time; at the lockout threshold it is blocked for
+// LockoutDuration. Counters are forgotten after LockoutDuration without
+// failures.
+type LoginConfig struct {
+	BackoffAfter    int           `mapstructure:"backoffafter"`
+	LockoutAfter    int           `mapstructure:"lockoutafter"`
+	IPBackoffAfter  int           `mapstructure:"ipbackoffafter"`
+	IPLockoutAfter  int           `mapstructure:"iplockoutafter"`
+	BackoffBase     time.Duration `mapstructure:"backoffbase"`
+	LockoutDuration time.Duration `mapstructure:"lockoutduration"`
+}
+
+// OIDCConfig enables login through an OpenID Connect provider with the
+// authorization code flow. Users are found by the issuer and subject they
+// were linked to; an unlinked identity is linked only by a verified email
+// matching the user's verified email. Otherwise a user is created when
+// AutoProvision is set, named by UsernameClaim ("email" requires a verified
+// address); the claim never links an existing account.
+type OIDCConfig struct {
+	Enabled       bool     `mapstructure:"enabled"`
+	Issuer        string   `mapstructure:"issuer"`
+	ClientID      string   `mapstructure:"clientid"`
+	ClientSecret  string   `mapstructure:"clientsecret"`
+	RedirectURL   string   `mapstructure:"redirecturl"`
+	Scopes        []string `mapstructure:"scopes"`
+	AutoProvision bool     `mapstructure:"autoprovision"`
+	UsernameClaim string   `mapstructure:"usernameclaim"`
+}
+
+// MailConfig selects how account mails (email verification, password reset)
+// are delivered: "log" writes them to the log, "file" stores each message as
+// an .eml file in Dir and "smtp" sends them. Only smtp is accepted outside dev
+// mode. It is only read at startup.
+type MailConfig struct {
+	Transport string `mapstructure:"transport"`
+	From      string `mapstructure:"from"`
+	// BaseURL is the address of the frontend that links in mails point to.
+	BaseURL string     `mapstructure:"baseurl"`
+	Dir     string     `mapstructure:"dir"`
+	SMTP    SMTPConfig `mapstructure:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     string `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+// ExportConfig controls personal data archives. Archives are written to Dir
+// and can be downloaded for Retention after they were built.
+type ExportConfig struct {
+	Dir       string        `mapstructure:"dir"`
+	Retention time.Duration `mapstructure:"retention"`
+}
+
+// ImportConfig limits note imports. MaxSize is the largest upload in bytes.
+// Uploads to background imports are kept in Dir until they are imported.
+type ImportConfig struct {
+	MaxSize int64  `mapstructure:"maxsize"`
+	Dir     string `mapstructure:"dir"`
+}
+
+// AttachmentConfig limits the files attached to notes and selects where
+// their content is kept: "local" stores them in Dir, "s3" in a bucket of an
+// S3 compatible service. MaxSize is the largest file and Quota the total size
+// of the attachments of a user's notes, both in bytes. The store is only read
+// at startup.
+type AttachmentConfig struct {
+	MaxSize int64    `mapstructure:"maxsize"`
+	Quota   int64    `mapstructure:"quota"`
+	Store   string   `mapstructure:"store"`
+	Dir     string   `mapstructure:"dir"`
+	S3      S3Config `mapstructure:"s3"`
+}
+
+// S3Config addresses a bucket of an S3 compatible service such as AWS S3 or
+// MinIO. With PathStyle the bucket is the first path segment of the
+// Endpoint rather than a subdomain of it.
+type S3Config struct {
+	Endpoint  string `mapstructure:"endpoint"`
+	Region    string `mapstructure:"region"`
+	Bucket    string `mapstructure:"bucket"`
+	AccessKey string `mapstructure:"accesskey"`
+	SecretKey string `mapstructure:"secretkey"`
+	PathStyle bool   `mapstructure:"pathstyle"`
+}
+
+// LogConfig controls the log output. Level is "debug" to also log every
+// request, "info" for startup, shutdown and other notices as well as errors,
+// or "error" for errors only.
+type LogConfig struct {
+	Level string `mapstructure:"level"`
+}
+
+type AdminConfig struct {
+	// Token grants access to the /api/admin endpoints, which are disabled
+	// while it is empty.
+	Token string `mapstructure:"token"`
+}
+
+// defaults lists every configuration key. Each key can be overridden from the
+// config file, a NOTES_ prefixed environment variable (dots become
+// underscores), a NOTES_..._FILE variable naming a file holding the value, or
+// a --key=value flag, in increasing order of precedence.
+var defaults = map[string]interface{}{
+	"mode": "production",
+
+	"database.host":     "127.0.0.1",
+	"database.port":     "5432",
+	"database.name":     "notes",
+	"database.user":     "postgres",
+	"database.password": "",
+	"database.migrate":  false,
+
+	"token.secretkey": "",
+	"token.lifetime":  2 * time.Hour,
+	"token.keys":      []map[string]interface{}{},
+
+	"server.host":            "",
+	"server.port":            "8081",
+	"server.readtimeout":     15 * time.Second,
+	"server.writetimeout":    30 * time.Second,
+	"server.idletimeout":     60 * time.Second,
+	"server.shutdowntimeout": 30 * time.Second,
+	"server.tls.certfile":    "",
+	"server.tls.keyfile":     "",
+
+	"ratelimit.store":          "memory",
+	"ratelimit.redis.addr":     "127.0.0.1:6379",
+	"ratelimit.redis.password": "",
+	"ratelimit.redis.db":       "0",
+	"ratelimit.redis.prefix":   "notes:ratelimit:",
+	"ratelimit.policies": []map[string]interface{}{
+		{"name": "auth", "prefix": "/api/auth", "requests": 10, "period": time.Minute},
+		{"name": "default", "prefix": "/", "requests": 100, "period": time.Second},
+	},
+
+	"login.backoffafter":    "3",
+	"login.lockoutafter":    "10",
+	"login.ipbackoffafter":  "10",
+	"login.iplockoutafter":  "50",
+	"login.backoffbase":     time.Second,
+	"login.lockoutduration": 15 * time.Minute,
+
+	"oidc.enabled":       false,
+	"oidc.issuer":        "",
+	"oidc.clientid":      "",
+	"oidc.clientsecret":  "",
+	"oidc.redirecturl":   "",
+	"oidc.scopes":        "openid,email,profile",
+	"oidc.autoprovision": false,
+	"oidc.usernameclaim": "email",
+
+	"mail.transport":     "log",
+	"mail.from":          "notes@localhost",
+	"mail.baseurl":       "http://localhost:8081",
+	"mail.dir":           "mail",
+	"mail.smtp.host":     "",
+	"mail.smtp.port":     "587",
+	"mail.smtp.username": "",
+	"mail.smtp.password": "",
+
+	"export.dir":       "exports",
+	"export.retention": 7 * 24 * time.Hour,
+
+	"import.maxsize": "104857600",
+	"import.dir":     "imports",
+
+	"attachments.maxsize":      "26214400",
+	"attachments.quota":        "1073741824",
+	"attachments.store":        "local",
+	"attachments.dir":          "attachments",
+	"attachments.s3.endpoint":  "",
+	"attachments.s3.region":    "us-east-1",
+	"attachments.s3.bucket":    "",
+	"attachments.s3.accesskey": "",
+	"attachments.s3.secretkey": "",
+	"attachments.s3.pathstyle": true,
+
+	"log.level": "info",
+
+	"admin.token": "",
+}
+
+// decodeHook adds RFC 3339 timestamps to the conversions viper applies by
+// default.
+var decodeHook = viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+	mapstructure.StringToTimeDurationHookFunc(),
+	mapstructure.StringToSliceHookFunc(","),
+	mapstructure.StringToTimeHookFunc(time.RFC3339),
+))
+
+var current atomic.Pointer[Config]
+
+// Get returns the configuration stored by the last successful Load, or the
+// defaults when Load has not been called (e.g. in tests).
+func Get() *Config {
+
+	if cfg := current.Load(); cfg != nil {
+		return cfg
+	}
+
+	return defaultConfig()
+}
+
+func defaultConfig() *Config {
+
+	cfg := &Config{}
+	v := viper.New()
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+	v.Unmarshal(cfg, decodeHook)
+
+	return cfg
+}
+
+// Set replaces the current configuration.
+func Set(cfg *Config) {
+	current.Store(cfg)
+}
+
+// Load builds the configuration from all layers, validates it and makes it
+// available through Get. Leading --flags are consumed from args and the
+// remaining arguments are returned. Reload repeats the same steps with args.
+func Load(args []string) (*Config, []string, error) {
+
+	cfg, rest, err := load(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reloadMu.Lock()
+	loadArgs = args
+	reloadMu.Unlock()
+
+	current.Store(cfg)
+
+	return cfg, rest, nil
+}
+
+func load(args []string) (*Config, []string, error) {
 
-	viper.AddConfigPath("config/")
-	viper.AutomaticEnv()
+	v := viper.New()
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+
+	flags := pflag.NewFlagSet("notes", pflag.ContinueOnError)
+	flags.SetInterspersed(false)
+	configFile := flags.String("config", "", "path to the config file (env NOTES_CONFIG)")
+
+	for _, key := range keys() {
+		switch value := defaults[key].(type) {
+		case bool:
+			flags.Bool(key, value, "")
+		case time.Duration:
+			flags.Duration(key, value, "")
+		case []map[string]interface{}:
+			// lists can only be set in the config file
+			continue
+		default:
+			flags.String(key, fmt.Sprint(value), "")
+		}
+		v.BindPFlag(key, flags.Lookup(key))
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	v.SetEnvPrefix(envPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	path := *configFile
+	if path == "" {
+		path = os.Getenv(envPrefix + "_CONFIG")
+	}
+
+	if path != "" {
+		v.SetConfigFile(path)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, nil, fmt.Errorf("reading config file: %w", err)
+		}
+	} else {
+		v.SetConfigName("config")
+		v.SetConfigType("yml")
+		v.AddConfigPath("config/")
+		if err := v.ReadInConfig(); err != nil && !errors.As(err, &viper.ConfigFileNotFoundError{}) {
+			return nil, nil, fmt.Errorf("reading config file: %w", err)
+		}
+	}
+
+	for _, key := range keys() {
+		if flags.Changed(key) {
+			continue
+		}
+
+		secretFile := os.Getenv(envName(key) + "_FILE")
+		if secretFile == "" {
+			continue
+		}
+
+		data, err := os.ReadFile(secretFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading %s_FILE: %w", envName(key), err)
+		}
+		v.Set(key, strings.TrimRight(string(data), "\r\n"))
+	}
+
+	cfg := &Config{}
+	if err := v.Unmarshal(cfg, decodeHook); err != nil {
+		return nil, nil, fmt.Errorf("decoding config: %w", err)
+	}
+
+	cfg.File = v.ConfigFileUsed()
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
 
-	viper.SetConfigType("yml")
-	
-	if err := viper.ReadInConfig(); err != nil {
-		log.Fatal("Error reading config file, ", err)
-		return
+	return cfg, flags.Args(), nil
+}
+
+func (c *Config) DevMode() bool {
+	return c.Mode == devMode
+}
+
+// Validate reports every problem with the configuration at once.
+func (c *Config) Validate() error {
+
+	problems := []string{}
+
+	if c.Mode != devMode && c.Mode != "production" {
+		problems = append(problems, fmt.Sprintf("mode must be %q or \"production\", got %q", devMode, c.Mode))
+	}
+
+	if c.Database.Host == "" {
+		problems = append(problems, "database.host is required")
+	}
+	if c.Database.Name == "" {
+		problems = append(problems, "database.name is required")
+	}
+	if c.Database.User == "" {
+		problems = append(problems, "database.user is required")
 	}
+	if !validPort(c.Database.Port) {
+		problems = append(problems, fmt.Sprintf("database.port %q is not a valid port", c.Database.Port))
+	}
+
+	if c.Token.SecretKey == "" && len(c.Token.Keys) == 0 {
+		problems = append(problems, "token.secretkey is required unless token.keys are configured (set NOTES_TOKEN_SECRETKEY or NOTES_TOKEN_SECRETKEY_FILE)")
+	} else if c.Token.SecretKey == defaultSecret && !c.DevMode() {
+		problems = append(problems, fmt.Sprintf("token.secretkey must not be the default %q outside dev mode", defaultSecret))
+	}
+
+	if !validPort(c.Server.Port) {
+		problems = append(problems, fmt.Sprintf("server.port %q is not a valid port", c.Server.Port))
+	}
+	if c.Server.ReadTimeout <= 0 || c.Server.WriteTimeout <= 0 || c.Server.IdleTimeout <= 0 || c.Server.ShutdownTimeout <= 0 {
+		problems = append(problems, "server timeouts must be positive durations")
+	}
+	if (c.Server.TLS.CertFile == "") != (c.Server.TLS.KeyFile == "") {
+		problems = append(problems, "server.tls.certfile and server.tls.keyfile must be set together")
+	}
+
+	if c.Token.Lifetime <= 0 {
+		problems = append(problems, "token.lifetime must be a positive duration")
+	}
+	problems = append(problems, c.Token.validateKeys()...)
+
+	switch c.RateLimit.Store {
+	case "memory":
+	case "redis":
+		if c.RateLimit.Redis.Addr == "" {
+			problems = append(problems, "ratelimit.redis.addr is required when ratelimit.store is redis")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("ratelimit.store must be memory or redis, got %q", c.RateLimit.Store))
+	}
+
+	names := map[string]bool{}
+	for _, policy := range c.RateLimit.Policies {
+		if policy.Name == "" || names[policy.Name] {
+			problems = append(problems, fmt.Sprintf("ratelimit policy names must be unique and non-empty, got %q", policy.Name))
+		}
+		names[policy.Name] = true
+
+		if !strings.HasPrefix(policy.Prefix, "/") {
+			problems = append(problems, fmt.Sprintf("ratelimit policy %q: prefix must start with /", policy.Name))
+		}
+		if policy.Requests <= 0 || policy.Period <= 0 {
+			problems = append(problems, fmt.Sprintf("ratelimit policy %q: requests and period must be positive", policy.Name))
+		}
+	}
+
+	if c.Login.BackoffAfter <= 0 || c.Login.LockoutAfter <= c.Login.BackoffAfter {
+		problems = append(problems, "login.backoffafter must be positive and below login.lockoutafter")
+	}
+	if c.Login.IPBackoffAfter <= 0 || c.Login.IPLockoutAfter <= c.Login.IPBackoffAfter {
+		problems = append(problems, "login.ipbackoffafter must be positive and below login.iplockoutafter")
+	}
+	if c.Login.BackoffBase <= 0 || c.Login.LockoutDuration < c.Login.BackoffBase {
+		problems = append(problems, "login.backoffbase must be positive and login.lockoutduration at least as long")
+	}
+
+	if c.OIDC.Enabled {
+		if c.OIDC.Issuer == "" || c.OIDC.ClientID == "" || c.OIDC.RedirectURL == "" {
+			problems = append(problems, "oidc.issuer, oidc.clientid and oidc.redirecturl are required when oidc is enabled")
+		}
+		if !contains(c.OIDC.Scopes, "openid") {
+			problems = append(problems, "oidc.scopes must include openid")
+		}
+	}
+	switch c.OIDC.UsernameClaim {
+	case "email", "preferred_username", "sub":
+	default:
+		problems = append(problems, fmt.Sprintf("oidc.usernameclaim must be email, preferred_username or sub, got %q", c.OIDC.UsernameClaim))
+	}
+
+	switch c.Mail.Transport {
+	case "log", "file":
+		// reset links in a log or a local directory are readable by anyone
+		// with access to the host
+		if !c.DevMode() {
+			problems = append(problems, fmt.Sprintf("mail.transport %s is only accepted in dev mode, configure smtp", c.Mail.Transport))
+		} else if c.Mail.Transport == "file" && c.Mail.Dir == "" {
+			problems = append(problems, "mail.dir is required when mail.transport is file")
+		}
+	case "smtp":
+		if c.Mail.SMTP.Host == "" || !validPort(c.Mail.SMTP.Port) {
+			problems = append(problems, "mail.smtp.host and a valid mail.smtp.port are required when mail.transport is smtp")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("mail.transport must be log, file or smtp, got %q", c.Mail.Transport))
+	}
+	if _, err := mail.ParseAddress(c.Mail.From); err != nil {
+		problems = append(problems, fmt.Sprintf("mail.from %q is not a valid address", c.Mail.From))
+	}
+
+	if c.Export.Dir == "" || c.Export.Retention <= 0 {
+		problems = append(problems, "export.dir is required and export.retention must be a positive duration")
+	}
+
+	if c.Import.MaxSize <= 0 {
+		problems = append(problems, fmt.Sprintf("import.maxsize must be a positive number of bytes, got %d", c.Import.MaxSize))
+	}
+	if c.Import.Dir == "" {
+		problems = append(problems, "import.dir is required")
+	}
+
+	if c.Attachments.MaxSize <= 0 || c.Attachments.Quota < c.Attachments.MaxSize {
+		problems = append(problems, "attachments.maxsize must be positive and attachments.quota at least as large")
+	}
+	switch c.Attachments.Store {
+	case "local":
+		if c.Attachments.Dir == "" {
+			problems = append(problems, "attachments.dir is required when attachments.store is local")
+		}
+	case "s3":
+		s3 := c.Attachments.S3
+		if s3.Endpoint == "" || s3.Bucket == "" || s3.Region == "" {
+			problems = append(problems, "attachments.s3.endpoint, attachments.s3.region and attachments.s3.bucket are required when attachments.store is s3")
+		}
+		if s3.AccessKey == "" || s3.SecretKey == "" {
+			problems = append(problems, "attachments.s3.accesskey and attachments.s3.secretkey are required when attachments.store is s3 (set NOTES_ATTACHMENTS_S3_SECRETKEY)")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("attachments.store must be local or s3, got %q", c.Attachments.Store))
+	}
+
+	switch c.Log.Level {
+	case "debug", "info", "error":
+	default:
+		problems = append(problems, fmt.Sprintf("log.level must be debug, info or error, got %q", c.Log.Level))
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration:\n  - " + strings.Join(problems, "\n  - "))
+	}
+
+	return nil
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n < 65536
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func keys() []string {
+
+	out := make([]string, 0, len(defaults))
+	for key := range defaults {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+func envName(key string) string {
+	return envPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
 }
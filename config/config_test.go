@@ -0,0 +1,157 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, body string) string {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+
+	path := writeConfig(t, `
+mode: dev
+database:
+  host: file-host
+  name: file-name
+token:
+  secretkey: file-secret
+server:
+  port: 9000
+`)
+
+	secretFile := filepath.Join(t.TempDir(), "password")
+	os.WriteFile(secretFile, []byte("from-file\n"), 0o600)
+
+	t.Setenv("NOTES_DATABASE_NAME", "env-name")
+	t.Setenv("NOTES_SERVER_PORT", "9001")
+	t.Setenv("NOTES_DATABASE_PASSWORD_FILE", secretFile)
+
+	cfg, rest, err := Load([]string{"--config", path, "--server.port=9002", "serve", "--other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"serve", "--other"}, rest)
+	assert.Equal(t, path, cfg.File)
+	assert.Equal(t, "file-host", cfg.Database.Host, "file overrides default")
+	assert.Equal(t, "postgres", cfg.Database.User, "default used when unset")
+	assert.Equal(t, "env-name", cfg.Database.Name, "env overrides file")
+	assert.Equal(t, "9002", cfg.Server.Port, "flag overrides env")
+	assert.Equal(t, "from-file", cfg.Database.Password, "secret read from _FILE")
+	assert.Equal(t, 15*time.Second, cfg.Server.ReadTimeout)
+	assert.Same(t, cfg, Get())
+}
+
+func TestLoadRejectsDefaultSecretOutsideDev(t *testing.T) {
+
+	path := writeConfig(t, `
+mode: production
+token:
+  secretkey: my-secret-key
+`)
+
+	_, _, err := Load([]string{"--config", path})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "must not be the default")
+
+	t.Setenv("NOTES_MODE", "dev")
+
+	_, _, err = Load([]string{"--config", path})
+	assert.NoError(t, err)
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+
+	cfg := defaultConfig()
+	cfg.Mode = "staging"
+	cfg.Database.Port = "abc"
+	cfg.Server.TLS.CertFile = "cert.pem"
+
+	err := cfg.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `mode must be`)
+	assert.Contains(t, err.Error(), `database.port "abc"`)
+	assert.Contains(t, err.Error(), "token.secretkey is required")
+	assert.Contains(t, err.Error(), "must be set together")
+}
+
+func TestValidateMailTransport(t *testing.T) {
+
+	cfg := defaultConfig()
+	cfg.Token.SecretKey = "secret"
+
+	for _, transport := range []string{"log", "file"} {
+		cfg.Mode = "production"
+		cfg.Mail.Transport = transport
+		err := cfg.Validate()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "only accepted in dev mode")
+
+		cfg.Mode = devMode
+		assert.NoError(t, cfg.Validate())
+	}
+
+	cfg.Mode = "production"
+	cfg.Mail.Transport = "smtp"
+	cfg.Mail.SMTP.Host = "mail.example.com"
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestReload(t *testing.T) {
+
+	path := writeConfig(t, `
+mode: dev
+token:
+  secretkey: my-secret-key
+log:
+  level: info
+`)
+
+	_, _, err := Load([]string{"--config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var applied *Config
+	OnReload(func(cfg *Config) { applied = cfg })
+
+	os.WriteFile(path, []byte(`
+mode: dev
+token:
+  secretkey: my-secret-key
+  lifetime: 10m
+log:
+  level: debug
+`), 0o600)
+
+	status := Reload("test")
+	assert.True(t, status.Success)
+	assert.Equal(t, "debug", Get().Log.Level)
+	assert.Equal(t, 10*time.Minute, Get().Token.Lifetime)
+	assert.Same(t, Get(), applied)
+
+	os.WriteFile(path, []byte(`
+mode: dev
+token:
+  secretkey: my-secret-key
+log:
+  level: loud
+`), 0o600)
+
+	status = Reload("test")
+	assert.False(t, status.Success)
+	assert.Contains(t, status.Error, "log.level")
+	assert.Equal(t, "debug", Get().Log.Level, "invalid reload keeps the previous config")
+	assert.Equal(t, status, LastReload())
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// TokenKey is an asymmetric key used to sign tokens. The key with the latest
+// ActiveFrom that has been reached signs new tokens; every key that is not
+// retired yet is accepted for verification and published in the JWKS, so a
+// new key can be announced before it is used and an old one kept until the
+// tokens it signed have expired.
+type TokenKey struct {
+	Kid string `mapstructure:"kid"`
+	// File holds a PEM encoded PKCS#8 (or PKCS#1 for RSA) private key. RSA
+	// keys sign with RS256, Ed25519 keys with EdDSA.
+	File       string    `mapstructure:"file"`
+	ActiveFrom time.Time `mapstructure:"activefrom"`
+	// RetireAt removes the key entirely, zero keeps it forever.
+	RetireAt time.Time `mapstructure:"retireat"`
+}
+
+// Load reads and parses the private key in File.
+func (k TokenKey) Load() (crypto.Signer, error) {
+
+	data, err := os.ReadFile(k.File)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", k.File)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", k.File, err)
+	}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("%s: RSA keys must have at least 2048 bits", k.File)
+		}
+		return key, nil
+	case ed25519.PrivateKey:
+		return key, nil
+	}
+
+	return nil, errors.New(k.File + ": only RSA and Ed25519 keys are supported")
+}
+
+// Active reports whether the key may sign tokens at t.
+func (k TokenKey) Active(t time.Time) bool {
+	return !t.Before(k.ActiveFrom) && !k.Retired(t)
+}
+
+// Retired reports whether the key is no longer accepted at t.
+func (k TokenKey) Retired(t time.Time) bool {
+	return !k.RetireAt.IsZero() && !t.Before(k.RetireAt)
+}
+
+func (c TokenConfig) validateKeys() []string {
+
+	problems := []string{}
+	kids := map[string]bool{}
+
+	for _, key := range c.Keys {
+		if key.Kid == "" || kids[key.Kid] {
+			problems = append(problems, fmt.Sprintf("token key ids must be unique and non-empty, got %q", key.Kid))
+		}
+		kids[key.Kid] = true
+
+		if _, err := key.Load(); err != nil {
+			problems = append(problems, fmt.Sprintf("token key %q: %v", key.Kid, err))
+		}
+
+		if !key.RetireAt.IsZero() && !key.RetireAt.After(key.ActiveFrom) {
+			problems = append(problems, fmt.Sprintf("token key %q: retireat must be after activefrom", key.Kid))
+		}
+	}
+
+	return problems
+}
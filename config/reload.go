@@ -0,0 +1,116 @@
+package config
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// ReloadStatus describes the outcome of the most recent reload attempt.
+type ReloadStatus struct {
+	Time    time.Time `json:"time"`
+	Trigger string    `json:"trigger"`
+	File    string    `json:"file"`
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+}
+
+var (
+	reloadMu    sync.Mutex
+	loadArgs    []string
+	subscribers []func(*Config)
+	lastReload  ReloadStatus
+	watching    bool
+
+	// infoln and errorln print the reload messages. The utility package,
+	// which imports config, replaces them with its leveled helpers.
+	infoln  = log.Println
+	errorln = log.Println
+)
+
+// SetLogger routes the reload messages through info and errors.
+func SetLogger(info, errors func(v ...interface{})) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	infoln, errorln = info, errors
+}
+
+// OnReload registers fn to be called with the new configuration after every
+// successful reload.
+func OnReload(fn func(*Config)) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	subscribers = append(subscribers, fn)
+}
+
+// Reload rebuilds the configuration with the arguments given to Load. An
+// invalid configuration is rejected and the current one stays in effect.
+// Server and database settings are only read at startup.
+func Reload(trigger string) ReloadStatus {
+
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	status := ReloadStatus{Time: time.Now(), Trigger: trigger}
+
+	cfg, _, err := load(loadArgs)
+	if err != nil {
+		status.File = Get().File
+		status.Error = err.Error()
+		lastReload = status
+		errorln("Configuration reload ("+trigger+") rejected:", err)
+		return status
+	}
+
+	previous := Get()
+	current.Store(cfg)
+
+	status.File = cfg.File
+	status.Success = true
+	lastReload = status
+
+	if previous.Server != cfg.Server || previous.Database != cfg.Database {
+		infoln("Configuration reload: server and database changes take effect after a restart")
+	}
+
+	for _, fn := range subscribers {
+		fn(cfg)
+	}
+
+	infoln("Configuration reloaded ("+trigger+") from", cfg.File)
+
+	return status
+}
+
+func LastReload() ReloadStatus {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	return lastReload
+}
+
+// Watch reloads the configuration whenever the config file changes.
+func Watch() {
+
+	file := Get().File
+	if file == "" {
+		return
+	}
+
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	if watching {
+		return
+	}
+	watching = true
+
+	v := viper.New()
+	v.SetConfigFile(file)
+	v.OnConfigChange(func(e fsnotify.Event) {
+		Reload("file change")
+	})
+	v.WatchConfig()
+}
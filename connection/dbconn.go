@@ -1,40 +1,68 @@
 package connection
 
 import (
+	"NOTESBE/config"
 	"NOTESBE/repository"
-	"log"
+	"NOTESBE/utility"
 
-	"github.com/spf13/viper"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
 func InitializeDB() (*repository.Database, error) {
 
-	dsn := "host=" + viper.GetString("database.host") + " user=" + viper.GetString("database.user") + " password=" + viper.GetString("database.password") + " dbname=" + viper.GetString("database.name") + " port=" + viper.GetString("database.port") + " sslmode=disable"
+	cfg := config.Get().Database
+
+	dsn := "host=" + cfg.Host + " user=" + cfg.User + " password=" + cfg.Password + " dbname=" + cfg.Name + " port=" + cfg.Port + " sslmode=disable"
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
 	if err != nil {
-		log.Fatal(err)
+		utility.Errorln("Error in connecting to database:", err)
+		return nil, err
 	}
 
-	if viper.GetBool("database.migrate") {
-		Migrate(db)
+	if cfg.Migrate {
+		if err := Migrate(db); err != nil {
+			return nil, err
+		}
 	}
 
 	return &repository.Database{DbConn: db}, nil
 }
 
-func Migrate(db *gorm.DB) {
+func Migrate(db *gorm.DB) error {
 
 	err := db.AutoMigrate(
 		&repository.User{}, &repository.Note{}, &repository.Sharerecords{},
+		&repository.Authevent{}, &repository.Recoverycode{},
+		&repository.Accesstoken{}, &repository.Usedtoken{},
+		&repository.Export{}, &repository.Importjob{}, &repository.Attachment{},
+		&repository.Checklistitem{},
 	)
 	if err != nil {
-		log.Fatalln(err)
-		return
+		utility.Errorln("Error in migrating database:", err)
+		return err
 	}
 
+	// events recorded before they carried the user id are attributed by the
+	// username, which is all they have
+	db.Exec("UPDATE authevents SET userid = users.id FROM users WHERE authevents.userid = 0 AND authevents.username = users.username;")
+
 	db.Exec("CREATE EXTENSION btree_gin;")
 	db.Exec("CREATE INDEX idx ON notes USING GIN (userid, to_tsvector('english', note));")
+	db.Exec("CREATE INDEX idx_attachments_text ON attachments USING GIN (to_tsvector('english', text));")
+
+	return nil
+}
+
+func Reindex(db *gorm.DB) error {
+
+	for _, index := range []string{"idx", "idx_attachments_text"} {
+		err := db.Exec("REINDEX INDEX " + index + ";").Error
+		if err != nil {
+			utility.Errorln("Error in Rebuilding search index", index, err)
+			return err
+		}
+	}
 
+	return nil
 }
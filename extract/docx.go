@@ -0,0 +1,98 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// maxDocumentXML bounds how much of a DOCX file is decompressed, against
+// zip bombs.
+const maxDocumentXML = 64 << 20
+
+// docxParts are the parts of a Word document with text, in the order they
+// are read.
+var docxParts = []string{"word/document.xml", "word/footnotes.xml", "word/endnotes.xml"}
+
+// docxText returns the text of the paragraphs of a Word document. Zip
+// archives without a document are unsupported.
+func docxText(data []byte) (string, error) {
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", ErrUnsupported
+	}
+
+	files := map[string]*zip.File{}
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+	if files[docxParts[0]] == nil {
+		return "", ErrUnsupported
+	}
+
+	var b strings.Builder
+	for _, name := range docxParts {
+		file := files[name]
+		if file == nil {
+			continue
+		}
+		part, err := file.Open()
+		if err != nil {
+			return "", err
+		}
+		err = wordText(&b, io.LimitReader(part, maxDocumentXML))
+		part.Close()
+		if err != nil {
+			return "", err
+		}
+		if b.Len() > MaxText {
+			break
+		}
+	}
+
+	return b.String(), nil
+}
+
+// wordText writes the runs of text of WordprocessingML, with tabs, breaks
+// and the ends of paragraphs.
+func wordText(b *strings.Builder, r io.Reader) error {
+
+	decoder := xml.NewDecoder(r)
+	inText := false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			switch token.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				b.WriteString("\t")
+			case "br", "cr":
+				b.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch token.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				b.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				b.Write(token)
+			}
+		}
+	}
+}
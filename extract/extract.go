@@ -0,0 +1,134 @@
+// Package extract pulls the text out of attached files so they can be
+// searched. It reads plain text, Markdown, HTML, PDF and DOCX; formatting,
+// images and anything it does not understand are skipped.
+package extract
+
+import (
+	"NOTESBE/render"
+	"bytes"
+	"errors"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// MaxText is the most text returned for a file, in bytes. Postgres limits
+// full text search vectors to 1 MB.
+const MaxText = 256 << 10
+
+// ErrUnsupported is returned for files Text cannot read.
+var ErrUnsupported = errors.New("no text can be extracted from this type of file")
+
+const docxType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+
+// Supported reports whether Text may find text in files of the type. Zip
+// archives are included as DOCX files are sniffed as such.
+func Supported(mime string) bool {
+
+	switch baseType(mime) {
+	case "text/plain", "text/markdown", "text/html", "application/pdf", docxType, "application/zip":
+		return true
+	}
+
+	return false
+}
+
+func baseType(mime string) string {
+	base, _, _ := strings.Cut(mime, ";")
+	return strings.TrimSpace(strings.ToLower(base))
+}
+
+// Text returns the text of a file of the type. The name only tells
+// Markdown from other plain text.
+func Text(data []byte, mime, name string) (string, error) {
+
+	var text string
+	var err error
+
+	switch baseType(mime) {
+	case "text/plain", "text/markdown":
+		text = decodeText(data)
+		ext := strings.ToLower(path.Ext(name))
+		if baseType(mime) == "text/markdown" || ext == ".md" || ext == ".markdown" {
+			text = render.Text(text)
+		}
+	case "text/html":
+		text = htmlText(decodeText(data))
+	case "application/pdf":
+		text, err = pdfText(data)
+	case docxType, "application/zip":
+		text, err = docxText(data)
+	default:
+		err = ErrUnsupported
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return normalize(text), nil
+}
+
+// decodeText reads UTF-16 with a byte order mark and UTF-8, replacing
+// invalid bytes.
+func decodeText(data []byte) string {
+
+	var order func([]byte) uint16
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		order = func(b []byte) uint16 { return uint16(b[0])<<8 | uint16(b[1]) }
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		order = func(b []byte) uint16 { return uint16(b[1])<<8 | uint16(b[0]) }
+	default:
+		return strings.ToValidUTF8(string(bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))), "�")
+	}
+
+	units := make([]uint16, 0, len(data)/2)
+	for i := 2; i+1 < len(data); i += 2 {
+		units = append(units, order(data[i:]))
+	}
+
+	return string(utf16.Decode(units))
+}
+
+// normalize collapses runs of blanks and empty lines, drops control
+// characters Postgres does not store and cuts the text after MaxText bytes.
+func normalize(text string) string {
+
+	var b strings.Builder
+	blankLines := 0
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.FieldsFunc(line, func(r rune) bool {
+			return unicode.IsSpace(r) || unicode.IsControl(r)
+		}), " ")
+
+		if line == "" {
+			blankLines++
+			continue
+		}
+		separator := ""
+		if b.Len() > 0 {
+			separator = "\n"
+			if blankLines > 0 {
+				separator = "\n\n"
+			}
+		}
+		blankLines = 0
+
+		if room := MaxText - b.Len() - len(separator); len(line) > room {
+			if room > 0 {
+				line = line[:room]
+				for !utf8.ValidString(line) {
+					line = line[:len(line)-1]
+				}
+				b.WriteString(separator + line)
+			}
+			break
+		}
+		b.WriteString(separator + line)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,140 @@
+package extract
+
+import (
+	"NOTESBE/render"
+	"archive/zip"
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestText(t *testing.T) {
+
+	text, err := Text([]byte("\xEF\xBB\xBFShopping   list\r\n\n\n\nmilk\x00 eggs"), "text/plain; charset=utf-8", "list.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "Shopping list\n\nmilk eggs", text)
+
+	text, err = Text([]byte("# Plan\n\n* **buy** [seeds](https://example.com)\n"), "text/plain; charset=utf-8", "plan.md")
+	assert.NoError(t, err)
+	assert.Equal(t, "Plan\n\n- buy seeds (https://example.com)", text)
+
+	text, err = Text([]byte("\xFF\xFEh\x00i\x00"), "text/plain; charset=utf-16le", "hi.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "hi", text)
+
+	_, err = Text([]byte("GIF89a"), "image/gif", "a.gif")
+	assert.ErrorIs(t, err, ErrUnsupported)
+	assert.False(t, Supported("image/gif"))
+	assert.True(t, Supported("text/html; charset=utf-8"))
+}
+
+func TestHTML(t *testing.T) {
+
+	page := `<!DOCTYPE html><html><head><title>Recipes</title><style>p { color: red }</style>
+<script>var secret = "not text";</script></head>
+<body><!-- hidden --><h1>Pancakes &amp; syrup</h1><p>Mix <b>flour</b> and milk.<br>Fry.</p>
+<img src="a.png" alt="golden pancake"></body></html>`
+
+	text, err := Text([]byte(page), "text/html; charset=utf-8", "recipes.html")
+	assert.NoError(t, err)
+	assert.Equal(t, "Recipes\n\nPancakes & syrup\n\nMix flour and milk.\nFry.\n\ngolden pancake", text)
+}
+
+func TestDOCX(t *testing.T) {
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	part, _ := archive.Create("word/document.xml")
+	part.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:r><w:t>Quarterly</w:t></w:r><w:r><w:t xml:space="preserve"> report</w:t></w:r></w:p>
+<w:p><w:r><w:t>Revenue</w:t><w:tab/><w:t>42</w:t></w:r></w:p>
+</w:body></w:document>`))
+	archive.Close()
+
+	text, err := Text(buf.Bytes(), "application/zip", "report.docx")
+	assert.NoError(t, err)
+	assert.Equal(t, "Quarterly report\nRevenue 42", text)
+
+	buf.Reset()
+	archive = zip.NewWriter(&buf)
+	archive.Create("photo.jpg")
+	archive.Close()
+
+	_, err = Text(buf.Bytes(), "application/zip", "photos.zip")
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
+
+func TestPDF(t *testing.T) {
+
+	t.Run("rendered", func(t *testing.T) {
+
+		var buf bytes.Buffer
+		_, err := render.PDF(&buf, []render.Document{
+			{Title: "Trip", Text: "Pack the tent (green) and a café guide, палатка"},
+			{Title: "Second", Text: strings.Repeat("word ", 40)},
+		})
+		assert.NoError(t, err)
+
+		text, err := Text(buf.Bytes(), "application/pdf", "trip.pdf")
+		assert.NoError(t, err)
+		assert.Contains(t, text, "Trip\n")
+		assert.Contains(t, text, "Pack the tent (green) and a café guide, палатка")
+		assert.Less(t, strings.Index(text, "café"), strings.Index(text, "Second"), "pages are in order")
+	})
+
+	t.Run("ToUnicode", func(t *testing.T) {
+
+		cmap := `/CIDInit /ProcSet findresource begin 12 dict begin begincmap
+1 begincodespacerange <0000> <FFFF> endcodespacerange
+2 beginbfchar <0003> <0020> <0010> <00DF> endbfchar
+1 beginbfrange <0024> <0026> <0061> endbfrange
+endcmap CMapName currentdict /CMap defineresource pop end end`
+		content := `BT /F1 12 Tf 72 700 Td <002400250003> Tj 0 -14 Td [<0026> -300 <0010>] TJ ET`
+
+		pdf := "%PDF-1.4\n" +
+			"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+			"2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 >> endobj\n" +
+			"3 0 obj << /Type /Page /Parent 2 0 R /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >> endobj\n" +
+			"4 0 obj << /Type /Font /Subtype /Type0 /BaseFont /Sans /Encoding /Identity-H /ToUnicode 6 0 R >> endobj\n" +
+			"5 0 obj << /Length " + strconv.Itoa(len(content)) + " >>\nstream\n" + content + "\nendstream endobj\n" +
+			"6 0 obj << /Length " + strconv.Itoa(len(cmap)) + " >>\nstream\n" + cmap + "\nendstream endobj\n" +
+			"trailer << /Root 1 0 R >>\n%%EOF\n"
+
+		text, err := Text([]byte(pdf), "application/pdf", "cmap.pdf")
+		assert.NoError(t, err)
+		assert.Equal(t, "ab\nc ß", text)
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+
+		content := `BT /F1 12 Tf (kept) Tj ET`
+		pages := "1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+			"2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 >> endobj\n" +
+			"3 0 obj << /Type /Page /Parent 2 0 R /Resources << /Font << /F1 7 0 R >> >> /Contents 4 0 R >> endobj\n"
+
+		stream := "4 0 obj << /Length " + strconv.Itoa(len(content)) + " >>\nstream\n" + content + "\nendstream endobj\n"
+
+		cases := []struct {
+			name, pdf, text string
+		}{
+			{"huge length", "4 0 obj << /Length 1e30 >>\nstream\n" + content + "\nendstream endobj\n", "kept"},
+			{"fraction length", "4 0 obj << /Length 3.5 >>\nstream\n" + content + "\nendstream endobj\n", "kept"},
+			{"negative first", stream + "5 0 obj << /Type /ObjStm /N 1 /First -50 /Length 4 >>\nstream\n6 0 \nendstream endobj\n", "kept"},
+			// the font maps no code of the content, so there is no text
+			{"bfrange at the last code", stream + "7 0 obj << /Type /Font /Subtype /Type1 /ToUnicode 6 0 R >> endobj\n" +
+				"6 0 obj << /Length 60 >>\nstream\n1 beginbfrange <FFFFFFFE> <FFFFFFFF> <0061> endbfrange\nendstream endobj\n", ""},
+		}
+
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				text, err := Text([]byte("%PDF-1.4\n"+pages+c.pdf+"trailer << /Root 1 0 R >>\n%%EOF\n"), "application/pdf", "bad.pdf")
+				assert.NoError(t, err)
+				assert.Equal(t, c.text, text)
+			})
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package extract
+
+import (
+	"html"
+	"strings"
+)
+
+// blockTags end a line of text.
+var blockTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"br": true, "dd": true, "div": true, "dl": true, "dt": true,
+	"figcaption": true, "footer": true, "form": true, "h1": true,
+	"h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hr": true, "li": true, "main": true, "nav": true,
+	"ol": true, "p": true, "pre": true, "section": true, "table": true,
+	"td": true, "th": true, "title": true, "tr": true, "ul": true,
+}
+
+// htmlText drops the tags, comments, scripts and styles of an HTML
+// document and decodes its character references.
+func htmlText(source string) string {
+
+	var b strings.Builder
+
+	for len(source) > 0 {
+		start := strings.IndexByte(source, '<')
+		if start < 0 {
+			b.WriteString(html.UnescapeString(source))
+			break
+		}
+		b.WriteString(html.UnescapeString(source[:start]))
+		source = source[start:]
+
+		if strings.HasPrefix(source, "<!--") {
+			end := strings.Index(source, "-->")
+			if end < 0 {
+				break
+			}
+			source = source[end+3:]
+			continue
+		}
+
+		end := strings.IndexByte(source, '>')
+		if end < 0 {
+			break
+		}
+		tag := source[1:end]
+		source = source[end+1:]
+
+		name := strings.ToLower(strings.TrimPrefix(tag, "/"))
+		if i := strings.IndexAny(name, " \t\r\n/"); i >= 0 {
+			name = name[:i]
+		}
+
+		if (name == "script" || name == "style") && !strings.HasPrefix(tag, "/") {
+			// their content is no text, skip it up to the closing tag
+			closing := strings.Index(strings.ToLower(source), "</"+name)
+			if closing < 0 {
+				break
+			}
+			source = source[closing:]
+			continue
+		}
+
+		if blockTags[name] {
+			b.WriteString("\n")
+		} else if name == "img" {
+			// the alternative text of images is searched too
+			if alt := attribute(tag, "alt"); alt != "" {
+				b.WriteString(" " + alt + " ")
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// attribute returns the unescaped value of an attribute of a tag.
+func attribute(tag, name string) string {
+
+	lower := strings.ToLower(tag)
+	for offset := 0; ; {
+		i := strings.Index(lower[offset:], name+"=")
+		if i < 0 {
+			return ""
+		}
+		i += offset
+		offset = i + len(name) + 1
+		if i > 0 && !strings.ContainsRune(" \t\r\n", rune(lower[i-1])) {
+			continue
+		}
+
+		value := tag[offset:]
+		if len(value) > 0 && (value[0] == '"' || value[0] == '\'') {
+			quote := value[0]
+			value = value[1:]
+			if end := strings.IndexByte(value, quote); end >= 0 {
+				value = value[:end]
+			}
+		} else if end := strings.IndexAny(value, " \t\r\n"); end >= 0 {
+			value = value[:end]
+		}
+
+		return html.UnescapeString(value)
+	}
+}
@@ -0,0 +1,838 @@
+package extract
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// The PDF reader finds objects by scanning for "n g obj" rather than
+// trusting the cross reference table, which is often broken, and reads
+// objects in object streams. Text is taken from the text operators of the
+// page content streams and decoded with the ToUnicode map of the font, or
+// as WinAnsi for simple fonts without one. Filters other than Flate and
+// text in form XObjects are skipped.
+
+// maxStream bounds how much a single stream is inflated to.
+const maxStream = 64 << 20
+
+// pdfName is a /Name, pdfRef an indirect reference and pdfOp a keyword,
+// operator or delimiter. Numbers are float64, strings []byte, arrays
+// []interface{} and dictionaries map[string]interface{}.
+type (
+	pdfName string
+	pdfRef  int
+	pdfOp   string
+)
+
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isWhite(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (l *pdfLexer) skipSpace() {
+
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isWhite(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// token returns the next token, false at the end of the data.
+func (l *pdfLexer) token() (interface{}, bool) {
+
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, false
+	}
+
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		l.pos++
+		return pdfName(l.name()), true
+	case c == '(':
+		l.pos++
+		return l.literal(), true
+	case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		l.pos += 2
+		return pdfOp("<<"), true
+	case c == '>' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '>':
+		l.pos += 2
+		return pdfOp(">>"), true
+	case c == '<':
+		l.pos++
+		return l.hex(), true
+	case isDelimiter(c):
+		l.pos++
+		return pdfOp(c), true
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isWhite(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+
+	if strings.IndexByte("+-.0123456789", word[0]) >= 0 {
+		if number, err := strconv.ParseFloat(word, 64); err == nil {
+			return number, true
+		}
+	}
+
+	return pdfOp(word), true
+}
+
+func (l *pdfLexer) name() string {
+
+	var b []byte
+	for l.pos < len(l.data) && !isWhite(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '#' && l.pos+2 <= len(l.data) {
+			if value, err := strconv.ParseUint(string(l.data[l.pos:l.pos+2]), 16, 8); err == nil {
+				c = byte(value)
+				l.pos += 2
+			}
+		}
+		b = append(b, c)
+	}
+
+	return string(b)
+}
+
+func (l *pdfLexer) literal() []byte {
+
+	var b []byte
+	depth := 1
+
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return b
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return b
+			}
+			c = l.data[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			}
+			if c >= '0' && c <= '7' {
+				value := int(c - '0')
+				for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+					value = value*8 + int(l.data[l.pos]-'0')
+					l.pos++
+				}
+				c = byte(value)
+			}
+		}
+		b = append(b, c)
+	}
+
+	return b
+}
+
+func (l *pdfLexer) hex() []byte {
+
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if c := l.data[l.pos]; strings.IndexByte("0123456789abcdefABCDEF", c) >= 0 {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	l.pos++
+
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	b := make([]byte, len(digits)/2)
+	for i := range b {
+		value, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		b[i] = byte(value)
+	}
+
+	return b
+}
+
+// value parses the object that starts with tok.
+func (l *pdfLexer) value(tok interface{}, depth int) interface{} {
+
+	if depth > 64 {
+		return nil
+	}
+
+	switch tok := tok.(type) {
+	case float64:
+		// "n g R" is a reference
+		save := l.pos
+		generation, ok := l.token()
+		if _, isNumber := generation.(float64); ok && isNumber {
+			if r, ok := l.token(); ok && r == pdfOp("R") {
+				return pdfRef(tok)
+			}
+		}
+		l.pos = save
+		return tok
+
+	case pdfOp:
+		switch tok {
+		case "[":
+			array := []interface{}{}
+			for {
+				next, ok := l.token()
+				if !ok || next == pdfOp("]") {
+					return array
+				}
+				array = append(array, l.value(next, depth+1))
+			}
+		case "<<":
+			dict := map[string]interface{}{}
+			for {
+				next, ok := l.token()
+				if !ok || next == pdfOp(">>") {
+					return dict
+				}
+				key, isName := next.(pdfName)
+				if !isName {
+					continue
+				}
+				next, ok = l.token()
+				if !ok {
+					return dict
+				}
+				dict[string(key)] = l.value(next, depth+1)
+			}
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+	}
+
+	return tok
+}
+
+type pdfObject struct {
+	value  interface{}
+	stream []byte
+}
+
+type pdfFont struct {
+	// width is the number of bytes of a character code
+	width int
+	// toUnicode maps character codes to text, nil for simple fonts
+	// without a map
+	toUnicode map[uint32]string
+	// composite fonts without a map cannot be read
+	composite bool
+}
+
+type pdfDoc struct {
+	objects map[int]*pdfObject
+	fonts   map[pdfRef]*pdfFont
+}
+
+var objectHeader = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+
+func pdfText(data []byte) (string, error) {
+
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("%PDF-")) {
+		return "", ErrUnsupported
+	}
+
+	doc := &pdfDoc{objects: map[int]*pdfObject{}, fonts: map[pdfRef]*pdfFont{}}
+	doc.scan(data)
+
+	var out textWriter
+	for _, page := range doc.pages() {
+		doc.pageText(&out, page)
+		out.newline()
+		if out.Len() > MaxText {
+			break
+		}
+	}
+
+	return out.String(), nil
+}
+
+// scan reads every object of the file. Later definitions replace earlier
+// ones, as in incremental updates.
+func (d *pdfDoc) scan(data []byte) {
+
+	for _, match := range objectHeader.FindAllSubmatchIndex(data, -1) {
+		number, err := strconv.Atoi(string(data[match[2]:match[3]]))
+		if err != nil {
+			continue
+		}
+
+		l := &pdfLexer{data: data, pos: match[1]}
+		tok, ok := l.token()
+		if !ok {
+			continue
+		}
+		object := &pdfObject{value: l.value(tok, 0)}
+
+		if tok, ok := l.token(); ok && tok == pdfOp("stream") {
+			start := l.pos
+			if start < len(data) && data[start] == '\r' {
+				start++
+			}
+			if start < len(data) && data[start] == '\n' {
+				start++
+			}
+
+			end := -1
+			if dict, ok := object.value.(map[string]interface{}); ok {
+				// lengths that are no integers or past the end of the file
+				// would overflow int
+				if length, ok := dict["Length"].(float64); ok && length >= 0 && length == math.Trunc(length) && length <= float64(len(data)-start) {
+					if bytes.Contains(data[start+int(length):minInt(len(data), start+int(length)+32)], []byte("endstream")) {
+						end = start + int(length)
+					}
+				}
+			}
+			if end < 0 {
+				if i := bytes.Index(data[start:], []byte("endstream")); i >= 0 {
+					end = start + i
+				} else {
+					end = len(data)
+				}
+			}
+			object.stream = data[start:end]
+		}
+
+		d.objects[number] = object
+	}
+
+	// objects in object streams, which never hold streams themselves
+	for _, object := range d.objects {
+		dict, ok := object.value.(map[string]interface{})
+		if !ok || dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+		content := d.decode(object)
+		count, _ := d.resolve(dict["N"]).(float64)
+		first, _ := d.resolve(dict["First"]).(float64)
+
+		l := &pdfLexer{data: content}
+		for i := 0; i < int(count); i++ {
+			number, ok1 := l.token()
+			offset, ok2 := l.token()
+			n, isNumber := number.(float64)
+			o, isOffset := offset.(float64)
+			if !ok1 || !ok2 || !isNumber || !isOffset {
+				break
+			}
+			if _, exists := d.objects[int(n)]; exists || first+o < 0 || first+o >= float64(len(content)) {
+				continue
+			}
+
+			value := &pdfLexer{data: content, pos: int(first + o)}
+			if tok, ok := value.token(); ok {
+				d.objects[int(n)] = &pdfObject{value: value.value(tok, 0)}
+			}
+		}
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// resolve follows references.
+func (d *pdfDoc) resolve(v interface{}) interface{} {
+
+	for i := 0; i < 32; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		object := d.objects[int(ref)]
+		if object == nil {
+			return nil
+		}
+		v = object.value
+	}
+
+	return nil
+}
+
+func (d *pdfDoc) dict(v interface{}) map[string]interface{} {
+	dict, _ := d.resolve(v).(map[string]interface{})
+	return dict
+}
+
+// decode returns the content of a stream, nil for unsupported filters.
+func (d *pdfDoc) decode(object *pdfObject) []byte {
+
+	dict, _ := object.value.(map[string]interface{})
+
+	var filters []interface{}
+	switch filter := d.resolve(dict["Filter"]).(type) {
+	case pdfName:
+		filters = []interface{}{filter}
+	case []interface{}:
+		filters = filter
+	}
+
+	data := object.stream
+	for _, filter := range filters {
+		if d.resolve(filter) != pdfName("FlateDecode") {
+			return nil
+		}
+		data = inflate(data)
+	}
+
+	return data
+}
+
+// inflate decompresses zlib or raw deflate data, keeping what was read
+// before an error as broken streams are common.
+func inflate(data []byte) []byte {
+
+	var r io.Reader
+	if z, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+		r = z
+	} else {
+		r = flate.NewReader(bytes.NewReader(data))
+	}
+
+	var out bytes.Buffer
+	io.Copy(&out, io.LimitReader(r, maxStream))
+
+	return out.Bytes()
+}
+
+// pages returns the pages in the order of the page tree, or of their
+// object numbers when there is no tree.
+func (d *pdfDoc) pages() []map[string]interface{} {
+
+	var pages []map[string]interface{}
+	visited := map[pdfRef]bool{}
+
+	var walk func(node interface{}, depth int)
+	walk = func(node interface{}, depth int) {
+		if ref, ok := node.(pdfRef); ok {
+			if visited[ref] {
+				return
+			}
+			visited[ref] = true
+		}
+		dict := d.dict(node)
+		if dict == nil || depth > 64 {
+			return
+		}
+		switch dict["Type"] {
+		case pdfName("Page"):
+			pages = append(pages, dict)
+		case pdfName("Pages"):
+			kids, _ := d.resolve(dict["Kids"]).([]interface{})
+			for _, kid := range kids {
+				walk(kid, depth+1)
+			}
+		}
+	}
+
+	numbers := make([]int, 0, len(d.objects))
+	for number := range d.objects {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	for _, number := range numbers {
+		dict, ok := d.objects[number].value.(map[string]interface{})
+		if ok && dict["Type"] == pdfName("Pages") && dict["Parent"] == nil {
+			walk(pdfRef(number), 0)
+		}
+	}
+
+	if len(pages) == 0 {
+		for _, number := range numbers {
+			dict, ok := d.objects[number].value.(map[string]interface{})
+			if ok && dict["Type"] == pdfName("Page") {
+				pages = append(pages, dict)
+			}
+		}
+	}
+
+	return pages
+}
+
+// font reads a font and its ToUnicode map.
+func (d *pdfDoc) font(v interface{}) *pdfFont {
+
+	ref, isRef := v.(pdfRef)
+	if font, ok := d.fonts[ref]; isRef && ok {
+		return font
+	}
+
+	font := &pdfFont{width: 1}
+	dict := d.dict(v)
+	if dict["Subtype"] == pdfName("Type0") {
+		font.width = 2
+		font.composite = true
+	}
+
+	if ref, ok := dict["ToUnicode"].(pdfRef); ok {
+		if object := d.objects[int(ref)]; object != nil {
+			parseCMap(d.decode(object), font)
+		}
+	}
+
+	if isRef {
+		d.fonts[ref] = font
+	}
+
+	return font
+}
+
+// parseCMap reads the character code space and the bfchar and bfrange
+// mappings of a ToUnicode CMap.
+func parseCMap(data []byte, font *pdfFont) {
+
+	font.toUnicode = map[uint32]string{}
+
+	l := &pdfLexer{data: data}
+	var operands []interface{}
+
+	for {
+		tok, ok := l.token()
+		if !ok {
+			return
+		}
+
+		op, isOp := tok.(pdfOp)
+		if !isOp || op == "[" {
+			operands = append(operands, l.value(tok, 0))
+			continue
+		}
+
+		switch op {
+		case "endcodespacerange":
+			if len(operands) > 0 {
+				if low, ok := operands[0].([]byte); ok && len(low) >= 1 && len(low) <= 4 {
+					font.width = len(low)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				code, ok1 := operands[i].([]byte)
+				text, ok2 := operands[i+1].([]byte)
+				if ok1 && ok2 {
+					font.toUnicode[codeOf(code)] = utf16Text(text)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				low, ok1 := operands[i].([]byte)
+				high, ok2 := operands[i+1].([]byte)
+				if !ok1 || !ok2 || codeOf(high) < codeOf(low) || codeOf(high)-codeOf(low) > 0xFFFF {
+					continue
+				}
+				// counted by offset, as the code can be the largest uint32
+				for offset := uint32(0); offset <= codeOf(high)-codeOf(low); offset++ {
+					code := codeOf(low) + offset
+					switch target := operands[i+2].(type) {
+					case []byte:
+						font.toUnicode[code] = utf16Text(increment(target, offset))
+					case []interface{}:
+						if int(offset) < len(target) {
+							if text, ok := target[offset].([]byte); ok {
+								font.toUnicode[code] = utf16Text(text)
+							}
+						}
+					}
+				}
+			}
+		}
+		operands = nil
+	}
+}
+
+func codeOf(b []byte) uint32 {
+
+	var code uint32
+	for _, c := range b {
+		code = code<<8 | uint32(c)
+	}
+
+	return code
+}
+
+// increment adds offset to the last UTF-16 unit of text.
+func increment(text []byte, offset uint32) []byte {
+
+	if len(text) < 2 {
+		return text
+	}
+	out := append([]byte(nil), text...)
+	last := (uint32(out[len(out)-2])<<8 | uint32(out[len(out)-1])) + offset
+	out[len(out)-2], out[len(out)-1] = byte(last>>8), byte(last)
+
+	return out
+}
+
+func utf16Text(b []byte) string {
+
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+
+	return string(utf16.Decode(units))
+}
+
+// winAnsi are the characters of Windows-1252 that differ from Latin-1.
+var winAnsi = map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†',
+	0x87: '‡', 0x88: 'ˆ', 0x89: '‰', 0x8A: 'Š', 0x8B: '‹', 0x8C: 'Œ',
+	0x8E: 'Ž', 0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•',
+	0x96: '–', 0x97: '—', 0x98: '˜', 0x99: '™', 0x9A: 'š', 0x9B: '›',
+	0x9C: 'œ', 0x9E: 'ž', 0x9F: 'Ÿ',
+}
+
+func (f *pdfFont) text(s []byte) string {
+
+	var b strings.Builder
+
+	if f.toUnicode == nil {
+		if f.composite {
+			return ""
+		}
+		for _, c := range s {
+			if r, ok := winAnsi[c]; ok {
+				b.WriteRune(r)
+			} else {
+				b.WriteRune(rune(c))
+			}
+		}
+		return b.String()
+	}
+
+	for i := 0; i+f.width <= len(s); i += f.width {
+		b.WriteString(f.toUnicode[codeOf(s[i:i+f.width])])
+	}
+
+	return b.String()
+}
+
+// contents returns the concatenated content streams of a page.
+func (d *pdfDoc) contents(page map[string]interface{}) []byte {
+
+	var streams []interface{}
+	switch contents := page["Contents"].(type) {
+	case pdfRef:
+		if array, ok := d.resolve(contents).([]interface{}); ok {
+			streams = array
+		} else {
+			streams = []interface{}{contents}
+		}
+	case []interface{}:
+		streams = contents
+	}
+
+	var out []byte
+	for _, stream := range streams {
+		ref, ok := stream.(pdfRef)
+		if !ok || d.objects[int(ref)] == nil {
+			continue
+		}
+		out = append(out, d.decode(d.objects[int(ref)])...)
+		out = append(out, '\n')
+	}
+
+	return out
+}
+
+// pageFonts returns the fonts of a page by resource name, inheriting the
+// resources of the page tree.
+func (d *pdfDoc) pageFonts(page map[string]interface{}) map[string]*pdfFont {
+
+	fonts := map[string]*pdfFont{}
+
+	node := page
+	for i := 0; node != nil && i < 32; i++ {
+		if resources := d.dict(node["Resources"]); resources != nil {
+			for name, font := range d.dict(resources["Font"]) {
+				fonts[name] = d.font(font)
+			}
+			break
+		}
+		node = d.dict(node["Parent"])
+	}
+
+	return fonts
+}
+
+type textWriter struct {
+	strings.Builder
+}
+
+func (w *textWriter) last() byte {
+	s := w.String()
+	if s == "" {
+		return '\n'
+	}
+	return s[len(s)-1]
+}
+
+func (w *textWriter) newline() {
+	if w.last() != '\n' {
+		w.WriteByte('\n')
+	}
+}
+
+func (w *textWriter) space() {
+	if last := w.last(); last != ' ' && last != '\n' {
+		w.WriteByte(' ')
+	}
+}
+
+// pageText runs the text operators of the content of a page.
+func (d *pdfDoc) pageText(out *textWriter, page map[string]interface{}) {
+
+	fonts := d.pageFonts(page)
+	font := &pdfFont{width: 1}
+	lineY, haveLine := 0.0, false
+
+	l := &pdfLexer{data: d.contents(page)}
+	var operands []interface{}
+
+	for out.Len() <= MaxText {
+		tok, ok := l.token()
+		if !ok {
+			return
+		}
+
+		op, isOp := tok.(pdfOp)
+		if !isOp || op == "[" || op == "<<" {
+			operands = append(operands, l.value(tok, 0))
+			continue
+		}
+
+		number := func(i int) float64 {
+			if i < len(operands) {
+				n, _ := operands[i].(float64)
+				return n
+			}
+			return 0
+		}
+		show := func(operand interface{}) {
+			if s, ok := operand.([]byte); ok {
+				out.WriteString(font.text(s))
+			}
+		}
+
+		switch op {
+		case "Tf":
+			if len(operands) > 0 {
+				if name, ok := operands[0].(pdfName); ok && fonts[string(name)] != nil {
+					font = fonts[string(name)]
+				}
+			}
+		case "Tj":
+			if len(operands) > 0 {
+				show(operands[0])
+			}
+		case "'":
+			out.newline()
+			if len(operands) > 0 {
+				show(operands[0])
+			}
+		case "\"":
+			out.newline()
+			if len(operands) > 2 {
+				show(operands[2])
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				array, _ := operands[0].([]interface{})
+				for _, item := range array {
+					if n, ok := item.(float64); ok && n < -200 {
+						out.space()
+					}
+					show(item)
+				}
+			}
+		case "Td", "TD":
+			if number(1) != 0 {
+				out.newline()
+			}
+		case "T*":
+			out.newline()
+		case "Tm":
+			if y := number(5); !haveLine || y != lineY {
+				out.newline()
+				lineY, haveLine = y, true
+			} else {
+				out.space()
+			}
+		case "ET":
+			out.space()
+		case "ID":
+			// inline image data up to EI
+			if end := bytes.Index(l.data[l.pos:], []byte("EI")); end >= 0 {
+				l.pos += end + 2
+			} else {
+				return
+			}
+		}
+		operands = nil
+	}
+}
@@ -0,0 +1,158 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testImage(width, height int) *image.NRGBA {
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+
+	return img
+}
+
+// exifSegment is an APP1 segment with the orientation and, standing in for
+// a GPS position, a string no stripped image may contain.
+func exifSegment(orientation int) []byte {
+
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	tiff = append(tiff, 0x12, 0x01, 3, 0, 1, 0, 0, 0, byte(orientation), 0, 0, 0)
+	tiff = append(tiff, 0, 0, 0, 0)
+	tiff = append(tiff, "GPS 52.5200N 13.4050E"...)
+
+	data := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(data)+2))
+
+	return append(segment, data...)
+}
+
+func testJPEG(t *testing.T, width, height, orientation int) []byte {
+
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, testImage(width, height), nil))
+	encoded := buf.Bytes()
+
+	comment := []byte{0xFF, 0xFE, 0, 12}
+	comment = append(comment, "Owner Bob"...)
+	comment = append(comment, 0)
+
+	data := append([]byte{0xFF, 0xD8}, exifSegment(orientation)...)
+	data = append(data, comment...)
+	data = append(data, encoded[2:]...)
+	// a second image of a multi-picture file, with its own EXIF
+	data = append(data, 0xFF, 0xD8)
+	data = append(data, exifSegment(orientation)...)
+
+	return data
+}
+
+func TestStripJPEG(t *testing.T) {
+
+	data := testJPEG(t, 40, 30, 6)
+
+	var out bytes.Buffer
+	assert.NoError(t, Strip(&out, bytes.NewReader(data), "image/jpeg"))
+
+	assert.NotContains(t, out.String(), "GPS")
+	assert.NotContains(t, out.String(), "Owner Bob")
+	assert.Equal(t, 6, Orientation(out.Bytes()), "the orientation is kept")
+	assert.True(t, bytes.HasSuffix(out.Bytes(), []byte{0xFF, 0xD9}))
+
+	img, err := jpeg.Decode(bytes.NewReader(out.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 40, 30), img.Bounds())
+
+	err = Strip(&out, bytes.NewReader([]byte("\xFF\xD8\xFF\xE1\x00")), "image/jpeg")
+	assert.ErrorIs(t, err, ErrFormat)
+}
+
+func TestStripPNG(t *testing.T) {
+
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, testImage(8, 8)))
+	encoded := buf.Bytes()
+
+	text := []byte("Comment\x00taken at home")
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(text)))
+	chunk = append(chunk, "tEXt"...)
+	chunk = append(chunk, text...)
+	chunk = append(chunk, 0, 0, 0, 0)
+
+	// the text goes after IHDR, which is 8 + 4 + 4 + 13 + 4 bytes into the file
+	data := append(append(append([]byte(nil), encoded[:33]...), chunk...), encoded[33:]...)
+
+	var out bytes.Buffer
+	assert.NoError(t, Strip(&out, bytes.NewReader(data), "image/png"))
+	assert.NotContains(t, out.String(), "taken at home")
+	assert.Equal(t, encoded, out.Bytes())
+}
+
+func TestStripWebP(t *testing.T) {
+
+	chunk := func(fourcc string, data string) []byte {
+		c := append([]byte(fourcc), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+		c = append(c, data...)
+		if len(data)%2 == 1 {
+			c = append(c, 0)
+		}
+		return c
+	}
+	riff := func(chunks ...[]byte) []byte {
+		body := []byte("WEBP")
+		for _, c := range chunks {
+			body = append(body, c...)
+		}
+		return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...), body...)
+	}
+
+	data := riff(chunk("VP8X", "\x0c\x00\x00\x00\x07\x00\x00\x07\x00\x00"), chunk("VP8L", "pixels"), chunk("EXIF", "GPS"), chunk("XMP ", "<x/>"))
+
+	var out bytes.Buffer
+	assert.NoError(t, Strip(&out, bytes.NewReader(data), "image/webp"))
+	assert.Equal(t, riff(chunk("VP8X", "\x00\x00\x00\x00\x07\x00\x00\x07\x00\x00"), chunk("VP8L", "pixels")), out.Bytes())
+}
+
+func TestThumbnails(t *testing.T) {
+
+	var stripped bytes.Buffer
+	assert.NoError(t, Strip(&stripped, bytes.NewReader(testJPEG(t, 400, 200, 6)), "image/jpeg"))
+
+	thumbs, err := Thumbnails(stripped.Bytes(), []int{100, 1000})
+	assert.NoError(t, err)
+
+	small, err := jpeg.Decode(bytes.NewReader(thumbs[100]))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 50, 100), small.Bounds(), "turned upright")
+	assert.Equal(t, 1, Orientation(thumbs[100]))
+
+	large, err := jpeg.Decode(bytes.NewReader(thumbs[1000]))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 200, 400), large.Bounds(), "small images are not enlarged")
+
+	transparent := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, transparent))
+	thumbs, err = Thumbnails(buf.Bytes(), []int{10})
+	assert.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(thumbs[10]))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 10, 5), img.Bounds())
+
+	_, err = Thumbnails([]byte("\x89PNG\r\n\x1a\n"), []int{10})
+	assert.ErrorIs(t, err, ErrFormat)
+}
@@ -0,0 +1,415 @@
+// Package imaging removes metadata from uploaded images and scales them
+// down to thumbnails, using only the standard library.
+package imaging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrFormat is returned for images whose structure cannot be read.
+var ErrFormat = errors.New("malformed image")
+
+// CanStrip reports whether Strip removes metadata from images of the type.
+func CanStrip(mime string) bool {
+	return mime == "image/jpeg" || mime == "image/png" || mime == "image/webp"
+}
+
+// Strip copies the image in r to w without the metadata a camera or editor
+// may have stored in it: EXIF with GPS positions and serial numbers, XMP,
+// IPTC, comments and text chunks. Pixel data is copied as is. The EXIF
+// orientation of a JPEG is kept so the photo is still shown upright.
+// Images of other types are copied unchanged.
+func Strip(w io.Writer, r io.Reader, mime string) error {
+
+	out := bufio.NewWriter(w)
+
+	var err error
+	switch mime {
+	case "image/jpeg":
+		err = stripJPEG(out, bufio.NewReader(r))
+	case "image/png":
+		err = stripPNG(out, r)
+	case "image/webp":
+		err = stripWebP(out, r)
+	default:
+		_, err = io.Copy(out, r)
+	}
+	if err != nil {
+		return err
+	}
+
+	return out.Flush()
+}
+
+func formatError(format string, a ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrFormat, fmt.Sprintf(format, a...))
+}
+
+// truncated turns the end of the input in the middle of a structure into
+// ErrFormat and passes on errors of the reader.
+func truncated(err error, what string) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return formatError("truncated %s", what)
+	}
+	return err
+}
+
+const (
+	markerSOI   = 0xD8
+	markerEOI   = 0xD9
+	markerSOS   = 0xDA
+	markerAPP0  = 0xE0
+	markerAPP1  = 0xE1
+	markerAPP2  = 0xE2
+	markerAPP14 = 0xEE
+	markerAPP15 = 0xEF
+	markerCOM   = 0xFE
+)
+
+// keepSegment reports whether a JPEG segment is needed to show the image.
+// Of the application segments only JFIF, ICC colour profiles and the Adobe
+// colour transform are; multi-picture indexes go as the images they point
+// to after the end of the first one are dropped.
+func keepSegment(marker byte, data []byte) bool {
+
+	switch {
+	case marker == markerCOM:
+		return false
+	case marker == markerAPP0:
+		return bytes.HasPrefix(data, []byte("JFIF\x00")) || bytes.HasPrefix(data, []byte("JFXX\x00"))
+	case marker == markerAPP2:
+		return bytes.HasPrefix(data, []byte("ICC_PROFILE\x00"))
+	case marker == markerAPP14:
+		return bytes.HasPrefix(data, []byte("Adobe"))
+	case marker >= markerAPP0 && marker <= markerAPP15:
+		return false
+	}
+
+	return true
+}
+
+func stripJPEG(w *bufio.Writer, r *bufio.Reader) error {
+
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil {
+		return truncated(err, "JPEG")
+	}
+	if soi != [2]byte{0xFF, markerSOI} {
+		return formatError("not a JPEG")
+	}
+	w.Write(soi[:])
+
+	orientationWritten := false
+	inScan := false
+
+	for {
+		var marker byte
+		var err error
+		if inScan {
+			marker, err = copyScan(w, r)
+			if err == io.EOF {
+				// a truncated scan still shows most of the image
+				return nil
+			}
+		} else {
+			marker, err = readMarker(r)
+		}
+		if err != nil {
+			return truncated(err, "JPEG")
+		}
+
+		switch {
+		case marker == markerEOI:
+			// whatever follows, such as the images of a multi-picture
+			// file with their own EXIF, is dropped
+			w.Write([]byte{0xFF, markerEOI})
+			return nil
+		case marker >= 0xD0 && marker <= 0xD7 || marker == 0x01:
+			w.Write([]byte{0xFF, marker})
+			continue
+		}
+
+		var length [2]byte
+		if _, err := io.ReadFull(r, length[:]); err != nil {
+			return truncated(err, "JPEG")
+		}
+		size := int(binary.BigEndian.Uint16(length[:]))
+		if size < 2 {
+			return formatError("JPEG segment of %d bytes", size)
+		}
+		data := make([]byte, size-2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return truncated(err, "JPEG")
+		}
+
+		if marker == markerAPP1 && !orientationWritten && bytes.HasPrefix(data, []byte("Exif\x00\x00")) {
+			orientationWritten = true
+			if o := exifOrientation(data[6:]); o > 1 {
+				w.Write(orientationSegment(o))
+			}
+		}
+		if !keepSegment(marker, data) {
+			continue
+		}
+
+		w.Write([]byte{0xFF, marker})
+		w.Write(length[:])
+		w.Write(data)
+
+		inScan = marker == markerSOS
+	}
+}
+
+// readMarker reads the next marker, skipping the fill bytes before it.
+func readMarker(r *bufio.Reader) (byte, error) {
+
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b != 0xFF {
+		return 0, formatError("JPEG marker expected, found %#x", b)
+	}
+	for b == 0xFF {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+
+	return b, nil
+}
+
+// copyScan copies entropy coded data up to the next marker that is not a
+// restart, and returns that marker.
+func copyScan(w *bufio.Writer, r *bufio.Reader) (byte, error) {
+
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != 0xFF {
+			if err := w.WriteByte(b); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		for b == 0xFF {
+			if b, err = r.ReadByte(); err != nil {
+				return 0, err
+			}
+		}
+		if b == 0x00 || b >= 0xD0 && b <= 0xD7 {
+			w.Write([]byte{0xFF, b})
+			continue
+		}
+
+		return b, nil
+	}
+}
+
+// exifOrientation returns the orientation tag of the first IFD of a TIFF
+// structure, or 0 when there is none.
+func exifOrientation(tiff []byte) int {
+
+	if len(tiff) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + 12*i
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			o := int(order.Uint16(tiff[entry+8:]))
+			if o < 1 || o > 8 {
+				return 0
+			}
+			return o
+		}
+	}
+
+	return 0
+}
+
+// orientationSegment is an APP1 segment with EXIF that holds nothing but
+// the orientation.
+func orientationSegment(orientation int) []byte {
+
+	segment := []byte{
+		0xFF, markerAPP1, 0, 34,
+		'E', 'x', 'i', 'f', 0, 0,
+		'M', 'M', 0, 42, 0, 0, 0, 8,
+		0, 1, // one entry
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, byte(orientation), 0, 0,
+		0, 0, 0, 0, // no further IFD
+	}
+
+	return segment
+}
+
+// Orientation returns the EXIF orientation of a JPEG, 1 to 8, or 1 when it
+// has none.
+func Orientation(data []byte) int {
+
+	if !bytes.HasPrefix(data, []byte{0xFF, markerSOI}) {
+		return 1
+	}
+
+	r := bufio.NewReader(bytes.NewReader(data[2:]))
+	for {
+		marker, err := readMarker(r)
+		if err != nil || marker == markerSOS || marker == markerEOI {
+			return 1
+		}
+		if marker >= 0xD0 && marker <= 0xD7 || marker == 0x01 {
+			continue
+		}
+
+		var length [2]byte
+		if _, err := io.ReadFull(r, length[:]); err != nil {
+			return 1
+		}
+		size := int(binary.BigEndian.Uint16(length[:]))
+		if size < 2 {
+			return 1
+		}
+		segment := make([]byte, size-2)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return 1
+		}
+
+		if marker == markerAPP1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			if o := exifOrientation(segment[6:]); o > 0 {
+				return o
+			}
+			return 1
+		}
+	}
+}
+
+// pngDropped are the PNG chunks that hold metadata rather than pixels.
+var pngDropped = map[string]bool{
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"eXIf": true,
+	"tIME": true,
+}
+
+func stripPNG(w *bufio.Writer, r io.Reader) error {
+
+	signature := make([]byte, 8)
+	if _, err := io.ReadFull(r, signature); err != nil {
+		return truncated(err, "PNG")
+	}
+	if string(signature) != "\x89PNG\r\n\x1a\n" {
+		return formatError("not a PNG")
+	}
+	w.Write(signature)
+
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(r, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return truncated(err, "PNG")
+		}
+
+		length := binary.BigEndian.Uint32(header)
+		if length > 1<<31-1 {
+			return formatError("PNG chunk of %d bytes", length)
+		}
+		chunk := string(header[4:])
+
+		var err error
+		if pngDropped[chunk] {
+			_, err = io.CopyN(io.Discard, r, int64(length)+4)
+		} else {
+			w.Write(header)
+			_, err = io.CopyN(w, r, int64(length)+4)
+		}
+		if err != nil {
+			return truncated(err, "PNG")
+		}
+
+		if chunk == "IEND" {
+			return nil
+		}
+	}
+}
+
+// stripWebP drops the EXIF and XMP chunks. They follow the image data, so
+// the file is read into memory to correct the size in its header.
+func stripWebP(w *bufio.Writer, r io.Reader) error {
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return formatError("not a WebP")
+	}
+
+	chunks := []byte("WEBP")
+	for rest := data[12:]; len(rest) > 0; {
+		if len(rest) < 8 {
+			return formatError("truncated WebP")
+		}
+		size := int64(binary.LittleEndian.Uint32(rest[4:]))
+		end := 8 + size + size%2
+		if end > int64(len(rest)) {
+			if 8+size != int64(len(rest)) {
+				return formatError("truncated WebP")
+			}
+			end = 8 + size
+		}
+		chunk := rest[:end]
+		rest = rest[end:]
+
+		switch string(chunk[:4]) {
+		case "EXIF", "XMP ":
+			continue
+		case "VP8X":
+			if size >= 1 {
+				chunk = append([]byte(nil), chunk...)
+				chunk[8] &^= 0x08 | 0x04
+			}
+		}
+		chunks = append(chunks, chunk...)
+	}
+
+	var header [8]byte
+	copy(header[:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(chunks)))
+	w.Write(header[:])
+	w.Write(chunks)
+
+	return nil
+}
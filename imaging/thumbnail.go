@@ -0,0 +1,239 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"sort"
+
+	_ "image/gif"
+)
+
+// MaxPixels is the largest image Thumbnails decodes, as decoding takes four
+// bytes of memory per pixel.
+const MaxPixels = 50_000_000
+
+// ErrTooLarge is returned by Thumbnails for images over MaxPixels.
+var ErrTooLarge = errors.New("image has too many pixels")
+
+// CanThumbnail reports whether Thumbnails can decode images of the type.
+func CanThumbnail(mime string) bool {
+	return mime == "image/jpeg" || mime == "image/png" || mime == "image/gif"
+}
+
+// Thumbnails scales the image down to fit into squares of each of the
+// sizes, turned upright by its EXIF orientation. Images smaller than a size
+// keep their dimensions. Opaque thumbnails are JPEGs, others PNGs; neither
+// has metadata.
+func Thumbnails(data []byte, sizes []int) (map[int][]byte, error) {
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrTooLarge, cfg.Width, cfg.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	orientation := Orientation(data)
+
+	// each thumbnail is scaled from the next larger one, which is faster
+	// than scaling every size from the original and looks the same
+	sorted := append([]int(nil), sizes...)
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+
+	b := img.Bounds()
+	thumbs := map[int][]byte{}
+	for _, size := range sorted {
+		if size < 1 {
+			return nil, fmt.Errorf("invalid thumbnail size %d", size)
+		}
+
+		width, height := fit(b.Dx(), b.Dy(), size)
+		scaled := scale(img, width, height)
+
+		thumb, err := encode(orient(scaled, orientation))
+		if err != nil {
+			return nil, err
+		}
+		thumbs[size] = thumb
+		img = scaled
+	}
+
+	return thumbs, nil
+}
+
+// fit returns the dimensions of an image scaled down to fit into a square
+// of the size.
+func fit(width, height, size int) (int, int) {
+
+	if width <= size && height <= size {
+		return width, height
+	}
+
+	if width >= height {
+		return size, maxInt(1, (height*size+width/2)/width)
+	}
+
+	return maxInt(1, (width*size+height/2)/height), size
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// scale shrinks img to width by height pixels, each the average of the
+// pixels it covers.
+func scale(img image.Image, width, height int) *image.RGBA {
+
+	b := img.Bounds()
+	srcWidth, srcHeight := b.Dx(), b.Dy()
+	pixel := pixelReader(img)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	columns := make([]int, srcWidth)
+	for x := range columns {
+		columns[x] = x * width / srcWidth
+	}
+
+	sums := make([]uint64, 4*width)
+	counts := make([]uint64, width)
+
+	flush := func(row int) {
+		line := dst.Pix[row*dst.Stride:]
+		for x, count := range counts {
+			if count == 0 {
+				continue
+			}
+			for c := 0; c < 4; c++ {
+				line[4*x+c] = uint8(sums[4*x+c] / count >> 8)
+				sums[4*x+c] = 0
+			}
+			counts[x] = 0
+		}
+	}
+
+	row := 0
+	for y := 0; y < srcHeight; y++ {
+		if next := y * height / srcHeight; next != row {
+			flush(row)
+			row = next
+		}
+		for x := 0; x < srcWidth; x++ {
+			r, g, bl, a := pixel(b.Min.X+x, b.Min.Y+y)
+			column := columns[x]
+			sums[4*column] += uint64(r)
+			sums[4*column+1] += uint64(g)
+			sums[4*column+2] += uint64(bl)
+			sums[4*column+3] += uint64(a)
+			counts[column]++
+		}
+	}
+	flush(row)
+
+	return dst
+}
+
+// pixelReader returns a function reading the premultiplied 16 bit colour of
+// a pixel. The types decoders return are read without going through
+// color.Color, which would allocate for every pixel.
+func pixelReader(img image.Image) func(x, y int) (uint32, uint32, uint32, uint32) {
+
+	switch img := img.(type) {
+	case *image.YCbCr:
+		return func(x, y int) (uint32, uint32, uint32, uint32) {
+			c := img.YCbCrAt(x, y)
+			r, g, b := color.YCbCrToRGB(c.Y, c.Cb, c.Cr)
+			return uint32(r) * 0x101, uint32(g) * 0x101, uint32(b) * 0x101, 0xFFFF
+		}
+	case *image.RGBA:
+		return func(x, y int) (uint32, uint32, uint32, uint32) {
+			return img.RGBAAt(x, y).RGBA()
+		}
+	case *image.NRGBA:
+		return func(x, y int) (uint32, uint32, uint32, uint32) {
+			return img.NRGBAAt(x, y).RGBA()
+		}
+	case *image.Gray:
+		return func(x, y int) (uint32, uint32, uint32, uint32) {
+			return img.GrayAt(x, y).RGBA()
+		}
+	case *image.Paletted:
+		return func(x, y int) (uint32, uint32, uint32, uint32) {
+			return img.Palette[img.ColorIndexAt(x, y)].RGBA()
+		}
+	}
+
+	return func(x, y int) (uint32, uint32, uint32, uint32) {
+		return img.At(x, y).RGBA()
+	}
+}
+
+// orient turns an image stored with an EXIF orientation upright.
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = width-1-x, y
+			case 3: // upside down
+				dx, dy = width-1-x, height-1-y
+			case 4: // mirrored upside down
+				dx, dy = x, height-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // to be turned clockwise
+				dx, dy = height-1-y, x
+			case 7: // transversed
+				dx, dy = height-1-y, width-1-x
+			case 8: // to be turned counterclockwise
+				dx, dy = y, width-1-x
+			}
+			dst.SetRGBA(dx, dy, img.RGBAAt(x, y))
+		}
+	}
+
+	return dst
+}
+
+func encode(img *image.RGBA) ([]byte, error) {
+
+	var buf bytes.Buffer
+
+	var err error
+	if img.Opaque() {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
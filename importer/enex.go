@@ -0,0 +1,117 @@
+package importer
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// enexTime is the timestamp format of Evernote exports, always UTC.
+const enexTime = "20060102T150405Z"
+
+type enexNote struct {
+	Title     string         `xml:"title"`
+	Content   string         `xml:"content"`
+	Created   string         `xml:"created"`
+	Updated   string         `xml:"updated"`
+	Tags      []string       `xml:"tag"`
+	Resources []enexResource `xml:"resource"`
+}
+
+type enexResource struct {
+	Data     string `xml:"data"`
+	Mime     string `xml:"mime"`
+	FileName string `xml:"resource-attributes>file-name"`
+}
+
+// ReadENEX calls fn with every note of an Evernote export. Notes are decoded
+// one at a time, so exports of any size can be read.
+func ReadENEX(r io.Reader, fn func(*Note) error) error {
+
+	dec := xml.NewDecoder(r)
+	dec.Strict = false
+
+	found := false
+
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "note" {
+			continue
+		}
+		found = true
+
+		var en enexNote
+		if err := dec.DecodeElement(&en, &start); err != nil {
+			return err
+		}
+
+		note, err := en.note()
+		if err != nil {
+			note = &Note{Title: en.Title, Err: err}
+		}
+		if err := fn(note); err != nil {
+			return err
+		}
+	}
+
+	if !found {
+		return ErrNoNotes
+	}
+
+	return nil
+}
+
+func (en *enexNote) note() (*Note, error) {
+
+	note := &Note{Title: strings.TrimSpace(en.Title), Tags: en.Tags}
+
+	// en-media elements refer to resources by the MD5 of their data
+	byHash := map[string]*Attachment{}
+	for i, res := range en.Resources {
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(res.Data), ""))
+		if err != nil {
+			return nil, fmt.Errorf("attachment %d: %w", i+1, err)
+		}
+		name := res.FileName
+		if name == "" {
+			name = fmt.Sprintf("attachment-%d", i+1)
+		}
+		sum := md5.Sum(data)
+		attachment := &Attachment{Name: name, Mime: res.Mime, Data: data}
+		byHash[hex.EncodeToString(sum[:])] = attachment
+		note.Attachments = append(note.Attachments, attachment)
+	}
+
+	body, err := toMarkdown(en.Content, func(hash string) string {
+		if attachment, ok := byHash[hash]; ok {
+			return attachment.placeholder()
+		}
+		return ""
+	})
+	if err != nil {
+		return nil, err
+	}
+	note.Body = body
+
+	if t, err := time.Parse(enexTime, en.Created); err == nil {
+		note.Created = t
+	}
+	if t, err := time.Parse(enexTime, en.Updated); err == nil {
+		note.Updated = t
+	}
+
+	return note, nil
+}
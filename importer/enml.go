@@ -0,0 +1,341 @@
+package importer
+
+import (
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// node is an element or, with an empty name, a text node of a parsed ENML
+// (or HTML) document.
+type node struct {
+	name     string
+	attrs    map[string]string
+	text     string
+	children []*node
+}
+
+// parseMarkup parses ENML leniently: HTML entities and unclosed void
+// elements are common in exported notes.
+func parseMarkup(content string) (*node, error) {
+
+	dec := xml.NewDecoder(strings.NewReader(content))
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+	dec.AutoClose = xml.HTMLAutoClose
+
+	root := &node{name: "#root"}
+	stack := []*node{root}
+
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		parent := stack[len(stack)-1]
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			n := &node{name: strings.ToLower(t.Name.Local), attrs: map[string]string{}}
+			for _, attr := range t.Attr {
+				n.attrs[strings.ToLower(attr.Name.Local)] = attr.Value
+			}
+			parent.children = append(parent.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			// close up to the matching element, tolerating stray end tags
+			name := strings.ToLower(t.Name.Local)
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].name == name {
+					stack = stack[:i]
+					break
+				}
+			}
+		case xml.CharData:
+			parent.children = append(parent.children, &node{text: string(t)})
+		}
+	}
+
+	return root, nil
+}
+
+var (
+	spaces      = regexp.MustCompile(`[ \t\r\n]+`)
+	blankLines  = regexp.MustCompile(`\n{3,}`)
+	checkedItem = regexp.MustCompile(`--en-checked:\s*true`)
+	todoItem    = regexp.MustCompile(`--en-checked:\s*false`)
+)
+
+// markdown renders ENML as Markdown. Media elements are replaced by the text
+// media returns for their hash.
+type markdown struct {
+	media func(hash string) string
+
+	lines  []string
+	cur    strings.Builder
+	quotes int
+	// lists holds "-" or the next number for every open list
+	lists  []string
+	bullet string
+	pre    bool
+}
+
+func toMarkdown(content string, media func(hash string) string) (string, error) {
+
+	root, err := parseMarkup(content)
+	if err != nil {
+		return "", err
+	}
+
+	m := &markdown{media: media}
+	m.children(root)
+	m.flush()
+
+	text := strings.Join(m.lines, "\n")
+	text = blankLines.ReplaceAllString(text, "\n\n")
+
+	return strings.TrimSpace(text), nil
+}
+
+func (m *markdown) prefix() string {
+	return strings.Repeat("> ", m.quotes) + strings.Repeat("  ", max(len(m.lists)-1, 0))
+}
+
+// flush ends the current line. The first line of a list item carries its
+// bullet, the following ones are indented under it.
+func (m *markdown) flush() {
+
+	text := strings.TrimSpace(m.cur.String())
+	m.cur.Reset()
+	if text == "" {
+		return
+	}
+
+	line := m.prefix()
+	if m.bullet != "" {
+		line += m.bullet + " "
+		m.bullet = ""
+	} else if len(m.lists) > 0 {
+		line += "  "
+	}
+
+	m.lines = append(m.lines, line+text)
+}
+
+func (m *markdown) blank() {
+	m.flush()
+	if len(m.lists) == 0 && len(m.lines) > 0 && m.lines[len(m.lines)-1] != "" {
+		m.lines = append(m.lines, "")
+	}
+}
+
+// wrap writes the children between two inline markers, or nothing when
+// they are empty.
+func (m *markdown) wrap(n *node, open, close string) {
+
+	before := m.cur.Len()
+	m.cur.WriteString(open)
+	m.children(n)
+	if m.cur.Len() == before+len(open) {
+		text := m.cur.String()[:before]
+		m.cur.Reset()
+		m.cur.WriteString(text)
+		return
+	}
+	m.cur.WriteString(close)
+}
+
+func (m *markdown) children(n *node) {
+	for _, child := range n.children {
+		m.node(child)
+	}
+}
+
+func (m *markdown) node(n *node) {
+
+	if n.name == "" {
+		if m.pre {
+			m.cur.WriteString(n.text)
+		} else {
+			text := strings.ReplaceAll(n.text, "\u00a0", " ")
+			m.cur.WriteString(spaces.ReplaceAllString(text, " "))
+		}
+		return
+	}
+
+	switch n.name {
+	case "div", "en-note", "section", "article", "header", "footer":
+		m.flush()
+		m.children(n)
+		m.flush()
+
+	case "p":
+		m.blank()
+		m.children(n)
+		m.blank()
+
+	case "br":
+		if strings.TrimSpace(m.cur.String()) == "" && len(m.lists) == 0 {
+			m.blank()
+		}
+		m.flush()
+
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		m.blank()
+		m.cur.WriteString(strings.Repeat("#", int(n.name[1]-'0')) + " ")
+		m.children(n)
+		m.blank()
+
+	case "hr":
+		m.blank()
+		m.lines = append(m.lines, "* * *")
+		m.blank()
+
+	case "b", "strong":
+		m.wrap(n, "**", "**")
+	case "i", "em":
+		m.wrap(n, "_", "_")
+	case "s", "strike", "del":
+		m.wrap(n, "~~", "~~")
+	case "code":
+		m.wrap(n, "`", "`")
+
+	case "a":
+		href := n.attrs["href"]
+		if href == "" {
+			m.children(n)
+			return
+		}
+		m.wrap(n, "[", "]("+href+")")
+
+	case "img":
+		m.cur.WriteString("![" + n.attrs["alt"] + "](" + n.attrs["src"] + ")")
+
+	case "en-media":
+		if m.media != nil {
+			m.cur.WriteString(m.media(n.attrs["hash"]))
+		}
+
+	case "en-todo":
+		box := "[ ] "
+		if n.attrs["checked"] == "true" {
+			box = "[x] "
+		}
+		// a todo outside a list starts a checklist item of its own
+		if len(m.lists) == 0 && strings.TrimSpace(m.cur.String()) == "" {
+			box = "- " + box
+		}
+		m.cur.WriteString(box)
+
+	case "ul", "ol":
+		m.flush()
+		kind := "-"
+		if n.name == "ol" {
+			kind = "1"
+		}
+		m.lists = append(m.lists, kind)
+		m.children(n)
+		m.flush()
+		m.lists = m.lists[:len(m.lists)-1]
+		if len(m.lists) == 0 {
+			m.blank()
+		}
+
+	case "li":
+		m.flush()
+		m.bullet = "-"
+		if len(m.lists) > 0 && m.lists[len(m.lists)-1] != "-" {
+			number, _ := strconv.Atoi(m.lists[len(m.lists)-1])
+			m.bullet = strconv.Itoa(number) + "."
+			m.lists[len(m.lists)-1] = strconv.Itoa(number + 1)
+		}
+		switch style := n.attrs["style"]; {
+		case checkedItem.MatchString(style):
+			m.bullet += " [x]"
+		case todoItem.MatchString(style):
+			m.bullet += " [ ]"
+		}
+		m.children(n)
+		m.flush()
+		m.bullet = ""
+
+	case "blockquote":
+		m.blank()
+		m.quotes++
+		m.children(n)
+		m.flush()
+		m.quotes--
+		m.blank()
+
+	case "pre":
+		m.blank()
+		m.lines = append(m.lines, "```")
+		m.pre = true
+		m.children(n)
+		m.pre = false
+		text := strings.TrimRight(m.cur.String(), "\n")
+		m.cur.Reset()
+		m.lines = append(m.lines, strings.Split(text, "\n")...)
+		m.lines = append(m.lines, "```")
+		m.blank()
+
+	case "table":
+		m.blank()
+		m.table(n)
+		m.blank()
+
+	case "script", "style", "title", "head":
+		// not content
+
+	default:
+		m.children(n)
+	}
+}
+
+// table renders rows as a Markdown table, the first row as header.
+func (m *markdown) table(n *node) {
+
+	rows := [][]string{}
+
+	var collect func(n *node)
+	collect = func(n *node) {
+		for _, child := range n.children {
+			if child.name != "tr" {
+				collect(child)
+				continue
+			}
+			row := []string{}
+			for _, cell := range child.children {
+				if cell.name != "td" && cell.name != "th" {
+					continue
+				}
+				c := &markdown{media: m.media}
+				c.children(cell)
+				c.flush()
+				row = append(row, strings.ReplaceAll(strings.Join(c.lines, " "), "|", `\|`))
+			}
+			rows = append(rows, row)
+		}
+	}
+	collect(n)
+
+	for i, row := range rows {
+		m.lines = append(m.lines, m.prefix()+"| "+strings.Join(row, " | ")+" |")
+		if i == 0 {
+			m.lines = append(m.lines, m.prefix()+strings.Repeat("|---", len(row))+"|")
+		}
+	}
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
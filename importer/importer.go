@@ -0,0 +1,252 @@
+// Package importer converts exports of other note taking applications,
+// Evernote ENEX files and Google Keep Takeout archives, into notes.
+package importer
+
+import (
+	"NOTESBE/notefile"
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Sources of imports.
+const (
+	SourceENEX = "enex"
+	SourceKeep = "keep"
+)
+
+var Sources = []string{SourceENEX, SourceKeep}
+
+const (
+	maxAttachmentSize = 25 << 20
+	// maxKeepNoteSize bounds the JSON of a single Keep note
+	maxKeepNoteSize = 5 << 20
+	// maxFailures is how many failed notes and attachments are listed on a
+	// job
+	maxFailures    = 100
+	updateInterval = time.Second
+)
+
+var ErrNoNotes = errors.New("the file contains no notes")
+
+type Note struct {
+	Title       string
+	Body        string
+	Tags        []string
+	Created     time.Time
+	Updated     time.Time
+	Attachments []*Attachment
+	// Err is set for a note that could not be read, the import goes on with
+	// the next one.
+	Err error
+}
+
+// Attachment is a file embedded in a note. It is stored as an attachment of
+// the imported note and the note text names it where it appeared.
+type Attachment struct {
+	Name string
+	Mime string
+	Data []byte
+}
+
+func (a *Attachment) placeholder() string {
+	return fmt.Sprintf("[attachment: %s (%s)]", a.Name, a.Mime)
+}
+
+// AttachmentStore keeps the attachments of imported notes, within the same
+// size limit and quota as uploads.
+type AttachmentStore interface {
+	StoreAttachment(ctx context.Context, userId, noteId uint64, attachment *Attachment) error
+}
+
+// markdown is the text of the note with its title as heading.
+func (n *Note) markdown() string {
+	if n.Title == "" {
+		return n.Body
+	}
+	return "# " + n.Title + "\n\n" + n.Body
+}
+
+// Run imports the file at name into notes of job.Userid, with their
+// attachments kept in attachments. The job is updated in the database as the
+// import progresses and passed to progress, which may be nil, each time.
+func Run(db repository.Repository, attachments AttachmentStore, job *repository.Importjob, name string, progress func(*repository.Importjob)) error {
+
+	err := run(db, attachments, job, name, progress)
+
+	job.Finishedat = time.Now()
+	if err != nil {
+		job.Status = repository.ImportFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = repository.ImportDone
+		job.Progress = 100
+	}
+
+	if err := db.UpdateImportJob(job); err != nil {
+		utility.Errorln("Error in updating import job:", err)
+	}
+	if progress != nil {
+		progress(job)
+	}
+
+	return err
+}
+
+func run(db repository.Repository, attachments AttachmentStore, job *repository.Importjob, name string, progress func(*repository.Importjob)) error {
+
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	counter := &counter{}
+	last := time.Now()
+
+	update := func(force bool) {
+		if !force && time.Since(last) < updateInterval {
+			return
+		}
+		last = time.Now()
+		// zip archives are read out of order, so never claim to be done
+		if size > 0 {
+			job.Progress = int(min(counter.n*100/size, 99))
+		}
+		if err := db.UpdateImportJob(job); err != nil {
+			utility.Errorln("Error in updating import job:", err)
+		}
+		if progress != nil {
+			progress(job)
+		}
+	}
+
+	job.Status = repository.ImportRunning
+	update(true)
+
+	failures := 0
+	failed := func(note *Note, err error) {
+		failures++
+		if failures <= maxFailures {
+			title := note.Title
+			if title == "" {
+				title = fmt.Sprintf("note %d", job.Processed)
+			}
+			job.Failures += fmt.Sprintf("%s: %s\n", title, err)
+		}
+	}
+
+	handle := func(note *Note) error {
+
+		job.Processed++
+
+		var created *repository.Note
+		if note.Err == nil {
+			created, note.Err = create(db, job.Userid, note)
+		}
+		if note.Err != nil {
+			job.Failed++
+			failed(note, note.Err)
+			update(false)
+			return nil
+		}
+		job.Imported++
+
+		// a note is kept without the attachments that are refused, e.g.
+		// for exceeding the quota
+		for _, attachment := range note.Attachments {
+			err := attachments.StoreAttachment(context.Background(), job.Userid, created.Id, attachment)
+			if err != nil {
+				failed(note, fmt.Errorf("attachment %s: %w", attachment.Name, err))
+				continue
+			}
+			job.Attachments++
+		}
+
+		update(false)
+		return nil
+	}
+
+	switch job.Source {
+	case SourceENEX:
+		return ReadENEX(&countingReader{r: file, counter: counter}, handle)
+	case SourceKeep:
+		archive, err := zip.NewReader(&countingReaderAt{r: file, counter: counter}, size)
+		if err != nil {
+			return fmt.Errorf("not a Takeout archive: %w", err)
+		}
+		return ReadKeep(archive, handle)
+	}
+
+	return fmt.Errorf("unknown import source %q", job.Source)
+}
+
+func create(db repository.Repository, userId uint64, note *Note) (*repository.Note, error) {
+
+	body := note.markdown()
+	if strings.TrimSpace(body) == "" {
+		return nil, errors.New("note is empty")
+	}
+	if len(body) > notefile.MaxSize {
+		return nil, notefile.ErrTooLarge
+	}
+
+	created := &repository.Note{
+		Note:      body,
+		Userid:    userId,
+		Tags:      strings.Join(notefile.NormalizeTags(note.Tags), ","),
+		Createdat: note.Created,
+		Updatedat: note.Updated,
+	}
+	if err := db.CreateNote(created); err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+type counter struct {
+	n int64
+}
+
+type countingReader struct {
+	r       io.Reader
+	counter *counter
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.counter.n += int64(n)
+	return n, err
+}
+
+type countingReaderAt struct {
+	r       io.ReaderAt
+	counter *counter
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.counter.n += int64(n)
+	return n, err
+}
+
+func min(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,120 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToMarkdown(t *testing.T) {
+
+	enml := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE en-note SYSTEM "http://xml.evernote.com/pub/enml2.dtd">
+<en-note><h1>Trip</h1><div>Bring <b>passport</b> &amp; <i>tickets</i>&nbsp;<a href="https://example.com">booking</a></div>
+<div><en-todo checked="true"/>Pack bags</div><div><en-todo checked="false"/>Water plants</div>
+<ul style="--en-todo:true;"><li style="--en-checked:true;"><div>Book hotel</div></li><li style="--en-checked:false;"><div>Rent car</div></li></ul>
+<ol><li>first</li><li>second<ul><li>nested</li></ul></li></ol>
+<div><br/></div><div>done</div></en-note>`
+
+	md, err := toMarkdown(enml, nil)
+	assert.NoError(t, err)
+
+	for _, line := range []string{
+		"# Trip",
+		"Bring **passport** & _tickets_ [booking](https://example.com)",
+		"- [x] Pack bags",
+		"- [ ] Water plants",
+		"- [x] Book hotel",
+		"- [ ] Rent car",
+		"1. first",
+		"2. second",
+		"  - nested",
+		"done",
+	} {
+		assert.Contains(t, strings.Split(md, "\n"), line)
+	}
+}
+
+func TestReadENEX(t *testing.T) {
+
+	image := []byte("not really a png")
+
+	enex := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE en-export SYSTEM "http://xml.evernote.com/pub/evernote-export3.dtd">
+<en-export export-date="20240101T000000Z" application="Evernote">
+<note><title>Recipe</title>
+<content><![CDATA[<?xml version="1.0" encoding="UTF-8"?><en-note><div>Mix</div><en-media type="image/png" hash="a4f84feadf4cad85108478e074357b33"/></en-note>]]></content>
+<created>20230102T030405Z</created><updated>20230203T040506Z</updated>
+<tag>cooking</tag><tag>family</tag>
+<resource><data encoding="base64">` + base64.StdEncoding.EncodeToString(image) + `</data><mime>image/png</mime>
+<resource-attributes><file-name>cake.png</file-name></resource-attributes></resource>
+</note>
+<note><title>Empty</title><content><![CDATA[<en-note></en-note>]]></content></note>
+</en-export>`
+
+	notes := []*Note{}
+	err := ReadENEX(strings.NewReader(enex), func(note *Note) error {
+		notes = append(notes, note)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, notes, 2)
+
+	note := notes[0]
+	assert.Equal(t, "Recipe", note.Title)
+	assert.Equal(t, []string{"cooking", "family"}, note.Tags)
+	assert.Equal(t, time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC), note.Created)
+	assert.Len(t, note.Attachments, 1)
+	assert.Equal(t, image, note.Attachments[0].Data)
+	assert.Contains(t, note.markdown(), "# Recipe\n\nMix\n[attachment: cake.png (image/png)]")
+
+	err = ReadENEX(strings.NewReader("<html></html>"), func(*Note) error { return nil })
+	assert.ErrorIs(t, err, ErrNoNotes)
+}
+
+func TestReadKeep(t *testing.T) {
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	files := map[string]string{
+		"Takeout/Keep/Shopping.json": `{"title": "Shopping", "listContent": [{"text": "milk", "isChecked": true}, {"text": "eggs"}],
+			"labels": [{"name": "home"}], "isArchived": true, "createdTimestampUsec": 1700000000000000,
+			"attachments": [{"filePath": "list.jpg", "mimetype": "image/jpeg"}]}`,
+		"Takeout/Keep/list.jpg":      "jpeg",
+		"Takeout/Keep/Old.json":      `{"title": "Old", "textContent": "gone", "isTrashed": true}`,
+		"Takeout/Keep/Shopping.html": "<html></html>",
+		"Takeout/Keep/Huge.json":     `{"title": "Huge", "textContent": "` + strings.Repeat("a", maxKeepNoteSize) + `"}`,
+	}
+	for name, content := range files {
+		w, _ := archive.Create(name)
+		w.Write([]byte(content))
+	}
+	archive.Close()
+
+	reader, _ := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+
+	notes := []*Note{}
+	err := ReadKeep(reader, func(note *Note) error {
+		notes = append(notes, note)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, notes, 2, "trashed notes are skipped")
+	sort.Slice(notes, func(i, j int) bool { return notes[i].Title > notes[j].Title })
+
+	assert.Equal(t, "Huge.json", notes[1].Title)
+	assert.ErrorContains(t, notes[1].Err, "larger than 5 MiB")
+
+	note := notes[0]
+	assert.NoError(t, note.Err)
+	assert.Contains(t, note.Body, "- [x] milk\n- [ ] eggs")
+	assert.Equal(t, []string{"home", "archived"}, note.Tags)
+	assert.Equal(t, int64(1700000000), note.Created.Unix())
+	assert.Equal(t, []byte("jpeg"), note.Attachments[0].Data)
+}
@@ -0,0 +1,166 @@
+package importer
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+type keepNote struct {
+	Title       string `json:"title"`
+	TextContent string `json:"textContent"`
+	ListContent []struct {
+		Text      string `json:"text"`
+		IsChecked bool   `json:"isChecked"`
+	} `json:"listContent"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Annotations []struct {
+		Title string `json:"title"`
+		URL   string `json:"url"`
+	} `json:"annotations"`
+	Attachments []struct {
+		FilePath string `json:"filePath"`
+		Mimetype string `json:"mimetype"`
+	} `json:"attachments"`
+	IsTrashed               bool  `json:"isTrashed"`
+	IsArchived              bool  `json:"isArchived"`
+	CreatedTimestampUsec    int64 `json:"createdTimestampUsec"`
+	UserEditedTimestampUsec int64 `json:"userEditedTimestampUsec"`
+}
+
+// ReadKeep calls fn with every note of a Google Takeout archive of Keep.
+// Every note is a JSON file next to its attachments; the HTML renderings
+// of the notes are ignored. Trashed notes are skipped and archived notes are
+// tagged "archived".
+func ReadKeep(archive *zip.Reader, fn func(*Note) error) error {
+
+	files := map[string]*zip.File{}
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+
+	found := false
+
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() || path.Ext(f.Name) != ".json" || !strings.Contains(f.Name, "Keep/") {
+			continue
+		}
+
+		found = true
+
+		var kn keepNote
+		if err := readJSON(f, &kn); err != nil {
+			if err := fn(&Note{Title: path.Base(f.Name), Err: err}); err != nil {
+				return err
+			}
+			continue
+		}
+		if kn.IsTrashed {
+			continue
+		}
+
+		note := kn.note()
+
+		for _, a := range kn.Attachments {
+			attachment := &Attachment{Name: a.FilePath, Mime: a.Mimetype}
+			file, ok := files[path.Join(path.Dir(f.Name), a.FilePath)]
+			if !ok {
+				note.Err = fmt.Errorf("attachment %s is missing from the archive", a.FilePath)
+				break
+			}
+			if attachment.Data, note.Err = readFile(file); note.Err != nil {
+				break
+			}
+			note.Attachments = append(note.Attachments, attachment)
+			note.Body += "\n\n" + attachment.placeholder()
+		}
+
+		if err := fn(note); err != nil {
+			return err
+		}
+	}
+
+	if !found {
+		return ErrNoNotes
+	}
+
+	return nil
+}
+
+func (kn *keepNote) note() *Note {
+
+	note := &Note{Title: strings.TrimSpace(kn.Title)}
+
+	var b strings.Builder
+	b.WriteString(kn.TextContent)
+	for _, item := range kn.ListContent {
+		box := "[ ]"
+		if item.IsChecked {
+			box = "[x]"
+		}
+		fmt.Fprintf(&b, "- %s %s\n", box, strings.TrimSpace(item.Text))
+	}
+	for _, link := range kn.Annotations {
+		if link.URL == "" {
+			continue
+		}
+		title := link.Title
+		if title == "" {
+			title = link.URL
+		}
+		fmt.Fprintf(&b, "\n[%s](%s)", title, link.URL)
+	}
+	note.Body = strings.TrimSpace(b.String())
+
+	for _, label := range kn.Labels {
+		note.Tags = append(note.Tags, label.Name)
+	}
+	if kn.IsArchived {
+		note.Tags = append(note.Tags, "archived")
+	}
+
+	if kn.CreatedTimestampUsec > 0 {
+		note.Created = time.UnixMicro(kn.CreatedTimestampUsec).UTC()
+	}
+	if kn.UserEditedTimestampUsec > 0 {
+		note.Updated = time.UnixMicro(kn.UserEditedTimestampUsec).UTC()
+	}
+
+	return note
+}
+
+func readJSON(f *zip.File, v interface{}) error {
+
+	if f.UncompressedSize64 > maxKeepNoteSize {
+		return fmt.Errorf("note %s is larger than %d MiB", path.Base(f.Name), maxKeepNoteSize>>20)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	return json.NewDecoder(io.LimitReader(rc, maxKeepNoteSize)).Decode(v)
+}
+
+func readFile(f *zip.File) ([]byte, error) {
+
+	if f.UncompressedSize64 > maxAttachmentSize {
+		return nil, fmt.Errorf("attachment %s is larger than %d MiB", path.Base(f.Name), maxAttachmentSize>>20)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(io.LimitReader(rc, maxAttachmentSize))
+}
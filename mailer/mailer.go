@@ -0,0 +1,58 @@
+// Package mailer delivers the mails sent to users, such as email
+// verification and password reset links.
+package mailer
+
+import (
+	"NOTESBE/config"
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the mailer selected by mail.transport.
+func New(cfg config.MailConfig) Mailer {
+
+	switch cfg.Transport {
+	case "smtp":
+		return &SMTPMailer{
+			Addr:     cfg.SMTP.Host + ":" + cfg.SMTP.Port,
+			From:     cfg.From,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+		}
+	case "file":
+		return &FileMailer{Dir: cfg.Dir, From: cfg.From}
+	}
+
+	return &LogMailer{From: cfg.From}
+}
+
+// format renders msg as a plain text RFC 5322 message.
+func format(from string, msg Message) []byte {
+
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+
+	return b.Bytes()
+}
@@ -0,0 +1,244 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testMessage = Message{To: "dana@example.com", Subject: "Réinitialiser", Body: "open the link\n"}
+
+func TestFormat(t *testing.T) {
+
+	data := string(format("notes@localhost", testMessage))
+
+	header, body, found := strings.Cut(data, "\r\n\r\n")
+	assert.True(t, found)
+	assert.Equal(t, "open the link\n", body)
+	assert.Contains(t, header, "From: notes@localhost\r\n")
+	assert.Contains(t, header, "To: dana@example.com\r\n")
+	assert.Contains(t, header, "Subject: =?utf-8?q?R=C3=A9initialiser?=\r\n")
+	assert.Contains(t, header, "Content-Type: text/plain; charset=utf-8")
+}
+
+func TestFileMailer(t *testing.T) {
+
+	dir := filepath.Join(t.TempDir(), "mail")
+	m := &FileMailer{Dir: dir, From: "notes@localhost"}
+
+	assert.NoError(t, m.Send(context.Background(), testMessage))
+	assert.NoError(t, m.Send(context.Background(), testMessage))
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.Len(t, files, 2, "every message gets its own file")
+
+	data, _ := os.ReadFile(files[0])
+	assert.Contains(t, string(data), "open the link")
+}
+
+// smtpServer is a minimal SMTP server for one session that offers STARTTLS
+// and AUTH PLAIN once the connection is encrypted.
+type smtpServer struct {
+	ln       net.Listener
+	cert     tls.Certificate
+	commands chan string
+	data     chan string
+}
+
+func newSMTPServer(t *testing.T) (*smtpServer, *x509.CertPool) {
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "mail.test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := x509.ParseCertificate(der)
+	roots := x509.NewCertPool()
+	roots.AddCert(parsed)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &smtpServer{
+		ln:       ln,
+		cert:     tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+		commands: make(chan string, 20),
+		data:     make(chan string, 1),
+	}
+
+	return s, roots
+}
+
+func (s *smtpServer) serve() {
+
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	reply := func(lines ...string) {
+		for _, line := range lines {
+			rw.WriteString(line + "\r\n")
+		}
+		rw.Flush()
+	}
+
+	encrypted := false
+	reply("220 mail.test ESMTP")
+
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		s.commands <- verb
+
+		switch verb {
+		case "EHLO":
+			if encrypted {
+				reply("250-mail.test", "250 AUTH PLAIN")
+			} else {
+				reply("250-mail.test", "250 STARTTLS")
+			}
+		case "STARTTLS":
+			reply("220 ready")
+			tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{s.cert}})
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			rw = bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+			encrypted = true
+		case "AUTH":
+			credentials, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "AUTH PLAIN "))
+			if string(credentials) != "\x00notes\x00secret" {
+				reply("535 authentication failed")
+				continue
+			}
+			reply("235 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var b strings.Builder
+			for {
+				line, err := rw.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				b.WriteString(line)
+			}
+			s.data <- b.String()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+
+	t.Run("STARTTLS and auth", func(t *testing.T) {
+
+		srv, roots := newSMTPServer(t)
+		go srv.serve()
+
+		m := &SMTPMailer{
+			Addr:     srv.ln.Addr().String(),
+			From:     "Notes <notes@example.com>",
+			Username: "notes",
+			Password: "secret",
+			TLS:      &tls.Config{RootCAs: roots},
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		assert.NoError(t, m.Send(ctx, testMessage))
+
+		data := <-srv.data
+		assert.Contains(t, data, "To: dana@example.com\r\n")
+		assert.Contains(t, data, "open the link")
+
+		close(srv.commands)
+		commands := []string{}
+		for command := range srv.commands {
+			commands = append(commands, command)
+		}
+		assert.Equal(t, []string{"EHLO", "STARTTLS", "EHLO", "AUTH", "MAIL", "RCPT", "DATA", "QUIT"}, commands)
+	})
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+
+		srv, _ := newSMTPServer(t)
+		go srv.serve()
+
+		m := &SMTPMailer{Addr: srv.ln.Addr().String(), From: "notes@example.com"}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		assert.Error(t, m.Send(ctx, testMessage), "the upgrade must not fall back to plain text")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+
+		// accepts the connection but never greets
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		go func() {
+			conn, err := ln.Accept()
+			if err == nil {
+				defer conn.Close()
+				time.Sleep(time.Second)
+			}
+		}()
+
+		m := &SMTPMailer{Addr: ln.Addr().String(), From: "notes@example.com"}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		assert.Error(t, m.Send(ctx, testMessage))
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+	})
+}
@@ -0,0 +1,222 @@
+// Package notefile reads and writes notes as Markdown files with a YAML
+// front matter holding the id, timestamps and tags of the note.
+package notefile
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const delimiter = "---"
+
+// MaxSize is the largest note a file may hold.
+const MaxSize = 10 << 20
+
+var ErrTooLarge = errors.New("note is larger than 10 MiB")
+
+type Note struct {
+	Id      uint64
+	Body    string
+	Tags    []string
+	Created time.Time
+	Updated time.Time
+}
+
+type frontMatter struct {
+	Id      uint64    `yaml:"id,omitempty"`
+	Created time.Time `yaml:"created,omitempty"`
+	Updated time.Time `yaml:"updated,omitempty"`
+	Tags    tagList   `yaml:"tags,omitempty,flow"`
+}
+
+// tagList also accepts a single comma or space separated string, as written
+// by many note taking apps.
+type tagList []string
+
+func (t *tagList) UnmarshalYAML(node *yaml.Node) error {
+
+	if node.Kind == yaml.ScalarNode {
+		*t = strings.FieldsFunc(node.Value, func(r rune) bool { return r == ',' || r == ' ' })
+		return nil
+	}
+
+	var tags []string
+	if err := node.Decode(&tags); err != nil {
+		return err
+	}
+	*t = tags
+
+	return nil
+}
+
+// knownKeys start the front matter of the next note in a Markdown stream, so
+// that a horizontal rule inside a note is not taken for one.
+var knownKeys = []string{"id:", "created:", "updated:", "tags:"}
+
+// Marshal renders the note as a Markdown document with front matter.
+func Marshal(note *Note) []byte {
+
+	var b bytes.Buffer
+
+	meta, _ := yaml.Marshal(frontMatter{
+		Id:      note.Id,
+		Created: note.Created.UTC(),
+		Updated: note.Updated.UTC(),
+		Tags:    note.Tags,
+	})
+
+	b.WriteString(delimiter + "\n")
+	b.Write(meta)
+	b.WriteString(delimiter + "\n")
+	b.WriteString(note.Body)
+	b.WriteString("\n")
+
+	return b.Bytes()
+}
+
+// Parse reads a single Markdown document. Without front matter the whole
+// document is the body of the note. The final newline of the file is not part
+// of the body.
+func Parse(data []byte) (*Note, error) {
+
+	if len(data) > MaxSize {
+		return nil, ErrTooLarge
+	}
+
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.TrimSuffix(text, "\n")
+
+	if !strings.HasPrefix(text, delimiter+"\n") {
+		return &Note{Body: text}, nil
+	}
+
+	rest := text[len(delimiter)+1:]
+
+	var meta, body string
+	switch {
+	case strings.HasPrefix(rest, delimiter+"\n"):
+		body = rest[len(delimiter)+1:]
+	case strings.Contains(rest, "\n"+delimiter+"\n"):
+		end := strings.Index(rest, "\n"+delimiter+"\n")
+		meta, body = rest[:end], rest[end+len(delimiter)+2:]
+	case strings.HasSuffix(rest, "\n"+delimiter):
+		meta = strings.TrimSuffix(rest, "\n"+delimiter)
+	default:
+		return &Note{Body: text}, nil
+	}
+
+	var fm frontMatter
+	if err := yaml.Unmarshal([]byte(meta), &fm); err != nil {
+		return nil, errors.New("invalid front matter: " + err.Error())
+	}
+
+	return &Note{
+		Id:      fm.Id,
+		Body:    body,
+		Tags:    NormalizeTags(fm.Tags),
+		Created: fm.Created,
+		Updated: fm.Updated,
+	}, nil
+}
+
+// Split reads a stream of concatenated documents as written by Marshal and
+// calls fn with each one. A new document starts at a front matter delimiter
+// directly followed by one of the keys Marshal writes.
+func Split(r io.Reader, fn func(doc []byte) error) error {
+
+	reader := bufio.NewReader(r)
+
+	var doc bytes.Buffer
+	var pending string
+
+	// next is set when another document follows, which is separated from
+	// this one by an extra newline
+	flush := func(next bool) error {
+		data := doc.Bytes()
+		if next {
+			data = data[:len(data)-1]
+		}
+		var err error
+		if strings.TrimSpace(string(data)) != "" {
+			err = fn(data)
+		}
+		doc.Reset()
+		return err
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if line == "" && err == io.EOF {
+			break
+		}
+
+		trimmed := strings.TrimRight(line, "\r\n")
+
+		if pending != "" {
+			if startsFrontMatter(trimmed) {
+				if ferr := flush(doc.Len() > 0); ferr != nil {
+					return ferr
+				}
+			}
+			doc.WriteString(pending)
+			pending = ""
+		}
+
+		if trimmed == delimiter && (doc.Len() == 0 || bytes.HasSuffix(doc.Bytes(), []byte("\n\n"))) {
+			pending = line
+		} else {
+			doc.WriteString(line)
+		}
+
+		if doc.Len() > MaxSize {
+			return ErrTooLarge
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	doc.WriteString(pending)
+
+	return flush(false)
+}
+
+func startsFrontMatter(line string) bool {
+	for _, key := range knownKeys {
+		if strings.HasPrefix(line, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeTags trims the tags and drops empty and duplicate ones. Tags are
+// stored comma separated, so commas split a tag.
+func NormalizeTags(tags []string) []string {
+
+	out := []string{}
+	seen := map[string]bool{}
+
+	for _, tag := range tags {
+		for _, part := range strings.Split(tag, ",") {
+			part = strings.TrimPrefix(strings.TrimSpace(part), "#")
+			if part == "" || seen[part] {
+				continue
+			}
+			seen[part] = true
+			out = append(out, part)
+		}
+	}
+
+	return out
+}
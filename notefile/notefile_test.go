@@ -0,0 +1,64 @@
+package notefile
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundTrip(t *testing.T) {
+
+	created := time.Date(2023, 4, 1, 9, 30, 0, 0, time.UTC)
+
+	notes := []*Note{
+		{Id: 1, Body: "# Groceries\n\n- milk\n", Tags: []string{"home", "todo"}, Created: created, Updated: created.Add(time.Hour)},
+		{Id: 2, Body: "above\n\n---\n\nbelow the rule", Created: created},
+		{Id: 3, Body: ""},
+	}
+
+	var stream bytes.Buffer
+	for i, note := range notes {
+		if i > 0 {
+			stream.WriteString("\n")
+		}
+		stream.Write(Marshal(note))
+	}
+
+	parsed := []*Note{}
+	err := Split(&stream, func(doc []byte) error {
+		note, err := Parse(doc)
+		if err == nil {
+			parsed = append(parsed, note)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, parsed, len(notes))
+	for i, note := range parsed {
+		assert.Equal(t, notes[i].Id, note.Id)
+		assert.Equal(t, notes[i].Body, note.Body)
+		assert.True(t, notes[i].Created.Equal(note.Created))
+	}
+	assert.Equal(t, []string{"home", "todo"}, parsed[0].Tags)
+}
+
+func TestParse(t *testing.T) {
+
+	note, err := Parse([]byte("plain text\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "plain text", note.Body)
+
+	note, err = Parse([]byte("---\r\ntitle: Trip\r\ntags: travel, 2024 travel\r\ncreated: 2024-02-03\r\n---\r\nPack bags\r\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Pack bags", note.Body)
+	assert.Equal(t, []string{"travel", "2024"}, note.Tags)
+	assert.Equal(t, 2024, note.Created.Year())
+
+	_, err = Parse([]byte("---\ntags: [unclosed\n---\nbody"))
+	assert.Error(t, err)
+}
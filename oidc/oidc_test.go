@@ -0,0 +1,60 @@
+package oidc
+
+import (
+	"NOTESBE/oidc/oidctest"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+
+	mock := oidctest.NewProvider("notes", "")
+	defer mock.Close()
+
+	ctx := context.Background()
+
+	provider, err := Discover(ctx, mock.URL, Config{ClientID: "notes"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   mock.URL,
+			"aud":   "notes",
+			"sub":   "u-1",
+			"nonce": "n",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+		}
+	}
+
+	claims, err := provider.Verify(ctx, mock.Sign(valid()), "n")
+	assert.NoError(t, err)
+	assert.Equal(t, "u-1", claims.Subject)
+
+	tests := map[string]func(jwt.MapClaims){
+		"wrong issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example" },
+		"wrong audience": func(c jwt.MapClaims) { c["aud"] = []string{"other"} },
+		"expired":        func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+		"no expiry":      func(c jwt.MapClaims) { delete(c, "exp") },
+		"wrong nonce":    func(c jwt.MapClaims) { c["nonce"] = "replayed" },
+		"no subject":     func(c jwt.MapClaims) { delete(c, "sub") },
+	}
+	for name, tamper := range tests {
+		c := valid()
+		tamper(c)
+		_, err := provider.Verify(ctx, mock.Sign(c), "n")
+		assert.Error(t, err, name)
+	}
+
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, valid()).SignedString([]byte("guess"))
+	_, err = provider.Verify(ctx, unsigned, "n")
+	assert.Error(t, err, "HS256 tokens are rejected")
+
+	_, err = Discover(ctx, mock.URL+"/other", Config{}, nil)
+	assert.Error(t, err)
+}
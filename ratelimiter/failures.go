@@ -0,0 +1,165 @@
+package ratelimiter
+
+import (
+	"NOTESBE/config"
+	"context"
+	"sync"
+	"time"
+)
+
+// FailureStore counts failed attempts per key, such as failed logins, and
+// keeps until when a key is blocked. The failures of a key are forgotten
+// once forget has passed since the last one, and a key is never blocked for
+// longer than that.
+type FailureStore interface {
+	// Get returns the failures of key, zero when there are none.
+	Get(ctx context.Context, key string, now time.Time) (Failures, error)
+	// Fail counts one more failure of key and returns the failures.
+	Fail(ctx context.Context, key string, now time.Time, forget time.Duration) (Failures, error)
+	// Block blocks key until the given time.
+	Block(ctx context.Context, key string, until time.Time) error
+	// Reset forgets the failures of key and reports whether there were any.
+	Reset(ctx context.Context, key string) (bool, error)
+	// Blocked returns the failures of the keys that are blocked at now.
+	Blocked(ctx context.Context, now time.Time) (map[string]Failures, error)
+}
+
+// Failures are the failed attempts of a key.
+type Failures struct {
+	Count        int
+	Last         time.Time
+	BlockedUntil time.Time
+}
+
+// NewFailureStore returns the failure store selected by ratelimit.store, so
+// that failures are shared between replicas like the rate limits.
+func NewFailureStore(cfg config.RateLimitConfig) FailureStore {
+
+	if cfg.Store == "redis" {
+		return NewRedisFailures(RedisOptions{
+			Addr:     cfg.Redis.Addr,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+			Prefix:   cfg.Redis.Prefix,
+		})
+	}
+
+	return NewMemoryFailures()
+}
+
+// MemoryFailures keeps the failures in process memory. Each replica of the
+// service counts on its own; use RedisFailures to share them.
+type MemoryFailures struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryFailures
+	lastSweep time.Time
+}
+
+type memoryFailures struct {
+	Failures
+	forget time.Duration
+}
+
+func NewMemoryFailures() *MemoryFailures {
+	return &MemoryFailures{entries: map[string]*memoryFailures{}}
+}
+
+func (m *MemoryFailures) Get(ctx context.Context, key string, now time.Time) (Failures, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if f := m.entry(key, now); f != nil {
+		return f.Failures, nil
+	}
+
+	return Failures{}, nil
+}
+
+func (m *MemoryFailures) Fail(ctx context.Context, key string, now time.Time, forget time.Duration) (Failures, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(now)
+
+	f := m.entry(key, now)
+	if f == nil {
+		f = &memoryFailures{}
+		m.entries[key] = f
+	}
+
+	f.Count++
+	f.Last = now
+	f.forget = forget
+
+	return f.Failures, nil
+}
+
+func (m *MemoryFailures) Block(ctx context.Context, key string, until time.Time) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if f, found := m.entries[key]; found {
+		f.BlockedUntil = until
+	}
+
+	return nil
+}
+
+func (m *MemoryFailures) Reset(ctx context.Context, key string) (bool, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, found := m.entries[key]
+	delete(m.entries, key)
+
+	return found, nil
+}
+
+func (m *MemoryFailures) Blocked(ctx context.Context, now time.Time) (map[string]Failures, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	blocked := map[string]Failures{}
+	for key, f := range m.entries {
+		if f.BlockedUntil.After(now) {
+			blocked[key] = f.Failures
+		}
+	}
+
+	return blocked, nil
+}
+
+// entry returns the failures of key, dropping them once they are forgotten.
+func (m *MemoryFailures) entry(key string, now time.Time) *memoryFailures {
+
+	f, found := m.entries[key]
+	if !found {
+		return nil
+	}
+
+	if now.Sub(f.Last) > f.forget && !f.BlockedUntil.After(now) {
+		delete(m.entries, key)
+		return nil
+	}
+
+	return f
+}
+
+// sweep drops forgotten entries so that failures from many keys do not pile
+// up in memory.
+func (m *MemoryFailures) sweep(now time.Time) {
+
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+
+	for key := range m.entries {
+		m.entry(key, now)
+	}
+}
@@ -0,0 +1,154 @@
+// Package ratelimiter implements keyed request budgets using the sliding
+// window counter algorithm: a request is allowed while
+//
+//	previous*(1-elapsed/period) + current < limit
+//
+// where previous and current are the request counts of the last and the
+// ongoing fixed window and elapsed is the time spent in the ongoing window.
+package ratelimiter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter checks and consumes request budgets. Allow counts one request
+// against key when it fits in limit requests per period.
+type RateLimiter interface {
+	Allow(ctx context.Context, key string, limit int, period time.Duration) (Result, error)
+}
+
+// Result describes the budget of a key after a call to Allow.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the ongoing window ends.
+	Reset time.Duration
+	// RetryAfter is the time until a request would be allowed again, zero
+	// when the request was allowed.
+	RetryAfter time.Duration
+}
+
+type window struct {
+	start    time.Time
+	period   time.Duration
+	previous int
+	current  int
+}
+
+// MemoryLimiter keeps the counters in process memory. Each replica of the
+// service has its own budgets; use RedisLimiter to share them.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	windows   map[string]*window
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+const sweepInterval = time.Minute
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		windows: map[string]*window{},
+		now:     time.Now,
+	}
+}
+
+func (m *MemoryLimiter) Allow(ctx context.Context, key string, limit int, period time.Duration) (Result, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	start := now.Truncate(period)
+
+	w, found := m.windows[key]
+	if !found || w.period != period {
+		w = &window{start: start, period: period}
+		m.windows[key] = w
+	}
+
+	switch {
+	case w.start.Equal(start):
+	case w.start.Add(period).Equal(start):
+		w.previous, w.current, w.start = w.current, 0, start
+	default:
+		w.previous, w.current, w.start = 0, 0, start
+	}
+
+	result := evaluate(w.previous, w.current, limit, now.Sub(start), period)
+	if result.Allowed {
+		w.current++
+		result.Remaining = remaining(w.previous, w.current, limit, now.Sub(start), period)
+	}
+
+	return result, nil
+}
+
+// sweep drops keys that have not been used for two windows.
+func (m *MemoryLimiter) sweep(now time.Time) {
+
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+
+	for key, w := range m.windows {
+		if now.Sub(w.start) > 2*w.period {
+			delete(m.windows, key)
+		}
+	}
+}
+
+// evaluate decides whether one more request fits in the budget and, if not,
+// how long the caller has to wait.
+func evaluate(previous, current, limit int, elapsed, period time.Duration) Result {
+
+	result := Result{
+		Limit: limit,
+		Reset: period - elapsed,
+	}
+
+	weight := 1 - float64(elapsed)/float64(period)
+	estimated := float64(previous)*weight + float64(current)
+
+	// tolerance for float rounding right at the RetryAfter boundary
+	if estimated+1 <= float64(limit)+1e-9 {
+		result.Allowed = true
+		return result
+	}
+
+	var wait time.Duration
+	if current+1 > limit {
+		// the ongoing window alone exhausts the budget: wait for it to end
+		// and for its weight to decay enough in the next one
+		wait = period - elapsed
+		if current > 0 {
+			wait += time.Duration(float64(period) * (1 - float64(limit-1)/float64(current)))
+		}
+	} else {
+		// the previous window still weighs too much
+		needed := 1 - float64(limit-current-1)/float64(previous)
+		wait = time.Duration(float64(period)*needed) - elapsed
+	}
+
+	if wait <= 0 {
+		wait = time.Millisecond
+	}
+
+	result.RetryAfter = wait
+	return result
+}
+
+func remaining(previous, current, limit int, elapsed, period time.Duration) int {
+
+	weight := 1 - float64(elapsed)/float64(period)
+	left := float64(limit) - (float64(previous)*weight + float64(current))
+
+	return int(math.Max(0, math.Floor(left)))
+}
@@ -0,0 +1,122 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newClock() *fakeClock {
+	return &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func TestMemoryLimiterSlidingWindow(t *testing.T) {
+
+	clock := newClock()
+	limiter := NewMemoryLimiter()
+	limiter.now = clock.now
+
+	testSlidingWindow(t, limiter, clock)
+
+	clock.advance(5 * time.Minute)
+	limiter.Allow(context.Background(), "user:1", 10, time.Minute)
+	assert.Len(t, limiter.windows, 1, "stale keys are swept")
+}
+
+// testSlidingWindow is shared by every RateLimiter implementation.
+func testSlidingWindow(t *testing.T, limiter RateLimiter, clock *fakeClock) {
+
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		result, err := limiter.Allow(ctx, "user:1", 10, time.Minute)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 9-i, result.Remaining)
+	}
+
+	result, _ := limiter.Allow(ctx, "user:1", 10, time.Minute)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, time.Minute, result.Reset)
+	assert.True(t, result.RetryAfter > time.Minute, "has to wait for the previous window to decay")
+
+	other, _ := limiter.Allow(ctx, "user:2", 10, time.Minute)
+	assert.True(t, other.Allowed, "keys have separate budgets")
+
+	// half way through the next window the previous one still counts half
+	clock.advance(90 * time.Second)
+	for i := 0; i < 5; i++ {
+		result, _ = limiter.Allow(ctx, "user:1", 10, time.Minute)
+		assert.True(t, result.Allowed)
+	}
+	result, _ = limiter.Allow(ctx, "user:1", 10, time.Minute)
+	assert.False(t, result.Allowed)
+
+	clock.advance(result.RetryAfter)
+	result, _ = limiter.Allow(ctx, "user:1", 10, time.Minute)
+	assert.True(t, result.Allowed, "allowed again after RetryAfter")
+
+	// an idle key starts from scratch
+	clock.advance(5 * time.Minute)
+	result, _ = limiter.Allow(ctx, "user:1", 10, time.Minute)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 9, result.Remaining)
+}
+
+func TestMemoryFailures(t *testing.T) {
+
+	clock := newClock()
+	testFailureStore(t, NewMemoryFailures(), clock)
+}
+
+func testFailureStore(t *testing.T, store FailureStore, clock *fakeClock) {
+
+	ctx := context.Background()
+	forget := 10 * time.Minute
+
+	f, err := store.Get(ctx, "user:alice", clock.now())
+	assert.NoError(t, err)
+	assert.Equal(t, Failures{}, f)
+
+	store.Fail(ctx, "user:alice", clock.now(), forget)
+	clock.advance(time.Second)
+	f, err = store.Fail(ctx, "user:alice", clock.now(), forget)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, f.Count)
+	assert.True(t, clock.now().Equal(f.Last))
+	assert.True(t, f.BlockedUntil.IsZero())
+
+	until := clock.now().Add(5 * time.Minute)
+	assert.NoError(t, store.Block(ctx, "user:alice", until))
+	store.Fail(ctx, "ip:10.0.0.1", clock.now(), forget)
+
+	blocked, err := store.Blocked(ctx, clock.now())
+	assert.NoError(t, err)
+	assert.Len(t, blocked, 1)
+	assert.Equal(t, 2, blocked["user:alice"].Count)
+	assert.True(t, until.Equal(blocked["user:alice"].BlockedUntil))
+
+	clock.advance(6 * time.Minute)
+	blocked, _ = store.Blocked(ctx, clock.now())
+	assert.Empty(t, blocked, "blocks end")
+	f, _ = store.Get(ctx, "user:alice", clock.now())
+	assert.Equal(t, 2, f.Count, "failures are kept until forgotten")
+
+	found, err := store.Reset(ctx, "user:alice")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	found, _ = store.Reset(ctx, "user:alice")
+	assert.False(t, found)
+
+	clock.advance(forget + time.Second)
+	f, _ = store.Get(ctx, "ip:10.0.0.1", clock.now())
+	assert.Equal(t, Failures{}, f, "failures are forgotten")
+}
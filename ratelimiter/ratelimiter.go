@@ -0,0 +1,18 @@
+package ratelimiter
+
+import "NOTESBE/config"
+
+// New returns the limiter selected by ratelimit.store.
+func New(cfg config.RateLimitConfig) RateLimiter {
+
+	if cfg.Store == "redis" {
+		return NewRedisLimiter(RedisOptions{
+			Addr:     cfg.Redis.Addr,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+			Prefix:   cfg.Redis.Prefix,
+		})
+	}
+
+	return NewMemoryLimiter()
+}
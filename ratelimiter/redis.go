@@ -0,0 +1,456 @@
+package ratelimiter
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// RedisLimiter keeps the sliding window counters in a Redis compatible
+// server so that every replica shares the same budgets. Each fixed window is
+// a counter key expiring after two periods.
+type RedisLimiter struct {
+	prefix string
+	pool   *redisPool
+	now    func() time.Time
+}
+
+type RedisOptions struct {
+	Addr     string
+	Password string
+	DB       int
+	Prefix   string
+	PoolSize int
+	Timeout  time.Duration
+}
+
+func NewRedisLimiter(opts RedisOptions) *RedisLimiter {
+
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = 10
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Second
+	}
+
+	return &RedisLimiter{
+		prefix: opts.Prefix,
+		pool:   &redisPool{opts: opts, idle: make(chan *redisConn, opts.PoolSize)},
+		now:    time.Now,
+	}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string, limit int, period time.Duration) (Result, error) {
+
+	now := l.now()
+	start := now.Truncate(period)
+	elapsed := now.Sub(start)
+
+	currentKey := l.prefix + key + ":" + strconv.FormatInt(start.UnixMilli(), 10)
+	previousKey := l.prefix + key + ":" + strconv.FormatInt(start.Add(-period).UnixMilli(), 10)
+	ttl := strconv.FormatInt((2 * period).Milliseconds(), 10)
+
+	conn, err := l.pool.get(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// count the request optimistically and roll back when it is over the
+	// limit, so concurrent replicas never both take the last slot
+	replies, err := conn.pipeline(
+		[]string{"INCR", currentKey},
+		[]string{"PEXPIRE", currentKey, ttl},
+		[]string{"GET", previousKey},
+	)
+	if err != nil {
+		conn.Close()
+		return Result{}, err
+	}
+
+	current, err := replyInt(replies[0])
+	if err != nil {
+		l.pool.put(conn)
+		return Result{}, err
+	}
+
+	previous := 0
+	if replies[2] != nil {
+		if previous, err = replyInt(replies[2]); err != nil {
+			l.pool.put(conn)
+			return Result{}, err
+		}
+	}
+
+	result := evaluate(previous, int(current)-1, limit, elapsed, period)
+
+	if !result.Allowed {
+		if _, err := conn.pipeline([]string{"DECR", currentKey}); err != nil {
+			conn.Close()
+			return result, nil
+		}
+	} else {
+		result.Remaining = remaining(previous, int(current), limit, elapsed, period)
+	}
+
+	l.pool.put(conn)
+
+	return result, nil
+}
+
+func (l *RedisLimiter) Close() error {
+	return l.pool.close()
+}
+
+// RedisFailures keeps the failures of each key in a Redis hash expiring
+// when they are forgotten, and the blocked keys in a sorted set scored by
+// the end of the block, so that every replica sees the same failures.
+type RedisFailures struct {
+	prefix string
+	pool   *redisPool
+}
+
+func NewRedisFailures(opts RedisOptions) *RedisFailures {
+
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = 10
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Second
+	}
+
+	return &RedisFailures{
+		prefix: opts.Prefix,
+		pool:   &redisPool{opts: opts, idle: make(chan *redisConn, opts.PoolSize)},
+	}
+}
+
+func (f *RedisFailures) hashKey(key string) string { return f.prefix + "failures:" + key }
+func (f *RedisFailures) blockedKey() string        { return f.prefix + "failures:blocked" }
+
+func (f *RedisFailures) Get(ctx context.Context, key string, now time.Time) (Failures, error) {
+
+	replies, err := f.pool.do(ctx, []string{"HMGET", f.hashKey(key), "count", "last", "until"})
+	if err != nil {
+		return Failures{}, err
+	}
+
+	return replyFailures(replies[0])
+}
+
+func (f *RedisFailures) Fail(ctx context.Context, key string, now time.Time, forget time.Duration) (Failures, error) {
+
+	hash := f.hashKey(key)
+
+	replies, err := f.pool.do(ctx,
+		[]string{"HINCRBY", hash, "count", "1"},
+		[]string{"HSET", hash, "last", strconv.FormatInt(now.UnixMilli(), 10)},
+		[]string{"PEXPIRE", hash, strconv.FormatInt(forget.Milliseconds(), 10)},
+		[]string{"HMGET", hash, "count", "last", "until"},
+	)
+	if err != nil {
+		return Failures{}, err
+	}
+
+	return replyFailures(replies[3])
+}
+
+func (f *RedisFailures) Block(ctx context.Context, key string, until time.Time) error {
+
+	ms := strconv.FormatInt(until.UnixMilli(), 10)
+
+	_, err := f.pool.do(ctx,
+		[]string{"HSET", f.hashKey(key), "until", ms},
+		[]string{"ZADD", f.blockedKey(), ms, key},
+	)
+
+	return err
+}
+
+func (f *RedisFailures) Reset(ctx context.Context, key string) (bool, error) {
+
+	replies, err := f.pool.do(ctx,
+		[]string{"DEL", f.hashKey(key)},
+		[]string{"ZREM", f.blockedKey(), key},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	deleted, err := replyInt(replies[0])
+
+	return deleted > 0, err
+}
+
+func (f *RedisFailures) Blocked(ctx context.Context, now time.Time) (map[string]Failures, error) {
+
+	ms := strconv.FormatInt(now.UnixMilli(), 10)
+
+	replies, err := f.pool.do(ctx,
+		[]string{"ZREMRANGEBYSCORE", f.blockedKey(), "-inf", ms},
+		[]string{"ZRANGEBYSCORE", f.blockedKey(), "(" + ms, "+inf"},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, _ := replies[1].([]interface{})
+	blocked := map[string]Failures{}
+	if len(keys) == 0 {
+		return blocked, nil
+	}
+
+	commands := [][]string{}
+	for _, key := range keys {
+		commands = append(commands, []string{"HMGET", f.hashKey(fmt.Sprint(key)), "count", "last", "until"})
+	}
+
+	replies, err = f.pool.do(ctx, commands...)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, key := range keys {
+		failures, err := replyFailures(replies[i])
+		if err != nil {
+			return nil, err
+		}
+		// reset between the two round trips
+		if failures.Count == 0 {
+			continue
+		}
+		blocked[fmt.Sprint(key)] = failures
+	}
+
+	return blocked, nil
+}
+
+func (f *RedisFailures) Close() error {
+	return f.pool.close()
+}
+
+// replyFailures reads the reply to HMGET of count, last and until.
+func replyFailures(reply interface{}) (Failures, error) {
+
+	fields, ok := reply.([]interface{})
+	if !ok || len(fields) != 3 {
+		return Failures{}, fmt.Errorf("redis: unexpected reply %v", reply)
+	}
+
+	values := [3]int{}
+	for i, field := range fields {
+		if field == nil {
+			continue
+		}
+		value, err := replyInt(field)
+		if err != nil {
+			return Failures{}, err
+		}
+		values[i] = value
+	}
+
+	failures := Failures{Count: values[0]}
+	if values[1] != 0 {
+		failures.Last = time.UnixMilli(int64(values[1]))
+	}
+	if values[2] != 0 {
+		failures.BlockedUntil = time.UnixMilli(int64(values[2]))
+	}
+
+	return failures, nil
+}
+
+type redisPool struct {
+	opts RedisOptions
+	idle chan *redisConn
+}
+
+func (p *redisPool) get(ctx context.Context) (*redisConn, error) {
+
+	select {
+	case conn := <-p.idle:
+		return conn, nil
+	default:
+	}
+
+	dialer := net.Dialer{Timeout: p.opts.Timeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", p.opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &redisConn{Conn: netConn, reader: bufio.NewReader(netConn), timeout: p.opts.Timeout}
+
+	if p.opts.Password != "" {
+		if _, err := conn.pipeline([]string{"AUTH", p.opts.Password}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if p.opts.DB != 0 {
+		if _, err := conn.pipeline([]string{"SELECT", strconv.Itoa(p.opts.DB)}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// do runs the commands on a connection of the pool and returns their
+// replies.
+func (p *redisPool) do(ctx context.Context, commands ...[]string) ([]interface{}, error) {
+
+	conn, err := p.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := conn.pipeline(commands...)
+	if err != nil {
+		// replies after an error reply are left unread
+		conn.Close()
+		return nil, err
+	}
+
+	p.put(conn)
+
+	return replies, nil
+}
+
+func (p *redisPool) put(conn *redisConn) {
+	select {
+	case p.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+func (p *redisPool) close() error {
+	for {
+		select {
+		case conn := <-p.idle:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// redisConn speaks just enough RESP2 for the limiter.
+type redisConn struct {
+	net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+}
+
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// pipeline sends all commands before reading the replies. Nil bulk replies
+// are returned as nil, Redis error replies as redisError.
+func (c *redisConn) pipeline(commands ...[]string) ([]interface{}, error) {
+
+	c.SetDeadline(time.Now().Add(c.timeout))
+
+	buf := []byte{}
+	for _, args := range commands {
+		buf = append(buf, '*')
+		buf = strconv.AppendInt(buf, int64(len(args)), 10)
+		buf = append(buf, '\r', '\n')
+		for _, arg := range args {
+			buf = append(buf, '$')
+			buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+			buf = append(buf, '\r', '\n')
+			buf = append(buf, arg...)
+			buf = append(buf, '\r', '\n')
+		}
+	}
+
+	if _, err := c.Write(buf); err != nil {
+		return nil, err
+	}
+
+	replies := make([]interface{}, len(commands))
+	for i := range commands {
+		reply, err := c.readReply()
+		if err != nil {
+			return nil, err
+		}
+		if replyErr, ok := reply.(redisError); ok {
+			return nil, replyErr
+		}
+		replies[i] = reply
+	}
+
+	return replies, nil
+}
+
+func (c *redisConn) readReply() (interface{}, error) {
+
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: malformed reply")
+	}
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+func replyInt(reply interface{}) (int, error) {
+
+	switch v := reply.(type) {
+	case int64:
+		return int(v), nil
+	case string:
+		return strconv.Atoi(v)
+	}
+
+	return 0, fmt.Errorf("redis: unexpected reply %v", reply)
+}
@@ -0,0 +1,359 @@
+package ratelimiter
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRedis is an in-memory stand-in implementing the subset of the Redis
+// protocol used by RedisLimiter and RedisFailures.
+type fakeRedis struct {
+	listener net.Listener
+	now      func() time.Time
+	password string
+
+	mu      sync.Mutex
+	values  map[string]int64
+	hashes  map[string]map[string]string
+	zsets   map[string]map[string]int64
+	expires map[string]time.Time
+}
+
+// newFakeRedis starts a fake Redis server, which requires AUTH when password
+// is not empty.
+func newFakeRedis(t *testing.T, now func() time.Time, password string) *fakeRedis {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &fakeRedis{
+		listener: listener,
+		password: password,
+		now:      now,
+		values:   map[string]int64{},
+		hashes:   map[string]map[string]string{},
+		zsets:    map[string]map[string]int64{},
+		expires:  map[string]time.Time{},
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+
+	return r
+}
+
+func (r *fakeRedis) addr() string {
+	return r.listener.Addr().String()
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authed := r.password == ""
+
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+
+		cmd := strings.ToUpper(args[0])
+		if !authed && cmd != "AUTH" {
+			fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+
+		switch cmd {
+		case "AUTH":
+			if args[1] != r.password {
+				fmt.Fprint(conn, "-WRONGPASS invalid password\r\n")
+				continue
+			}
+			authed = true
+			fmt.Fprint(conn, "+OK\r\n")
+		case "PING":
+			fmt.Fprint(conn, "+PONG\r\n")
+		case "SELECT":
+			fmt.Fprint(conn, "+OK\r\n")
+		case "INCR", "DECR":
+			delta := int64(1)
+			if cmd == "DECR" {
+				delta = -1
+			}
+			r.mu.Lock()
+			r.expire(args[1])
+			r.values[args[1]] += delta
+			value := r.values[args[1]]
+			r.mu.Unlock()
+			fmt.Fprintf(conn, ":%d\r\n", value)
+		case "GET":
+			r.mu.Lock()
+			r.expire(args[1])
+			value, found := r.values[args[1]]
+			r.mu.Unlock()
+			if !found {
+				fmt.Fprint(conn, "$-1\r\n")
+				continue
+			}
+			s := strconv.FormatInt(value, 10)
+			fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(s), s)
+		case "PEXPIRE":
+			ms, _ := strconv.ParseInt(args[2], 10, 64)
+			r.mu.Lock()
+			_, found := r.values[args[1]]
+			if _, hash := r.hashes[args[1]]; hash {
+				found = true
+			}
+			if found {
+				r.expires[args[1]] = r.now().Add(time.Duration(ms) * time.Millisecond)
+			}
+			r.mu.Unlock()
+			if found {
+				fmt.Fprint(conn, ":1\r\n")
+			} else {
+				fmt.Fprint(conn, ":0\r\n")
+			}
+		case "HINCRBY", "HSET", "HMGET", "DEL":
+			r.mu.Lock()
+			r.expire(args[1])
+			hash, found := r.hashes[args[1]]
+			if !found && cmd != "HMGET" && cmd != "DEL" {
+				hash = map[string]string{}
+				r.hashes[args[1]] = hash
+			}
+			switch cmd {
+			case "HINCRBY":
+				value, _ := strconv.ParseInt(hash[args[2]], 10, 64)
+				delta, _ := strconv.ParseInt(args[3], 10, 64)
+				hash[args[2]] = strconv.FormatInt(value+delta, 10)
+				fmt.Fprintf(conn, ":%d\r\n", value+delta)
+			case "HSET":
+				for i := 2; i+1 < len(args); i += 2 {
+					hash[args[i]] = args[i+1]
+				}
+				fmt.Fprintf(conn, ":%d\r\n", (len(args)-2)/2)
+			case "HMGET":
+				fmt.Fprintf(conn, "*%d\r\n", len(args)-2)
+				for _, field := range args[2:] {
+					value, set := hash[field]
+					if !set {
+						fmt.Fprint(conn, "$-1\r\n")
+						continue
+					}
+					fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(value), value)
+				}
+			case "DEL":
+				delete(r.hashes, args[1])
+				delete(r.expires, args[1])
+				if found {
+					fmt.Fprint(conn, ":1\r\n")
+				} else {
+					fmt.Fprint(conn, ":0\r\n")
+				}
+			}
+			r.mu.Unlock()
+		case "ZADD", "ZREM", "ZREMRANGEBYSCORE", "ZRANGEBYSCORE":
+			r.mu.Lock()
+			set, found := r.zsets[args[1]]
+			if !found {
+				set = map[string]int64{}
+				r.zsets[args[1]] = set
+			}
+			switch cmd {
+			case "ZADD":
+				score, _ := strconv.ParseInt(args[2], 10, 64)
+				set[args[3]] = score
+				fmt.Fprint(conn, ":1\r\n")
+			case "ZREM":
+				delete(set, args[2])
+				fmt.Fprint(conn, ":1\r\n")
+			case "ZREMRANGEBYSCORE":
+				// only -inf to a score is used
+				max, _ := strconv.ParseInt(args[3], 10, 64)
+				removed := 0
+				for member, score := range set {
+					if score <= max {
+						delete(set, member)
+						removed++
+					}
+				}
+				fmt.Fprintf(conn, ":%d\r\n", removed)
+			case "ZRANGEBYSCORE":
+				// only an exclusive score to +inf is used
+				min, _ := strconv.ParseInt(strings.TrimPrefix(args[2], "("), 10, 64)
+				members := []string{}
+				for member, score := range set {
+					if score > min {
+						members = append(members, member)
+					}
+				}
+				fmt.Fprintf(conn, "*%d\r\n", len(members))
+				for _, member := range members {
+					fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(member), member)
+				}
+			}
+			r.mu.Unlock()
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+	}
+}
+
+func (r *fakeRedis) expire(key string) {
+	if at, found := r.expires[key]; found && !r.now().Before(at) {
+		delete(r.values, key)
+		delete(r.hashes, key)
+		delete(r.expires, key)
+	}
+}
+
+func (r *fakeRedis) keys() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range r.values {
+		r.expire(key)
+	}
+	for key := range r.hashes {
+		r.expire(key)
+	}
+	return len(r.values) + len(r.hashes)
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, count)
+	for i := range args {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+
+	return args, nil
+}
+
+func TestRedisLimiterSlidingWindow(t *testing.T) {
+
+	clock := newClock()
+	redis := newFakeRedis(t, clock.now, "")
+
+	limiter := NewRedisLimiter(RedisOptions{Addr: redis.addr(), Prefix: "test:"})
+	limiter.now = clock.now
+	defer limiter.Close()
+
+	testSlidingWindow(t, limiter, clock)
+
+	clock.advance(5 * time.Minute)
+	assert.Equal(t, 0, redis.keys(), "counters expire after two windows")
+}
+
+func TestRedisLimiterSharedBetweenReplicas(t *testing.T) {
+
+	clock := newClock()
+	redis := newFakeRedis(t, clock.now, "secret")
+	ctx := context.Background()
+
+	replicas := []*RedisLimiter{}
+	for i := 0; i < 3; i++ {
+		limiter := NewRedisLimiter(RedisOptions{Addr: redis.addr(), Password: "secret", DB: 1})
+		limiter.now = clock.now
+		defer limiter.Close()
+		replicas = append(replicas, limiter)
+	}
+
+	allowed := 0
+	for i := 0; i < 30; i++ {
+		result, err := replicas[i%3].Allow(ctx, "ip:10.0.0.1", 10, time.Second)
+		assert.NoError(t, err)
+		if result.Allowed {
+			allowed++
+		}
+	}
+
+	assert.Equal(t, 10, allowed, "the limit applies across replicas, not per replica")
+}
+
+func TestRedisLimiterUnavailable(t *testing.T) {
+
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := listener.Addr().String()
+	listener.Close()
+
+	limiter := NewRedisLimiter(RedisOptions{Addr: addr, Timeout: 100 * time.Millisecond})
+
+	_, err := limiter.Allow(context.Background(), "ip:10.0.0.1", 10, time.Second)
+	assert.Error(t, err)
+}
+
+func TestRedisFailures(t *testing.T) {
+
+	clock := newClock()
+	redis := newFakeRedis(t, clock.now, "")
+
+	store := NewRedisFailures(RedisOptions{Addr: redis.addr(), Prefix: "test:"})
+	defer store.Close()
+
+	testFailureStore(t, store, clock)
+
+	clock.advance(time.Hour)
+	assert.Equal(t, 0, redis.keys(), "failures expire once forgotten")
+}
+
+func TestRedisFailuresSharedBetweenReplicas(t *testing.T) {
+
+	clock := newClock()
+	redis := newFakeRedis(t, clock.now, "")
+	ctx := context.Background()
+
+	first := NewRedisFailures(RedisOptions{Addr: redis.addr()})
+	defer first.Close()
+	second := NewRedisFailures(RedisOptions{Addr: redis.addr()})
+	defer second.Close()
+
+	first.Fail(ctx, "user:alice", clock.now(), time.Minute)
+	f, err := second.Fail(ctx, "user:alice", clock.now(), time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, f.Count, "failures count across replicas")
+
+	until := clock.now().Add(time.Minute)
+	assert.NoError(t, second.Block(ctx, "user:alice", until))
+	f, _ = first.Get(ctx, "user:alice", clock.now())
+	assert.True(t, until.Equal(f.BlockedUntil))
+}
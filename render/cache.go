@@ -0,0 +1,97 @@
+package render
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// cacheSize is how many rendered notes are kept.
+const cacheSize = 1024
+
+// Cache keeps the HTML of recently rendered notes. An entry is only used for
+// the version of the note it was rendered from, identified by its update
+// time, and is dropped with Invalidate when the note changes. The zero value
+// is ready to use.
+type Cache struct {
+	mu      sync.Mutex
+	entries map[uint64]*list.Element
+	order   list.List
+}
+
+type cacheEntry struct {
+	noteId  uint64
+	updated time.Time
+	html    string
+}
+
+func (c *Cache) Get(noteId uint64, updated time.Time) (string, bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[noteId]
+	if !ok {
+		return "", false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if !entry.updated.Equal(updated) {
+		return "", false
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.html, true
+}
+
+func (c *Cache) Put(noteId uint64, updated time.Time, html string) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = map[uint64]*list.Element{}
+	}
+
+	if elem, ok := c.entries[noteId]; ok {
+		elem.Value = &cacheEntry{noteId: noteId, updated: updated, html: html}
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[noteId] = c.order.PushFront(&cacheEntry{noteId: noteId, updated: updated, html: html})
+
+	if c.order.Len() > cacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).noteId)
+	}
+}
+
+func (c *Cache) Invalidate(noteId uint64) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[noteId]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, noteId)
+	}
+}
+
+// Render returns the HTML of a note, from the cache when it was rendered
+// since its last update.
+func (c *Cache) Render(noteId uint64, updated time.Time, source string) (string, error) {
+
+	if html, ok := c.Get(noteId, updated); ok {
+		return html, nil
+	}
+
+	html, err := HTML(source)
+	if err != nil {
+		return "", err
+	}
+
+	c.Put(noteId, updated, html)
+	return html, nil
+}
@@ -0,0 +1,401 @@
+package render
+
+import (
+	"bytes"
+	"embed"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// fontFiles are DejaVu Sans Mono and its bold face, see fonts/LICENSE. They
+// cover Latin, Greek, Cyrillic and many symbols, but no CJK or emoji.
+//
+//go:embed fonts/*.ttf
+var fontFiles embed.FS
+
+var (
+	fontsOnce          sync.Once
+	regular, bold      *trueType
+	errFontUnavailable error
+)
+
+// loadFonts parses the embedded fonts once.
+func loadFonts() (*trueType, *trueType, error) {
+
+	fontsOnce.Do(func() {
+		regular, errFontUnavailable = openFont("fonts/DejaVuSansMono.ttf", "DejaVuSansMono")
+		if errFontUnavailable == nil {
+			bold, errFontUnavailable = openFont("fonts/DejaVuSansMono-Bold.ttf", "DejaVuSansMono-Bold")
+		}
+	})
+
+	return regular, bold, errFontUnavailable
+}
+
+func openFont(file, name string) (*trueType, error) {
+
+	data, err := fontFiles.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	font, err := parseTrueType(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	font.name = name
+
+	return font, nil
+}
+
+var errBadFont = errors.New("not a TrueType font")
+
+// trueType is the part of a TrueType font that PDF needs: the glyph of a
+// character, the glyph widths and the tables that are embedded.
+type trueType struct {
+	name       string
+	tables     map[string][]byte
+	unitsPerEm int
+	bbox       [4]int
+	ascent     int
+	descent    int
+	numGlyphs  int
+	glyphs     map[rune]uint16
+	advances   []int
+	longLoca   bool
+}
+
+func parseTrueType(data []byte) (*trueType, error) {
+
+	if len(data) < 12 {
+		return nil, errBadFont
+	}
+
+	font := &trueType{tables: map[string][]byte{}, glyphs: map[rune]uint16{}}
+
+	count := int(binary.BigEndian.Uint16(data[4:]))
+	for i := 0; i < count; i++ {
+		record := 12 + 16*i
+		if record+16 > len(data) {
+			return nil, errBadFont
+		}
+		offset := int(binary.BigEndian.Uint32(data[record+8:]))
+		length := int(binary.BigEndian.Uint32(data[record+12:]))
+		if offset < 0 || length < 0 || offset+length > len(data) {
+			return nil, errBadFont
+		}
+		font.tables[string(data[record:record+4])] = data[offset : offset+length]
+	}
+
+	head, hhea, maxp := font.tables["head"], font.tables["hhea"], font.tables["maxp"]
+	if len(head) < 54 || len(hhea) < 36 || len(maxp) < 6 || font.tables["glyf"] == nil || font.tables["loca"] == nil {
+		return nil, errBadFont
+	}
+
+	font.unitsPerEm = int(binary.BigEndian.Uint16(head[18:]))
+	for i := range font.bbox {
+		font.bbox[i] = int(int16(binary.BigEndian.Uint16(head[36+2*i:])))
+	}
+	font.longLoca = binary.BigEndian.Uint16(head[50:]) == 1
+	font.ascent = int(int16(binary.BigEndian.Uint16(hhea[4:])))
+	font.descent = int(int16(binary.BigEndian.Uint16(hhea[6:])))
+	font.numGlyphs = int(binary.BigEndian.Uint16(maxp[4:]))
+
+	// glyphs past the last long metric have its advance
+	metrics := int(binary.BigEndian.Uint16(hhea[34:]))
+	hmtx := font.tables["hmtx"]
+	if metrics == 0 || len(hmtx) < 4*metrics || font.unitsPerEm == 0 {
+		return nil, errBadFont
+	}
+	font.advances = make([]int, font.numGlyphs)
+	for i := range font.advances {
+		font.advances[i] = int(binary.BigEndian.Uint16(hmtx[4*minInt(i, metrics-1):]))
+	}
+
+	if err := font.parseCmap(); err != nil {
+		return nil, err
+	}
+
+	return font, nil
+}
+
+// parseCmap reads the Unicode character map, format 12 for the full range
+// or format 4 for the Basic Multilingual Plane.
+func (f *trueType) parseCmap() error {
+
+	cmap := f.tables["cmap"]
+	if len(cmap) < 4 {
+		return errBadFont
+	}
+
+	var format4, format12 []byte
+	count := int(binary.BigEndian.Uint16(cmap[2:]))
+	for i := 0; i < count && 4+8*i+8 <= len(cmap); i++ {
+		record := cmap[4+8*i:]
+		platform, encoding := binary.BigEndian.Uint16(record), binary.BigEndian.Uint16(record[2:])
+		offset := int(binary.BigEndian.Uint32(record[4:]))
+		if offset+4 > len(cmap) || platform != 3 {
+			continue
+		}
+		switch subtable := cmap[offset:]; {
+		case encoding == 10 && binary.BigEndian.Uint16(subtable) == 12:
+			format12 = subtable
+		case encoding == 1 && binary.BigEndian.Uint16(subtable) == 4:
+			format4 = subtable
+		}
+	}
+
+	switch {
+	case len(format12) >= 16:
+		groups := int(binary.BigEndian.Uint32(format12[12:]))
+		for i := 0; i < groups && 16+12*i+12 <= len(format12); i++ {
+			group := format12[16+12*i:]
+			start, end := binary.BigEndian.Uint32(group), binary.BigEndian.Uint32(group[4:])
+			glyph := binary.BigEndian.Uint32(group[8:])
+			for c := start; c <= end && c <= 0x10ffff; c++ {
+				f.glyphs[rune(c)] = uint16(glyph + c - start)
+			}
+		}
+
+	case len(format4) >= 14:
+		segments := int(binary.BigEndian.Uint16(format4[6:])) / 2
+		if len(format4) < 16+8*segments {
+			return errBadFont
+		}
+		ends, starts := format4[14:], format4[16+2*segments:]
+		deltas, ranges := format4[16+4*segments:], format4[16+6*segments:]
+		for i := 0; i < segments; i++ {
+			start, end := binary.BigEndian.Uint16(starts[2*i:]), binary.BigEndian.Uint16(ends[2*i:])
+			delta, offset := binary.BigEndian.Uint16(deltas[2*i:]), int(binary.BigEndian.Uint16(ranges[2*i:]))
+			for c := int(start); c <= int(end) && c != 0xffff; c++ {
+				glyph := uint16(c) + delta
+				if offset != 0 {
+					at := 2*i + offset + 2*(c-int(start))
+					if at+2 > len(ranges) {
+						continue
+					}
+					if glyph = binary.BigEndian.Uint16(ranges[at:]); glyph != 0 {
+						glyph += delta
+					}
+				}
+				f.glyphs[rune(c)] = glyph
+			}
+		}
+
+	default:
+		return errBadFont
+	}
+
+	return nil
+}
+
+// glyph returns the glyph of r, 0 when the font does not have one.
+func (f *trueType) glyph(r rune) uint16 {
+
+	glyph := f.glyphs[r]
+	if int(glyph) >= f.numGlyphs {
+		return 0
+	}
+
+	return glyph
+}
+
+// width returns the advance of glyph in PDF text space, 1000 to the em.
+func (f *trueType) width(glyph uint16) int {
+	return f.advances[glyph] * 1000 / f.unitsPerEm
+}
+
+// scale converts font units to PDF text space.
+func (f *trueType) scale(v int) int {
+	return v * 1000 / f.unitsPerEm
+}
+
+// glyphData returns the outline of glyph from the glyf table.
+func (f *trueType) glyphData(glyph uint16) []byte {
+
+	loca, glyf := f.tables["loca"], f.tables["glyf"]
+
+	var start, end int
+	if f.longLoca {
+		if 4*int(glyph)+8 > len(loca) {
+			return nil
+		}
+		start = int(binary.BigEndian.Uint32(loca[4*int(glyph):]))
+		end = int(binary.BigEndian.Uint32(loca[4*int(glyph)+4:]))
+	} else {
+		if 2*int(glyph)+4 > len(loca) {
+			return nil
+		}
+		start = 2 * int(binary.BigEndian.Uint16(loca[2*int(glyph):]))
+		end = 2 * int(binary.BigEndian.Uint16(loca[2*int(glyph)+2:]))
+	}
+
+	if start >= end || end > len(glyf) {
+		return nil
+	}
+
+	return glyf[start:end]
+}
+
+// components returns the glyphs a composite glyph is built from.
+func components(data []byte) []uint16 {
+
+	const (
+		argsAreWords = 0x0001
+		haveScale    = 0x0008
+		moreGlyphs   = 0x0020
+		haveXYScale  = 0x0040
+		have2x2      = 0x0080
+	)
+
+	// a negative number of contours marks a composite glyph
+	if len(data) < 10 || int16(binary.BigEndian.Uint16(data)) >= 0 {
+		return nil
+	}
+
+	var glyphs []uint16
+	for at := 10; at+4 <= len(data); {
+		flags := binary.BigEndian.Uint16(data[at:])
+		glyphs = append(glyphs, binary.BigEndian.Uint16(data[at+2:]))
+		at += 4
+		if flags&argsAreWords != 0 {
+			at += 4
+		} else {
+			at += 2
+		}
+		switch {
+		case flags&haveScale != 0:
+			at += 2
+		case flags&haveXYScale != 0:
+			at += 4
+		case flags&have2x2 != 0:
+			at += 8
+		}
+		if flags&moreGlyphs == 0 {
+			break
+		}
+	}
+
+	return glyphs
+}
+
+// subsetTables are the tables a PDF reader needs from an embedded TrueType
+// font, with the character map and post table that some readers insist on;
+// the names and layout tables are left out.
+var subsetTables = []string{"cmap", "cvt ", "fpgm", "glyf", "head", "hhea", "hmtx", "loca", "maxp", "post", "prep"}
+
+// subset returns the font with the outlines of the given glyphs only. The
+// other glyphs keep their numbers but are empty, so text can refer to the
+// glyphs of the full font.
+func (f *trueType) subset(used map[uint16]rune) []byte {
+
+	keep := map[uint16]bool{0: true}
+	var pending []uint16
+	for glyph := range used {
+		pending = append(pending, glyph)
+	}
+	for len(pending) > 0 {
+		glyph := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if keep[glyph] || int(glyph) >= f.numGlyphs {
+			continue
+		}
+		keep[glyph] = true
+		pending = append(pending, components(f.glyphData(glyph))...)
+	}
+	// .notdef may itself be composite
+	pending = append(pending, components(f.glyphData(0))...)
+	for _, glyph := range pending {
+		keep[glyph] = true
+	}
+
+	var glyf bytes.Buffer
+	loca := make([]byte, 4*(f.numGlyphs+1))
+	for glyph := 0; glyph < f.numGlyphs; glyph++ {
+		binary.BigEndian.PutUint32(loca[4*glyph:], uint32(glyf.Len()))
+		if keep[uint16(glyph)] {
+			glyf.Write(f.glyphData(uint16(glyph)))
+			for glyf.Len()%4 != 0 {
+				glyf.WriteByte(0)
+			}
+		}
+	}
+	binary.BigEndian.PutUint32(loca[4*f.numGlyphs:], uint32(glyf.Len()))
+
+	// the subset always has long offsets
+	head := append([]byte(nil), f.tables["head"]...)
+	binary.BigEndian.PutUint32(head[8:], 0)
+	binary.BigEndian.PutUint16(head[50:], 1)
+
+	// a version 3 post table has the metrics of the original but no glyph
+	// names, which are most of it
+	tables := map[string][]byte{"glyf": glyf.Bytes(), "loca": loca, "head": head}
+	if post := f.tables["post"]; len(post) >= 32 {
+		tables["post"] = append([]byte{0, 3, 0, 0}, post[4:32]...)
+	}
+	var tags []string
+	for _, tag := range subsetTables {
+		if tables[tag] == nil && f.tables[tag] != nil {
+			tables[tag] = f.tables[tag]
+		}
+		if tables[tag] != nil {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+
+	// the offset table, with the binary search hints of the spec
+	var out bytes.Buffer
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= len(tags) {
+		entrySelector++
+	}
+	searchRange := 16 << entrySelector
+	binary.Write(&out, binary.BigEndian, []uint16{1, 0, uint16(len(tags)), uint16(searchRange), uint16(entrySelector), uint16(16*len(tags) - searchRange)})
+
+	offset := 12 + 16*len(tags)
+	for _, tag := range tags {
+		out.WriteString(tag)
+		binary.Write(&out, binary.BigEndian, []uint32{checksum(tables[tag]), uint32(offset), uint32(len(tables[tag]))})
+		offset += (len(tables[tag]) + 3) &^ 3
+	}
+
+	headAt := 0
+	for _, tag := range tags {
+		if tag == "head" {
+			headAt = out.Len()
+		}
+		out.Write(tables[tag])
+		for out.Len()%4 != 0 {
+			out.WriteByte(0)
+		}
+	}
+
+	font := out.Bytes()
+	binary.BigEndian.PutUint32(font[headAt+8:], 0xb1b0afba-checksum(font))
+
+	return font
+}
+
+// checksum is the TrueType table checksum, the sum of its 32 bit words.
+func checksum(data []byte) uint32 {
+
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+
+	return sum
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
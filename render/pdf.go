@@ -0,0 +1,346 @@
+package render
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// Page layout of PDF in points: A4 with 2cm margins, the glyphs of DejaVu
+// Sans Mono are 0.602 em wide.
+const (
+	pageWidth    = 595
+	pageHeight   = 842
+	pageMargin   = 56
+	titleSize    = 14
+	titleLead    = 20
+	bodySize     = 10
+	bodyLead     = 13
+	titleColumns = (pageWidth - 2*pageMargin) * 1000 / (602 * titleSize)
+	bodyColumns  = (pageWidth - 2*pageMargin) * 1000 / (602 * bodySize)
+)
+
+// Document is a note laid out by PDF, it starts on a new page.
+type Document struct {
+	Title string
+	Text  string
+}
+
+// PDF writes the documents as an A4 PDF set in DejaVu Sans Mono. Only the
+// glyphs the documents use are embedded. Characters the font has no glyph
+// for, such as CJK and emoji, are drawn as U+FFFD and returned in missing,
+// so that the caller can tell what was lost.
+func PDF(w io.Writer, docs []Document) (missing []rune, err error) {
+
+	regular, bold, err := loadFonts()
+	if err != nil {
+		return nil, err
+	}
+
+	fonts := []*pdfFont{newPDFFont(regular), newPDFFont(bold)}
+	lost := map[rune]bool{}
+
+	var pages [][]byte
+	for _, doc := range docs {
+		pages = append(pages, layout(doc, fonts[0], fonts[1], lost)...)
+	}
+	if len(pages) == 0 {
+		pages = append(pages, nil)
+	}
+
+	// objects 1 and 2 are the catalog and the page tree, every font takes
+	// five objects after them and every page is followed by its content
+	// stream
+	first := 3 + fontObjects*len(fonts)
+	objects := make([][]byte, 2, first-1+2*len(pages))
+
+	for i, font := range fonts {
+		o, err := font.objects(3 + fontObjects*i)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, o...)
+	}
+
+	kids := make([]string, len(pages))
+	for i, content := range pages {
+		page := first + 2*i
+		kids[i] = fmt.Sprintf("%d 0 R", page)
+
+		stream, err := streamObject("", content)
+		if err != nil {
+			return nil, err
+		}
+
+		objects = append(objects,
+			[]byte(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 %d 0 R >> >> /Contents %d 0 R >>",
+				pageWidth, pageHeight, 3+fontObjects, page+1)),
+			stream,
+		)
+	}
+
+	objects[0] = []byte("<< /Type /Catalog /Pages 2 0 R >>")
+	objects[1] = []byte(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n", i+1)
+		buf.Write(object)
+		buf.WriteString("\nendobj\n")
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	for r := range lost {
+		missing = append(missing, r)
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return missing, nil
+}
+
+// layout returns the content streams of the pages of doc.
+func layout(doc Document, body, title *pdfFont, lost map[rune]bool) [][]byte {
+
+	var pages [][]byte
+	var page bytes.Buffer
+	y := pageHeight - pageMargin
+
+	line := func(font string, size, lead int, text []byte) {
+		if y-lead < pageMargin {
+			pages = append(pages, append([]byte(nil), page.Bytes()...))
+			page.Reset()
+			y = pageHeight - pageMargin
+		}
+		y -= lead
+		if len(text) > 0 {
+			fmt.Fprintf(&page, "BT /%s %d Tf %d %d Td <%s> Tj ET\n", font, size, pageMargin, y, text)
+		}
+	}
+
+	if doc.Title != "" {
+		for _, text := range wrap(printable(doc.Title), titleColumns) {
+			line("F2", titleSize, titleLead, title.encode(text, lost))
+		}
+		y -= bodyLead
+	}
+
+	for _, paragraph := range strings.Split(doc.Text, "\n") {
+		paragraph = strings.ReplaceAll(paragraph, "\t", "    ")
+		for _, text := range wrap(printable(paragraph), bodyColumns) {
+			line("F1", bodySize, bodyLead, body.encode(text, lost))
+		}
+	}
+
+	return append(pages, page.Bytes())
+}
+
+// wrap breaks text into lines of at most columns characters, at the last
+// space if there is one.
+func wrap(text []rune, columns int) [][]rune {
+
+	for len(text) > 0 && text[len(text)-1] == ' ' {
+		text = text[:len(text)-1]
+	}
+	if len(text) <= columns {
+		return [][]rune{text}
+	}
+
+	var lines [][]rune
+	for len(text) > columns {
+		cut := columns
+		for i := columns; i > 0; i-- {
+			if text[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+		line := text[:cut]
+		for len(line) > 0 && line[len(line)-1] == ' ' {
+			line = line[:len(line)-1]
+		}
+		lines = append(lines, line)
+		text = text[cut:]
+		for len(text) > 0 && text[0] == ' ' {
+			text = text[1:]
+		}
+	}
+
+	return append(lines, text)
+}
+
+// printable returns the characters of s without the control characters.
+func printable(s string) []rune {
+
+	text := make([]rune, 0, len(s))
+
+	for _, r := range s {
+		if r >= 0x20 && (r < 0x7f || r > 0x9f) {
+			text = append(text, r)
+		}
+	}
+
+	return text
+}
+
+// fontObjects is the number of PDF objects of a font: the Type0 font, its
+// descendant CIDFont, the descriptor, the font file and the ToUnicode map.
+const fontObjects = 5
+
+// pdfFont is a TrueType font as used by one PDF, it remembers the glyphs
+// that are shown so that only those are embedded.
+type pdfFont struct {
+	*trueType
+	used        map[uint16]rune
+	replacement uint16
+}
+
+func newPDFFont(font *trueType) *pdfFont {
+
+	f := &pdfFont{trueType: font, used: map[uint16]rune{}}
+
+	f.replacement = font.glyph(0xfffd)
+	if f.replacement == 0 {
+		f.replacement = font.glyph('?')
+	}
+
+	return f
+}
+
+// encode returns text as hex glyph numbers for the Identity-H encoding.
+// Characters without a glyph are added to lost and drawn as the
+// replacement glyph.
+func (f *pdfFont) encode(text []rune, lost map[rune]bool) []byte {
+
+	b := make([]byte, 0, 4*len(text))
+
+	for _, r := range text {
+		glyph := f.glyph(r)
+		if glyph == 0 {
+			lost[r] = true
+			glyph = f.replacement
+			r = 0xfffd
+		}
+		if _, found := f.used[glyph]; !found {
+			f.used[glyph] = r
+		}
+		b = append(b, fmt.Sprintf("%04X", glyph)...)
+	}
+
+	return b
+}
+
+// objects returns the PDF objects of the font, numbered from first.
+func (f *pdfFont) objects(first int) ([][]byte, error) {
+
+	glyphs := make([]int, 0, len(f.used))
+	for glyph := range f.used {
+		glyphs = append(glyphs, int(glyph))
+	}
+	sort.Ints(glyphs)
+
+	// a subset font is named with a tag that differs between subsets
+	hash := fnv.New32a()
+	for _, glyph := range glyphs {
+		fmt.Fprint(hash, glyph, " ")
+	}
+	tag := make([]byte, 6)
+	for i, sum := 0, hash.Sum32(); i < len(tag); i, sum = i+1, sum/26 {
+		tag[i] = 'A' + byte(sum%26)
+	}
+	name := string(tag) + "+" + f.name
+
+	var widths strings.Builder
+	for _, glyph := range glyphs {
+		fmt.Fprintf(&widths, "%d [%d] ", glyph, f.width(uint16(glyph)))
+	}
+
+	var cmap strings.Builder
+	cmap.WriteString("/CIDInit /ProcSet findresource begin 12 dict begin begincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def /CMapType 2 def\n" +
+		"1 begincodespacerange <0000> <FFFF> endcodespacerange\n")
+	for i := 0; i < len(glyphs); i += 100 {
+		chunk := glyphs[i:minInt(i+100, len(glyphs))]
+		fmt.Fprintf(&cmap, "%d beginbfchar\n", len(chunk))
+		for _, glyph := range chunk {
+			fmt.Fprintf(&cmap, "<%04X> <", glyph)
+			for _, unit := range utf16.Encode([]rune{f.used[uint16(glyph)]}) {
+				fmt.Fprintf(&cmap, "%04X", unit)
+			}
+			cmap.WriteString(">\n")
+		}
+		cmap.WriteString("endbfchar\n")
+	}
+	cmap.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend")
+
+	font := f.subset(f.used)
+	file, err := streamObject(fmt.Sprintf("/Length1 %d ", len(font)), font)
+	if err != nil {
+		return nil, err
+	}
+	toUnicode, err := streamObject("", []byte(cmap.String()))
+	if err != nil {
+		return nil, err
+	}
+
+	return [][]byte{
+		[]byte(fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+			name, first+1, first+4)),
+		[]byte(fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /CIDToGIDMap /Identity /W [%s] >>",
+			name, first+2, strings.TrimSpace(widths.String()))),
+		[]byte(fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 33 /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+			name, f.scale(f.bbox[0]), f.scale(f.bbox[1]), f.scale(f.bbox[2]), f.scale(f.bbox[3]),
+			f.scale(f.ascent), f.scale(f.descent), f.scale(f.ascent), first+3)),
+		file,
+		toUnicode,
+	}, nil
+}
+
+// streamObject returns a compressed stream object, dict holds the entries
+// besides its length and filter.
+func streamObject(dict string, content []byte) ([]byte, error) {
+
+	stream, err := deflate(content)
+	if err != nil {
+		return nil, err
+	}
+
+	object := []byte(fmt.Sprintf("<< %s/Length %d /Filter /FlateDecode >>\nstream\n", dict, len(stream)))
+	object = append(object, stream...)
+
+	return append(object, "\nendstream"...), nil
+}
+
+func deflate(content []byte) ([]byte, error) {
+
+	var buf bytes.Buffer
+
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(content); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,31 @@
+// Package render turns the Markdown of notes into HTML that is safe to embed
+// in a page.
+package render
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// markdown renders CommonMark with the GitHub extensions: tables, task
+// lists, strikethrough and autolinks. Fenced code blocks get a
+// language-<info> class for syntax highlighting in the browser.
+//
+// The renderer is not given html.WithUnsafe, so raw HTML in a note is
+// dropped and links and images with javascript:, vbscript:, file: or
+// non-image data: URLs lose their target; everything else is escaped.
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// HTML renders the Markdown source as an HTML fragment.
+func HTML(source string) (string, error) {
+
+	var buf bytes.Buffer
+
+	if err := markdown.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,125 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTML(t *testing.T) {
+
+	html, err := HTML("| a | b |\n|---|---|\n| 1 | 2 |\n\n- [x] done\n- [ ] open\n\n```go\nfmt.Println(\"<hi>\")\n```\n\n~~old~~ https://example.com\n")
+	assert.NoError(t, err)
+
+	assert.Contains(t, html, "<table>")
+	assert.Contains(t, html, `<input checked="" disabled="" type="checkbox"`)
+	assert.Contains(t, html, `<code class="language-go">fmt.Println(&quot;&lt;hi&gt;&quot;)`)
+	assert.Contains(t, html, "<del>old</del>")
+	assert.Contains(t, html, `<a href="https://example.com">`)
+}
+
+func TestHTMLIsSanitized(t *testing.T) {
+
+	for _, source := range []string{
+		"<script>alert(1)</script>",
+		"<img src=x onerror=alert(1)>",
+		"[click](javascript:alert(1))",
+		"![x](javascript:alert(1))",
+		"<a href=\"javascript:alert(1)\">x</a>",
+		"[x](data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==)",
+		"<iframe src=\"https://evil.example\"></iframe>",
+		"```\" onmouseover=\"alert(1)\n```",
+	} {
+		html, err := HTML(source)
+		assert.NoError(t, err)
+		assert.NotContains(t, html, "<script", source)
+		assert.NotContains(t, html, "<iframe", source)
+		assert.NotContains(t, html, "onerror=", source)
+		assert.NotContains(t, html, "\" onmouseover", source)
+		assert.NotContains(t, html, "href=\"javascript:", source)
+		assert.NotContains(t, html, "src=\"javascript:", source)
+		assert.NotContains(t, html, "data:text/html", source)
+	}
+}
+
+func TestCache(t *testing.T) {
+
+	var cache Cache
+	updated := time.Now()
+
+	html, _ := cache.Render(1, updated, "*one*")
+	assert.Equal(t, "<p><em>one</em></p>\n", html)
+
+	html, _ = cache.Render(1, updated, "*changed*")
+	assert.Contains(t, html, "one", "same version is served from the cache")
+
+	html, _ = cache.Render(1, updated.Add(time.Second), "*changed*")
+	assert.Contains(t, html, "changed", "a newer version is rendered again")
+
+	cache.Invalidate(1)
+	_, ok := cache.Get(1, updated.Add(time.Second))
+	assert.False(t, ok)
+}
+
+func TestText(t *testing.T) {
+
+	text := Text("# Trip\n\nBring **passport** and [tickets](https://example.com).<b>x</b>\n\n- [x] pack\n- [ ] water\n  1. plants\n  2. cat\n\n```\ncode()\n```\n")
+
+	assert.Equal(t, "Trip\n\nBring passport and tickets (https://example.com).x\n\n- [x] pack\n- [ ] water\n  1. plants\n  2. cat\n\ncode()", text)
+}
+
+func TestPDF(t *testing.T) {
+
+	var buf bytes.Buffer
+	missing, err := PDF(&buf, []Document{
+		{Title: "Note 1", Text: "Crème brûlée – 100 €, Привет, Γειά σου"},
+		{Title: "Note 2", Text: strings.Repeat("a long line that has to be wrapped ", 400)},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, missing, "Latin, Cyrillic and Greek are in the font")
+
+	pdf := buf.String()
+	assert.True(t, strings.HasPrefix(pdf, "%PDF-1.4\n"))
+	assert.True(t, strings.HasSuffix(pdf, "%%EOF\n"))
+	assert.Regexp(t, `/Count [3-9] `, pdf, "the long note continues on more pages")
+	assert.Regexp(t, `/BaseFont /[A-Z]{6}\+DejaVuSansMono /Encoding /Identity-H`, pdf)
+	assert.Contains(t, pdf, "/FontFile2 ")
+	assert.Less(t, len(pdf), 100000, "only the used glyphs are embedded")
+
+	// the cross-reference table is where startxref points
+	var xref int
+	fmt.Sscanf(pdf[strings.LastIndex(pdf, "startxref\n")+len("startxref\n"):], "%d", &xref)
+	assert.True(t, strings.HasPrefix(pdf[xref:], "xref\n"))
+
+	buf.Reset()
+	missing, err = PDF(&buf, []Document{{Title: "Note 3", Text: "Tokyo 東京 ☃ 🙂"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []rune{'京', '東', '🙂'}, missing, "characters without a glyph are reported")
+	assert.True(t, strings.HasPrefix(buf.String(), "%PDF-"), "the rest of the note is kept")
+
+	assert.Equal(t, [][]rune{[]rune("one two"), []rune("three"), []rune("abcdefghij"), []rune("kl")}, wrap([]rune("one two three abcdefghijkl"), 10))
+	assert.Equal(t, []rune("ab"), printable("a\x00\u0085b"))
+}
+
+func TestSubset(t *testing.T) {
+
+	font, _, err := loadFonts()
+	assert.NoError(t, err)
+
+	a, b := font.glyph('a'), font.glyph('Ж')
+	assert.NotZero(t, a)
+	assert.NotZero(t, b)
+	assert.Zero(t, font.glyph('東'))
+
+	subset, err := parseTrueType(font.subset(map[uint16]rune{a: 'a', b: 'Ж'}))
+	assert.NoError(t, err)
+	assert.Equal(t, font.numGlyphs, subset.numGlyphs, "glyphs keep their numbers")
+	assert.Equal(t, font.glyphData(a), subset.glyphData(a))
+	assert.Equal(t, font.glyphData(b), subset.glyphData(b))
+	assert.Empty(t, subset.glyphData(font.glyph('z')))
+	assert.Equal(t, uint32(0xb1b0afba), checksum(font.subset(map[uint16]rune{a: 'a'})))
+}
@@ -0,0 +1,157 @@
+package render
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// Text returns the Markdown source as plain text: emphasis, headings and
+// code markers are dropped, list items keep a bullet or their number, task
+// list items a [ ] or [x] box, and link targets follow the link text in
+// parentheses. Raw HTML is dropped as in HTML.
+func Text(source string) string {
+
+	src := []byte(source)
+	doc := markdown.Parser().Parse(text.NewReader(src))
+
+	var b strings.Builder
+
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+
+		switch n := n.(type) {
+		case *ast.Text:
+			if entering {
+				b.Write(n.Segment.Value(src))
+				if n.SoftLineBreak() || n.HardLineBreak() {
+					b.WriteByte('\n')
+				}
+			}
+
+		case *ast.String:
+			if entering {
+				b.Write(n.Value)
+			}
+
+		case *ast.AutoLink:
+			if entering {
+				b.Write(n.URL(src))
+			}
+			return ast.WalkSkipChildren, nil
+
+		case *ast.Link:
+			if !entering && string(n.Destination) != linkText(n, src) {
+				b.WriteString(" (" + string(n.Destination) + ")")
+			}
+
+		case *ast.RawHTML, *ast.HTMLBlock:
+			return ast.WalkSkipChildren, nil
+
+		case *ast.CodeBlock, *ast.FencedCodeBlock:
+			if entering {
+				lines := n.Lines()
+				for i := 0; i < lines.Len(); i++ {
+					segment := lines.At(i)
+					b.Write(segment.Value(src))
+				}
+				b.WriteString("\n")
+			}
+			return ast.WalkSkipChildren, nil
+
+		case *ast.ThematicBreak:
+			if entering {
+				b.WriteString("---\n\n")
+			}
+
+		case *ast.ListItem:
+			if entering {
+				b.WriteString(strings.Repeat("  ", depth(n)))
+				b.WriteString(bullet(n))
+			}
+
+		case *east.TaskCheckBox:
+			if entering {
+				if n.IsChecked {
+					b.WriteString("[x] ")
+				} else {
+					b.WriteString("[ ] ")
+				}
+			}
+
+		case *east.TableCell:
+			if !entering && n.NextSibling() != nil {
+				b.WriteString("\t")
+			}
+
+		case *east.TableHeader, *east.TableRow:
+			if !entering {
+				b.WriteString("\n")
+			}
+
+		case *ast.List:
+			if !entering && depth(n) == 0 {
+				b.WriteString("\n")
+			}
+
+		case *ast.TextBlock:
+			if !entering {
+				b.WriteString("\n")
+			}
+
+		case *ast.Paragraph, *ast.Heading, *east.Table:
+			if !entering {
+				b.WriteString("\n\n")
+			}
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	return strings.TrimSpace(blankLines.ReplaceAllString(b.String(), "\n\n"))
+}
+
+// depth is the number of list items n is nested in.
+func depth(n ast.Node) int {
+
+	d := 0
+	for p := n.Parent(); p != nil; p = p.Parent() {
+		if _, ok := p.(*ast.ListItem); ok {
+			d++
+		}
+	}
+
+	return d
+}
+
+func bullet(item *ast.ListItem) string {
+
+	list, ok := item.Parent().(*ast.List)
+	if !ok || !list.IsOrdered() {
+		return "- "
+	}
+
+	number := list.Start
+	for p := item.PreviousSibling(); p != nil; p = p.PreviousSibling() {
+		number++
+	}
+
+	return strconv.Itoa(number) + ". "
+}
+
+func linkText(link *ast.Link, src []byte) string {
+
+	var b strings.Builder
+	for c := link.FirstChild(); c != nil; c = c.NextSibling() {
+		if t, ok := c.(*ast.Text); ok {
+			b.Write(t.Segment.Value(src))
+		}
+	}
+
+	return b.String()
+}
@@ -7,6 +7,7 @@ package mock_repository
 import (
 	repository "NOTESBE/repository"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -34,6 +35,104 @@ func (m *MockRepository) EXPECT() *MockRepositoryMockRecorder {
 	return m.recorder
 }
 
+// CreateAccessToken mocks base method.
+func (m *MockRepository) CreateAccessToken(token *repository.Accesstoken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAccessToken", token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateAccessToken indicates an expected call of CreateAccessToken.
+func (mr *MockRepositoryMockRecorder) CreateAccessToken(token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAccessToken", reflect.TypeOf((*MockRepository)(nil).CreateAccessToken), token)
+}
+
+// CreateAttachment mocks base method.
+func (m *MockRepository) CreateAttachment(attachment *repository.Attachment) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAttachment", attachment)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateAttachment indicates an expected call of CreateAttachment.
+func (mr *MockRepositoryMockRecorder) CreateAttachment(attachment interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAttachment", reflect.TypeOf((*MockRepository)(nil).CreateAttachment), attachment)
+}
+
+// CreateAuthEvent mocks base method.
+func (m *MockRepository) CreateAuthEvent(event *repository.Authevent) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAuthEvent", event)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateAuthEvent indicates an expected call of CreateAuthEvent.
+func (mr *MockRepositoryMockRecorder) CreateAuthEvent(event interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAuthEvent", reflect.TypeOf((*MockRepository)(nil).CreateAuthEvent), event)
+}
+
+// CreateChecklist mocks base method.
+func (m *MockRepository) CreateChecklist(note *repository.Note, items []repository.Checklistitem) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateChecklist", note, items)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateChecklist indicates an expected call of CreateChecklist.
+func (mr *MockRepositoryMockRecorder) CreateChecklist(note, items interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateChecklist", reflect.TypeOf((*MockRepository)(nil).CreateChecklist), note, items)
+}
+
+// CreateChecklistItem mocks base method.
+func (m *MockRepository) CreateChecklistItem(item *repository.Checklistitem) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateChecklistItem", item)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateChecklistItem indicates an expected call of CreateChecklistItem.
+func (mr *MockRepositoryMockRecorder) CreateChecklistItem(item interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateChecklistItem", reflect.TypeOf((*MockRepository)(nil).CreateChecklistItem), item)
+}
+
+// CreateExport mocks base method.
+func (m *MockRepository) CreateExport(export *repository.Export) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateExport", export)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateExport indicates an expected call of CreateExport.
+func (mr *MockRepositoryMockRecorder) CreateExport(export interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateExport", reflect.TypeOf((*MockRepository)(nil).CreateExport), export)
+}
+
+// CreateImportJob mocks base method.
+func (m *MockRepository) CreateImportJob(job *repository.Importjob) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateImportJob", job)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateImportJob indicates an expected call of CreateImportJob.
+func (mr *MockRepositoryMockRecorder) CreateImportJob(job interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateImportJob", reflect.TypeOf((*MockRepository)(nil).CreateImportJob), job)
+}
+
 // CreateNote mocks base method.
 func (m *MockRepository) CreateNote(req *repository.Note) error {
 	m.ctrl.T.Helper()
@@ -62,6 +161,62 @@ func (mr *MockRepositoryMockRecorder) CreateUser(req interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockRepository)(nil).CreateUser), req)
 }
 
+// DeleteAccessToken mocks base method.
+func (m *MockRepository) DeleteAccessToken(tokenid, userid uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteAccessToken", tokenid, userid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteAccessToken indicates an expected call of DeleteAccessToken.
+func (mr *MockRepositoryMockRecorder) DeleteAccessToken(tokenid, userid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAccessToken", reflect.TypeOf((*MockRepository)(nil).DeleteAccessToken), tokenid, userid)
+}
+
+// DeleteAttachment mocks base method.
+func (m *MockRepository) DeleteAttachment(attachmentid uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteAttachment", attachmentid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteAttachment indicates an expected call of DeleteAttachment.
+func (mr *MockRepositoryMockRecorder) DeleteAttachment(attachmentid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAttachment", reflect.TypeOf((*MockRepository)(nil).DeleteAttachment), attachmentid)
+}
+
+// DeleteChecklistItem mocks base method.
+func (m *MockRepository) DeleteChecklistItem(itemid, noteid uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteChecklistItem", itemid, noteid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteChecklistItem indicates an expected call of DeleteChecklistItem.
+func (mr *MockRepositoryMockRecorder) DeleteChecklistItem(itemid, noteid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteChecklistItem", reflect.TypeOf((*MockRepository)(nil).DeleteChecklistItem), itemid, noteid)
+}
+
+// DeleteExport mocks base method.
+func (m *MockRepository) DeleteExport(exportid uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteExport", exportid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteExport indicates an expected call of DeleteExport.
+func (mr *MockRepositoryMockRecorder) DeleteExport(exportid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteExport", reflect.TypeOf((*MockRepository)(nil).DeleteExport), exportid)
+}
+
 // DeleteNoteById mocks base method.
 func (m *MockRepository) DeleteNoteById(noteId, userid uint64) error {
 	m.ctrl.T.Helper()
@@ -76,6 +231,273 @@ func (mr *MockRepositoryMockRecorder) DeleteNoteById(noteId, userid interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteNoteById", reflect.TypeOf((*MockRepository)(nil).DeleteNoteById), noteId, userid)
 }
 
+// DeleteUser mocks base method.
+func (m *MockRepository) DeleteUser(userid uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", userid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockRepositoryMockRecorder) DeleteUser(userid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockRepository)(nil).DeleteUser), userid)
+}
+
+// DisableTotp mocks base method.
+func (m *MockRepository) DisableTotp(userid uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DisableTotp", userid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DisableTotp indicates an expected call of DisableTotp.
+func (mr *MockRepositoryMockRecorder) DisableTotp(userid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableTotp", reflect.TypeOf((*MockRepository)(nil).DisableTotp), userid)
+}
+
+// EnableTotp mocks base method.
+func (m *MockRepository) EnableTotp(userid uint64, step int64, codehashes []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnableTotp", userid, step, codehashes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnableTotp indicates an expected call of EnableTotp.
+func (mr *MockRepositoryMockRecorder) EnableTotp(userid, step, codehashes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnableTotp", reflect.TypeOf((*MockRepository)(nil).EnableTotp), userid, step, codehashes)
+}
+
+// GetAccessTokenByHash mocks base method.
+func (m *MockRepository) GetAccessTokenByHash(tokenhash string) (*repository.Accesstoken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAccessTokenByHash", tokenhash)
+	ret0, _ := ret[0].(*repository.Accesstoken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAccessTokenByHash indicates an expected call of GetAccessTokenByHash.
+func (mr *MockRepositoryMockRecorder) GetAccessTokenByHash(tokenhash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccessTokenByHash", reflect.TypeOf((*MockRepository)(nil).GetAccessTokenByHash), tokenhash)
+}
+
+// GetAccessTokens mocks base method.
+func (m *MockRepository) GetAccessTokens(userid uint64) ([]repository.Accesstoken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAccessTokens", userid)
+	ret0, _ := ret[0].([]repository.Accesstoken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAccessTokens indicates an expected call of GetAccessTokens.
+func (mr *MockRepositoryMockRecorder) GetAccessTokens(userid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccessTokens", reflect.TypeOf((*MockRepository)(nil).GetAccessTokens), userid)
+}
+
+// GetAttachment mocks base method.
+func (m *MockRepository) GetAttachment(attachmentid, noteid uint64) (*repository.Attachment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAttachment", attachmentid, noteid)
+	ret0, _ := ret[0].(*repository.Attachment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAttachment indicates an expected call of GetAttachment.
+func (mr *MockRepositoryMockRecorder) GetAttachment(attachmentid, noteid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAttachment", reflect.TypeOf((*MockRepository)(nil).GetAttachment), attachmentid, noteid)
+}
+
+// GetAttachmentById mocks base method.
+func (m *MockRepository) GetAttachmentById(attachmentid uint64) (*repository.Attachment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAttachmentById", attachmentid)
+	ret0, _ := ret[0].(*repository.Attachment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAttachmentById indicates an expected call of GetAttachmentById.
+func (mr *MockRepositoryMockRecorder) GetAttachmentById(attachmentid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAttachmentById", reflect.TypeOf((*MockRepository)(nil).GetAttachmentById), attachmentid)
+}
+
+// GetAttachmentUsage mocks base method.
+func (m *MockRepository) GetAttachmentUsage(userid uint64) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAttachmentUsage", userid)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAttachmentUsage indicates an expected call of GetAttachmentUsage.
+func (mr *MockRepositoryMockRecorder) GetAttachmentUsage(userid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAttachmentUsage", reflect.TypeOf((*MockRepository)(nil).GetAttachmentUsage), userid)
+}
+
+// GetAttachments mocks base method.
+func (m *MockRepository) GetAttachments(noteid uint64) ([]repository.Attachment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAttachments", noteid)
+	ret0, _ := ret[0].([]repository.Attachment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAttachments indicates an expected call of GetAttachments.
+func (mr *MockRepositoryMockRecorder) GetAttachments(noteid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAttachments", reflect.TypeOf((*MockRepository)(nil).GetAttachments), noteid)
+}
+
+// GetAttachmentsOfUser mocks base method.
+func (m *MockRepository) GetAttachmentsOfUser(userid uint64) ([]repository.Attachment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAttachmentsOfUser", userid)
+	ret0, _ := ret[0].([]repository.Attachment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAttachmentsOfUser indicates an expected call of GetAttachmentsOfUser.
+func (mr *MockRepositoryMockRecorder) GetAttachmentsOfUser(userid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAttachmentsOfUser", reflect.TypeOf((*MockRepository)(nil).GetAttachmentsOfUser), userid)
+}
+
+// GetAuthEvents mocks base method.
+func (m *MockRepository) GetAuthEvents(username string, limit int) ([]repository.Authevent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAuthEvents", username, limit)
+	ret0, _ := ret[0].([]repository.Authevent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAuthEvents indicates an expected call of GetAuthEvents.
+func (mr *MockRepositoryMockRecorder) GetAuthEvents(username, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAuthEvents", reflect.TypeOf((*MockRepository)(nil).GetAuthEvents), username, limit)
+}
+
+// GetAuthEventsOfUser mocks base method.
+func (m *MockRepository) GetAuthEventsOfUser(userid uint64, limit int) ([]repository.Authevent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAuthEventsOfUser", userid, limit)
+	ret0, _ := ret[0].([]repository.Authevent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAuthEventsOfUser indicates an expected call of GetAuthEventsOfUser.
+func (mr *MockRepositoryMockRecorder) GetAuthEventsOfUser(userid, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAuthEventsOfUser", reflect.TypeOf((*MockRepository)(nil).GetAuthEventsOfUser), userid, limit)
+}
+
+// GetChecklistItem mocks base method.
+func (m *MockRepository) GetChecklistItem(itemid, noteid uint64) (*repository.Checklistitem, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetChecklistItem", itemid, noteid)
+	ret0, _ := ret[0].(*repository.Checklistitem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetChecklistItem indicates an expected call of GetChecklistItem.
+func (mr *MockRepositoryMockRecorder) GetChecklistItem(itemid, noteid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetChecklistItem", reflect.TypeOf((*MockRepository)(nil).GetChecklistItem), itemid, noteid)
+}
+
+// GetChecklistItems mocks base method.
+func (m *MockRepository) GetChecklistItems(noteids []uint64) ([]repository.Checklistitem, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetChecklistItems", noteids)
+	ret0, _ := ret[0].([]repository.Checklistitem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetChecklistItems indicates an expected call of GetChecklistItems.
+func (mr *MockRepositoryMockRecorder) GetChecklistItems(noteids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetChecklistItems", reflect.TypeOf((*MockRepository)(nil).GetChecklistItems), noteids)
+}
+
+// GetExpiredExports mocks base method.
+func (m *MockRepository) GetExpiredExports(finishedbefore time.Time) ([]repository.Export, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetExpiredExports", finishedbefore)
+	ret0, _ := ret[0].([]repository.Export)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetExpiredExports indicates an expected call of GetExpiredExports.
+func (mr *MockRepositoryMockRecorder) GetExpiredExports(finishedbefore interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExpiredExports", reflect.TypeOf((*MockRepository)(nil).GetExpiredExports), finishedbefore)
+}
+
+// GetExport mocks base method.
+func (m *MockRepository) GetExport(exportid, userid uint64) (*repository.Export, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetExport", exportid, userid)
+	ret0, _ := ret[0].(*repository.Export)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetExport indicates an expected call of GetExport.
+func (mr *MockRepositoryMockRecorder) GetExport(exportid, userid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExport", reflect.TypeOf((*MockRepository)(nil).GetExport), exportid, userid)
+}
+
+// GetExports mocks base method.
+func (m *MockRepository) GetExports(userid uint64) ([]repository.Export, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetExports", userid)
+	ret0, _ := ret[0].([]repository.Export)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetExports indicates an expected call of GetExports.
+func (mr *MockRepositoryMockRecorder) GetExports(userid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExports", reflect.TypeOf((*MockRepository)(nil).GetExports), userid)
+}
+
+// GetImportJob mocks base method.
+func (m *MockRepository) GetImportJob(jobid, userid uint64) (*repository.Importjob, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetImportJob", jobid, userid)
+	ret0, _ := ret[0].(*repository.Importjob)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetImportJob indicates an expected call of GetImportJob.
+func (mr *MockRepositoryMockRecorder) GetImportJob(jobid, userid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetImportJob", reflect.TypeOf((*MockRepository)(nil).GetImportJob), jobid, userid)
+}
+
 // GetNoteById mocks base method.
 func (m *MockRepository) GetNoteById(noteId, userid uint64) (*repository.Note, error) {
 	m.ctrl.T.Helper()
@@ -121,6 +543,66 @@ func (mr *MockRepositoryMockRecorder) GetNotesOfUser(userid interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNotesOfUser", reflect.TypeOf((*MockRepository)(nil).GetNotesOfUser), userid)
 }
 
+// GetReadableNote mocks base method.
+func (m *MockRepository) GetReadableNote(noteId, userid uint64) (*repository.Note, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetReadableNote", noteId, userid)
+	ret0, _ := ret[0].(*repository.Note)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetReadableNote indicates an expected call of GetReadableNote.
+func (mr *MockRepositoryMockRecorder) GetReadableNote(noteId, userid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReadableNote", reflect.TypeOf((*MockRepository)(nil).GetReadableNote), noteId, userid)
+}
+
+// GetShareRecords mocks base method.
+func (m *MockRepository) GetShareRecords(userid uint64) ([]repository.Sharerecords, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetShareRecords", userid)
+	ret0, _ := ret[0].([]repository.Sharerecords)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetShareRecords indicates an expected call of GetShareRecords.
+func (mr *MockRepositoryMockRecorder) GetShareRecords(userid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetShareRecords", reflect.TypeOf((*MockRepository)(nil).GetShareRecords), userid)
+}
+
+// GetTokenGeneration mocks base method.
+func (m *MockRepository) GetTokenGeneration(userid uint64) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTokenGeneration", userid)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTokenGeneration indicates an expected call of GetTokenGeneration.
+func (mr *MockRepositoryMockRecorder) GetTokenGeneration(userid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTokenGeneration", reflect.TypeOf((*MockRepository)(nil).GetTokenGeneration), userid)
+}
+
+// GetUnindexedAttachments mocks base method.
+func (m *MockRepository) GetUnindexedAttachments() ([]repository.Attachment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUnindexedAttachments")
+	ret0, _ := ret[0].([]repository.Attachment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUnindexedAttachments indicates an expected call of GetUnindexedAttachments.
+func (mr *MockRepositoryMockRecorder) GetUnindexedAttachments() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUnindexedAttachments", reflect.TypeOf((*MockRepository)(nil).GetUnindexedAttachments))
+}
+
 // GetUser mocks base method.
 func (m *MockRepository) GetUser(req *repository.User) (uint64, error) {
 	m.ctrl.T.Helper()
@@ -136,6 +618,180 @@ func (mr *MockRepositoryMockRecorder) GetUser(req interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockRepository)(nil).GetUser), req)
 }
 
+// GetUserByEmail mocks base method.
+func (m *MockRepository) GetUserByEmail(email string) (*repository.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByEmail", email)
+	ret0, _ := ret[0].(*repository.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByEmail indicates an expected call of GetUserByEmail.
+func (mr *MockRepositoryMockRecorder) GetUserByEmail(email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByEmail", reflect.TypeOf((*MockRepository)(nil).GetUserByEmail), email)
+}
+
+// GetUserById mocks base method.
+func (m *MockRepository) GetUserById(userid uint64) (*repository.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserById", userid)
+	ret0, _ := ret[0].(*repository.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserById indicates an expected call of GetUserById.
+func (mr *MockRepositoryMockRecorder) GetUserById(userid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserById", reflect.TypeOf((*MockRepository)(nil).GetUserById), userid)
+}
+
+// GetUserByOidc mocks base method.
+func (m *MockRepository) GetUserByOidc(issuer, subject string) (*repository.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByOidc", issuer, subject)
+	ret0, _ := ret[0].(*repository.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByOidc indicates an expected call of GetUserByOidc.
+func (mr *MockRepositoryMockRecorder) GetUserByOidc(issuer, subject interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByOidc", reflect.TypeOf((*MockRepository)(nil).GetUserByOidc), issuer, subject)
+}
+
+// GetUserByUsername mocks base method.
+func (m *MockRepository) GetUserByUsername(username string) (*repository.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByUsername", username)
+	ret0, _ := ret[0].(*repository.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByUsername indicates an expected call of GetUserByUsername.
+func (mr *MockRepositoryMockRecorder) GetUserByUsername(username interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByUsername", reflect.TypeOf((*MockRepository)(nil).GetUserByUsername), username)
+}
+
+// LinkOidc mocks base method.
+func (m *MockRepository) LinkOidc(userid uint64, issuer, subject string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LinkOidc", userid, issuer, subject)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LinkOidc indicates an expected call of LinkOidc.
+func (mr *MockRepositoryMockRecorder) LinkOidc(userid, issuer, subject interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LinkOidc", reflect.TypeOf((*MockRepository)(nil).LinkOidc), userid, issuer, subject)
+}
+
+// ListUsers mocks base method.
+func (m *MockRepository) ListUsers() ([]repository.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUsers")
+	ret0, _ := ret[0].([]repository.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUsers indicates an expected call of ListUsers.
+func (mr *MockRepositoryMockRecorder) ListUsers() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUsers", reflect.TypeOf((*MockRepository)(nil).ListUsers))
+}
+
+// MoveChecklistItem mocks base method.
+func (m *MockRepository) MoveChecklistItem(itemid, noteid uint64, position int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MoveChecklistItem", itemid, noteid, position)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MoveChecklistItem indicates an expected call of MoveChecklistItem.
+func (mr *MockRepositoryMockRecorder) MoveChecklistItem(itemid, noteid, position interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MoveChecklistItem", reflect.TypeOf((*MockRepository)(nil).MoveChecklistItem), itemid, noteid, position)
+}
+
+// SearchAttachments mocks base method.
+func (m *MockRepository) SearchAttachments(userid uint64, key string) ([]repository.Attachment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchAttachments", userid, key)
+	ret0, _ := ret[0].([]repository.Attachment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchAttachments indicates an expected call of SearchAttachments.
+func (mr *MockRepositoryMockRecorder) SearchAttachments(userid, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchAttachments", reflect.TypeOf((*MockRepository)(nil).SearchAttachments), userid, key)
+}
+
+// SetAttachmentText mocks base method.
+func (m *MockRepository) SetAttachmentText(attachmentid uint64, text string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetAttachmentText", attachmentid, text)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetAttachmentText indicates an expected call of SetAttachmentText.
+func (mr *MockRepositoryMockRecorder) SetAttachmentText(attachmentid, text interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAttachmentText", reflect.TypeOf((*MockRepository)(nil).SetAttachmentText), attachmentid, text)
+}
+
+// SetEmail mocks base method.
+func (m *MockRepository) SetEmail(userid uint64, email string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetEmail", userid, email)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetEmail indicates an expected call of SetEmail.
+func (mr *MockRepositoryMockRecorder) SetEmail(userid, email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetEmail", reflect.TypeOf((*MockRepository)(nil).SetEmail), userid, email)
+}
+
+// SetTotpSecret mocks base method.
+func (m *MockRepository) SetTotpSecret(userid uint64, secret string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetTotpSecret", userid, secret)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetTotpSecret indicates an expected call of SetTotpSecret.
+func (mr *MockRepositoryMockRecorder) SetTotpSecret(userid, secret interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetTotpSecret", reflect.TypeOf((*MockRepository)(nil).SetTotpSecret), userid, secret)
+}
+
+// SetUserDisabled mocks base method.
+func (m *MockRepository) SetUserDisabled(userid uint64, disabled bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserDisabled", userid, disabled)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserDisabled indicates an expected call of SetUserDisabled.
+func (mr *MockRepositoryMockRecorder) SetUserDisabled(userid, disabled interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserDisabled", reflect.TypeOf((*MockRepository)(nil).SetUserDisabled), userid, disabled)
+}
+
 // ShareNoteToUser mocks base method.
 func (m *MockRepository) ShareNoteToUser(noteId, senderuserid, recieveruserid uint64) error {
 	m.ctrl.T.Helper()
@@ -150,6 +806,48 @@ func (mr *MockRepositoryMockRecorder) ShareNoteToUser(noteId, senderuserid, reci
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ShareNoteToUser", reflect.TypeOf((*MockRepository)(nil).ShareNoteToUser), noteId, senderuserid, recieveruserid)
 }
 
+// UpdateChecklistItem mocks base method.
+func (m *MockRepository) UpdateChecklistItem(item *repository.Checklistitem) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateChecklistItem", item)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateChecklistItem indicates an expected call of UpdateChecklistItem.
+func (mr *MockRepositoryMockRecorder) UpdateChecklistItem(item interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateChecklistItem", reflect.TypeOf((*MockRepository)(nil).UpdateChecklistItem), item)
+}
+
+// UpdateExport mocks base method.
+func (m *MockRepository) UpdateExport(export *repository.Export) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateExport", export)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateExport indicates an expected call of UpdateExport.
+func (mr *MockRepositoryMockRecorder) UpdateExport(export interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateExport", reflect.TypeOf((*MockRepository)(nil).UpdateExport), export)
+}
+
+// UpdateImportJob mocks base method.
+func (m *MockRepository) UpdateImportJob(job *repository.Importjob) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateImportJob", job)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateImportJob indicates an expected call of UpdateImportJob.
+func (mr *MockRepositoryMockRecorder) UpdateImportJob(job interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateImportJob", reflect.TypeOf((*MockRepository)(nil).UpdateImportJob), job)
+}
+
 // UpdateNoteById mocks base method.
 func (m *MockRepository) UpdateNoteById(noteId, userid uint64, note string) error {
 	m.ctrl.T.Helper()
@@ -163,3 +861,87 @@ func (mr *MockRepositoryMockRecorder) UpdateNoteById(noteId, userid, note interf
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateNoteById", reflect.TypeOf((*MockRepository)(nil).UpdateNoteById), noteId, userid, note)
 }
+
+// UpdatePassword mocks base method.
+func (m *MockRepository) UpdatePassword(userid uint64, password string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePassword", userid, password)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePassword indicates an expected call of UpdatePassword.
+func (mr *MockRepositoryMockRecorder) UpdatePassword(userid, password interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePassword", reflect.TypeOf((*MockRepository)(nil).UpdatePassword), userid, password)
+}
+
+// UpdateProfile mocks base method.
+func (m *MockRepository) UpdateProfile(user *repository.User) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateProfile", user)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateProfile indicates an expected call of UpdateProfile.
+func (mr *MockRepositoryMockRecorder) UpdateProfile(user interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProfile", reflect.TypeOf((*MockRepository)(nil).UpdateProfile), user)
+}
+
+// UseRecoveryCode mocks base method.
+func (m *MockRepository) UseRecoveryCode(userid uint64, codehash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", userid, codehash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockRepositoryMockRecorder) UseRecoveryCode(userid, codehash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockRepository)(nil).UseRecoveryCode), userid, codehash)
+}
+
+// UseToken mocks base method.
+func (m *MockRepository) UseToken(id string, expiresat time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseToken", id, expiresat)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseToken indicates an expected call of UseToken.
+func (mr *MockRepositoryMockRecorder) UseToken(id, expiresat interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseToken", reflect.TypeOf((*MockRepository)(nil).UseToken), id, expiresat)
+}
+
+// UseTotpStep mocks base method.
+func (m *MockRepository) UseTotpStep(userid uint64, step int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTotpStep", userid, step)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseTotpStep indicates an expected call of UseTotpStep.
+func (mr *MockRepositoryMockRecorder) UseTotpStep(userid, step interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTotpStep", reflect.TypeOf((*MockRepository)(nil).UseTotpStep), userid, step)
+}
+
+// VerifyEmail mocks base method.
+func (m *MockRepository) VerifyEmail(userid uint64, email string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyEmail", userid, email)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// VerifyEmail indicates an expected call of VerifyEmail.
+func (mr *MockRepositoryMockRecorder) VerifyEmail(userid, email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyEmail", reflect.TypeOf((*MockRepository)(nil).VerifyEmail), userid, email)
+}
@@ -4,22 +4,192 @@ import (
 	"time"
 )
 
+// Note is a note of a user. Kind is NoteText or NoteChecklist; the Note of
+// a checklist describes it and its items are Checklistitems.
 type Note struct {
-	Id        uint64 `gorm:"primaryKey;autoIncrement"`
-	Note      string
-	Userid    uint64
+	Id     uint64 `gorm:"primaryKey;autoIncrement"`
+	Note   string
+	Userid uint64
+	// Tags is a comma separated list.
+	Tags      string
+	Kind      string `gorm:"not null;default:text"`
 	Createdat time.Time
 	Updatedat time.Time
 }
 
+const (
+	NoteText      = "text"
+	NoteChecklist = "checklist"
+)
+
+// Checklistitem is an item of a checklist note, items are ordered by
+// Position. Duedate is a date like 2024-01-31 or empty; Assigneeid is the
+// owner of the note or a user it is shared with, 0 for nobody.
+type Checklistitem struct {
+	Id         uint64 `gorm:"primaryKey;autoIncrement"`
+	Noteid     uint64 `gorm:"not null;index"`
+	Position   int    `gorm:"not null"`
+	Text       string `gorm:"not null"`
+	Checked    bool   `gorm:"not null;default:false"`
+	Duedate    string
+	Assigneeid uint64 `gorm:"not null;default:0"`
+	Createdat  time.Time
+	Updatedat  time.Time
+}
+
 type User struct {
 	Id       uint64 `gorm:"primaryKey;autoIncrement"`
 	Username string `gorm:"unique"`
 	Password string
+	Disabled bool `gorm:"not null;default:false"`
+	// Tokengeneration is carried by login tokens, which are only accepted
+	// while it is unchanged. It is increased to revoke them all.
+	Tokengeneration int `gorm:"not null;default:0"`
+	// Totpsecret is set by the 2fa setup and only enforced once Totpenabled
+	// is true.
+	Totpsecret  string
+	Totpenabled bool `gorm:"not null;default:false"`
+	// Totplaststep is the time step of the last accepted TOTP code. Codes of
+	// that step or earlier ones are refused.
+	Totplaststep int64 `gorm:"not null;default:0"`
+	// Oidcissuer and Oidcsubject link the user to an account at an OpenID
+	// Connect provider. Both are empty for local users.
+	Oidcissuer  string
+	Oidcsubject string `gorm:"index"`
+	// Passwordless is set for users provisioned through OpenID Connect, whose
+	// random password they never knew, until they set one.
+	Passwordless bool `gorm:"not null;default:false"`
+	// Email is only used for password resets once Emailverified is true.
+	Email         string `gorm:"index"`
+	Emailverified bool   `gorm:"not null;default:false"`
+	// Profile settings, empty until the user sets them.
+	Displayname string
+	Avatar      string
+	Timezone    string
+	Locale      string
+	Defaultsort string
+}
+
+// Recoverycode is a single use replacement for a TOTP code, stored hashed.
+type Recoverycode struct {
+	Id       uint64 `gorm:"primaryKey;autoIncrement"`
+	Userid   uint64 `gorm:"not null;index"`
+	Codehash string `gorm:"not null"`
+	Used     bool   `gorm:"not null;default:false"`
 }
 
 type Sharerecords struct {
-	Noteid       uint64 `gorm:"not null"`
+	Noteid        uint64 `gorm:"not null"`
 	Senderuserid  uint64 `gorm:"not null"`
 	Reciveruserid uint64 `gorm:"not null"`
 }
+
+// Accesstoken is a personal access token. Only the SHA-256 of the token is
+// stored; Prefix keeps its first characters so users can tell tokens apart.
+// Scopes is a comma separated list. A zero Expiresat never expires.
+type Accesstoken struct {
+	Id        uint64 `gorm:"primaryKey;autoIncrement"`
+	Userid    uint64 `gorm:"not null;index"`
+	Name      string `gorm:"not null"`
+	Tokenhash string `gorm:"not null;uniqueIndex"`
+	Prefix    string
+	Scopes    string
+	Expiresat time.Time
+	Createdat time.Time
+}
+
+// Usedtoken records the id of a redeemed single use token (email
+// verification, password reset) until the token expires.
+type Usedtoken struct {
+	Id        string `gorm:"primaryKey"`
+	Expiresat time.Time
+}
+
+// Export is a personal data archive of a user, built in the background.
+// File is the path of the archive once Status is ExportDone.
+type Export struct {
+	Id         uint64 `gorm:"primaryKey;autoIncrement"`
+	Userid     uint64 `gorm:"not null;index"`
+	Status     string `gorm:"not null"`
+	Error      string
+	File       string
+	Size       int64
+	Createdat  time.Time
+	Finishedat time.Time
+}
+
+const (
+	ExportPending = "pending"
+	ExportDone    = "done"
+	ExportFailed  = "failed"
+)
+
+// Importjob is an import of notes from another application, run in the
+// background. Progress is the share of the upload read so far in percent,
+// Failures lists the first failed notes and refused attachments one per line
+// and Attachments counts the stored attachments of imported notes.
+type Importjob struct {
+	Id          uint64 `gorm:"primaryKey;autoIncrement"`
+	Userid      uint64 `gorm:"not null;index"`
+	Source      string `gorm:"not null"`
+	Status      string `gorm:"not null"`
+	Error       string
+	Progress    int
+	Processed   int
+	Imported    int
+	Failed      int
+	Attachments int
+	Failures    string
+	Createdat   time.Time
+	Finishedat  time.Time
+}
+
+const (
+	ImportPending = "pending"
+	ImportRunning = "running"
+	ImportDone    = "done"
+	ImportFailed  = "failed"
+)
+
+// Attachment is a file attached to a note. Its content is kept in the blob
+// store under Blobkey. Userid is the owner of the note, whose quota the file
+// counts against; Sha256 is the hex digest of the content. Text is what was
+// extracted from the file for search once Indexed is set, it is only read
+// by searches.
+type Attachment struct {
+	Id        uint64 `gorm:"primaryKey;autoIncrement"`
+	Noteid    uint64 `gorm:"not null;index"`
+	Userid    uint64 `gorm:"not null;index"`
+	Name      string `gorm:"not null"`
+	Mime      string `gorm:"not null"`
+	Size      int64  `gorm:"not null"`
+	Sha256    string
+	Blobkey   string `gorm:"not null;uniqueIndex"`
+	Text      string
+	Indexed   bool `gorm:"not null;default:false"`
+	Createdat time.Time
+}
+
+// Authevent records a failed login or a change of the lockout state of a
+// username. Ip is empty for events triggered by an administrator.
+type Authevent struct {
+	Id       uint64 `gorm:"primaryKey;autoIncrement"`
+	Username string `gorm:"index"`
+	// Userid is the account the username belonged to when the event was
+	// recorded, 0 for names without one. Usernames change hands, user ids
+	// do not.
+	Userid    uint64 `gorm:"not null;default:0;index"`
+	Ip        string
+	Event     string
+	Createdat time.Time
+}
+
+const (
+	EventLoginFailed = "login_failed"
+	EventLocked      = "locked"
+	EventIPLocked    = "ip_locked"
+	EventUnlocked    = "unlocked"
+
+	EventPasswordReset   = "password_reset"
+	EventPasswordChanged = "password_changed"
+)
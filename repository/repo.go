@@ -1,10 +1,12 @@
 package repository
 
 import (
+	"NOTESBE/utility"
 	"errors"
 	"fmt"
-	"log"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type Repository interface {
@@ -17,8 +19,92 @@ type Repository interface {
 	DeleteNoteById(noteId, userid uint64) error
 	ShareNoteToUser(noteId, senderuserid, recieveruserid uint64) error
 	GetNotesByKey(userid uint64, key string) ([]Note, error)
+	GetUserByUsername(username string) (*User, error)
+	ListUsers() ([]User, error)
+	SetUserDisabled(userid uint64, disabled bool) error
+	UpdatePassword(userid uint64, password string) error
+	GetTokenGeneration(userid uint64) (int, error)
+	CreateAuthEvent(event *Authevent) error
+	GetAuthEvents(username string, limit int) ([]Authevent, error)
+	GetAuthEventsOfUser(userid uint64, limit int) ([]Authevent, error)
+	GetUserById(userid uint64) (*User, error)
+	SetTotpSecret(userid uint64, secret string) error
+	EnableTotp(userid uint64, step int64, codehashes []string) error
+	UseTotpStep(userid uint64, step int64) error
+	DisableTotp(userid uint64) error
+	UseRecoveryCode(userid uint64, codehash string) error
+	CreateAccessToken(token *Accesstoken) error
+	GetAccessTokens(userid uint64) ([]Accesstoken, error)
+	GetAccessTokenByHash(tokenhash string) (*Accesstoken, error)
+	DeleteAccessToken(tokenid, userid uint64) error
+	GetUserByOidc(issuer, subject string) (*User, error)
+	LinkOidc(userid uint64, issuer, subject string) error
+	GetUserByEmail(email string) (*User, error)
+	SetEmail(userid uint64, email string) error
+	VerifyEmail(userid uint64, email string) error
+	UseToken(id string, expiresat time.Time) error
+	UpdateProfile(user *User) error
+	DeleteUser(userid uint64) error
+	GetShareRecords(userid uint64) ([]Sharerecords, error)
+	CreateExport(export *Export) error
+	UpdateExport(export *Export) error
+	GetExport(exportid, userid uint64) (*Export, error)
+	GetExports(userid uint64) ([]Export, error)
+	GetExpiredExports(finishedbefore time.Time) ([]Export, error)
+	DeleteExport(exportid uint64) error
+	CreateImportJob(job *Importjob) error
+	UpdateImportJob(job *Importjob) error
+	GetImportJob(jobid, userid uint64) (*Importjob, error)
+	GetReadableNote(noteId, userid uint64) (*Note, error)
+	CreateAttachment(attachment *Attachment) error
+	GetAttachments(noteid uint64) ([]Attachment, error)
+	GetAttachment(attachmentid, noteid uint64) (*Attachment, error)
+	GetAttachmentById(attachmentid uint64) (*Attachment, error)
+	DeleteAttachment(attachmentid uint64) error
+	GetAttachmentUsage(userid uint64) (int64, error)
+	GetAttachmentsOfUser(userid uint64) ([]Attachment, error)
+	SetAttachmentText(attachmentid uint64, text string) error
+	GetUnindexedAttachments() ([]Attachment, error)
+	SearchAttachments(userid uint64, key string) ([]Attachment, error)
+	GetChecklistItems(noteids []uint64) ([]Checklistitem, error)
+	GetChecklistItem(itemid, noteid uint64) (*Checklistitem, error)
+	CreateChecklist(note *Note, items []Checklistitem) error
+	CreateChecklistItem(item *Checklistitem) error
+	UpdateChecklistItem(item *Checklistitem) error
+	MoveChecklistItem(itemid, noteid uint64, position int) error
+	DeleteChecklistItem(itemid, noteid uint64) error
 }
 
+// ErrInvalidCredentials is returned by GetUser when no enabled user matches
+// the username and password.
+var ErrInvalidCredentials = errors.New("Invalid username or password")
+
+// ErrTokenUsed is returned by UseToken when the token was already redeemed.
+var ErrTokenUsed = errors.New("This link was already used")
+
+// ErrExportNotFound is returned by GetExport when the user has no such
+// export.
+var ErrExportNotFound = errors.New("this export doesn't exist in records")
+
+// ErrImportJobNotFound is returned by GetImportJob when the user has no such
+// import.
+var ErrImportJobNotFound = errors.New("this import doesn't exist in records")
+
+// ErrNoteNotFound is returned by GetNoteById and GetReadableNote when the
+// note does not exist or the user may not read it.
+var ErrNoteNotFound = errors.New("Note does not exist in records")
+
+// ErrAttachmentNotFound is returned by GetAttachment when the note has no
+// such attachment, and by GetAttachmentById when there is none at all.
+var ErrAttachmentNotFound = errors.New("this attachment doesn't exist in records")
+
+// ErrChecklistItemNotFound is returned when the checklist has no such item.
+var ErrChecklistItemNotFound = errors.New("this checklist item doesn't exist in records")
+
+// ErrUserNotFound is returned by the lookups of a single user when no user
+// matches.
+var ErrUserNotFound = errors.New("User does not exist in records")
+
 func (r *Database) CreateUser(req *User) error {
 
 	result := r.DbConn.Create(req)
@@ -30,30 +116,40 @@ func (r *Database) CreateUser(req *User) error {
 	return nil
 }
 
+// GetUser checks the username and password and fills req with the stored
+// record of the user.
 func (r *Database) GetUser(req *User) (uint64, error) {
 
-	var id uint64
+	user := &User{}
 
-	query := "select id from users where username = ? and password = ? ;"
+	query := "select * from users where username = ? and password = ? and disabled = false ;"
 
-	err := r.DbConn.Raw(query, req.Username, req.Password).Scan(&id).Error
+	err := r.DbConn.Raw(query, req.Username, req.Password).Scan(user).Error
 	if err != nil {
-		log.Println("Error in Fetching User Order details", err)
+		utility.Errorln("Error in Fetching User Order details", err)
 		return 0, err
 	}
 
-	if id == 0 {
-		return 0, errors.New("User does not exist in records")
+	if user.Id == 0 {
+		return 0, ErrInvalidCredentials
 	}
 
-	return id, nil
+	*req = *user
+
+	return user.Id, nil
 
 }
 
+// CreateNote stores a new note. Timestamps that are set, e.g. by an import,
+// are kept.
 func (r *Database) CreateNote(req *Note) error {
 
-	req.Createdat = time.Now()
-	req.Updatedat = time.Now()
+	if req.Createdat.IsZero() {
+		req.Createdat = time.Now()
+	}
+	if req.Updatedat.IsZero() {
+		req.Updatedat = req.Createdat
+	}
 
 	result := r.DbConn.Create(req)
 
@@ -73,7 +169,7 @@ func (r *Database) GetNotesOfUser(userid uint64) ([]Note, error) {
 
 	err := r.DbConn.Raw(query, userid).Scan(&usernotes).Error
 	if err != nil {
-		log.Println("Error in Fetching Notes details of User", err)
+		utility.Errorln("Error in Fetching Notes details of User", err)
 		return nil, err
 	}
 
@@ -86,7 +182,7 @@ func (r *Database) GetNotesOfUser(userid uint64) ([]Note, error) {
 
 	err = r.DbConn.Raw(query, userid).Scan(&sharednotes).Error
 	if err != nil {
-		log.Println("Error in Fetching shared Notes details of User", err)
+		utility.Errorln("Error in Fetching shared Notes details of User", err)
 		return nil, err
 	}
 
@@ -104,12 +200,12 @@ func (r *Database) GetNoteById(noteId, userid uint64) (*Note, error) {
 
 	err := r.DbConn.Raw(query, noteId, userid).Scan(noteInfo).Error
 	if err != nil {
-		log.Println("Error in Fetching Notes detail", err)
+		utility.Errorln("Error in Fetching Notes detail", err)
 		return nil, err
 	}
 
 	if noteInfo.Id == 0 {
-		return nil, errors.New("Note does not exist in records")
+		return nil, ErrNoteNotFound
 	}
 
 	return noteInfo, nil
@@ -123,7 +219,7 @@ func (r *Database) UpdateNoteById(noteId, userid uint64, note string) error {
 	result := r.DbConn.Exec(query)
 
 	if result.Error != nil {
-		log.Println("Error in Updating Note", result.Error)
+		utility.Errorln("Error in Updating Note", result.Error)
 		return result.Error
 	}
 
@@ -142,7 +238,7 @@ func (r *Database) DeleteNoteById(noteId, userid uint64) error {
 	result := r.DbConn.Exec(query)
 
 	if result.Error != nil {
-		log.Println("Error in Deleting Note", result.Error)
+		utility.Errorln("Error in Deleting Note", result.Error)
 		return result.Error
 	}
 
@@ -150,6 +246,12 @@ func (r *Database) DeleteNoteById(noteId, userid uint64) error {
 		return errors.New("this note doesn't exist in records")
 	}
 
+	err := r.DbConn.Exec("delete from checklistitems where noteid = ? ;", noteId).Error
+	if err != nil {
+		utility.Errorln("Error in Deleting Checklist items", err)
+		return err
+	}
+
 	return nil
 
 }
@@ -160,13 +262,13 @@ func (r *Database) ShareNoteToUser(noteId, senderuserid, recieveruserid uint64)
 
 	err := r.DbConn.First(&user, recieveruserid).Error
 	if err != nil {
-		log.Println("Error in Getting the Reciever User", err)
+		utility.Errorln("Error in Getting the Reciever User", err)
 		return err
 	}
 
 	_, err = r.GetNoteById(noteId, senderuserid)
 	if err != nil {
-		log.Println("Error in Getting the Note ", err)
+		utility.Errorln("Error in Getting the Note ", err)
 		return err
 	}
 
@@ -187,15 +289,19 @@ func (r *Database) ShareNoteToUser(noteId, senderuserid, recieveruserid uint64)
 
 }
 
+// GetNotesByKey returns the notes the user owns or that were shared with
+// them whose text, or the text of one of their checklist items, matches the
+// full text query.
 func (r *Database) GetNotesByKey(userid uint64, key string) ([]Note, error) {
 
 	noteRecords := []Note{}
 
-	query := `select * from notes WHERE userid = ? and note @@ to_tsquery('english', ?);`
+	query := `select * from notes WHERE userid = ? and (note @@ to_tsquery('english', ?) or exists
+    (select 1 from checklistitems where checklistitems.noteid = notes.id and checklistitems.text @@ to_tsquery('english', ?)));`
 
-	err := r.DbConn.Raw(query, userid, key).Scan(&noteRecords).Error
+	err := r.DbConn.Raw(query, userid, key, key).Scan(&noteRecords).Error
 	if err != nil {
-		log.Println("Error in Fetching Notes", err)
+		utility.Errorln("Error in Fetching Notes", err)
 		return nil, err
 	}
 
@@ -209,14 +315,15 @@ func (r *Database) GetNotesByKey(userid uint64, key string) ([]Note, error) {
 
 	err = r.DbConn.Raw(query, userid).Scan(&sharednoteids).Error
 	if err != nil {
-		log.Println("Error in Fetching shared Notes details of User", err)
+		utility.Errorln("Error in Fetching shared Notes details of User", err)
 		return nil, err
 	}
 
-	query = `select * from notes where id in(?) and note @@ to_tsquery('english', ?);`
-	err = r.DbConn.Raw(query, sharednoteids, key).Scan(&sharedNotes).Error
+	query = `select * from notes where id in(?) and (note @@ to_tsquery('english', ?) or exists
+    (select 1 from checklistitems where checklistitems.noteid = notes.id and checklistitems.text @@ to_tsquery('english', ?)));`
+	err = r.DbConn.Raw(query, sharednoteids, key, key).Scan(&sharedNotes).Error
 	if err != nil {
-		log.Println("Error in Fetching shared Notes details of User", err)
+		utility.Errorln("Error in Fetching shared Notes details of User", err)
 		return nil, err
 	}
 
@@ -225,3 +332,1191 @@ func (r *Database) GetNotesByKey(userid uint64, key string) ([]Note, error) {
 	return noteRecords, nil
 
 }
+
+func (r *Database) GetUserByUsername(username string) (*User, error) {
+
+	user := &User{}
+
+	query := "select * from users where username = ? ;"
+
+	err := r.DbConn.Raw(query, username).Scan(user).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching User", err)
+		return nil, err
+	}
+
+	if user.Id == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	return user, nil
+
+}
+
+func (r *Database) ListUsers() ([]User, error) {
+
+	users := []User{}
+
+	query := "select * from users order by id ;"
+
+	err := r.DbConn.Raw(query).Scan(&users).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching Users", err)
+		return nil, err
+	}
+
+	return users, nil
+
+}
+
+// SetUserDisabled disables or re-enables a user. Disabling revokes the login
+// tokens issued so far, so they stay invalid once the user is enabled again.
+func (r *Database) SetUserDisabled(userid uint64, disabled bool) error {
+
+	query := "update users set disabled = ? where id = ? ;"
+	if disabled {
+		query = "update users set disabled = ?, tokengeneration = tokengeneration + 1 where id = ? ;"
+	}
+
+	result := r.DbConn.Exec(query, disabled, userid)
+
+	if result.Error != nil {
+		utility.Errorln("Error in Updating User", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("User does not exist in records")
+	}
+
+	return nil
+
+}
+
+// UpdatePassword sets a new password and revokes the login tokens and
+// personal access tokens issued so far.
+func (r *Database) UpdatePassword(userid uint64, password string) error {
+
+	return r.DbConn.Transaction(func(tx *gorm.DB) error {
+
+		result := tx.Exec("update users set password = ?, passwordless = false, tokengeneration = tokengeneration + 1 where id = ? ;", password, userid)
+
+		if result.Error != nil {
+			utility.Errorln("Error in Updating Password", result.Error)
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return errors.New("User does not exist in records")
+		}
+
+		if err := tx.Exec("delete from accesstokens where userid = ? ;", userid).Error; err != nil {
+			utility.Errorln("Error in Revoking Access tokens", err)
+			return err
+		}
+
+		return nil
+	})
+
+}
+
+// GetTokenGeneration returns the generation that login tokens of the user
+// must carry. Disabled users are not found, so none of their tokens is
+// accepted.
+func (r *Database) GetTokenGeneration(userid uint64) (int, error) {
+
+	user := &User{}
+
+	err := r.DbConn.Raw("select id, tokengeneration from users where id = ? and disabled = false ;", userid).Scan(user).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching Token generation", err)
+		return 0, err
+	}
+
+	if user.Id == 0 {
+		return 0, ErrUserNotFound
+	}
+
+	return user.Tokengeneration, nil
+
+}
+
+// CreateAuthEvent stores an event. Without a Userid it is attributed to the
+// account the username currently belongs to, if any.
+func (r *Database) CreateAuthEvent(event *Authevent) error {
+
+	event.Createdat = time.Now()
+
+	if event.Userid == 0 {
+		err := r.DbConn.Raw("select id from users where username = ? ;", event.Username).Scan(&event.Userid).Error
+		if err != nil {
+			utility.Errorln("Error in Fetching User of Auth event", err)
+			return err
+		}
+	}
+
+	result := r.DbConn.Create(event)
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return nil
+
+}
+
+// GetAuthEvents returns the newest events recorded for username, whichever
+// account it belonged to, all of them when limit is not positive.
+func (r *Database) GetAuthEvents(username string, limit int) ([]Authevent, error) {
+
+	events := []Authevent{}
+
+	query := "select * from authevents where username = ? order by id desc limit ? ;"
+
+	var limitArg interface{} = limit
+	if limit <= 0 {
+		limitArg = nil
+	}
+
+	err := r.DbConn.Raw(query, username, limitArg).Scan(&events).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching Auth events", err)
+		return nil, err
+	}
+
+	return events, nil
+
+}
+
+// GetAuthEventsOfUser returns the newest events of the account, under any
+// username it had, all of them when limit is not positive.
+func (r *Database) GetAuthEventsOfUser(userid uint64, limit int) ([]Authevent, error) {
+
+	events := []Authevent{}
+
+	query := "select * from authevents where userid = ? order by id desc limit ? ;"
+
+	var limitArg interface{} = limit
+	if limit <= 0 {
+		limitArg = nil
+	}
+
+	err := r.DbConn.Raw(query, userid, limitArg).Scan(&events).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching Auth events", err)
+		return nil, err
+	}
+
+	return events, nil
+
+}
+
+func (r *Database) GetUserById(userid uint64) (*User, error) {
+
+	user := &User{}
+
+	query := "select * from users where id = ? ;"
+
+	err := r.DbConn.Raw(query, userid).Scan(user).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching User", err)
+		return nil, err
+	}
+
+	if user.Id == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	return user, nil
+
+}
+
+func (r *Database) SetTotpSecret(userid uint64, secret string) error {
+
+	result := r.DbConn.Exec("update users set totpsecret = ? where id = ? and totpenabled = false ;", secret, userid)
+
+	if result.Error != nil {
+		utility.Errorln("Error in Updating TOTP secret", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("two-factor authentication is already enabled")
+	}
+
+	return nil
+
+}
+
+// EnableTotp turns on the second factor and replaces the recovery codes.
+// step is the time step of the code that confirmed it.
+func (r *Database) EnableTotp(userid uint64, step int64, codehashes []string) error {
+
+	return r.DbConn.Transaction(func(tx *gorm.DB) error {
+
+		err := tx.Exec("update users set totpenabled = true, totplaststep = ? where id = ? ;", step, userid).Error
+		if err != nil {
+			utility.Errorln("Error in Enabling TOTP", err)
+			return err
+		}
+
+		err = tx.Exec("delete from recoverycodes where userid = ? ;", userid).Error
+		if err != nil {
+			utility.Errorln("Error in Deleting Recovery codes", err)
+			return err
+		}
+
+		codes := []Recoverycode{}
+		for _, hash := range codehashes {
+			codes = append(codes, Recoverycode{Userid: userid, Codehash: hash})
+		}
+
+		return tx.Create(&codes).Error
+	})
+
+}
+
+func (r *Database) DisableTotp(userid uint64) error {
+
+	return r.DbConn.Transaction(func(tx *gorm.DB) error {
+
+		result := tx.Exec("update users set totpenabled = false, totpsecret = '' where id = ? ;", userid)
+		if result.Error != nil {
+			utility.Errorln("Error in Disabling TOTP", result.Error)
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return errors.New("User does not exist in records")
+		}
+
+		return tx.Exec("delete from recoverycodes where userid = ? ;", userid).Error
+	})
+
+}
+
+// UseTotpStep records step as the last accepted TOTP time step of the user.
+// It returns ErrInvalidCredentials when a code of that step or a later one
+// was already accepted, so that concurrent logins cannot both use a code.
+func (r *Database) UseTotpStep(userid uint64, step int64) error {
+
+	result := r.DbConn.Exec("update users set totplaststep = ? where id = ? and totplaststep < ? ;", step, userid, step)
+
+	if result.Error != nil {
+		utility.Errorln("Error in Using TOTP step", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+
+}
+
+// UseRecoveryCode marks an unused recovery code of the user as used. It
+// returns ErrInvalidCredentials when there is none matching codehash.
+func (r *Database) UseRecoveryCode(userid uint64, codehash string) error {
+
+	result := r.DbConn.Exec("update recoverycodes set used = true where userid = ? and codehash = ? and used = false ;", userid, codehash)
+
+	if result.Error != nil {
+		utility.Errorln("Error in Using Recovery code", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+
+}
+
+func (r *Database) CreateAccessToken(token *Accesstoken) error {
+
+	token.Createdat = time.Now()
+
+	result := r.DbConn.Create(token)
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return nil
+
+}
+
+func (r *Database) GetAccessTokens(userid uint64) ([]Accesstoken, error) {
+
+	tokens := []Accesstoken{}
+
+	query := "select * from accesstokens where userid = ? order by id ;"
+
+	err := r.DbConn.Raw(query, userid).Scan(&tokens).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching Access tokens", err)
+		return nil, err
+	}
+
+	return tokens, nil
+
+}
+
+// GetAccessTokenByHash returns the token with the given hash, provided that
+// its user is not disabled.
+func (r *Database) GetAccessTokenByHash(tokenhash string) (*Accesstoken, error) {
+
+	token := &Accesstoken{}
+
+	query := `select accesstokens.*
+    from accesstokens
+    join users on users.id = accesstokens.userid
+    where accesstokens.tokenhash = ? and users.disabled = false ;`
+
+	err := r.DbConn.Raw(query, tokenhash).Scan(token).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching Access token", err)
+		return nil, err
+	}
+
+	if token.Id == 0 {
+		return nil, ErrInvalidCredentials
+	}
+
+	return token, nil
+
+}
+
+func (r *Database) DeleteAccessToken(tokenid, userid uint64) error {
+
+	result := r.DbConn.Exec("delete from accesstokens where id = ? and userid = ? ;", tokenid, userid)
+
+	if result.Error != nil {
+		utility.Errorln("Error in Deleting Access token", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("this token doesn't exist in records")
+	}
+
+	return nil
+
+}
+
+// GetUserByOidc returns the user linked to the subject of an OpenID Connect
+// issuer.
+func (r *Database) GetUserByOidc(issuer, subject string) (*User, error) {
+
+	user := &User{}
+
+	query := "select * from users where oidcissuer = ? and oidcsubject = ? ;"
+
+	err := r.DbConn.Raw(query, issuer, subject).Scan(user).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching User", err)
+		return nil, err
+	}
+
+	if user.Id == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	return user, nil
+
+}
+
+func (r *Database) LinkOidc(userid uint64, issuer, subject string) error {
+
+	result := r.DbConn.Exec("update users set oidcissuer = ?, oidcsubject = ? where id = ? ;", issuer, subject, userid)
+
+	if result.Error != nil {
+		utility.Errorln("Error in Linking User", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+
+}
+
+// GetUserByEmail returns the user who verified email.
+func (r *Database) GetUserByEmail(email string) (*User, error) {
+
+	user := &User{}
+
+	query := "select * from users where email = ? and emailverified = true ;"
+
+	err := r.DbConn.Raw(query, email).Scan(user).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching User", err)
+		return nil, err
+	}
+
+	if user.Id == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	return user, nil
+
+}
+
+// SetEmail changes the email of the user, which then needs to be verified
+// again.
+func (r *Database) SetEmail(userid uint64, email string) error {
+
+	result := r.DbConn.Exec("update users set email = ?, emailverified = false where id = ? ;", email, userid)
+
+	if result.Error != nil {
+		utility.Errorln("Error in Updating Email", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+
+}
+
+// VerifyEmail marks email as verified, provided that it is still the email
+// of the user.
+func (r *Database) VerifyEmail(userid uint64, email string) error {
+
+	result := r.DbConn.Exec("update users set emailverified = true where id = ? and email = ? ;", userid, email)
+
+	if result.Error != nil {
+		utility.Errorln("Error in Verifying Email", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+
+}
+
+// UseToken redeems the single use token with the given id, returning
+// ErrTokenUsed when it was redeemed before. Records of expired tokens are
+// removed along the way.
+func (r *Database) UseToken(id string, expiresat time.Time) error {
+
+	err := r.DbConn.Exec("delete from usedtokens where expiresat < ? ;", time.Now()).Error
+	if err != nil {
+		utility.Errorln("Error in Deleting Used tokens", err)
+		return err
+	}
+
+	result := r.DbConn.Exec("insert into usedtokens (id, expiresat) values (?, ?) on conflict do nothing ;", id, expiresat)
+
+	if result.Error != nil {
+		utility.Errorln("Error in Using token", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrTokenUsed
+	}
+
+	return nil
+
+}
+
+// UpdateProfile stores the username and profile settings of user.
+func (r *Database) UpdateProfile(user *User) error {
+
+	query := `update users
+    set username = ?, displayname = ?, avatar = ?, timezone = ?, locale = ?, defaultsort = ?
+    where id = ? ;`
+
+	result := r.DbConn.Exec(query, user.Username, user.Displayname, user.Avatar, user.Timezone, user.Locale, user.Defaultsort, user.Id)
+
+	if result.Error != nil {
+		utility.Errorln("Error in Updating Profile", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+
+}
+
+// DeleteUser removes the user with their notes, the shares of those notes
+// and of notes shared with them, their tokens, recovery codes and exports
+// (the caller removes the archive files). Checklist items assigned to them
+// are unassigned. Auth events are kept for auditing with the username
+// replaced.
+func (r *Database) DeleteUser(userid uint64) error {
+
+	return r.DbConn.Transaction(func(tx *gorm.DB) error {
+
+		user := &User{}
+		err := tx.Raw("select * from users where id = ? for update ;", userid).Scan(user).Error
+		if err != nil {
+			utility.Errorln("Error in Fetching User", err)
+			return err
+		}
+		if user.Id == 0 {
+			return ErrUserNotFound
+		}
+
+		statements := []struct {
+			query string
+			args  []interface{}
+		}{
+			{"delete from checklistitems where noteid in (select id from notes where userid = ?) ;", []interface{}{userid}},
+			{"update checklistitems set assigneeid = 0 where assigneeid = ? ;", []interface{}{userid}},
+			{"delete from sharerecords where senderuserid = ? or reciveruserid = ? or noteid in (select id from notes where userid = ?) ;", []interface{}{userid, userid, userid}},
+			{"delete from notes where userid = ? ;", []interface{}{userid}},
+			{"delete from accesstokens where userid = ? ;", []interface{}{userid}},
+			{"delete from recoverycodes where userid = ? ;", []interface{}{userid}},
+			{"delete from exports where userid = ? ;", []interface{}{userid}},
+			{"delete from importjobs where userid = ? ;", []interface{}{userid}},
+			{"delete from attachments where userid = ? ;", []interface{}{userid}},
+			{"update authevents set username = ? where userid = ? ;", []interface{}{fmt.Sprintf("deleted-user-%d", userid), userid}},
+			{"delete from users where id = ? ;", []interface{}{userid}},
+		}
+
+		for _, statement := range statements {
+			if err := tx.Exec(statement.query, statement.args...).Error; err != nil {
+				utility.Errorln("Error in Deleting User", err)
+				return err
+			}
+		}
+
+		return nil
+	})
+
+}
+
+// GetShareRecords returns the shares sent and received by the user.
+func (r *Database) GetShareRecords(userid uint64) ([]Sharerecords, error) {
+
+	records := []Sharerecords{}
+
+	query := "select * from sharerecords where senderuserid = ? or reciveruserid = ? ;"
+
+	err := r.DbConn.Raw(query, userid, userid).Scan(&records).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching Share records", err)
+		return nil, err
+	}
+
+	return records, nil
+
+}
+
+func (r *Database) CreateExport(export *Export) error {
+
+	export.Createdat = time.Now()
+
+	result := r.DbConn.Create(export)
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return nil
+
+}
+
+// UpdateExport stores the outcome of building the archive.
+func (r *Database) UpdateExport(export *Export) error {
+
+	query := "update exports set status = ?, error = ?, file = ?, size = ?, finishedat = ? where id = ? ;"
+
+	result := r.DbConn.Exec(query, export.Status, export.Error, export.File, export.Size, export.Finishedat, export.Id)
+
+	if result.Error != nil {
+		utility.Errorln("Error in Updating Export", result.Error)
+		return result.Error
+	}
+
+	return nil
+
+}
+
+func (r *Database) GetExport(exportid, userid uint64) (*Export, error) {
+
+	export := &Export{}
+
+	query := "select * from exports where id = ? and userid = ? ;"
+
+	err := r.DbConn.Raw(query, exportid, userid).Scan(export).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching Export", err)
+		return nil, err
+	}
+
+	if export.Id == 0 {
+		return nil, ErrExportNotFound
+	}
+
+	return export, nil
+
+}
+
+func (r *Database) GetExports(userid uint64) ([]Export, error) {
+
+	exports := []Export{}
+
+	query := "select * from exports where userid = ? order by id ;"
+
+	err := r.DbConn.Raw(query, userid).Scan(&exports).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching Exports", err)
+		return nil, err
+	}
+
+	return exports, nil
+
+}
+
+// GetExpiredExports returns the exports of all users that were built, or
+// failed, before finishedbefore.
+func (r *Database) GetExpiredExports(finishedbefore time.Time) ([]Export, error) {
+
+	exports := []Export{}
+
+	query := "select * from exports where status <> ? and finishedat < ? order by id ;"
+
+	err := r.DbConn.Raw(query, ExportPending, finishedbefore).Scan(&exports).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching Expired exports", err)
+		return nil, err
+	}
+
+	return exports, nil
+
+}
+
+func (r *Database) DeleteExport(exportid uint64) error {
+
+	result := r.DbConn.Exec("delete from exports where id = ? ;", exportid)
+
+	if result.Error != nil {
+		utility.Errorln("Error in Deleting Export", result.Error)
+		return result.Error
+	}
+
+	return nil
+
+}
+
+func (r *Database) CreateImportJob(job *Importjob) error {
+
+	job.Createdat = time.Now()
+
+	result := r.DbConn.Create(job)
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return nil
+
+}
+
+// UpdateImportJob stores the progress and, once finished, the outcome of
+// the import.
+func (r *Database) UpdateImportJob(job *Importjob) error {
+
+	query := `update importjobs set status = ?, error = ?, progress = ?, processed = ?, imported = ?,
+    failed = ?, attachments = ?, failures = ?, finishedat = ? where id = ? ;`
+
+	result := r.DbConn.Exec(query, job.Status, job.Error, job.Progress, job.Processed, job.Imported,
+		job.Failed, job.Attachments, job.Failures, job.Finishedat, job.Id)
+
+	if result.Error != nil {
+		utility.Errorln("Error in Updating Import job", result.Error)
+		return result.Error
+	}
+
+	return nil
+
+}
+
+func (r *Database) GetImportJob(jobid, userid uint64) (*Importjob, error) {
+
+	job := &Importjob{}
+
+	query := "select * from importjobs where id = ? and userid = ? ;"
+
+	err := r.DbConn.Raw(query, jobid, userid).Scan(job).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching Import job", err)
+		return nil, err
+	}
+
+	if job.Id == 0 {
+		return nil, ErrImportJobNotFound
+	}
+
+	return job, nil
+
+}
+
+// GetReadableNote returns the note if the user owns it or it was shared with
+// them.
+func (r *Database) GetReadableNote(noteId, userid uint64) (*Note, error) {
+
+	note := &Note{}
+
+	query := `select * from notes where id = ? and (userid = ? or exists
+    (select 1 from sharerecords where sharerecords.noteid = notes.id and sharerecords.reciveruserid = ?)) ;`
+
+	err := r.DbConn.Raw(query, noteId, userid, userid).Scan(note).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching Note detail", err)
+		return nil, err
+	}
+
+	if note.Id == 0 {
+		return nil, ErrNoteNotFound
+	}
+
+	return note, nil
+
+}
+
+// attachmentColumns are all columns of attachments but the extracted text,
+// which can be large and is only needed by searches.
+const attachmentColumns = "id, noteid, userid, name, mime, size, sha256, blobkey, indexed, createdat"
+
+func (r *Database) CreateAttachment(attachment *Attachment) error {
+
+	attachment.Createdat = time.Now()
+
+	result := r.DbConn.Create(attachment)
+
+	if result.Error != nil {
+		utility.Errorln("Error in Creating Attachment", result.Error)
+		return result.Error
+	}
+
+	return nil
+
+}
+
+func (r *Database) GetAttachments(noteid uint64) ([]Attachment, error) {
+
+	attachments := []Attachment{}
+
+	query := "select " + attachmentColumns + " from attachments where noteid = ? order by id ;"
+
+	err := r.DbConn.Raw(query, noteid).Scan(&attachments).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching Attachments", err)
+		return nil, err
+	}
+
+	return attachments, nil
+
+}
+
+func (r *Database) GetAttachment(attachmentid, noteid uint64) (*Attachment, error) {
+
+	attachment := &Attachment{}
+
+	query := "select " + attachmentColumns + " from attachments where id = ? and noteid = ? ;"
+
+	err := r.DbConn.Raw(query, attachmentid, noteid).Scan(attachment).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching Attachment", err)
+		return nil, err
+	}
+
+	if attachment.Id == 0 {
+		return nil, ErrAttachmentNotFound
+	}
+
+	return attachment, nil
+
+}
+
+func (r *Database) GetAttachmentById(attachmentid uint64) (*Attachment, error) {
+
+	attachment := &Attachment{}
+
+	query := "select " + attachmentColumns + " from attachments where id = ? ;"
+
+	err := r.DbConn.Raw(query, attachmentid).Scan(attachment).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching Attachment", err)
+		return nil, err
+	}
+
+	if attachment.Id == 0 {
+		return nil, ErrAttachmentNotFound
+	}
+
+	return attachment, nil
+
+}
+
+func (r *Database) DeleteAttachment(attachmentid uint64) error {
+
+	result := r.DbConn.Exec("delete from attachments where id = ? ;", attachmentid)
+
+	if result.Error != nil {
+		utility.Errorln("Error in Deleting Attachment", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrAttachmentNotFound
+	}
+
+	return nil
+
+}
+
+// GetAttachmentUsage returns the total size of the attachments of the
+// user's notes in bytes.
+func (r *Database) GetAttachmentUsage(userid uint64) (int64, error) {
+
+	var usage int64
+
+	query := "select coalesce(sum(size), 0) from attachments where userid = ? ;"
+
+	err := r.DbConn.Raw(query, userid).Scan(&usage).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching Attachment usage", err)
+		return 0, err
+	}
+
+	return usage, nil
+
+}
+
+func (r *Database) GetAttachmentsOfUser(userid uint64) ([]Attachment, error) {
+
+	attachments := []Attachment{}
+
+	query := "select " + attachmentColumns + " from attachments where userid = ? ;"
+
+	err := r.DbConn.Raw(query, userid).Scan(&attachments).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching Attachments of User", err)
+		return nil, err
+	}
+
+	return attachments, nil
+
+}
+
+// SetAttachmentText stores the text extracted from an attachment and marks
+// it indexed.
+func (r *Database) SetAttachmentText(attachmentid uint64, text string) error {
+
+	result := r.DbConn.Exec("update attachments set text = ?, indexed = true where id = ? ;", text, attachmentid)
+
+	if result.Error != nil {
+		utility.Errorln("Error in Updating Attachment text", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrAttachmentNotFound
+	}
+
+	return nil
+
+}
+
+// GetUnindexedAttachments returns the attachments whose text has not been
+// extracted yet, oldest first.
+func (r *Database) GetUnindexedAttachments() ([]Attachment, error) {
+
+	attachments := []Attachment{}
+
+	query := "select " + attachmentColumns + " from attachments where indexed = false order by id ;"
+
+	err := r.DbConn.Raw(query).Scan(&attachments).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching unindexed Attachments", err)
+		return nil, err
+	}
+
+	return attachments, nil
+
+}
+
+// SearchAttachments returns the attachments of notes the user owns or that
+// were shared with them whose text matches the full text query.
+func (r *Database) SearchAttachments(userid uint64, key string) ([]Attachment, error) {
+
+	attachments := []Attachment{}
+
+	query := `select ` + attachmentColumns + ` from attachments
+    where noteid in (select id from notes where userid = ?
+        union select noteid from sharerecords where reciveruserid = ?)
+    and to_tsvector('english', text) @@ to_tsquery('english', ?)
+    order by noteid, id ;`
+
+	err := r.DbConn.Raw(query, userid, userid, key).Scan(&attachments).Error
+	if err != nil {
+		utility.Errorln("Error in Searching Attachments", err)
+		return nil, err
+	}
+
+	return attachments, nil
+
+}
+
+// GetChecklistItems returns the items of the checklist notes in order. The
+// Position of an item is its index in the checklist.
+func (r *Database) GetChecklistItems(noteids []uint64) ([]Checklistitem, error) {
+
+	items := []Checklistitem{}
+
+	query := "select * from checklistitems where noteid in (?) order by noteid, position, id ;"
+
+	err := r.DbConn.Raw(query, noteids).Scan(&items).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching Checklist items", err)
+		return nil, err
+	}
+
+	return items, nil
+
+}
+
+func (r *Database) GetChecklistItem(itemid, noteid uint64) (*Checklistitem, error) {
+
+	item := &Checklistitem{}
+
+	query := "select * from checklistitems where id = ? and noteid = ? ;"
+
+	err := r.DbConn.Raw(query, itemid, noteid).Scan(item).Error
+	if err != nil {
+		utility.Errorln("Error in Fetching Checklist item", err)
+		return nil, err
+	}
+
+	if item.Id == 0 {
+		return nil, ErrChecklistItemNotFound
+	}
+
+	return item, nil
+
+}
+
+// touchNote marks the note of a changed checklist item as updated. Changes
+// to the items of a note are serialized by the lock this takes on it.
+func touchNote(tx *gorm.DB, noteid uint64, now time.Time) error {
+
+	result := tx.Exec("update notes set updatedat = ? where id = ? ;", now, noteid)
+
+	if result.Error != nil {
+		utility.Errorln("Error in Updating Note", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrNoteNotFound
+	}
+
+	return nil
+
+}
+
+// CreateChecklist creates the checklist note with its items in order, or
+// nothing if any of them fails.
+func (r *Database) CreateChecklist(note *Note, items []Checklistitem) error {
+
+	if note.Createdat.IsZero() {
+		note.Createdat = time.Now()
+	}
+	if note.Updatedat.IsZero() {
+		note.Updatedat = note.Createdat
+	}
+
+	return r.DbConn.Transaction(func(tx *gorm.DB) error {
+
+		err := tx.Create(note).Error
+		if err != nil {
+			utility.Errorln("Error in Creating Checklist", err)
+			return err
+		}
+
+		for i := range items {
+			items[i].Noteid = note.Id
+			items[i].Position = i
+			items[i].Createdat = note.Createdat
+			items[i].Updatedat = note.Createdat
+
+			err = tx.Create(&items[i]).Error
+			if err != nil {
+				utility.Errorln("Error in Creating Checklist item", err)
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// CreateChecklistItem adds the item at the end of the checklist of its
+// note.
+func (r *Database) CreateChecklistItem(item *Checklistitem) error {
+
+	return r.DbConn.Transaction(func(tx *gorm.DB) error {
+
+		item.Createdat = time.Now()
+		item.Updatedat = item.Createdat
+
+		if err := touchNote(tx, item.Noteid, item.Createdat); err != nil {
+			return err
+		}
+
+		query := "select coalesce(max(position) + 1, 0) from checklistitems where noteid = ? ;"
+
+		err := tx.Raw(query, item.Noteid).Scan(&item.Position).Error
+		if err != nil {
+			utility.Errorln("Error in Fetching Checklist position", err)
+			return err
+		}
+
+		err = tx.Create(item).Error
+		if err != nil {
+			utility.Errorln("Error in Creating Checklist item", err)
+			return err
+		}
+
+		return nil
+	})
+
+}
+
+// UpdateChecklistItem stores the text, state, due date and assignee of the
+// item.
+func (r *Database) UpdateChecklistItem(item *Checklistitem) error {
+
+	return r.DbConn.Transaction(func(tx *gorm.DB) error {
+
+		item.Updatedat = time.Now()
+
+		if err := touchNote(tx, item.Noteid, item.Updatedat); err != nil {
+			return err
+		}
+
+		query := `update checklistitems
+    set text = ?, checked = ?, duedate = ?, assigneeid = ?, updatedat = ?
+    where id = ? and noteid = ? ;`
+
+		result := tx.Exec(query, item.Text, item.Checked, item.Duedate, item.Assigneeid, item.Updatedat, item.Id, item.Noteid)
+
+		if result.Error != nil {
+			utility.Errorln("Error in Updating Checklist item", result.Error)
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrChecklistItemNotFound
+		}
+
+		return nil
+	})
+
+}
+
+// MoveChecklistItem moves the item to the position among the items of its
+// note, 0 being the top. Positions past the end move it to the end.
+func (r *Database) MoveChecklistItem(itemid, noteid uint64, position int) error {
+
+	return r.DbConn.Transaction(func(tx *gorm.DB) error {
+
+		if err := touchNote(tx, noteid, time.Now()); err != nil {
+			return err
+		}
+
+		ids := []uint64{}
+
+		query := "select id from checklistitems where noteid = ? order by position, id ;"
+
+		err := tx.Raw(query, noteid).Scan(&ids).Error
+		if err != nil {
+			utility.Errorln("Error in Fetching Checklist items", err)
+			return err
+		}
+
+		from := -1
+		for i, id := range ids {
+			if id == itemid {
+				from = i
+			}
+		}
+		if from < 0 {
+			return ErrChecklistItemNotFound
+		}
+
+		ids = append(ids[:from], ids[from+1:]...)
+		if position < 0 {
+			position = 0
+		}
+		if position > len(ids) {
+			position = len(ids)
+		}
+		ids = append(ids[:position], append([]uint64{itemid}, ids[position:]...)...)
+
+		for i, id := range ids {
+			err := tx.Exec("update checklistitems set position = ? where id = ? ;", i, id).Error
+			if err != nil {
+				utility.Errorln("Error in Moving Checklist item", err)
+				return err
+			}
+		}
+
+		return nil
+	})
+
+}
+
+// DeleteChecklistItem removes the item and moves up the items below it.
+func (r *Database) DeleteChecklistItem(itemid, noteid uint64) error {
+
+	return r.DbConn.Transaction(func(tx *gorm.DB) error {
+
+		if err := touchNote(tx, noteid, time.Now()); err != nil {
+			return err
+		}
+
+		positions := []int{}
+
+		query := "delete from checklistitems where id = ? and noteid = ? returning position ;"
+
+		err := tx.Raw(query, itemid, noteid).Scan(&positions).Error
+		if err != nil {
+			utility.Errorln("Error in Deleting Checklist item", err)
+			return err
+		}
+
+		if len(positions) == 0 {
+			return ErrChecklistItemNotFound
+		}
+
+		// positions stay the indexes of the items
+		query = "update checklistitems set position = position - 1 where noteid = ? and position > ? ;"
+
+		err = tx.Exec(query, noteid, positions[0]).Error
+		if err != nil {
+			utility.Errorln("Error in Deleting Checklist item", err)
+			return err
+		}
+
+		return nil
+	})
+
+}
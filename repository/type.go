@@ -5,3 +5,13 @@ import "gorm.io/gorm"
 type Database struct {
 	DbConn *gorm.DB
 }
+
+func (r *Database) Close() error {
+
+	sqlDB, err := r.DbConn.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.Close()
+}
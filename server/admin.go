@@ -0,0 +1,130 @@
+package server
+
+import (
+	"NOTESBE/config"
+	"NOTESBE/repository"
+	"encoding/json"
+	"net/http"
+)
+
+func ConfigStatus(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	cfg := config.Get()
+
+	resp := &ConfigStatusResp{
+		File:          cfg.File,
+		Mode:          cfg.Mode,
+		LogLevel:      cfg.Log.Level,
+		TokenLifetime: cfg.Token.Lifetime.String(),
+		RateLimits:    []RateLimitPolicy{},
+		LastReload:    config.LastReload(),
+	}
+
+	for _, policy := range cfg.RateLimit.Policies {
+		resp.RateLimits = append(resp.RateLimits, RateLimitPolicy{
+			Name:     policy.Name,
+			Prefix:   policy.Prefix,
+			Requests: policy.Requests,
+			Period:   policy.Period.String(),
+		})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func ReloadConfig(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	status := config.Reload("admin api")
+	if !status.Success {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(status)
+}
+
+func (s *server) Lockouts(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	lockouts, err := s.guard.lockouts(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(lockouts)
+}
+
+func (s *server) Unlock(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req UnlockReq
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	if (req.UserName == "") == (req.Ip == "") {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Exactly one of username and ip is required"})
+		return
+	}
+
+	key := userGuardKey(req.UserName)
+	if req.Ip != "" {
+		key = ipGuardKey(req.Ip)
+	}
+
+	found, err := s.guard.unlock(r.Context(), key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "No failed logins recorded"})
+		return
+	}
+
+	s.recordAuthEvent(req.UserName, req.Ip, repository.EventUnlocked)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Unlocked"))
+}
+
+func (s *server) AuthEvents(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	username := r.URL.Query().Get("username")
+	if username == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request"})
+		return
+	}
+
+	events, err := s.db.GetAuthEvents(username, 100)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(events)
+}
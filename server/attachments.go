@@ -0,0 +1,518 @@
+package server
+
+import (
+	"NOTESBE/blobstore"
+	"NOTESBE/config"
+	"NOTESBE/extract"
+	"NOTESBE/imaging"
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	errAttachmentTooLarge = errors.New("attachment is too large")
+	errQuotaExceeded      = errors.New("attachment quota exceeded")
+)
+
+// inlineTypes are shown by browsers without running anything, all other
+// attachments are sent as downloads.
+var inlineTypes = map[string]bool{
+	"image/png":                 true,
+	"image/jpeg":                true,
+	"image/gif":                 true,
+	"image/webp":                true,
+	"image/bmp":                 true,
+	"application/pdf":           true,
+	"text/plain; charset=utf-8": true,
+}
+
+// attachmentPolicy keeps attachments opened in a browser from running
+// scripts. PDFs are exempt as browsers do not show them in a sandbox.
+const attachmentPolicy = "default-src 'none'; img-src 'self'; style-src 'unsafe-inline'; sandbox"
+
+func attachmentResp(attachment *repository.Attachment) AttachmentResp {
+
+	resp := AttachmentResp{
+		Id:        attachment.Id,
+		NoteId:    attachment.Noteid,
+		Name:      attachment.Name,
+		Mime:      attachment.Mime,
+		Size:      attachment.Size,
+		Sha256:    attachment.Sha256,
+		Url:       fmt.Sprintf("/api/notes/%d/attachments/%d", attachment.Noteid, attachment.Id),
+		CreatedAt: attachment.Createdat,
+	}
+	if imaging.CanThumbnail(attachment.Mime) {
+		resp.Thumbnail = fmt.Sprintf("/api/attachments/%d/thumb", attachment.Id)
+	}
+
+	return resp
+}
+
+// sniff returns the type of an attachment from the first 512 bytes of its
+// content. The extension of the name only refines types the content does
+// not tell apart, such as Office documents which are zip archives, and
+// never makes an attachment one that is shown inline.
+func sniff(head []byte, name string) string {
+
+	sniffed := http.DetectContentType(head)
+
+	switch sniffed {
+	case "application/octet-stream", "application/zip", "text/plain; charset=utf-8":
+		byName := mime.TypeByExtension(strings.ToLower(path.Ext(name)))
+		if byName != "" && !inlineTypes[byName] {
+			return byName
+		}
+	}
+
+	return sniffed
+}
+
+// attachmentName drops control characters from the name a client gave the
+// file and shortens it to 255 bytes.
+func attachmentName(name string) string {
+
+	name = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, path.Base(strings.ReplaceAll(name, "\\", "/"))))
+
+	for len(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == "/" {
+		name = "attachment"
+	}
+
+	return name
+}
+
+// limitedReader fails with err once more than n bytes were read. Bytes past
+// the limit are never returned.
+type limitedReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+
+	if l.n < 0 {
+		return 0, l.err
+	}
+	// one byte more than allowed tells a reader at the limit from one over it
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n - 1, l.err
+	}
+
+	return n, err
+}
+
+// noteAccess parses the note of the request and checks the user may read
+// it, or with owner set that they own it. It writes the error response and
+// returns false otherwise.
+func (s *server) noteAccess(w http.ResponseWriter, r *http.Request, owner bool) (uint64, uint64, bool) {
+
+	noteId, err := utility.ParseNoteId(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return 0, 0, false
+	}
+
+	userId, err := utility.ParseUserId(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return 0, 0, false
+	}
+
+	if owner {
+		_, err = s.db.GetNoteById(noteId, userId)
+	} else {
+		_, err = s.db.GetReadableNote(noteId, userId)
+	}
+	if errors.Is(err, repository.ErrNoteNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return 0, 0, false
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return 0, 0, false
+	}
+
+	return noteId, userId, true
+}
+
+// UploadAttachments stores every file of a multipart form as an attachment
+// of the note. Files are streamed to the blob store as they arrive; a file
+// over attachments.maxsize or the user's quota ends the upload with 413,
+// files stored before it are kept. Metadata is removed from images; their
+// thumbnails are made and the text of documents is indexed for search in
+// the background.
+func (s *server) UploadAttachments(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	noteId, userId, ok := s.noteAccess(w, r, true)
+	if !ok {
+		return
+	}
+
+	r.Body = newStreamReader(w, r.Body)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	// concurrent uploads of a user can together exceed the quota by up to
+	// their size, which is accepted for not locking
+	usage, err := s.db.GetAttachmentUsage(userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	cfg := config.Get().Attachments
+	created := []AttachmentResp{}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		if part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		attachment, err := s.storeAttachment(r.Context(), part, part.FileName(), noteId, userId, cfg, usage)
+		part.Close()
+
+		switch {
+		case errors.Is(err, errAttachmentTooLarge):
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("%s is larger than %d bytes", part.FileName(), cfg.MaxSize)})
+			return
+		case errors.Is(err, errQuotaExceeded):
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("%s exceeds the attachment quota of %d bytes", part.FileName(), cfg.Quota)})
+			return
+		case errors.Is(err, imaging.ErrFormat):
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("%s is not a valid image: %v", part.FileName(), err)})
+			return
+		case err != nil:
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+
+		usage += attachment.Size
+		created = append(created, attachmentResp(attachment))
+
+		if imaging.CanThumbnail(attachment.Mime) {
+			go s.backgroundThumbnails(*attachment)
+		}
+		if !attachment.Indexed {
+			s.queueIndexing(*attachment)
+		}
+	}
+
+	if len(created) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "the form contains no file"})
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (s *server) storeAttachment(ctx context.Context, file io.Reader, fileName string, noteId, userId uint64, cfg config.AttachmentConfig, usage int64) (*repository.Attachment, error) {
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	limit := &limitedReader{r: io.MultiReader(bytes.NewReader(head), file), n: cfg.MaxSize, err: errAttachmentTooLarge}
+	if cfg.Quota-usage < cfg.MaxSize {
+		limit.n, limit.err = cfg.Quota-usage, errQuotaExceeded
+	}
+
+	suffix := make([]byte, 16)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+
+	attachment := &repository.Attachment{
+		Noteid:  noteId,
+		Userid:  userId,
+		Name:    attachmentName(fileName),
+		Mime:    sniff(head, fileName),
+		Blobkey: fmt.Sprintf("notes/%d/%s", noteId, hex.EncodeToString(suffix)),
+	}
+	// files without text need no indexing
+	attachment.Indexed = !extract.Supported(attachment.Mime)
+
+	var content io.Reader = limit
+	if imaging.CanStrip(attachment.Mime) {
+		stripped, w := io.Pipe()
+		done := make(chan struct{})
+		go func() {
+			w.CloseWithError(imaging.Strip(w, limit, attachment.Mime))
+			close(done)
+		}()
+		// stops stripping when the store gave up early, the file must not
+		// be read anymore once this returns
+		defer func() {
+			stripped.Close()
+			<-done
+		}()
+		content = stripped
+	}
+
+	// size and hash are those of the stored file, without metadata
+	hash := sha256.New()
+	counter := &counter{}
+
+	err = s.blobs.Put(ctx, attachment.Blobkey, io.TeeReader(content, io.MultiWriter(hash, counter)))
+	if err != nil {
+		return nil, err
+	}
+
+	attachment.Size = counter.n
+	attachment.Sha256 = hex.EncodeToString(hash.Sum(nil))
+
+	if err := s.db.CreateAttachment(attachment); err != nil {
+		s.deleteBlob(ctx, attachment.Blobkey)
+		return nil, err
+	}
+
+	return attachment, nil
+}
+
+type counter struct {
+	n int64
+}
+
+func (c *counter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// GetAttachments lists the attachments of a note the user owns or that was
+// shared with them.
+func (s *server) GetAttachments(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	noteId, _, ok := s.noteAccess(w, r, false)
+	if !ok {
+		return
+	}
+
+	attachments, err := s.db.GetAttachments(noteId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	resp := []AttachmentResp{}
+	for i := range attachments {
+		resp = append(resp, attachmentResp(&attachments[i]))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// attachment returns the attachment named by the request, writing the error
+// response when there is none.
+func (s *server) attachment(w http.ResponseWriter, r *http.Request, noteId uint64) (*repository.Attachment, bool) {
+
+	attachmentId, err := strconv.ParseUint(mux.Vars(r)["attachmentid"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return nil, false
+	}
+
+	attachment, err := s.db.GetAttachment(attachmentId, noteId)
+	if errors.Is(err, repository.ErrAttachmentNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return nil, false
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return nil, false
+	}
+
+	return attachment, true
+}
+
+// DownloadAttachment streams the content of an attachment. Types in
+// inlineTypes are shown by the browser, everything else is downloaded.
+func (s *server) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	noteId, _, ok := s.noteAccess(w, r, false)
+	if !ok {
+		return
+	}
+
+	attachment, ok := s.attachment(w, r, noteId)
+	if !ok {
+		return
+	}
+
+	etag := `"` + attachment.Sha256 + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		w.Header().Del("Content-Type")
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	content, err := s.blobs.Get(r.Context(), attachment.Blobkey)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		utility.Errorln("Error in reading attachment", attachment.Id, err)
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "the content of this attachment is missing"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	defer content.Close()
+
+	disposition := "attachment"
+	if inlineTypes[attachment.Mime] {
+		disposition = "inline"
+	}
+
+	w.Header().Set("Content-Type", attachment.Mime)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Name}))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if attachment.Mime != "application/pdf" {
+		w.Header().Set("Content-Security-Policy", attachmentPolicy)
+	}
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(newStreamWriter(w), content); err != nil {
+		utility.Errorln("Error in sending attachment", attachment.Id, err)
+	}
+}
+
+// DeleteAttachment removes an attachment of a note the user owns.
+func (s *server) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	noteId, _, ok := s.noteAccess(w, r, true)
+	if !ok {
+		return
+	}
+
+	attachment, ok := s.attachment(w, r, noteId)
+	if !ok {
+		return
+	}
+
+	err := s.db.DeleteAttachment(attachment.Id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	s.deleteBlobs(r.Context(), attachment)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// deleteAttachments removes the attachments of a deleted note.
+func (s *server) deleteAttachments(ctx context.Context, noteId uint64) {
+
+	attachments, err := s.db.GetAttachments(noteId)
+	if err != nil {
+		return
+	}
+
+	for _, attachment := range attachments {
+		if err := s.db.DeleteAttachment(attachment.Id); err != nil {
+			continue
+		}
+		s.deleteBlobs(ctx, &attachment)
+	}
+}
+
+// deleteBlobs removes the content and the thumbnails of an attachment whose
+// record is gone.
+func (s *server) deleteBlobs(ctx context.Context, attachment *repository.Attachment) {
+
+	s.deleteBlob(ctx, attachment.Blobkey)
+
+	if imaging.CanThumbnail(attachment.Mime) {
+		for _, size := range thumbnailSizes {
+			s.deleteBlob(ctx, thumbnailKey(attachment.Blobkey, size))
+		}
+	}
+}
+
+// deleteBlob removes a blob of an attachment whose record is gone. A
+// failure leaves an orphaned blob behind, which is only logged.
+func (s *server) deleteBlob(ctx context.Context, key string) {
+	if err := s.blobs.Delete(ctx, key); err != nil {
+		utility.Errorln("Error in deleting blob", key, err)
+	}
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"NOTESBE/blobstore"
+	"NOTESBE/config"
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttachments(t *testing.T) {
+
+	cfg := *config.Get()
+	cfg.RateLimit.Policies = nil
+	cfg.Attachments.MaxSize = 1 << 20
+	cfg.Attachments.Quota = 2 << 20
+	config.Set(&cfg)
+	defer config.Set(nil)
+
+	dir := t.TempDir()
+	s := &server{router: mux.NewRouter(), db: mockrepo, blobs: &blobstore.LocalStore{Dir: dir}}
+	r := Router(s)
+
+	owner, _ := (&utility.TokenReq{Id: 6}).CreateJwtToken()
+	reader, _ := (&utility.TokenReq{Id: 9}).CreateJwtToken()
+
+	note := &repository.Note{Id: 1, Userid: 6, Note: "photos"}
+
+	img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i)
+		if i%4 == 3 {
+			img.Pix[i] = 255
+		}
+	}
+	var encoded bytes.Buffer
+	png.Encode(&encoded, img)
+	photo := encoded.Bytes()
+
+	// the same image with a text chunk after IHDR, which uploads lose
+	text := []byte("Comment\x00taken at home")
+	chunk := append(binary.BigEndian.AppendUint32(nil, uint32(len(text))), "tEXt"...)
+	chunk = append(append(chunk, text...), 0, 0, 0, 0)
+	upload := append(append(append([]byte(nil), photo[:33]...), chunk...), photo[33:]...)
+
+	post := func(name string, content []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		form.WriteField("comment", "ignored")
+		part, _ := form.CreateFormFile("file", name)
+		part.Write(content)
+		form.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/notes/1/attachments?userid=6", &body)
+		req.Header.Set("Authtoken", owner.Token)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var stored repository.Attachment
+
+	t.Run("Upload", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetNoteById(uint64(1), uint64(6)).Return(note, nil)
+		mockrepo.EXPECT().GetAttachmentUsage(uint64(6)).Return(int64(0), nil)
+		mockrepo.EXPECT().CreateAttachment(gomock.Any()).DoAndReturn(func(attachment *repository.Attachment) error {
+			attachment.Id = 4
+			stored = *attachment
+			return nil
+		})
+
+		rec := post("holiday.txt", upload)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		resp := []AttachmentResp{}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		assert.Len(t, resp, 1)
+		assert.Equal(t, "image/png", resp[0].Mime, "the type is sniffed from the content")
+		assert.Equal(t, int64(len(photo)), resp[0].Size, "metadata is stripped")
+		assert.Equal(t, "/api/notes/1/attachments/4", resp[0].Url)
+		assert.Equal(t, "/api/attachments/4/thumb", resp[0].Thumbnail)
+		assert.Equal(t, uint64(6), stored.Userid)
+
+		// the original and a thumbnail of each size
+		assert.Eventually(t, func() bool {
+			entries, _ := os.ReadDir(dir + "/notes/1")
+			return len(entries) == 1+len(thumbnailSizes)
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Quota", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetNoteById(uint64(1), uint64(6)).Return(note, nil)
+		mockrepo.EXPECT().GetAttachmentUsage(uint64(6)).Return(int64(2<<20-10), nil)
+
+		rec := post("big.bin", bytes.Repeat([]byte("x"), 100))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+		assert.Contains(t, rec.Body.String(), "quota")
+
+		mockrepo.EXPECT().GetNoteById(uint64(1), uint64(6)).Return(note, nil)
+		mockrepo.EXPECT().GetAttachmentUsage(uint64(6)).Return(int64(0), nil)
+
+		rec = post("big.bin", bytes.Repeat([]byte("x"), 2<<20))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+		// nothing but the first upload is stored
+		entries, _ := os.ReadDir(dir + "/notes/1")
+		assert.Len(t, entries, 1+len(thumbnailSizes))
+	})
+
+	t.Run("Download shared", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetReadableNote(uint64(1), uint64(9)).Return(note, nil)
+		mockrepo.EXPECT().GetAttachment(uint64(4), uint64(1)).Return(&stored, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/notes/1/attachments/4?userid=9", nil)
+		req.Header.Set("Authtoken", reader.Token)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, photo, rec.Body.Bytes())
+		assert.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+		assert.Equal(t, `inline; filename=holiday.txt`, rec.Header().Get("Content-Disposition"))
+		assert.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+	})
+
+	t.Run("Thumbnail", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetAttachmentById(uint64(4)).Return(&stored, nil)
+		mockrepo.EXPECT().GetReadableNote(uint64(1), uint64(9)).Return(note, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/attachments/4/thumb?userid=9&size=128", nil)
+		req.Header.Set("Authtoken", reader.Token)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "image/jpeg", rec.Header().Get("Content-Type"))
+		thumb, err := jpeg.Decode(rec.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, image.Rect(0, 0, 128, 85), thumb.Bounds())
+
+		mockrepo.EXPECT().GetAttachmentById(uint64(4)).Return(&stored, nil)
+		mockrepo.EXPECT().GetReadableNote(uint64(1), uint64(7)).Return(nil, repository.ErrNoteNotFound)
+
+		other, _ := (&utility.TokenReq{Id: 7}).CreateJwtToken()
+		req = httptest.NewRequest(http.MethodGet, "/api/attachments/4/thumb?userid=7", nil)
+		req.Header.Set("Authtoken", other.Token)
+		rec = httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		req = httptest.NewRequest(http.MethodGet, "/api/attachments/4/thumb?userid=9&size=100", nil)
+		req.Header.Set("Authtoken", reader.Token)
+		rec = httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("Readers cannot delete", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetNoteById(uint64(1), uint64(9)).Return(nil, repository.ErrNoteNotFound)
+
+		req := httptest.NewRequest(http.MethodDelete, "/api/notes/1/attachments/4?userid=9", nil)
+		req.Header.Set("Authtoken", reader.Token)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetNoteById(uint64(1), uint64(6)).Return(note, nil)
+		mockrepo.EXPECT().GetAttachment(uint64(4), uint64(1)).Return(&stored, nil)
+		mockrepo.EXPECT().DeleteAttachment(uint64(4)).Return(nil)
+
+		req := httptest.NewRequest(http.MethodDelete, "/api/notes/1/attachments/4?userid=6", nil)
+		req.Header.Set("Authtoken", owner.Token)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		entries, _ := os.ReadDir(dir + "/notes/1")
+		assert.Len(t, entries, 0)
+	})
+}
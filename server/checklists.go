@@ -0,0 +1,413 @@
+package server
+
+import (
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// maxItemText is the longest text of a checklist item in bytes.
+const maxItemText = 1000
+
+var errNotChecklist = errors.New("this note is not a checklist")
+
+func isChecklist(note *repository.Note) bool {
+	return note.Kind == repository.NoteChecklist
+}
+
+func checklistItemResp(item *repository.Checklistitem) ChecklistItemResp {
+	return ChecklistItemResp{
+		Id:         item.Id,
+		NoteId:     item.Noteid,
+		Position:   item.Position,
+		Text:       item.Text,
+		Checked:    item.Checked,
+		Duedate:    item.Duedate,
+		Assigneeid: item.Assigneeid,
+		CreatedAt:  item.Createdat,
+		UpdatedAt:  item.Updatedat,
+	}
+}
+
+func checklistProgress(items []repository.Checklistitem) *ChecklistProgress {
+
+	progress := &ChecklistProgress{Total: len(items)}
+	for _, item := range items {
+		if item.Checked {
+			progress.Checked++
+		}
+	}
+
+	return progress
+}
+
+// checklistItems returns the items of the checklists among the notes by
+// note.
+func (s *server) checklistItems(notes []repository.Note) (map[uint64][]repository.Checklistitem, error) {
+
+	noteIds := []uint64{}
+	for i := range notes {
+		if isChecklist(&notes[i]) {
+			noteIds = append(noteIds, notes[i].Id)
+		}
+	}
+	if len(noteIds) == 0 {
+		return nil, nil
+	}
+
+	items, err := s.db.GetChecklistItems(noteIds)
+	if err != nil {
+		return nil, err
+	}
+
+	byNote := map[uint64][]repository.Checklistitem{}
+	for _, item := range items {
+		byNote[item.Noteid] = append(byNote[item.Noteid], item)
+	}
+
+	return byNote, nil
+}
+
+// checklistMarkdown returns the description of a checklist followed by its
+// items as a task list, which is how checklists are rendered and exported.
+func checklistMarkdown(note string, items []repository.Checklistitem) string {
+
+	var b strings.Builder
+
+	b.WriteString(strings.TrimRight(note, "\n"))
+	if b.Len() > 0 && len(items) > 0 {
+		b.WriteString("\n\n")
+	}
+
+	for _, item := range items {
+		box := "[ ]"
+		if item.Checked {
+			box = "[x]"
+		}
+		fmt.Fprintf(&b, "- %s %s", box, strings.Join(strings.Fields(item.Text), " "))
+		if item.Duedate != "" {
+			fmt.Fprintf(&b, " (due %s)", item.Duedate)
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// expandChecklists replaces the text of the checklists among the notes by
+// checklistMarkdown, for representations without a place for items.
+func expandChecklists(notes []repository.Note, checklists map[uint64][]repository.Checklistitem) {
+
+	for i := range notes {
+		if isChecklist(&notes[i]) {
+			notes[i].Note = checklistMarkdown(notes[i].Note, checklists[notes[i].Id])
+		}
+	}
+}
+
+// checklistNote returns the checklist named by the request if the user may
+// read it, or with owner set if they own it: users a checklist is shared with
+// only read its items. It writes the error response and returns false
+// otherwise.
+func (s *server) checklistNote(w http.ResponseWriter, r *http.Request, owner bool) (*repository.Note, bool) {
+
+	noteId, err := utility.ParseNoteId(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return nil, false
+	}
+
+	userId, err := utility.ParseUserId(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return nil, false
+	}
+
+	var note *repository.Note
+	if owner {
+		note, err = s.db.GetNoteById(noteId, userId)
+	} else {
+		note, err = s.db.GetReadableNote(noteId, userId)
+	}
+	if errors.Is(err, repository.ErrNoteNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return nil, false
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return nil, false
+	}
+
+	if !isChecklist(note) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": errNotChecklist.Error()})
+		return nil, false
+	}
+
+	return note, true
+}
+
+// checklistItem returns the item named by the request, writing the error
+// response when there is none.
+func (s *server) checklistItem(w http.ResponseWriter, r *http.Request, noteId uint64) (*repository.Checklistitem, bool) {
+
+	itemId, err := strconv.ParseUint(mux.Vars(r)["itemid"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return nil, false
+	}
+
+	item, err := s.db.GetChecklistItem(itemId, noteId)
+	if errors.Is(err, repository.ErrChecklistItemNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return nil, false
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return nil, false
+	}
+
+	return item, true
+}
+
+// errInvalidItem is wrapped by applyItemReq for requests that are refused.
+var errInvalidItem = errors.New("invalid checklist item")
+
+// applyItemReq sets the fields of the request on an item of the note. An
+// assignee must be able to read the note.
+func (s *server) applyItemReq(note *repository.Note, item *repository.Checklistitem, req *ChecklistItemReq) error {
+
+	if req.Text != nil {
+		text := strings.TrimSpace(*req.Text)
+		if text == "" {
+			return fmt.Errorf("%w: text is empty", errInvalidItem)
+		}
+		if len(text) > maxItemText || !utf8.ValidString(text) {
+			return fmt.Errorf("%w: text must be valid UTF-8 of at most %d bytes", errInvalidItem, maxItemText)
+		}
+		item.Text = text
+	}
+
+	if req.Checked != nil {
+		item.Checked = *req.Checked
+	}
+
+	if req.Duedate != nil {
+		if *req.Duedate != "" {
+			if _, err := time.Parse("2006-01-02", *req.Duedate); err != nil {
+				return fmt.Errorf("%w: duedate must be a date like 2024-01-31", errInvalidItem)
+			}
+		}
+		item.Duedate = *req.Duedate
+	}
+
+	if req.Assigneeid != nil {
+		assignee := *req.Assigneeid
+		if assignee != 0 && assignee != note.Userid {
+			_, err := s.db.GetReadableNote(note.Id, assignee)
+			if errors.Is(err, repository.ErrNoteNotFound) {
+				return fmt.Errorf("%w: the assignee must be the owner of the note or a user it is shared with", errInvalidItem)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		item.Assigneeid = assignee
+	}
+
+	return nil
+}
+
+// writeItemError writes the response to an error of applyItemReq or of
+// storing an item.
+func writeItemError(w http.ResponseWriter, err error) {
+
+	switch {
+	case errors.Is(err, errInvalidItem):
+		w.WriteHeader(http.StatusBadRequest)
+	case errors.Is(err, repository.ErrChecklistItemNotFound), errors.Is(err, repository.ErrNoteNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// GetChecklistItems lists the items of a checklist in order.
+func (s *server) GetChecklistItems(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	note, ok := s.checklistNote(w, r, false)
+	if !ok {
+		return
+	}
+
+	items, err := s.db.GetChecklistItems([]uint64{note.Id})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	resp := []ChecklistItemResp{}
+	for i := range items {
+		resp = append(resp, checklistItemResp(&items[i]))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// AddChecklistItem adds an item at the end of a checklist, or at Position.
+func (s *server) AddChecklistItem(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req ChecklistItemReq
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	note, ok := s.checklistNote(w, r, true)
+	if !ok {
+		return
+	}
+
+	if req.Text == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "the item has no text"})
+		return
+	}
+
+	item := &repository.Checklistitem{Noteid: note.Id}
+	if err := s.applyItemReq(note, item, &req); err != nil {
+		writeItemError(w, err)
+		return
+	}
+
+	if err := s.db.CreateChecklistItem(item); err != nil {
+		writeItemError(w, err)
+		return
+	}
+
+	if req.Position != nil && *req.Position < item.Position {
+		item, err = s.moveChecklistItem(item, *req.Position)
+		if err != nil {
+			writeItemError(w, err)
+			return
+		}
+	}
+
+	s.renders.Invalidate(note.Id)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(checklistItemResp(item))
+}
+
+// UpdateChecklistItem changes the fields of an item that the request sets:
+// checks or unchecks it, edits it or moves it to another position.
+func (s *server) UpdateChecklistItem(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req ChecklistItemReq
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	note, ok := s.checklistNote(w, r, true)
+	if !ok {
+		return
+	}
+
+	item, ok := s.checklistItem(w, r, note.Id)
+	if !ok {
+		return
+	}
+
+	if req.Text != nil || req.Checked != nil || req.Duedate != nil || req.Assigneeid != nil {
+		if err := s.applyItemReq(note, item, &req); err != nil {
+			writeItemError(w, err)
+			return
+		}
+		if err := s.db.UpdateChecklistItem(item); err != nil {
+			writeItemError(w, err)
+			return
+		}
+	}
+
+	if req.Position != nil && *req.Position != item.Position {
+		item, err = s.moveChecklistItem(item, *req.Position)
+		if err != nil {
+			writeItemError(w, err)
+			return
+		}
+	}
+
+	s.renders.Invalidate(note.Id)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(checklistItemResp(item))
+}
+
+// moveChecklistItem moves the item and returns it with its new position.
+func (s *server) moveChecklistItem(item *repository.Checklistitem, position int) (*repository.Checklistitem, error) {
+
+	if err := s.db.MoveChecklistItem(item.Id, item.Noteid, position); err != nil {
+		return nil, err
+	}
+
+	return s.db.GetChecklistItem(item.Id, item.Noteid)
+}
+
+// DeleteChecklistItem removes an item from a checklist.
+func (s *server) DeleteChecklistItem(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	note, ok := s.checklistNote(w, r, true)
+	if !ok {
+		return
+	}
+
+	itemId, err := strconv.ParseUint(mux.Vars(r)["itemid"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := s.db.DeleteChecklistItem(itemId, note.Id); err != nil {
+		writeItemError(w, err)
+		return
+	}
+
+	s.renders.Invalidate(note.Id)
+
+	w.WriteHeader(http.StatusOK)
+}
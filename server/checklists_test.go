@@ -0,0 +1,194 @@
+package server
+
+import (
+	"NOTESBE/config"
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecklists(t *testing.T) {
+
+	cfg := *config.Get()
+	cfg.RateLimit.Policies = nil
+	config.Set(&cfg)
+	defer config.Set(nil)
+
+	r := Router(&server{router: mux.NewRouter(), db: mockrepo})
+
+	owner, _ := (&utility.TokenReq{Id: 6}).CreateJwtToken()
+	member, _ := (&utility.TokenReq{Id: 9}).CreateJwtToken()
+
+	send := func(method, target, token, body string, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authtoken", token)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	note := &repository.Note{Id: 1, Userid: 6, Note: "Groceries", Kind: repository.NoteChecklist}
+	items := []repository.Checklistitem{
+		{Id: 11, Noteid: 1, Position: 0, Text: "milk", Checked: true},
+		{Id: 12, Noteid: 1, Position: 1, Text: "eggs", Duedate: "2024-02-01", Assigneeid: 9},
+	}
+
+	t.Run("Create", func(t *testing.T) {
+
+		mockrepo.EXPECT().CreateChecklist(gomock.Any(), []repository.Checklistitem{
+			{Text: "milk"},
+			{Text: "eggs", Duedate: "2024-02-01", Assigneeid: 6},
+		}).DoAndReturn(func(n *repository.Note, items []repository.Checklistitem) error {
+			assert.Equal(t, repository.NoteChecklist, n.Kind)
+			n.Id = 1
+			return nil
+		})
+
+		rec := send(http.MethodPost, "/api/notes?userid=6", owner.Token,
+			`{"note":"Groceries","type":"checklist","items":[{"text":"milk"},{"text":" eggs ","duedate":"2024-02-01","assigneeid":6}]}`, "")
+		assert.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+		// a failing item creates nothing
+		mockrepo.EXPECT().CreateChecklist(gomock.Any(), gomock.Any()).Return(errors.New("error from database"))
+		rec = send(http.MethodPost, "/api/notes?userid=6", owner.Token, `{"type":"checklist","items":[{"text":"milk"}]}`, "")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+		// nobody else can read a new note
+		mockrepo.EXPECT().GetReadableNote(uint64(0), uint64(9)).Return(nil, repository.ErrNoteNotFound)
+		rec = send(http.MethodPost, "/api/notes?userid=6", owner.Token, `{"type":"checklist","items":[{"text":"milk","assigneeid":9}]}`, "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		rec = send(http.MethodPost, "/api/notes?userid=6", owner.Token, `{"type":"checklist","items":[{"text":"milk","duedate":"tomorrow"}]}`, "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		rec = send(http.MethodPost, "/api/notes?userid=6", owner.Token, `{"note":"x","items":[{"text":"milk"}]}`, "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("Get", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetNoteById(uint64(1), uint64(6)).Return(note, nil)
+		mockrepo.EXPECT().GetChecklistItems([]uint64{1}).Return(items, nil)
+
+		rec := send(http.MethodGet, "/api/notes/1?userid=6", owner.Token, "", "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var resp NoteResp
+		json.NewDecoder(rec.Body).Decode(&resp)
+		assert.Equal(t, repository.NoteChecklist, resp.Type)
+		assert.Equal(t, &ChecklistProgress{Total: 2, Checked: 1}, resp.Progress)
+		assert.Equal(t, []ChecklistItemResp{checklistItemResp(&items[0]), checklistItemResp(&items[1])}, resp.Items)
+
+		// listings have the progress only, other representations a task list
+		text := &repository.Note{Id: 2, Userid: 6, Note: "plain"}
+		mockrepo.EXPECT().GetNotesOfUser(uint64(6)).Return([]repository.Note{*note, *text}, nil)
+		mockrepo.EXPECT().GetChecklistItems([]uint64{1}).Return(items, nil)
+
+		rec = send(http.MethodGet, "/api/notes?userid=6", owner.Token, "", "")
+		var list []NoteResp
+		json.NewDecoder(rec.Body).Decode(&list)
+		assert.Len(t, list, 2)
+		assert.Equal(t, &ChecklistProgress{Total: 2, Checked: 1}, list[0].Progress)
+		assert.Nil(t, list[0].Items)
+		assert.Nil(t, list[1].Progress)
+
+		mockrepo.EXPECT().GetNoteById(uint64(1), uint64(6)).Return(note, nil)
+		mockrepo.EXPECT().GetChecklistItems([]uint64{1}).Return(items, nil)
+
+		rec = send(http.MethodGet, "/api/notes/1?userid=6", owner.Token, "", "text/plain")
+		assert.Equal(t, "Groceries\n\n- [x] milk\n- [ ] eggs (due 2024-02-01)\n", rec.Body.String())
+	})
+
+	t.Run("Items", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetReadableNote(uint64(1), uint64(9)).Return(note, nil).AnyTimes()
+		mockrepo.EXPECT().GetNoteById(uint64(1), uint64(6)).Return(note, nil).AnyTimes()
+
+		mockrepo.EXPECT().GetChecklistItems([]uint64{1}).Return(items, nil)
+		rec := send(http.MethodGet, "/api/notes/1/items?userid=9", member.Token, "", "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var list []ChecklistItemResp
+		json.NewDecoder(rec.Body).Decode(&list)
+		assert.Len(t, list, 2)
+
+		item := items[1]
+		mockrepo.EXPECT().GetChecklistItem(uint64(12), uint64(1)).Return(&item, nil)
+		mockrepo.EXPECT().UpdateChecklistItem(gomock.Any()).DoAndReturn(func(i *repository.Checklistitem) error {
+			assert.True(t, i.Checked)
+			assert.Equal(t, "eggs", i.Text)
+			return nil
+		})
+
+		rec = send(http.MethodPatch, "/api/notes/1/items/12?userid=6", owner.Token, `{"checked":true}`, "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var updated ChecklistItemResp
+		json.NewDecoder(rec.Body).Decode(&updated)
+		assert.True(t, updated.Checked)
+
+		item = items[1]
+		mockrepo.EXPECT().GetChecklistItem(uint64(12), uint64(1)).Return(&item, nil)
+		mockrepo.EXPECT().GetReadableNote(uint64(1), uint64(4)).Return(nil, repository.ErrNoteNotFound)
+
+		rec = send(http.MethodPatch, "/api/notes/1/items/12?userid=6", owner.Token, `{"assigneeid":4}`, "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		item = items[1]
+		moved := items[1]
+		moved.Position = 0
+		mockrepo.EXPECT().GetChecklistItem(uint64(12), uint64(1)).Return(&item, nil)
+		mockrepo.EXPECT().MoveChecklistItem(uint64(12), uint64(1), 0).Return(nil)
+		mockrepo.EXPECT().GetChecklistItem(uint64(12), uint64(1)).Return(&moved, nil)
+
+		rec = send(http.MethodPatch, "/api/notes/1/items/12?userid=6", owner.Token, `{"position":0}`, "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		json.NewDecoder(rec.Body).Decode(&updated)
+		assert.Equal(t, 0, updated.Position)
+
+		mockrepo.EXPECT().CreateChecklistItem(&repository.Checklistitem{Noteid: 1, Text: "bread"}).DoAndReturn(func(i *repository.Checklistitem) error {
+			i.Id, i.Position = 13, 2
+			return nil
+		})
+
+		rec = send(http.MethodPost, "/api/notes/1/items?userid=6", owner.Token, `{"text":"bread"}`, "")
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		json.NewDecoder(rec.Body).Decode(&updated)
+		assert.Equal(t, uint64(13), updated.Id)
+
+		mockrepo.EXPECT().DeleteChecklistItem(uint64(11), uint64(1)).Return(nil)
+		rec = send(http.MethodDelete, "/api/notes/1/items/11?userid=6", owner.Token, "", "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		mockrepo.EXPECT().DeleteChecklistItem(uint64(11), uint64(1)).Return(repository.ErrChecklistItemNotFound)
+		rec = send(http.MethodDelete, "/api/notes/1/items/11?userid=6", owner.Token, "", "")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		// users the checklist is shared with only read its items
+		mockrepo.EXPECT().GetNoteById(uint64(1), uint64(9)).Return(nil, repository.ErrNoteNotFound).Times(3)
+
+		rec = send(http.MethodPatch, "/api/notes/1/items/12?userid=9", member.Token, `{"checked":true}`, "")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		rec = send(http.MethodPost, "/api/notes/1/items?userid=9", member.Token, `{"text":"bread"}`, "")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		rec = send(http.MethodDelete, "/api/notes/1/items/11?userid=9", member.Token, "", "")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("Not a checklist", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetNoteById(uint64(2), uint64(6)).Return(&repository.Note{Id: 2, Userid: 6, Kind: repository.NoteText}, nil)
+
+		rec := send(http.MethodPost, "/api/notes/2/items?userid=6", owner.Token, `{"text":"milk"}`, "")
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+}
@@ -0,0 +1,380 @@
+package server
+
+import (
+	"NOTESBE/config"
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// staleExportAge is after how long a pending export is assumed to have been
+// interrupted, e.g. by a restart, and no longer blocks a new one.
+const staleExportAge = time.Hour
+
+// exportSweepInterval is how often archives past their retention are
+// deleted.
+const exportSweepInterval = time.Hour
+
+func exportResp(export *repository.Export, retention time.Duration) *ExportResp {
+
+	resp := &ExportResp{
+		Id:        export.Id,
+		Status:    export.Status,
+		Error:     export.Error,
+		Size:      export.Size,
+		CreatedAt: export.Createdat,
+	}
+	if export.Status == repository.ExportDone {
+		resp.ExpiresAt = export.Finishedat.Add(retention)
+	}
+
+	return resp
+}
+
+// CreateExport starts building a personal data archive of the user. Previous
+// archives are deleted.
+func (s *server) CreateExport(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, err := utility.ParseUserId(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	exports, err := s.db.GetExports(userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	for _, export := range exports {
+		if export.Status == repository.ExportPending && time.Since(export.Createdat) < staleExportAge {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("Export %d is still being built", export.Id)})
+			return
+		}
+	}
+
+	for _, export := range exports {
+		s.removeExport(&export)
+	}
+
+	export := &repository.Export{
+		Userid: userId,
+		Status: repository.ExportPending,
+	}
+
+	err = s.db.CreateExport(export)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	go s.buildExport(*export)
+
+	w.Header().Set("Location", fmt.Sprintf("/api/me/export/%d", export.Id))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(exportResp(export, 0))
+}
+
+// GetExport sends the archive once it is built, and the status of the export
+// before that.
+func (s *server) GetExport(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, err := utility.ParseUserId(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	exportId, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	export, err := s.db.GetExport(exportId, userId)
+	if errors.Is(err, repository.ErrExportNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	retention := config.Get().Export.Retention
+
+	switch export.Status {
+	case repository.ExportPending:
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(exportResp(export, retention))
+		return
+	case repository.ExportFailed:
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(exportResp(export, retention))
+		return
+	}
+
+	if time.Since(export.Finishedat) > retention {
+		s.removeExport(export)
+		w.WriteHeader(http.StatusGone)
+		json.NewEncoder(w).Encode(map[string]string{"error": "The export has expired, request a new one"})
+		return
+	}
+
+	file, err := os.Open(export.File)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="notes-export-%d.zip"`, export.Id))
+	http.ServeContent(newStreamWriter(w), r, "", export.Finishedat, file)
+}
+
+// SweepExports deletes the archives past export.retention, that nobody
+// downloaded after they expired, every exportSweepInterval until ctx is done.
+// serve runs it in the background.
+func (s *server) SweepExports(ctx context.Context) {
+
+	ticker := time.NewTicker(exportSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		s.sweepExports()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *server) sweepExports() {
+
+	exports, err := s.db.GetExpiredExports(time.Now().Add(-config.Get().Export.Retention))
+	if err != nil {
+		return
+	}
+
+	for _, export := range exports {
+		s.removeExport(&export)
+	}
+}
+
+func (s *server) removeExport(export *repository.Export) {
+
+	if export.File != "" {
+		if err := os.Remove(export.File); err != nil && !os.IsNotExist(err) {
+			utility.Errorln("Error in removing export archive:", err)
+		}
+	}
+	if err := s.db.DeleteExport(export.Id); err != nil {
+		utility.Errorln("Error in deleting export:", err)
+	}
+}
+
+func (s *server) buildExport(export repository.Export) {
+
+	dir := config.Get().Export.Dir
+
+	err := os.MkdirAll(dir, 0700)
+
+	var file *os.File
+	if err == nil {
+		file, err = os.CreateTemp(dir, fmt.Sprintf("export-%d-*.zip.tmp", export.Id))
+	}
+	if err == nil {
+		err = s.writeExport(file, export.Userid)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			export.File = strings.TrimSuffix(file.Name(), ".tmp")
+			err = os.Rename(file.Name(), export.File)
+		}
+		if err != nil {
+			os.Remove(file.Name())
+		}
+	}
+
+	export.Finishedat = time.Now()
+	if err != nil {
+		utility.Errorln("Error in building export:", err)
+		export.Status = repository.ExportFailed
+		export.Error = "Building the archive failed"
+		export.File = ""
+	} else {
+		export.Status = repository.ExportDone
+		if info, statErr := os.Stat(export.File); statErr == nil {
+			export.Size = info.Size()
+		}
+	}
+
+	if err := s.db.UpdateExport(&export); err != nil {
+		utility.Errorln("Error in updating export:", err)
+	}
+}
+
+// writeExport writes the archive of the user: the data as JSON and a
+// Markdown rendering of the profile and of every note. Notes are stored
+// without revisions, so there is no history to include.
+func (s *server) writeExport(out io.Writer, userId uint64) error {
+
+	user, err := s.db.GetUserById(userId)
+	if err != nil {
+		return err
+	}
+	notes, err := s.db.GetNotesOfUser(userId)
+	if err != nil {
+		return err
+	}
+	checklists, err := s.checklistItems(notes)
+	if err != nil {
+		return err
+	}
+	expandChecklists(notes, checklists)
+	shares, err := s.db.GetShareRecords(userId)
+	if err != nil {
+		return err
+	}
+	tokens, err := s.db.GetAccessTokens(userId)
+	if err != nil {
+		return err
+	}
+	events, err := s.db.GetAuthEventsOfUser(userId, 0)
+	if err != nil {
+		return err
+	}
+
+	owned, shared := []repository.Note{}, []repository.Note{}
+	for _, note := range notes {
+		if note.Userid == userId {
+			owned = append(owned, note)
+		} else {
+			shared = append(shared, note)
+		}
+	}
+
+	tokenResps := []AccessTokenResp{}
+	for _, token := range tokens {
+		tokenResps = append(tokenResps, accessTokenResp(&token))
+	}
+
+	archive := zip.NewWriter(out)
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", profileResp(user)},
+		{"notes.json", owned},
+		{"shared_with_me.json", shared},
+		{"shares.json", shares},
+		{"access_tokens.json", tokenResps},
+		{"auth_events.json", events},
+	}
+
+	for _, f := range files {
+		w, err := archive.Create(f.name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			return err
+		}
+	}
+
+	w, err := archive.Create("README.md")
+	if err != nil {
+		return err
+	}
+	if err := writeExportReadme(w, user, owned, shared, shares, len(tokens), len(events)); err != nil {
+		return err
+	}
+
+	for _, note := range notes {
+		name := fmt.Sprintf("notes/%d.md", note.Id)
+		if note.Userid != userId {
+			name = fmt.Sprintf("shared_with_me/%d.md", note.Id)
+		}
+		w, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "# Note %d\n\n", note.Id)
+		if note.Userid != userId {
+			fmt.Fprintf(w, "- Owner: user %d\n", note.Userid)
+		}
+		fmt.Fprintf(w, "- Created: %s\n- Updated: %s\n\n%s\n", note.Createdat.Format(time.RFC3339), note.Updatedat.Format(time.RFC3339), note.Note)
+	}
+
+	return archive.Close()
+}
+
+func writeExportReadme(w io.Writer, user *repository.User, owned, shared []repository.Note, shares []repository.Sharerecords, tokens, events int) error {
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Personal data of %s\n\n", user.Username)
+	fmt.Fprintf(&b, "Exported on %s.\n\n", time.Now().UTC().Format(time.RFC1123))
+
+	b.WriteString("## Profile\n\n")
+	fmt.Fprintf(&b, "- Id: %d\n", user.Id)
+	fmt.Fprintf(&b, "- Username: %s\n", user.Username)
+	fmt.Fprintf(&b, "- Display name: %s\n", user.Displayname)
+	fmt.Fprintf(&b, "- Email: %s (verified: %t)\n", user.Email, user.Emailverified)
+	fmt.Fprintf(&b, "- Avatar: %s\n", user.Avatar)
+	fmt.Fprintf(&b, "- Time zone: %s\n", user.Timezone)
+	fmt.Fprintf(&b, "- Locale: %s\n", user.Locale)
+	fmt.Fprintf(&b, "- Two-factor authentication: %t\n", user.Totpenabled)
+	fmt.Fprintf(&b, "- Linked to an OpenID Connect identity: %t\n\n", user.Oidcsubject != "")
+
+	b.WriteString("## Contents\n\n")
+	fmt.Fprintf(&b, "- `notes/`: %d notes you own (`notes.json`)\n", len(owned))
+	fmt.Fprintf(&b, "- `shared_with_me/`: %d notes others shared with you (`shared_with_me.json`)\n", len(shared))
+	fmt.Fprintf(&b, "- `shares.json`: %d shares you sent or received\n", len(shares))
+	fmt.Fprintf(&b, "- `access_tokens.json`: %d personal access tokens (without the secrets)\n", tokens)
+	fmt.Fprintf(&b, "- `auth_events.json`: %d failed logins, lockouts and password changes\n", events)
+	b.WriteString("\nNotes have no revision history, every note is exported as it is now.\n")
+
+	if len(shares) > 0 {
+		b.WriteString("\n## Shares\n\n| Note | From user | To user |\n|---|---|---|\n")
+		for _, share := range shares {
+			fmt.Fprintf(&b, "| %d | %d | %d |\n", share.Noteid, share.Senderuserid, share.Reciveruserid)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"NOTESBE/config"
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersonalDataExport(t *testing.T) {
+
+	cfg := *config.Get()
+	cfg.RateLimit.Policies = nil
+	cfg.Export.Dir = t.TempDir()
+	config.Set(&cfg)
+	defer config.Set(nil)
+
+	s := &server{router: mux.NewRouter(), db: mockrepo}
+	r := Router(s)
+
+	login, _ := (&utility.TokenReq{Id: 2}).CreateJwtToken()
+
+	send := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authtoken", login.Token)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	now := time.Now()
+	user := &repository.User{Id: 2, Username: "gina", Email: "gina@example.com"}
+
+	// the export row as the fake database stores it
+	stored := make(chan repository.Export, 1)
+
+	mockrepo.EXPECT().GetExports(uint64(2)).Return([]repository.Export{}, nil)
+	mockrepo.EXPECT().CreateExport(gomock.Any()).DoAndReturn(func(export *repository.Export) error {
+		export.Id = 11
+		export.Createdat = now
+		return nil
+	})
+	mockrepo.EXPECT().GetUserById(uint64(2)).Return(user, nil)
+	mockrepo.EXPECT().GetNotesOfUser(uint64(2)).Return([]repository.Note{
+		{Id: 1, Note: "my note", Userid: 2},
+		{Id: 5, Note: "from a friend", Userid: 3},
+	}, nil)
+	mockrepo.EXPECT().GetShareRecords(uint64(2)).Return([]repository.Sharerecords{{Noteid: 5, Senderuserid: 3, Reciveruserid: 2}}, nil)
+	mockrepo.EXPECT().GetAccessTokens(uint64(2)).Return([]repository.Accesstoken{{Id: 1, Name: "backup", Tokenhash: "secret-hash"}}, nil)
+	mockrepo.EXPECT().GetAuthEventsOfUser(uint64(2), 0).Return([]repository.Authevent{{Username: "gina", Userid: 2, Event: repository.EventLoginFailed}}, nil)
+	mockrepo.EXPECT().UpdateExport(gomock.Any()).DoAndReturn(func(export *repository.Export) error {
+		stored <- *export
+		return nil
+	})
+
+	rec := send(http.MethodPost, "/api/me/export?userid=2")
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "/api/me/export/11", rec.Header().Get("Location"))
+
+	var export repository.Export
+	select {
+	case export = <-stored:
+	case <-time.After(5 * time.Second):
+		t.Fatal("export was not built")
+	}
+	assert.Equal(t, repository.ExportDone, export.Status)
+
+	mockrepo.EXPECT().GetExport(uint64(11), uint64(2)).Return(&export, nil)
+
+	rec = send(http.MethodGet, "/api/me/export/11?userid=2")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/zip", rec.Header().Get("Content-Type"))
+
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{}
+	for _, f := range archive.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+
+	assert.Contains(t, files["notes/1.md"], "my note")
+	assert.Contains(t, files["shared_with_me/5.md"], "from a friend")
+	assert.Contains(t, files["README.md"], "gina@example.com")
+	assert.Contains(t, files["README.md"], "no revision history")
+	assert.NotContains(t, files["access_tokens.json"], "secret-hash")
+
+	notes := []repository.Note{}
+	json.Unmarshal([]byte(files["notes.json"]), &notes)
+	assert.Len(t, notes, 1, "shared notes are listed separately")
+
+	t.Run("expired", func(t *testing.T) {
+
+		old := export
+		old.Finishedat = now.Add(-cfg.Export.Retention - time.Minute)
+		mockrepo.EXPECT().GetExport(uint64(11), uint64(2)).Return(&old, nil)
+		mockrepo.EXPECT().DeleteExport(uint64(11)).Return(nil)
+
+		assert.Equal(t, http.StatusGone, send(http.MethodGet, "/api/me/export/11?userid=2").Code)
+	})
+
+	t.Run("sweeper", func(t *testing.T) {
+
+		archive := filepath.Join(cfg.Export.Dir, "export-12.zip")
+		os.WriteFile(archive, []byte("zip"), 0600)
+
+		mockrepo.EXPECT().GetExpiredExports(gomock.Any()).DoAndReturn(func(before time.Time) ([]repository.Export, error) {
+			assert.WithinDuration(t, time.Now().Add(-cfg.Export.Retention), before, time.Minute)
+			return []repository.Export{{Id: 12, Userid: 4, Status: repository.ExportDone, File: archive}}, nil
+		})
+		mockrepo.EXPECT().DeleteExport(uint64(12)).Return(nil)
+
+		s.sweepExports()
+
+		_, err := os.Stat(archive)
+		assert.True(t, os.IsNotExist(err), "the archive is removed without a download")
+	})
+
+	t.Run("other users' exports are not found", func(t *testing.T) {
+
+		other, _ := (&utility.TokenReq{Id: 3}).CreateJwtToken()
+		mockrepo.EXPECT().GetExport(uint64(11), uint64(3)).Return(nil, repository.ErrExportNotFound)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/me/export/11?userid=3", nil)
+		req.Header.Set("Authtoken", other.Token)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
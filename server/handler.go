@@ -4,6 +4,8 @@ import (
 	"NOTESBE/repository"
 	"NOTESBE/utility"
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
 	"strconv"
 )
@@ -36,6 +38,15 @@ func (s *server) Signup(w http.ResponseWriter, r *http.Request) {
 		Password: req.PassWord,
 	}
 
+	if req.Email != "" {
+		userInfo.Email, err = parseEmail(req.Email)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
 	err = s.db.CreateUser(userInfo)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -43,6 +54,12 @@ func (s *server) Signup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if userInfo.Email != "" {
+		if err := s.sendVerification(userInfo.Id, userInfo.Email); err != nil {
+			utility.Errorln("Error in sending verification mail:", err)
+		}
+	}
+
 	w.WriteHeader(http.StatusCreated)
 	w.Write([]byte("User Account created"))
 }
@@ -71,15 +88,48 @@ func (s *server) Login(w http.ResponseWriter, r *http.Request) {
 		Password: req.PassWord,
 	}
 
+	ip := utility.ClientIP(r)
+
+	if wait := s.guard.blocked(r.Context(), req.UserName, ip); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Too many failed login attempts, try again later"})
+		return
+	}
+
 	userId, err := s.db.GetUser(userInfo)
+	if errors.Is(err, repository.ErrInvalidCredentials) {
+		s.loginFailed(r.Context(), req.UserName, ip)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
 
+	// with two-factor authentication the failure counters are only reset
+	// once the second factor is verified
+	if userInfo.Totpenabled {
+		challenge, err := utility.CreateChallengeToken(userId, req.UserName)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(&LoginResp{UserId: userId, Challenge: challenge, TwoFactor: true})
+		return
+	}
+
+	s.guard.succeeded(r.Context(), req.UserName)
+
 	tokenReq := &utility.TokenReq{
-		Id: userId,
+		Id:         userId,
+		Generation: userInfo.Tokengeneration,
 	}
 
 	token, err := tokenReq.CreateJwtToken()
@@ -121,9 +171,45 @@ func (s *server) CreateNotes(w http.ResponseWriter, r *http.Request) {
 	noteInfo := &repository.Note{
 		Note:   req.Note,
 		Userid: userId,
+		Kind:   repository.NoteText,
+	}
+
+	// items are checked before the note is created, when only its owner can
+	// be assigned
+	items := []repository.Checklistitem{}
+	switch req.Type {
+	case "", repository.NoteText:
+		if len(req.Items) > 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "only checklists have items"})
+			return
+		}
+	case repository.NoteChecklist:
+		noteInfo.Kind = repository.NoteChecklist
+		for i := range req.Items {
+			if req.Items[i].Text == nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "the item has no text"})
+				return
+			}
+			item := repository.Checklistitem{}
+			if err := s.applyItemReq(noteInfo, &item, &req.Items[i]); err != nil {
+				writeItemError(w, err)
+				return
+			}
+			items = append(items, item)
+		}
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "type must be text or checklist"})
+		return
 	}
 
-	err = s.db.CreateNote(noteInfo)
+	if noteInfo.Kind == repository.NoteChecklist {
+		err = s.db.CreateChecklist(noteInfo, items)
+	} else {
+		err = s.db.CreateNote(noteInfo)
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
@@ -151,8 +237,7 @@ func (s *server) GetNotes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(notes)
+	s.writeNotes(w, r, false, nil, notes...)
 
 }
 
@@ -181,8 +266,7 @@ func (s *server) GetNotesById(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(notes)
+	s.writeNotes(w, r, true, nil, *notes)
 
 }
 
@@ -219,6 +303,8 @@ func (s *server) UpdateNoteById(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.renders.Invalidate(noteId)
+
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -247,6 +333,9 @@ func (s *server) DeleteNoteById(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.renders.Invalidate(noteId)
+	s.deleteAttachments(r.Context(), noteId)
+
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -270,13 +359,38 @@ func (s *server) ShareNoteById(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.RecieverId == 0 || req.SenderId == 0 {
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	// the note is shared by the authenticated user, the senderid of the
+	// body is only accepted when it names that user
+	userId, err := utility.ParseUserId(r)
+	if err != nil || userId == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "User id is not valid"})
+		return
+	}
+
+	if req.RecieverId == 0 || noteId == 0 {
 		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "note id and recieverid are required"})
 		return
 	}
 
-	err = s.db.ShareNoteToUser(noteId, req.SenderId, req.RecieverId)
+	if req.SenderId != 0 && req.SenderId != userId {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "notes can only be shared by their owner"})
+		return
+	}
+
+	if _, err := s.db.GetNoteById(noteId, userId); errors.Is(err, repository.ErrNoteNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	err = s.db.ShareNoteToUser(noteId, userId, req.RecieverId)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
@@ -309,7 +423,38 @@ func (s *server) GetNoteByKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(records)
+	attachments, err := s.db.SearchAttachments(userId, keyword)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	matches := map[uint64]*searchMatch{}
+	for _, note := range records {
+		matches[note.Id] = &searchMatch{note: true}
+	}
+
+	// notes found through an attachment only follow those whose text matched
+	for _, attachment := range attachments {
+		match := matches[attachment.Noteid]
+		if match == nil {
+			note, err := s.db.GetReadableNote(attachment.Noteid, userId)
+			if errors.Is(err, repository.ErrNoteNotFound) {
+				continue
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+				return
+			}
+			records = append(records, *note)
+			match = &searchMatch{}
+			matches[attachment.Noteid] = match
+		}
+		match.attachments = append(match.attachments, attachment)
+	}
+
+	s.writeNotes(w, r, false, matches, records...)
 
 }
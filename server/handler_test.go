@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -31,6 +32,8 @@ func TestServer(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockrepo = repomock.NewMockRepository(ctrl)
+	// login tokens of the tests carry the initial generation
+	mockrepo.EXPECT().GetTokenGeneration(gomock.Any()).Return(0, nil).AnyTimes()
 	testServer = &server{}
 
 	testServer.router = mux.NewRouter()
@@ -224,11 +227,104 @@ func TestGetNotesById(t *testing.T) {
 		testServer.GetNotesById(rec, req)
 		assert.Equal(t, http.StatusOK, rec.Code)
 
-		var actualNotes repository.Note
+		var actualNotes NoteResp
 		json.NewDecoder(rec.Body).Decode(&actualNotes)
 
-		expectedNotes := *testNote
+		expectedNotes := NoteResp{Id: mockNoteID, Note: "Test Note 1", Userid: mockUserID, Type: repository.NoteText, Tags: []string{}, CreatedAt: mockTime, UpdatedAt: mockTime}
 		assert.Equal(t, expectedNotes, actualNotes, "Unexpected response")
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	})
+
+	t.Run("Success case - other representations", func(t *testing.T) {
+
+		get := func(accept string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/notes/{%d}?userid=%d", mockNoteID, mockUserID), nil)
+			req.Header.Set("Accept", accept)
+			req = mux.SetURLVars(req, map[string]string{"id": strconv.FormatUint(mockNoteID, 10)})
+			rec := httptest.NewRecorder()
+
+			mockrepo.EXPECT().GetNoteById(mockNoteID, mockUserID).Return(&repository.Note{
+				Id: mockNoteID, Note: "# Plan\n\n- **milk**", Userid: mockUserID, Tags: "home", Createdat: mockTime, Updatedat: mockTime,
+			}, nil)
+
+			testServer.GetNotesById(rec, req)
+			return rec
+		}
+
+		rec := get("text/markdown")
+		assert.Equal(t, "text/markdown; charset=utf-8", rec.Header().Get("Content-Type"))
+		assert.Contains(t, rec.Body.String(), "tags: [home]")
+		assert.Contains(t, rec.Body.String(), "# Plan\n\n- **milk**\n")
+
+		rec = get("text/*;q=0.5, text/plain")
+		assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+		assert.Equal(t, "Plan\n\n- milk\n", rec.Body.String())
+
+		rec = get("application/pdf")
+		assert.Equal(t, "application/pdf", rec.Header().Get("Content-Type"))
+		assert.Equal(t, `inline; filename="note-1.pdf"`, rec.Header().Get("Content-Disposition"))
+		assert.True(t, strings.HasPrefix(rec.Body.String(), "%PDF-"))
+
+		rec = get("image/png")
+		assert.Equal(t, http.StatusNotAcceptable, rec.Code)
+
+		pdf := func(note string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/notes/{%d}?userid=%d&render=pdf", mockNoteID, mockUserID), nil)
+			req = mux.SetURLVars(req, map[string]string{"id": strconv.FormatUint(mockNoteID, 10)})
+			rec := httptest.NewRecorder()
+			mockrepo.EXPECT().GetNoteById(mockNoteID, mockUserID).Return(&repository.Note{
+				Id: mockNoteID, Note: note, Userid: mockUserID, Createdat: mockTime, Updatedat: mockTime,
+			}, nil)
+
+			testServer.GetNotesById(rec, req)
+			return rec
+		}
+
+		rec = pdf("Купить молоко")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get("X-Missing-Characters"))
+
+		rec = pdf("Купить молоко 🥛 東京")
+		assert.Equal(t, http.StatusOK, rec.Code, "one character without a glyph does not refuse the note")
+		assert.Equal(t, "U+4EAC, U+6771, U+1F95B", rec.Header().Get("X-Missing-Characters"))
+	})
+
+	t.Run("Success case - rendered as HTML", func(t *testing.T) {
+
+		get := func(note string, header bool) *httptest.ResponseRecorder {
+			path := fmt.Sprintf("/api/notes/{%d}?userid=%d&render=html", mockNoteID, mockUserID)
+			if header {
+				path = fmt.Sprintf("/api/notes/{%d}?userid=%d", mockNoteID, mockUserID)
+			}
+			req, _ := http.NewRequest(http.MethodGet, path, nil)
+			if header {
+				req.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+			}
+			req = mux.SetURLVars(req, map[string]string{"id": strconv.FormatUint(mockNoteID, 10)})
+			rec := httptest.NewRecorder()
+
+			mockrepo.EXPECT().GetNoteById(mockNoteID, mockUserID).Return(&repository.Note{
+				Id: mockNoteID, Note: note, Userid: mockUserID, Createdat: mockTime, Updatedat: mockTime,
+			}, nil)
+
+			testServer.GetNotesById(rec, req)
+			return rec
+		}
+
+		rec := get("# Plan\n<script>alert(1)</script>", false)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+		assert.Contains(t, rec.Body.String(), "<h1>Plan</h1>")
+		assert.NotContains(t, rec.Body.String(), "<script>")
+
+		// an update drops the cached rendering even within the same timestamp
+		req, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("/api/notes/{%d}?userid=%d", mockNoteID, mockUserID), bytes.NewBufferString(`{"note": "# Done"}`))
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.FormatUint(mockNoteID, 10)})
+		mockrepo.EXPECT().UpdateNoteById(mockNoteID, mockUserID, "# Done").Return(nil)
+		testServer.UpdateNoteById(httptest.NewRecorder(), req)
+
+		rec = get("# Done", true)
+		assert.Contains(t, rec.Body.String(), "<h1>Done</h1>")
 	})
 
 	t.Run("Failure case - NoteId is missing", func(t *testing.T) {
@@ -289,10 +385,10 @@ func TestGetNotes(t *testing.T) {
 		testServer.GetNotes(rec, req)
 		assert.Equal(t, http.StatusOK, rec.Code)
 
-		var actualNotes []repository.Note
+		var actualNotes []NoteResp
 		json.NewDecoder(rec.Body).Decode(&actualNotes)
 
-		expectedNotes := testNotes
+		expectedNotes := []NoteResp{noteResp(&testNotes[0])}
 		assert.Equal(t, expectedNotes, actualNotes, "Unexpected response")
 
 	})
@@ -408,6 +504,7 @@ func TestDeleteNoteById(t *testing.T) {
 		rec := httptest.NewRecorder()
 
 		mockrepo.EXPECT().DeleteNoteById(mockNoteID, mockUserID).Return(nil)
+		mockrepo.EXPECT().GetAttachments(mockNoteID).Return([]repository.Attachment{}, nil)
 
 		testServer.DeleteNoteById(rec, req)
 		assert.Equal(t, http.StatusOK, rec.Code)
@@ -450,24 +547,11 @@ func TestDeleteNoteById(t *testing.T) {
 
 func TestShareNoteById(t *testing.T) {
 
-	mockNoteReq := ShareNoteReq{
-		SenderId:   1,
-		RecieverId: 2,
-	}
-	mockNoteReqBytes, _ := json.Marshal(mockNoteReq)
-
-	mockNoteReq1 := ShareNoteReq{
-		SenderId:   0,
-		RecieverId: 2,
-	}
-
-	mockNoteReqBytes1, _ := json.Marshal(mockNoteReq1)
-
 	mockNoteID := uint64(1)
 
-	t.Run("Success case", func(t *testing.T) {
-
-		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("/api/notes/{%d}/share", mockNoteID), bytes.NewBuffer(mockNoteReqBytes))
+	share := func(userId uint64, body ShareNoteReq) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("/api/notes/{%d}/share?userid=%d", mockNoteID, userId), bytes.NewBuffer(b))
 		if err != nil {
 			t.Fatal("Error creating request:", err)
 		}
@@ -475,43 +559,58 @@ func TestShareNoteById(t *testing.T) {
 		req = mux.SetURLVars(req, map[string]string{"id": strconv.FormatUint(mockNoteID, 10)})
 		rec := httptest.NewRecorder()
 
-		mockrepo.EXPECT().ShareNoteToUser(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
-
 		testServer.ShareNoteById(rec, req)
+		return rec
+	}
+
+	t.Run("Success case", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetNoteById(mockNoteID, uint64(1)).Return(&repository.Note{Id: mockNoteID, Userid: 1}, nil)
+		mockrepo.EXPECT().ShareNoteToUser(mockNoteID, uint64(1), uint64(2)).Return(nil)
+
+		rec := share(1, ShareNoteReq{SenderId: 1, RecieverId: 2})
 		assert.Equal(t, http.StatusOK, rec.Code)
+	})
 
+	t.Run("Success case - sender defaults to the user", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetNoteById(mockNoteID, uint64(1)).Return(&repository.Note{Id: mockNoteID, Userid: 1}, nil)
+		mockrepo.EXPECT().ShareNoteToUser(mockNoteID, uint64(1), uint64(2)).Return(nil)
+
+		rec := share(1, ShareNoteReq{RecieverId: 2})
+		assert.Equal(t, http.StatusOK, rec.Code)
 	})
 
-	t.Run("Failure case - Invalid body", func(t *testing.T) {
+	t.Run("Failure case - sharing the note of another user", func(t *testing.T) {
 
-		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("/api/notes/{%d}/share", mockNoteID), bytes.NewBuffer(mockNoteReqBytes1))
-		if err != nil {
-			t.Fatal("Error creating request:", err)
-		}
-		req.Header.Set("Content-Type", "application/json")
-		rec := httptest.NewRecorder()
+		// user 2 names the owner as sender to share the note with itself
+		rec := share(2, ShareNoteReq{SenderId: 1, RecieverId: 2})
+		assert.Equal(t, http.StatusForbidden, rec.Code)
 
-		testServer.ShareNoteById(rec, req)
-		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		// or leaves the sender out
+		mockrepo.EXPECT().GetNoteById(mockNoteID, uint64(2)).Return(nil, repository.ErrNoteNotFound)
 
+		rec = share(2, ShareNoteReq{RecieverId: 2})
+		assert.Equal(t, http.StatusNotFound, rec.Code)
 	})
 
-	t.Run("Failure case - error from database", func(t *testing.T) {
+	t.Run("Failure case - Invalid body", func(t *testing.T) {
 
-		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("/api/notes/{%d}/share", mockNoteID), bytes.NewBuffer(mockNoteReqBytes))
-		if err != nil {
-			t.Fatal("Error creating request:", err)
-		}
-		req.Header.Set("Content-Type", "application/json")
-		req = mux.SetURLVars(req, map[string]string{"id": strconv.FormatUint(mockNoteID, 10)})
+		rec := share(1, ShareNoteReq{SenderId: 1})
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "recieverid")
 
-		rec := httptest.NewRecorder()
+		rec = share(0, ShareNoteReq{RecieverId: 2})
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("Failure case - error from database", func(t *testing.T) {
 
-		mockrepo.EXPECT().ShareNoteToUser(gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("error from database"))
+		mockrepo.EXPECT().GetNoteById(mockNoteID, uint64(1)).Return(&repository.Note{Id: mockNoteID, Userid: 1}, nil)
+		mockrepo.EXPECT().ShareNoteToUser(mockNoteID, uint64(1), uint64(2)).Return(errors.New("error from database"))
 
-		testServer.ShareNoteById(rec, req)
+		rec := share(1, ShareNoteReq{SenderId: 1, RecieverId: 2})
 		assert.Equal(t, http.StatusInternalServerError, rec.Code)
-
 	})
 }
 
@@ -535,18 +634,47 @@ func TestGetNoteByKey(t *testing.T) {
 		}
 
 		mockrepo.EXPECT().GetNotesByKey(gomock.Any(), gomock.Any()).Return(testNotes, nil)
+		mockrepo.EXPECT().SearchAttachments(gomock.Any(), gomock.Any()).Return(nil, nil)
 
 		testServer.GetNoteByKey(rec, req)
 		assert.Equal(t, http.StatusOK, rec.Code)
 
-		var actualNotes []repository.Note
+		var actualNotes []NoteResp
 		json.NewDecoder(rec.Body).Decode(&actualNotes)
 
-		expectedNotes := testNotes
+		expectedNotes := []NoteResp{noteResp(&testNotes[0])}
+		expectedNotes[0].MatchedIn = []string{"note"}
 		assert.Equal(t, expectedNotes, actualNotes, "Unexpected response")
 
 	})
 
+	t.Run("Success case - match in attachment", func(t *testing.T) {
+
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/search?userid=%d&query=%s", mockUserID, "invoice"), nil)
+		if err != nil {
+			t.Fatal("Error creating request:", err)
+		}
+		rec := httptest.NewRecorder()
+
+		testNote := repository.Note{Id: mockNoteID, Note: "Receipts", Userid: mockUserID, Createdat: mockTime, Updatedat: mockTime}
+		testAttachments := []repository.Attachment{{Id: 3, Noteid: mockNoteID, Userid: mockUserID, Name: "invoice.pdf", Mime: "application/pdf", Createdat: mockTime}}
+
+		mockrepo.EXPECT().GetNotesByKey(mockUserID, "invoice").Return(nil, nil)
+		mockrepo.EXPECT().SearchAttachments(mockUserID, "invoice").Return(testAttachments, nil)
+		mockrepo.EXPECT().GetReadableNote(mockNoteID, mockUserID).Return(&testNote, nil)
+
+		testServer.GetNoteByKey(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var actualNotes []NoteResp
+		json.NewDecoder(rec.Body).Decode(&actualNotes)
+
+		assert.Len(t, actualNotes, 1)
+		assert.Equal(t, []string{"attachment"}, actualNotes[0].MatchedIn)
+		assert.Equal(t, []AttachmentResp{attachmentResp(&testAttachments[0])}, actualNotes[0].MatchedAttachments)
+
+	})
+
 	t.Run("Failure case - error from database", func(t *testing.T) {
 
 		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/search?userid=%d&query=%s", mockNoteID, "mocktest"), nil)
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"NOTESBE/config"
+	"NOTESBE/utility"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// NewHTTPServer wraps handler in an http.Server configured from the server
+// section of the config. TLS is enabled when both certfile and keyfile are set.
+// Only the headers are timed by the http.Server, the read and write timeouts
+// are applied per request by timeouts, so that uploads and downloads may
+// take longer.
+func NewHTTPServer(handler http.Handler) (*http.Server, error) {
+
+	cfg := config.Get().Server
+
+	srv := &http.Server{
+		Addr:              net.JoinHostPort(cfg.Host, cfg.Port),
+		Handler:           timeouts(handler),
+		ReadHeaderTimeout: cfg.ReadTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+
+	certFile := cfg.TLS.CertFile
+	keyFile := cfg.TLS.KeyFile
+
+	if certFile == "" && keyFile == "" {
+		return srv, nil
+	}
+
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("server.tls.certfile and server.tls.keyfile must be set together")
+	}
+
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	srv.TLSConfig = &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	return srv, nil
+}
+
+// timeouts gives every request server.readtimeout for its body to be read
+// and every response server.writetimeout to be written. Handlers that take
+// large uploads wrap the body in a streamReader, and those that stream large
+// responses wrap the writer in a streamWriter, which keep moving the
+// deadline while the client sends or reads.
+func timeouts(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := config.Get().Server
+		rc := http.NewResponseController(w)
+		if err := rc.SetReadDeadline(time.Now().Add(cfg.ReadTimeout)); err != nil {
+			utility.Errorln("Error in setting read deadline:", err)
+		}
+		if err := rc.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout)); err != nil {
+			utility.Errorln("Error in setting write deadline:", err)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// streamReader moves the read deadline server.readtimeout ahead of every
+// read of the request body, so that an upload is only cut off when the
+// client stops sending for that long rather than after it in total. The
+// write deadline moves along, the response is only due after the upload.
+type streamReader struct {
+	io.ReadCloser
+	rc           *http.ResponseController
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+func newStreamReader(w http.ResponseWriter, body io.ReadCloser) *streamReader {
+	cfg := config.Get().Server
+	return &streamReader{
+		ReadCloser:   body,
+		rc:           http.NewResponseController(w),
+		readTimeout:  cfg.ReadTimeout,
+		writeTimeout: cfg.WriteTimeout,
+	}
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	// not supported by test recorders, which have no deadline either
+	now := time.Now()
+	s.rc.SetReadDeadline(now.Add(s.readTimeout))
+	s.rc.SetWriteDeadline(now.Add(s.writeTimeout))
+	return s.ReadCloser.Read(p)
+}
+
+// streamWriter moves the write deadline server.writetimeout ahead of every
+// write, so that a download is only cut off when the client stops reading
+// for that long rather than after it in total.
+type streamWriter struct {
+	http.ResponseWriter
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+func newStreamWriter(w http.ResponseWriter) *streamWriter {
+	return &streamWriter{
+		ResponseWriter: w,
+		rc:             http.NewResponseController(w),
+		timeout:        config.Get().Server.WriteTimeout,
+	}
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	// not supported by test recorders, which have no deadline either
+	s.rc.SetWriteDeadline(time.Now().Add(s.timeout))
+	return s.ResponseWriter.Write(p)
+}
+
+func (s *streamWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// ListenAndServe serves plain HTTP or HTTPS depending on how srv was built.
+func ListenAndServe(srv *http.Server) error {
+
+	if srv.TLSConfig != nil {
+		return srv.ListenAndServeTLS("", "")
+	}
+
+	return srv.ListenAndServe()
+}
+
+// CertReloader serves a certificate key pair from disk and reloads it when
+// either file changes, so certificates can be rotated without a restart.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	certMod   time.Time
+	keyMod    time.Time
+	lastCheck time.Time
+}
+
+const certCheckInterval = time.Second
+
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+
+	c := &CertReloader{certFile: certFile, keyFile: keyFile}
+
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.lastCheck) >= certCheckInterval {
+		c.lastCheck = time.Now()
+
+		if c.changed() {
+			if err := c.reload(); err != nil {
+				// keep serving the previous certificate until the files are fixed
+				utility.Errorln("Error in reloading TLS certificate:", err)
+			} else {
+				utility.Infoln("Reloaded TLS certificate from", c.certFile)
+			}
+		}
+	}
+
+	return c.cert, nil
+}
+
+func (c *CertReloader) changed() bool {
+
+	certInfo, err := os.Stat(c.certFile)
+	if err != nil {
+		return false
+	}
+
+	keyInfo, err := os.Stat(c.keyFile)
+	if err != nil {
+		return false
+	}
+
+	return !certInfo.ModTime().Equal(c.certMod) || !keyInfo.ModTime().Equal(c.keyMod)
+}
+
+func (c *CertReloader) reload() error {
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	certInfo, err := os.Stat(c.certFile)
+	if err != nil {
+		return err
+	}
+
+	keyInfo, err := os.Stat(c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.cert = &cert
+	c.certMod = certInfo.ModTime()
+	c.keyMod = keyInfo.ModTime()
+
+	return nil
+}
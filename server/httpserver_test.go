@@ -0,0 +1,174 @@
+package server
+
+import (
+	"NOTESBE/config"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestCert(t *testing.T, dir, commonName string, modTime time.Time) (string, string) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600)
+	os.Chtimes(certFile, modTime, modTime)
+	os.Chtimes(keyFile, modTime, modTime)
+
+	return certFile, keyFile
+}
+
+func TestCertReloader(t *testing.T) {
+
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, "first", time.Now().Add(-time.Minute))
+
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := reloader.GetCertificate(nil)
+	assert.NoError(t, err)
+	leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+	assert.Equal(t, "first", leaf.Subject.CommonName)
+
+	writeTestCert(t, dir, "second", time.Now())
+	reloader.lastCheck = time.Time{}
+
+	cert, err = reloader.GetCertificate(nil)
+	assert.NoError(t, err)
+	leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	assert.Equal(t, "second", leaf.Subject.CommonName)
+
+	os.WriteFile(certFile, []byte("broken"), 0o600)
+	os.Chtimes(certFile, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	reloader.lastCheck = time.Time{}
+
+	cert, err = reloader.GetCertificate(nil)
+	assert.NoError(t, err)
+	leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	assert.Equal(t, "second", leaf.Subject.CommonName, "previous certificate is kept when reload fails")
+}
+
+func TestTimeouts(t *testing.T) {
+
+	cfg := *config.Get()
+	cfg.Server.WriteTimeout = 200 * time.Millisecond
+	cfg.Server.ReadTimeout = 200 * time.Millisecond
+	config.Set(&cfg)
+	defer config.Set(nil)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("start"))
+		time.Sleep(400 * time.Millisecond)
+		w.Write([]byte("end"))
+	})
+	mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		stream := newStreamWriter(w)
+		for i := 0; i < 5; i++ {
+			stream.Write([]byte("chunk"))
+			http.NewResponseController(w).Flush()
+			time.Sleep(100 * time.Millisecond)
+		}
+	})
+
+	read := func(w http.ResponseWriter, body io.Reader) {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			w.WriteHeader(http.StatusRequestTimeout)
+			return
+		}
+		w.Write(data)
+	}
+	mux.HandleFunc("/body", func(w http.ResponseWriter, r *http.Request) {
+		read(w, r.Body)
+	})
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		read(w, newStreamReader(w, r.Body))
+	})
+
+	srv := httptest.NewServer(timeouts(mux))
+	defer srv.Close()
+
+	// post sends the body in chunks 100ms apart
+	post := func(path string) (int, string) {
+		body, pw := io.Pipe()
+		go func() {
+			for i := 0; i < 5; i++ {
+				pw.Write([]byte("chunk"))
+				time.Sleep(100 * time.Millisecond)
+			}
+			pw.Close()
+		}()
+		resp, err := http.Post(srv.URL+path, "application/octet-stream", body)
+		if err != nil {
+			return 0, ""
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	get := func(path string) (string, error) {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	body, err := get("/slow")
+	assert.True(t, err != nil || body != "startend", "the response is cut off after the write timeout")
+
+	body, err = get("/download")
+	assert.NoError(t, err)
+	assert.Equal(t, "chunkchunkchunkchunkchunk", body, "downloads may take longer while the client reads")
+
+	code, _ := post("/body")
+	assert.NotEqual(t, http.StatusOK, code, "the body is cut off after the read timeout")
+
+	code, body = post("/upload")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "chunkchunkchunkchunkchunk", body, "uploads may take longer while the client sends")
+}
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"NOTESBE/blobstore"
+	"NOTESBE/config"
+	"NOTESBE/importer"
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+func importJobResp(job *repository.Importjob) *ImportJobResp {
+
+	resp := &ImportJobResp{
+		Id:          job.Id,
+		Source:      job.Source,
+		Status:      job.Status,
+		Error:       job.Error,
+		Progress:    job.Progress,
+		Processed:   job.Processed,
+		Imported:    job.Imported,
+		Failed:      job.Failed,
+		Attachments: job.Attachments,
+		CreatedAt:   job.Createdat,
+		FinishedAt:  job.Finishedat,
+	}
+	if job.Failures != "" {
+		resp.Failures = strings.Split(strings.TrimSuffix(job.Failures, "\n"), "\n")
+	}
+
+	return resp
+}
+
+// sourceOf guesses the source of an import from the type or name of the
+// upload.
+func sourceOf(mediaType, filename string) string {
+
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".enex":
+		return importer.SourceENEX
+	case ".zip":
+		return importer.SourceKeep
+	}
+
+	switch mediaType {
+	case "application/xml", "text/xml", "application/enex+xml":
+		return importer.SourceENEX
+	case "application/zip", "application/x-zip-compressed":
+		return importer.SourceKeep
+	}
+
+	return ""
+}
+
+// CreateImportJob stores an Evernote export or Keep Takeout archive, sent as
+// the body or as the first file of a multipart form, and imports it in the
+// background.
+func (s *server) CreateImportJob(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, err := utility.ParseUserId(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	cfg := config.Get().Import
+	r.Body = http.MaxBytesReader(w, newStreamReader(w, r.Body), cfg.MaxSize)
+
+	source := r.URL.Query().Get("source")
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var upload io.Reader = r.Body
+	filename := ""
+
+	if mediaType == "multipart/form-data" {
+		upload, filename, err = firstFile(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	if source == "" {
+		source = sourceOf(mediaType, filename)
+	}
+	if !contains(importer.Sources, source) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "source must be enex or keep"})
+		return
+	}
+
+	name, err := spool(cfg.Dir, upload)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("Upload is larger than %d bytes", cfg.MaxSize)})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	job := &repository.Importjob{
+		Userid: userId,
+		Source: source,
+		Status: repository.ImportPending,
+	}
+
+	err = s.db.CreateImportJob(job)
+	if err != nil {
+		os.Remove(name)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	go s.runImport(*job, name)
+
+	w.Header().Set("Location", fmt.Sprintf("/api/notes/imports/%d", job.Id))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(importJobResp(job))
+}
+
+func (s *server) GetImportJob(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, err := utility.ParseUserId(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	jobId, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	job, err := s.db.GetImportJob(jobId, userId)
+	if errors.Is(err, repository.ErrImportJobNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(importJobResp(job))
+}
+
+func (s *server) runImport(job repository.Importjob, name string) {
+
+	defer os.Remove(name)
+
+	if err := importer.Run(s.db, s, &job, name, nil); err != nil {
+		utility.Errorln("Error in import", job.Id, err)
+	}
+}
+
+// ImportStore returns the store for attachments of notes imported by
+// `notes import`, outside a running server. Their text is indexed when the
+// server starts next.
+func ImportStore(db repository.Repository) importer.AttachmentStore {
+	return &server{db: db, blobs: blobstore.New(config.Get().Attachments)}
+}
+
+// StoreAttachment stores an attachment of an imported note like an upload,
+// within attachments.maxsize and the quota of the user. Thumbnails are made
+// when the image is first shown.
+func (s *server) StoreAttachment(ctx context.Context, userId, noteId uint64, file *importer.Attachment) error {
+
+	usage, err := s.db.GetAttachmentUsage(userId)
+	if err != nil {
+		return err
+	}
+
+	attachment, err := s.storeAttachment(ctx, bytes.NewReader(file.Data), file.Name, noteId, userId, config.Get().Attachments, usage)
+	if err != nil {
+		return err
+	}
+
+	if !attachment.Indexed && s.indexQueue != nil {
+		s.queueIndexing(*attachment)
+	}
+
+	return nil
+}
+
+func firstFile(r *http.Request) (io.Reader, string, error) {
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, "", errors.New("the form contains no file")
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if part.FileName() != "" {
+			return part, part.FileName(), nil
+		}
+		part.Close()
+	}
+}
+
+// spool writes the upload to a new file in dir and returns its name.
+func spool(dir string, r io.Reader) (string, error) {
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	file, err := os.CreateTemp(dir, "import-*.upload")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"NOTESBE/blobstore"
+	"NOTESBE/config"
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportJob(t *testing.T) {
+
+	cfg := *config.Get()
+	cfg.RateLimit.Policies = nil
+	cfg.Import.Dir = t.TempDir()
+	cfg.Attachments.Quota = 16
+	config.Set(&cfg)
+	defer config.Set(nil)
+
+	dir := t.TempDir()
+	s := &server{router: mux.NewRouter(), db: mockrepo, blobs: &blobstore.LocalStore{Dir: dir}}
+	r := Router(s)
+
+	login, _ := (&utility.TokenReq{Id: 6}).CreateJwtToken()
+
+	enex := `<?xml version="1.0" encoding="UTF-8"?>
+<en-export><note><title>Hello</title><content><![CDATA[<en-note><div>from Evernote</div></en-note>]]></content>
+<created>20230102T030405Z</created><tag>imported</tag>
+<resource><data encoding="base64">` + base64.StdEncoding.EncodeToString([]byte("\x00\x01\x02")) + `</data><mime>application/octet-stream</mime>
+<resource-attributes><file-name>small.bin</file-name></resource-attributes></resource>
+<resource><data encoding="base64">` + base64.StdEncoding.EncodeToString(make([]byte, 32)) + `</data><mime>application/octet-stream</mime>
+<resource-attributes><file-name>large.bin</file-name></resource-attributes></resource>
+</note></en-export>`
+
+	finished := make(chan repository.Importjob, 1)
+
+	mockrepo.EXPECT().CreateImportJob(gomock.Any()).DoAndReturn(func(job *repository.Importjob) error {
+		job.Id = 3
+		return nil
+	})
+	mockrepo.EXPECT().CreateNote(gomock.Any()).DoAndReturn(func(note *repository.Note) error {
+		assert.Equal(t, "# Hello\n\nfrom Evernote", note.Note)
+		assert.Equal(t, "imported", note.Tags)
+		assert.Equal(t, uint64(6), note.Userid)
+		note.Id = 12
+		return nil
+	})
+
+	// the second attachment is over the quota and left out
+	gomock.InOrder(
+		mockrepo.EXPECT().GetAttachmentUsage(uint64(6)).Return(int64(0), nil),
+		mockrepo.EXPECT().GetAttachmentUsage(uint64(6)).Return(int64(3), nil),
+	)
+	mockrepo.EXPECT().CreateAttachment(gomock.Any()).DoAndReturn(func(attachment *repository.Attachment) error {
+		assert.Equal(t, uint64(12), attachment.Noteid)
+		assert.Equal(t, "small.bin", attachment.Name)
+		assert.Equal(t, int64(3), attachment.Size)
+		return nil
+	})
+	mockrepo.EXPECT().UpdateImportJob(gomock.Any()).DoAndReturn(func(job *repository.Importjob) error {
+		if job.Status == repository.ImportDone || job.Status == repository.ImportFailed {
+			finished <- *job
+		}
+		return nil
+	}).MinTimes(2)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/notes/imports?userid=6", strings.NewReader(enex))
+	req.Header.Set("Authtoken", login.Token)
+	req.Header.Set("Content-Type", "application/xml")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "/api/notes/imports/3", rec.Header().Get("Location"))
+
+	var job repository.Importjob
+	select {
+	case job = <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("import did not finish")
+	}
+	assert.Equal(t, repository.ImportDone, job.Status)
+	assert.Equal(t, 1, job.Imported)
+	assert.Equal(t, 1, job.Attachments)
+	assert.Equal(t, "Hello: attachment large.bin: attachment quota exceeded\n", job.Failures)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "notes", "12", "*"))
+	assert.Len(t, files, 1, "the refused attachment is not kept")
+
+	mockrepo.EXPECT().GetImportJob(uint64(3), uint64(6)).Return(&job, nil)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/notes/imports/3?userid=6", nil)
+	req.Header.Set("Authtoken", login.Token)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	resp := ImportJobResp{}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 100, resp.Progress)
+	assert.Equal(t, "enex", resp.Source)
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"NOTESBE/blobstore"
+	"NOTESBE/extract"
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"context"
+	"errors"
+	"io"
+)
+
+// indexQueueSize is how many uploaded attachments can wait for their text
+// to be extracted. Attachments that do not fit are indexed by
+// IndexPendingAttachments at the next start.
+const indexQueueSize = 1000
+
+// queueIndexing hands a new attachment to the index worker.
+func (s *server) queueIndexing(attachment repository.Attachment) {
+	select {
+	case s.indexQueue <- attachment:
+	default:
+		utility.Errorln("Index queue is full, attachment", attachment.Id, "is indexed at the next start")
+	}
+}
+
+// indexWorker extracts the text of queued attachments one at a time.
+func (s *server) indexWorker() {
+	for attachment := range s.indexQueue {
+		s.indexAttachment(attachment)
+	}
+}
+
+// IndexPendingAttachments extracts the text of attachments uploaded while
+// the server was stopped or the queue was full. serve runs it once at the
+// start.
+func (s *server) IndexPendingAttachments() {
+
+	attachments, err := s.db.GetUnindexedAttachments()
+	if err != nil {
+		return
+	}
+
+	for _, attachment := range attachments {
+		s.indexAttachment(attachment)
+	}
+}
+
+// indexAttachment stores the text of an attachment for search. Files whose
+// text cannot be read are marked indexed without text, so they are not
+// tried again; a failure to read the blob is retried at the next start.
+// A file crashing the extractor is marked indexed too, or it would crash
+// the server again at every start.
+func (s *server) indexAttachment(attachment repository.Attachment) {
+
+	defer func() {
+		if p := recover(); p != nil {
+			utility.Errorln("Error in extracting text of attachment", attachment.Id, p)
+			if err := s.db.SetAttachmentText(attachment.Id, ""); err != nil {
+				utility.Errorln("Error in indexing attachment", attachment.Id, err)
+			}
+		}
+	}()
+
+	ctx := context.Background()
+
+	text := ""
+	content, err := s.blobs.Get(ctx, attachment.Blobkey)
+	if err == nil {
+		var data []byte
+		data, err = io.ReadAll(content)
+		content.Close()
+		if err != nil {
+			utility.Errorln("Error in reading attachment", attachment.Id, err)
+			return
+		}
+
+		text, err = extract.Text(data, attachment.Mime, attachment.Name)
+		if err != nil {
+			utility.Errorln("Error in extracting text of attachment", attachment.Id, err)
+		}
+	} else if !errors.Is(err, blobstore.ErrNotFound) {
+		utility.Errorln("Error in reading attachment", attachment.Id, err)
+		return
+	}
+
+	err = s.db.SetAttachmentText(attachment.Id, text)
+	if err != nil && !errors.Is(err, repository.ErrAttachmentNotFound) {
+		utility.Errorln("Error in indexing attachment", attachment.Id, err)
+	}
+}
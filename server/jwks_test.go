@@ -0,0 +1,138 @@
+package server
+
+import (
+	"NOTESBE/config"
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeKey(t *testing.T, key interface{}) string {
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+
+	return path
+}
+
+func TestAsymmetricTokens(t *testing.T) {
+
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	now := time.Now()
+
+	cfg := *config.Get()
+	cfg.Token.SecretKey = "legacy-secret"
+	config.Set(&cfg)
+	defer config.Set(nil)
+
+	// a token issued before the migration
+	legacy, _ := (&utility.TokenReq{Id: 9}).CreateJwtToken()
+
+	cfg.Token.Keys = []config.TokenKey{
+		{Kid: "2024-rsa", File: writeKey(t, rsaKey), ActiveFrom: now.Add(-48 * time.Hour), RetireAt: now.Add(time.Hour)},
+		{Kid: "2024-ed", File: writeKey(t, edKey), ActiveFrom: now.Add(-time.Hour)},
+		{Kid: "next", File: writeKey(t, rsaKey), ActiveFrom: now.Add(24 * time.Hour)},
+	}
+	config.Set(&cfg)
+
+	s := &server{router: mux.NewRouter(), db: mockrepo}
+	r := Router(s)
+
+	get := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authtoken", token)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("signs with the newest active key", func(t *testing.T) {
+
+		token, err := (&utility.TokenReq{Id: 9}).CreateJwtToken()
+		assert.NoError(t, err)
+
+		parsed, _, _ := new(jwt.Parser).ParseUnverified(token.Token, jwt.MapClaims{})
+		assert.Equal(t, "EdDSA", parsed.Header["alg"])
+		assert.Equal(t, "2024-ed", parsed.Header["kid"])
+
+		mockrepo.EXPECT().GetNotesOfUser(uint64(9)).Return([]repository.Note{}, nil)
+		assert.Equal(t, http.StatusOK, get("/api/notes?userid=9", token.Token).Code)
+	})
+
+	t.Run("tokens of the previous key stay valid until it retires", func(t *testing.T) {
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"id": 9, "exp": now.Add(time.Hour).Unix()})
+		token.Header["kid"] = "2024-rsa"
+		signed, _ := token.SignedString(rsaKey)
+
+		mockrepo.EXPECT().GetNotesOfUser(uint64(9)).Return([]repository.Note{}, nil)
+		assert.Equal(t, http.StatusOK, get("/api/notes?userid=9", signed).Code)
+
+		token.Header["kid"] = "unknown"
+		signed, _ = token.SignedString(rsaKey)
+		assert.Equal(t, http.StatusUnauthorized, get("/api/notes?userid=9", signed).Code)
+
+		retired := cfg
+		retired.Token.Keys = append([]config.TokenKey{}, cfg.Token.Keys...)
+		retired.Token.Keys[0].RetireAt = now.Add(-time.Minute)
+		config.Set(&retired)
+		defer config.Set(&cfg)
+
+		token.Header["kid"] = "2024-rsa"
+		signed, _ = token.SignedString(rsaKey)
+		assert.Equal(t, http.StatusUnauthorized, get("/api/notes?userid=9", signed).Code)
+	})
+
+	t.Run("legacy HS256 tokens are accepted while the secret is set", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetNotesOfUser(uint64(9)).Return([]repository.Note{}, nil)
+		assert.Equal(t, http.StatusOK, get("/api/notes?userid=9", legacy.Token).Code)
+
+		noLegacy := cfg
+		noLegacy.Token.SecretKey = ""
+		config.Set(&noLegacy)
+		defer config.Set(&cfg)
+
+		assert.Equal(t, http.StatusUnauthorized, get("/api/notes?userid=9", legacy.Token).Code)
+	})
+
+	t.Run("jwks", func(t *testing.T) {
+
+		rec := get("/.well-known/jwks.json", "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		set := JWKSResp{}
+		json.NewDecoder(rec.Body).Decode(&set)
+
+		kids := []string{}
+		for _, key := range set.Keys {
+			kids = append(kids, key.Kid+"/"+key.Alg+"/"+key.Kty)
+		}
+		assert.Equal(t, []string{"2024-rsa/RS256/RSA", "2024-ed/EdDSA/OKP", "next/RS256/RSA"}, kids, "upcoming keys are published ahead of time")
+		assert.NotEmpty(t, set.Keys[1].X)
+		assert.False(t, strings.Contains(rec.Body.String(), "legacy-secret"))
+	})
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"NOTESBE/config"
+	"NOTESBE/ratelimiter"
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// loginGuard slows down password guessing by counting failed logins per
+// username and per IP, see config.LoginConfig. The counters are kept in the
+// ratelimit.store, so that all replicas share them. The zero value is ready
+// to use with counters in process memory.
+type loginGuard struct {
+	mu    sync.Mutex
+	store ratelimiter.FailureStore
+	now   func() time.Time
+}
+
+func userGuardKey(username string) string { return "user:" + username }
+func ipGuardKey(ip string) string         { return "ip:" + ip }
+
+func (g *loginGuard) clock() time.Time {
+	if g.now != nil {
+		return g.now()
+	}
+	return time.Now()
+}
+
+func (g *loginGuard) failures() ratelimiter.FailureStore {
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.store == nil {
+		g.store = ratelimiter.NewMemoryFailures()
+	}
+
+	return g.store
+}
+
+// blocked returns how long login attempts for username from ip have to wait,
+// zero when they are allowed or the store is unavailable.
+func (g *loginGuard) blocked(ctx context.Context, username, ip string) time.Duration {
+
+	now := g.clock()
+
+	var wait time.Duration
+	for _, key := range []string{userGuardKey(username), ipGuardKey(ip)} {
+		f, err := g.failures().Get(ctx, key, now)
+		if err != nil {
+			// fail open like the rate limits, the API must stay usable
+			utility.Errorln("Error in checking failed logins:", err)
+			continue
+		}
+		if f.BlockedUntil.Sub(now) > wait {
+			wait = f.BlockedUntil.Sub(now)
+		}
+	}
+
+	return wait
+}
+
+// failed counts a failed login and reports whether the username or the IP
+// has just been locked out.
+func (g *loginGuard) failed(ctx context.Context, username, ip string) (userLocked, ipLocked bool) {
+
+	now := g.clock()
+	cfg := config.Get().Login
+
+	userLocked = g.fail(ctx, userGuardKey(username), cfg.BackoffAfter, cfg.LockoutAfter, now, cfg)
+	ipLocked = g.fail(ctx, ipGuardKey(ip), cfg.IPBackoffAfter, cfg.IPLockoutAfter, now, cfg)
+
+	return userLocked, ipLocked
+}
+
+// succeeded forgets the failures of username. Failures of the IP are kept so
+// that logging into one account does not reset a guessing run on others.
+func (g *loginGuard) succeeded(ctx context.Context, username string) {
+
+	if _, err := g.failures().Reset(ctx, userGuardKey(username)); err != nil {
+		utility.Errorln("Error in resetting failed logins:", err)
+	}
+}
+
+// unlock forgets the failures of a user or IP guard key and reports whether
+// there were any.
+func (g *loginGuard) unlock(ctx context.Context, key string) (bool, error) {
+	return g.failures().Reset(ctx, key)
+}
+
+// lockouts lists the usernames and IPs that are currently blocked.
+func (g *loginGuard) lockouts(ctx context.Context) ([]LockoutResp, error) {
+
+	blocked, err := g.failures().Blocked(ctx, g.clock())
+	if err != nil {
+		return nil, err
+	}
+
+	out := []LockoutResp{}
+	for key, f := range blocked {
+		lockout := LockoutResp{Failures: f.Count, Until: f.BlockedUntil}
+		if strings.HasPrefix(key, "user:") {
+			lockout.UserName = strings.TrimPrefix(key, "user:")
+		} else {
+			lockout.Ip = strings.TrimPrefix(key, "ip:")
+		}
+		out = append(out, lockout)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Until.Before(out[j].Until) })
+
+	return out, nil
+}
+
+func (g *loginGuard) fail(ctx context.Context, key string, backoffAfter, lockoutAfter int, now time.Time, cfg config.LoginConfig) bool {
+
+	store := g.failures()
+
+	f, err := store.Fail(ctx, key, now, cfg.LockoutDuration)
+	if err != nil {
+		utility.Errorln("Error in counting failed login:", err)
+		return false
+	}
+
+	var until time.Time
+	switch {
+	case f.Count >= lockoutAfter:
+		until = now.Add(cfg.LockoutDuration)
+	case f.Count >= backoffAfter:
+		wait := cfg.BackoffBase
+		for i := backoffAfter; i < f.Count && wait < cfg.LockoutDuration; i++ {
+			wait *= 2
+		}
+		if wait > cfg.LockoutDuration {
+			wait = cfg.LockoutDuration
+		}
+		until = now.Add(wait)
+	default:
+		return false
+	}
+
+	if err := store.Block(ctx, key, until); err != nil {
+		utility.Errorln("Error in blocking logins:", err)
+	}
+
+	return f.Count >= lockoutAfter
+}
+
+// loginFailed counts a failed login and records it together with any
+// resulting lockout.
+func (s *server) loginFailed(ctx context.Context, username, ip string) {
+
+	userLocked, ipLocked := s.guard.failed(ctx, username, ip)
+
+	s.recordAuthEvent(username, ip, repository.EventLoginFailed)
+	if userLocked {
+		s.recordAuthEvent(username, ip, repository.EventLocked)
+	}
+	if ipLocked {
+		s.recordAuthEvent(username, ip, repository.EventIPLocked)
+	}
+}
+
+func (s *server) recordAuthEvent(username, ip, event string) {
+
+	err := s.db.CreateAuthEvent(&repository.Authevent{Username: username, Ip: ip, Event: event})
+	if err != nil {
+		utility.Errorln("Error in recording auth event:", err)
+	}
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"NOTESBE/config"
+	"NOTESBE/repository"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginLockout(t *testing.T) {
+
+	cfg := *config.Get()
+	cfg.Admin.Token = "admin-secret"
+	cfg.Login = config.LoginConfig{
+		BackoffAfter:    2,
+		LockoutAfter:    4,
+		IPBackoffAfter:  5,
+		IPLockoutAfter:  8,
+		BackoffBase:     time.Second,
+		LockoutDuration: 10 * time.Minute,
+	}
+	cfg.RateLimit.Policies = nil
+	config.Set(&cfg)
+	defer config.Set(nil)
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	s := &server{router: mux.NewRouter(), db: mockrepo}
+	s.guard.now = func() time.Time { return now }
+	r := Router(s)
+
+	login := func(username, ip string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(UserReq{UserName: username, PassWord: "guess"})
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewBuffer(body))
+		req.RemoteAddr = ip + ":4000"
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	admin := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(payload))
+		req.Header.Set("Admintoken", "admin-secret")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	events := []string{}
+	mockrepo.EXPECT().CreateAuthEvent(gomock.Any()).DoAndReturn(func(event *repository.Authevent) error {
+		events = append(events, event.Event)
+		return nil
+	}).AnyTimes()
+
+	t.Run("unknown users and wrong passwords look the same", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetUser(gomock.Any()).Return(uint64(0), repository.ErrInvalidCredentials)
+
+		rec := login("nobody", "10.0.0.1")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Contains(t, rec.Body.String(), "Invalid username or password")
+	})
+
+	t.Run("backoff then lockout", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetUser(gomock.Any()).Return(uint64(0), repository.ErrInvalidCredentials).Times(3)
+
+		assert.Equal(t, http.StatusUnauthorized, login("alice", "10.0.0.2").Code)
+		assert.Equal(t, http.StatusUnauthorized, login("alice", "10.0.0.2").Code)
+
+		// the second failure starts the backoff, even from another IP
+		rec := login("alice", "10.0.0.3")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+		now = now.Add(time.Second)
+		assert.Equal(t, http.StatusUnauthorized, login("alice", "10.0.0.3").Code)
+		rec = login("alice", "10.0.0.3")
+		assert.Equal(t, "2", rec.Header().Get("Retry-After"), "the delay doubles")
+
+		now = now.Add(2 * time.Second)
+		mockrepo.EXPECT().GetUser(gomock.Any()).Return(uint64(0), repository.ErrInvalidCredentials)
+		assert.Equal(t, http.StatusUnauthorized, login("alice", "10.0.0.3").Code)
+
+		now = now.Add(5 * time.Minute)
+		rec = login("alice", "10.0.0.3")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "300", rec.Header().Get("Retry-After"))
+		assert.Contains(t, events, repository.EventLocked)
+
+		rec = admin(http.MethodGet, "/api/admin/lockouts", nil)
+		lockouts := []LockoutResp{}
+		json.NewDecoder(rec.Body).Decode(&lockouts)
+		assert.Equal(t, []LockoutResp{{UserName: "alice", Failures: 4, Until: now.Add(5 * time.Minute)}}, lockouts)
+
+		assert.Equal(t, http.StatusOK, admin(http.MethodPost, "/api/admin/lockouts/unlock", UnlockReq{UserName: "alice"}).Code)
+		assert.Equal(t, repository.EventUnlocked, events[len(events)-1])
+		assert.Equal(t, http.StatusNotFound, admin(http.MethodPost, "/api/admin/lockouts/unlock", UnlockReq{UserName: "alice"}).Code)
+
+		mockrepo.EXPECT().GetUser(gomock.Any()).Return(uint64(1), nil)
+		assert.Equal(t, http.StatusOK, login("alice", "10.0.0.3").Code)
+	})
+
+	t.Run("one IP guessing many usernames", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetUser(gomock.Any()).Return(uint64(0), repository.ErrInvalidCredentials).Times(5)
+
+		for _, username := range []string{"u1", "u2", "u3", "u4", "u5"} {
+			assert.Equal(t, http.StatusUnauthorized, login(username, "10.0.0.9").Code)
+		}
+
+		rec := login("u6", "10.0.0.9")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, http.StatusOK, admin(http.MethodPost, "/api/admin/lockouts/unlock", UnlockReq{Ip: "10.0.0.9"}).Code)
+	})
+
+	t.Run("failures are forgotten", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetUser(gomock.Any()).Return(uint64(0), repository.ErrInvalidCredentials).Times(4)
+
+		assert.Equal(t, http.StatusUnauthorized, login("bob", "10.0.1.1").Code)
+		assert.Equal(t, http.StatusUnauthorized, login("bob", "10.0.1.1").Code)
+		assert.Equal(t, http.StatusTooManyRequests, login("bob", "10.0.1.1").Code)
+
+		now = now.Add(11 * time.Minute)
+		assert.Equal(t, http.StatusUnauthorized, login("bob", "10.0.1.1").Code)
+		assert.Equal(t, http.StatusUnauthorized, login("bob", "10.0.1.1").Code, "earlier failures no longer count")
+	})
+}
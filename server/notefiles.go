@@ -0,0 +1,495 @@
+package server
+
+import (
+	"NOTESBE/config"
+	"NOTESBE/notefile"
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// Formats of /api/notes/export and /api/notes/import.
+const (
+	formatZip      = "zip"
+	formatMarkdown = "md"
+	formatJSON     = "json"
+)
+
+// maxArchiveFiles is the largest number of files in an imported zip archive.
+const maxArchiveFiles = 10000
+
+// errFileTooLarge is reported for a JSON file in an archive that unpacks to
+// more than notefile.MaxSize.
+var errFileTooLarge = fmt.Errorf("file is larger than %d bytes", notefile.MaxSize)
+
+func splitTags(tags string) []string {
+	return notefile.NormalizeTags(strings.Split(tags, ","))
+}
+
+func toNoteFile(note *repository.Note) *notefile.Note {
+	return &notefile.Note{
+		Id:      note.Id,
+		Body:    note.Note,
+		Tags:    splitTags(note.Tags),
+		Created: note.Createdat,
+		Updated: note.Updatedat,
+	}
+}
+
+// ExportNotes sends the notes the user owns, by default as a zip archive of
+// Markdown files with front matter. Checklists are exported as task lists.
+func (s *server) ExportNotes(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, err := utility.ParseUserId(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = formatZip
+	}
+	if format != formatZip && format != formatMarkdown && format != formatJSON {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "format must be zip, md or json"})
+		return
+	}
+
+	owned, err := s.ownedNotes(userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="notes.%s"`, format))
+	switch format {
+	case formatJSON:
+		w.Header().Set("Content-Type", "application/json")
+	case formatMarkdown:
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	case formatZip:
+		w.Header().Set("Content-Type", "application/zip")
+	}
+	w.WriteHeader(http.StatusOK)
+
+	// all notes of a user may take longer than server.writetimeout to send
+	if err := writeNotesExport(newStreamWriter(w), owned, format); err != nil {
+		utility.Errorln("Error in exporting notes:", err)
+	}
+}
+
+// WriteNotesExport writes the notes the user owns to w as ExportNotes sends
+// them, format is zip, md or json. The admin CLI exports with it.
+func WriteNotesExport(db repository.Repository, w io.Writer, userId uint64, format string) error {
+
+	if format != formatZip && format != formatMarkdown && format != formatJSON {
+		return errors.New("format must be zip, md or json")
+	}
+
+	s := &server{db: db}
+	owned, err := s.ownedNotes(userId)
+	if err != nil {
+		return err
+	}
+
+	return writeNotesExport(w, owned, format)
+}
+
+// ownedNotes returns the notes of the user without those shared with them,
+// which belong to someone else, with checklists as task lists.
+func (s *server) ownedNotes(userId uint64) ([]repository.Note, error) {
+
+	notes, err := s.db.GetNotesOfUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	owned := []repository.Note{}
+	for _, note := range notes {
+		if note.Userid == userId {
+			owned = append(owned, note)
+		}
+	}
+
+	checklists, err := s.checklistItems(owned)
+	if err != nil {
+		return nil, err
+	}
+	expandChecklists(owned, checklists)
+
+	return owned, nil
+}
+
+func writeNotesExport(w io.Writer, owned []repository.Note, format string) error {
+
+	switch format {
+	case formatJSON:
+		files := []NoteFile{}
+		for _, note := range owned {
+			files = append(files, NoteFile{
+				Id:        note.Id,
+				Note:      note.Note,
+				Tags:      splitTags(note.Tags),
+				CreatedAt: note.Createdat,
+				UpdatedAt: note.Updatedat,
+			})
+		}
+		return json.NewEncoder(w).Encode(files)
+
+	case formatMarkdown:
+		for i, note := range owned {
+			if i > 0 {
+				io.WriteString(w, "\n")
+			}
+			if _, err := w.Write(notefile.Marshal(toNoteFile(&note))); err != nil {
+				return err
+			}
+		}
+
+	case formatZip:
+		archive := zip.NewWriter(w)
+		for _, note := range owned {
+			f, err := archive.CreateHeader(&zip.FileHeader{
+				Name:     fmt.Sprintf("notes/%d.md", note.Id),
+				Method:   zip.Deflate,
+				Modified: note.Updatedat,
+			})
+			if err != nil {
+				return err
+			}
+			f.Write(notefile.Marshal(toNoteFile(&note)))
+		}
+		return archive.Close()
+	}
+
+	return nil
+}
+
+// ImportNotes creates a note for every Markdown file or JSON entry of the
+// upload and reports the outcome of each. The body is a zip archive, a
+// Markdown stream, a JSON array of notes, or a multipart form whose files
+// may be any of these. Ids in front matter and JSON are ignored.
+func (s *server) ImportNotes(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, err := utility.ParseUserId(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	maxSize := config.Get().Import.MaxSize
+	r.Body = http.MaxBytesReader(w, newStreamReader(w, r.Body), maxSize)
+
+	imp := &noteImport{s: s, userId: userId, resp: ImportResp{Results: []ImportResult{}}}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	format := r.URL.Query().Get("format")
+
+	if format == "" && mediaType == "multipart/form-data" {
+		err = imp.multipart(r)
+	} else {
+		if format == "" {
+			format = formatOf(mediaType)
+		}
+		switch format {
+		case formatZip, formatJSON:
+			err = imp.read("", format, r.Body)
+		case formatMarkdown:
+			err = imp.stream(r.Body)
+		default:
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Upload a zip archive, Markdown, JSON or a multipart form"})
+			return
+		}
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("Upload is larger than %d bytes, %d notes were imported before", maxSize, imp.resp.Imported)})
+		return
+	}
+	if err != nil && len(imp.resp.Results) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		imp.failed("", err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(imp.resp)
+}
+
+func formatOf(mediaType string) string {
+
+	switch mediaType {
+	case "application/zip", "application/x-zip-compressed":
+		return formatZip
+	case "application/json":
+		return formatJSON
+	case "text/markdown", "text/x-markdown", "text/plain":
+		return formatMarkdown
+	}
+
+	return ""
+}
+
+// noteImport collects the results of one import request.
+type noteImport struct {
+	s      *server
+	userId uint64
+	resp   ImportResp
+}
+
+func (imp *noteImport) failed(name string, err error) {
+	imp.resp.Failed++
+	imp.resp.Results = append(imp.resp.Results, ImportResult{File: name, Error: err.Error()})
+}
+
+func (imp *noteImport) create(name string, note *notefile.Note) {
+
+	if strings.TrimSpace(note.Body) == "" {
+		imp.failed(name, errors.New("note is empty"))
+		return
+	}
+	if len(note.Body) > notefile.MaxSize {
+		imp.failed(name, notefile.ErrTooLarge)
+		return
+	}
+
+	record := &repository.Note{
+		Note:      note.Body,
+		Userid:    imp.userId,
+		Tags:      strings.Join(notefile.NormalizeTags(note.Tags), ","),
+		Createdat: note.Created,
+		Updatedat: note.Updated,
+	}
+
+	if err := imp.s.db.CreateNote(record); err != nil {
+		imp.failed(name, err)
+		return
+	}
+
+	imp.resp.Imported++
+	imp.resp.Results = append(imp.resp.Results, ImportResult{File: name, Id: record.Id})
+}
+
+// multipart imports the files of a form one part at a time, so that the
+// upload is never held in memory as a whole.
+func (imp *noteImport) multipart(r *http.Request) error {
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if part.FileName() != "" {
+			err = imp.file(part.FileName(), part)
+		}
+		part.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// file imports a file by its extension. Errors reading a file are reported
+// as its result, only errors of the upload itself are returned.
+func (imp *noteImport) file(name string, r io.Reader) error {
+
+	switch strings.ToLower(path.Ext(name)) {
+	case ".md", ".markdown", ".txt":
+		data, err := io.ReadAll(io.LimitReader(r, notefile.MaxSize+1))
+		if err != nil {
+			return err
+		}
+		note, err := notefile.Parse(data)
+		if err != nil {
+			imp.failed(name, err)
+			return nil
+		}
+		imp.create(name, note)
+		return nil
+	case ".json":
+		return imp.read(name, formatJSON, r)
+	case ".zip":
+		return imp.read(name, formatZip, r)
+	}
+
+	imp.failed(name, errors.New("skipped, not a Markdown, JSON or zip file"))
+	return nil
+}
+
+func (imp *noteImport) read(name, format string, r io.Reader) error {
+
+	var err error
+	if format == formatZip {
+		err = imp.zip(name, r)
+	} else {
+		err = imp.json(name, r)
+	}
+
+	// a broken file inside a multipart upload does not stop the others
+	var tooLarge *http.MaxBytesError
+	if err != nil && name != "" && !errors.As(err, &tooLarge) {
+		imp.failed(name, err)
+		return nil
+	}
+
+	return err
+}
+
+// stream imports concatenated Markdown documents as written by ExportNotes.
+func (imp *noteImport) stream(r io.Reader) error {
+
+	i := 0
+	return notefile.Split(r, func(doc []byte) error {
+		i++
+		name := fmt.Sprintf("#%d", i)
+		note, err := notefile.Parse(doc)
+		if err != nil {
+			imp.failed(name, err)
+			return nil
+		}
+		imp.create(name, note)
+		return nil
+	})
+}
+
+// json streams a JSON array of notes.
+func (imp *noteImport) json(name string, r io.Reader) error {
+
+	dec := json.NewDecoder(r)
+
+	if token, err := dec.Token(); err != nil || token != json.Delim('[') {
+		return errors.New("JSON imports must be an array of notes")
+	}
+
+	for i := 0; dec.More(); i++ {
+		var file NoteFile
+		if err := dec.Decode(&file); err != nil {
+			return err
+		}
+		imp.create(fmt.Sprintf("%s[%d]", name, i), &notefile.Note{
+			Body:    file.Note,
+			Tags:    file.Tags,
+			Created: file.CreatedAt,
+			Updated: file.UpdatedAt,
+		})
+	}
+
+	return nil
+}
+
+// zip spools the archive to a temporary file, since its directory is at
+// the end, and imports every file in it. The upload limit only bounds the
+// compressed size, so archives of more than maxArchiveFiles files are
+// refused and every file is read up to notefile.MaxSize.
+func (imp *noteImport) zip(name string, r io.Reader) error {
+
+	tmp, err := os.CreateTemp("", "notes-import-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return err
+	}
+
+	archive, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return err
+	}
+	if len(archive.File) > maxArchiveFiles {
+		return fmt.Errorf("the archive has more than %d files", maxArchiveFiles)
+	}
+
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() || strings.HasPrefix(f.Name, "__MACOSX/") || strings.HasPrefix(path.Base(f.Name), ".") {
+			continue
+		}
+
+		entry := f.Name
+		if name != "" {
+			entry = name + "/" + f.Name
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			imp.failed(entry, err)
+			continue
+		}
+
+		switch strings.ToLower(path.Ext(f.Name)) {
+		case ".md", ".markdown", ".txt":
+			imp.zipNote(entry, f, rc)
+		case ".json":
+			limited := &limitedReader{r: rc, n: notefile.MaxSize, err: errFileTooLarge}
+			if err := imp.json(entry, limited); err != nil {
+				imp.failed(entry, err)
+			}
+		default:
+			imp.failed(entry, errors.New("skipped, not a Markdown or JSON file"))
+		}
+		rc.Close()
+	}
+
+	return nil
+}
+
+// zipNote imports a Markdown file of an archive. Without timestamps in its
+// front matter the note keeps the modification time of the file.
+func (imp *noteImport) zipNote(name string, f *zip.File, r io.Reader) {
+
+	data, err := io.ReadAll(io.LimitReader(r, notefile.MaxSize+1))
+	if err != nil {
+		imp.failed(name, err)
+		return
+	}
+
+	note, err := notefile.Parse(data)
+	if err != nil {
+		imp.failed(name, err)
+		return
+	}
+
+	if note.Created.IsZero() && !f.Modified.IsZero() {
+		note.Created = f.Modified
+	}
+	if note.Updated.IsZero() && !f.Modified.IsZero() {
+		note.Updated = f.Modified
+	}
+
+	imp.create(name, note)
+}
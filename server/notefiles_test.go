@@ -0,0 +1,198 @@
+package server
+
+import (
+	"NOTESBE/config"
+	"NOTESBE/notefile"
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoteFiles(t *testing.T) {
+
+	cfg := *config.Get()
+	cfg.RateLimit.Policies = nil
+	config.Set(&cfg)
+	defer config.Set(nil)
+
+	s := &server{router: mux.NewRouter(), db: mockrepo}
+	r := Router(s)
+
+	login, _ := (&utility.TokenReq{Id: 4}).CreateJwtToken()
+
+	send := func(method, path, contentType string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, body)
+		req.Header.Set("Authtoken", login.Token)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	created := time.Date(2022, 12, 24, 18, 0, 0, 0, time.UTC)
+	notes := []repository.Note{
+		{Id: 1, Note: "first", Userid: 4, Tags: "work,ideas", Createdat: created, Updatedat: created},
+		{Id: 2, Note: "second\n\n---\n\nafter a rule", Userid: 4, Createdat: created, Updatedat: created},
+		{Id: 3, Note: "shared with me", Userid: 5},
+	}
+
+	// imported collects the notes the fake database is asked to create
+	var imported []repository.Note
+	expectCreate := func(times int) {
+		mockrepo.EXPECT().CreateNote(gomock.Any()).DoAndReturn(func(note *repository.Note) error {
+			note.Id = uint64(100 + len(imported))
+			imported = append(imported, *note)
+			return nil
+		}).Times(times)
+	}
+
+	t.Run("zip round trip", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetNotesOfUser(uint64(4)).Return(notes, nil)
+
+		rec := send(http.MethodGet, "/api/notes/export?userid=4", "", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/zip", rec.Header().Get("Content-Type"))
+
+		archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Len(t, archive.File, 2, "notes shared with the user are not exported")
+
+		imported = nil
+		expectCreate(2)
+
+		rec = send(http.MethodPost, "/api/notes/import?userid=4", "application/zip", rec.Body)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		resp := ImportResp{}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		assert.Equal(t, 2, resp.Imported)
+		assert.Equal(t, "notes/1.md", resp.Results[0].File)
+
+		assert.Equal(t, "first", imported[0].Note)
+		assert.Equal(t, "work,ideas", imported[0].Tags)
+		assert.True(t, created.Equal(imported[0].Createdat))
+		assert.Equal(t, notes[1].Note, imported[1].Note)
+	})
+
+	t.Run("markdown stream round trip", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetNotesOfUser(uint64(4)).Return(notes, nil)
+
+		rec := send(http.MethodGet, "/api/notes/export?userid=4&format=md", "", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		imported = nil
+		expectCreate(2)
+
+		rec = send(http.MethodPost, "/api/notes/import?userid=4", "text/markdown", rec.Body)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, notes[1].Note, imported[1].Note)
+	})
+
+	t.Run("multipart reports every file", func(t *testing.T) {
+
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		f, _ := form.CreateFormFile("files", "trip.md")
+		f.Write([]byte("---\ntags: travel\n---\nPack bags\n"))
+		f, _ = form.CreateFormFile("files", "notes.json")
+		f.Write([]byte(`[{"note": "from json", "tags": ["a"]}, {"note": "  "}]`))
+		f, _ = form.CreateFormFile("files", "photo.jpg")
+		f.Write([]byte("not a note"))
+		form.Close()
+
+		imported = nil
+		expectCreate(2)
+
+		rec := send(http.MethodPost, "/api/notes/import?userid=4", form.FormDataContentType(), &body)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		resp := ImportResp{}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		assert.Equal(t, 2, resp.Imported)
+		assert.Equal(t, 2, resp.Failed)
+		assert.Equal(t, "notes.json[1]", resp.Results[2].File)
+		assert.Equal(t, "photo.jpg", resp.Results[3].File)
+		assert.Equal(t, "travel", imported[0].Tags)
+	})
+
+	t.Run("uploads are limited", func(t *testing.T) {
+
+		limited := cfg
+		limited.Import.MaxSize = 16
+		config.Set(&limited)
+		defer config.Set(&cfg)
+
+		rec := send(http.MethodPost, "/api/notes/import?userid=4", "application/json", bytes.NewBufferString(`[{"note": "this note is too long"}]`))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+
+	t.Run("notes are limited", func(t *testing.T) {
+
+		limited := cfg
+		limited.Import.MaxSize = 2 * notefile.MaxSize
+		config.Set(&limited)
+		defer config.Set(&cfg)
+
+		large, _ := json.Marshal([]NoteFile{{Note: strings.Repeat("a", notefile.MaxSize+1)}})
+
+		rec := send(http.MethodPost, "/api/notes/import?userid=4", "application/json", bytes.NewReader(large))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		resp := ImportResp{}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		assert.Equal(t, 0, resp.Imported)
+		assert.Equal(t, notefile.ErrTooLarge.Error(), resp.Results[0].Error)
+	})
+
+	t.Run("archives are limited", func(t *testing.T) {
+
+		// compresses to a few KiB but unpacks to more than a note may hold
+		var bomb bytes.Buffer
+		archive := zip.NewWriter(&bomb)
+		f, _ := archive.Create("notes.json")
+		f.Write([]byte(`[{"note": "`))
+		f.Write(bytes.Repeat([]byte("a"), notefile.MaxSize))
+		f.Write([]byte(`"}]`))
+		archive.Close()
+
+		rec := send(http.MethodPost, "/api/notes/import?userid=4", "application/zip", &bomb)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		resp := ImportResp{}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		assert.Equal(t, 0, resp.Imported)
+		assert.Equal(t, "notes.json", resp.Results[0].File)
+		assert.Equal(t, errFileTooLarge.Error(), resp.Results[0].Error)
+
+		var many bytes.Buffer
+		archive = zip.NewWriter(&many)
+		for i := 0; i <= maxArchiveFiles; i++ {
+			archive.Create(fmt.Sprintf("%d.md", i))
+		}
+		archive.Close()
+
+		rec = send(http.MethodPost, "/api/notes/import?userid=4", "application/zip", &many)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "more than 10000 files")
+	})
+}
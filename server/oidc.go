@@ -0,0 +1,281 @@
+package server
+
+import (
+	"NOTESBE/config"
+	"NOTESBE/oidc"
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+const oidcStateCookie = "notes_oidc"
+
+// oidcProvider discovers the configured provider on first use and again
+// whenever the oidc settings change.
+type oidcProvider struct {
+	mu       sync.Mutex
+	source   string
+	provider *oidc.Provider
+}
+
+func (p *oidcProvider) get(r *http.Request, cfg config.OIDCConfig) (*oidc.Provider, error) {
+
+	source := fmt.Sprint(cfg)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.provider != nil && p.source == source {
+		return p.provider, nil
+	}
+
+	provider, err := oidc.Discover(r.Context(), cfg.Issuer, oidc.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURL,
+		Scopes:       cfg.Scopes,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	p.source = source
+	p.provider = provider
+
+	return provider, nil
+}
+
+// OidcLogin redirects to the OpenID provider. The state, nonce and PKCE
+// verifier travel in a signed cookie scoped to the callback.
+func (s *server) OidcLogin(w http.ResponseWriter, r *http.Request) {
+
+	cfg := config.Get().OIDC
+	if !cfg.Enabled {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "OpenID Connect login is not enabled"})
+		return
+	}
+
+	provider, err := s.oidc.get(r, cfg)
+	if err != nil {
+		utility.Errorln("Error in OpenID provider discovery:", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(map[string]string{"error": "OpenID provider is unavailable"})
+		return
+	}
+
+	values := make([]string, 3)
+	for i := range values {
+		values[i], err = oidc.NewVerifier()
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	cookie, err := utility.CreateOidcState(state, nonce, verifier)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    cookie,
+		Path:     "/api/auth/oidc",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, provider.AuthURL(state, nonce, verifier), http.StatusFound)
+}
+
+// OidcCallback completes the login started by OidcLogin and answers like
+// Login. The provider is responsible for any second factor.
+func (s *server) OidcCallback(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	cfg := config.Get().OIDC
+	if !cfg.Enabled {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "OpenID Connect login is not enabled"})
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": query.Get("error") + ": " + query.Get("error_description")})
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Missing login state"})
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/auth/oidc", MaxAge: -1})
+
+	state, nonce, verifier, err := utility.ParseOidcState(cookie.Value)
+	if err != nil || state != query.Get("state") {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid or expired login state"})
+		return
+	}
+
+	provider, err := s.oidc.get(r, cfg)
+	if err != nil {
+		utility.Errorln("Error in OpenID provider discovery:", err)
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(map[string]string{"error": "OpenID provider is unavailable"})
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), query.Get("code"), verifier, nonce)
+	if err != nil {
+		utility.Errorln("Error in OpenID login:", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "OpenID login failed"})
+		return
+	}
+
+	user, err := s.oidcUser(cfg, claims)
+	if errors.Is(err, errOidcNoAccount) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	if user.Disabled {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "User is disabled"})
+		return
+	}
+
+	tokenReq := &utility.TokenReq{
+		Id:         user.Id,
+		Generation: user.Tokengeneration,
+	}
+
+	token, err := tokenReq.CreateJwtToken()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	resp := &LoginResp{
+		Token:  token.Token,
+		UserId: user.Id,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+var errOidcNoAccount = errors.New("No account is linked to this identity")
+
+// oidcUser returns the user linked to the identity in claims. An unlinked
+// identity with a verified email is linked to the user who verified the
+// same email; usernames are never trusted for linking, as anyone can pick
+// one. Other identities get a new user with autoprovision, named by the
+// username claim unless that name is taken.
+func (s *server) oidcUser(cfg config.OIDCConfig, claims *oidc.Claims) (*repository.User, error) {
+
+	user, err := s.db.GetUserByOidc(claims.Issuer, claims.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		return nil, err
+	}
+
+	if claims.EmailVerified && claims.Email != "" {
+		user, err = s.db.GetUserByEmail(claims.Email)
+		if err == nil {
+			if user.Oidcsubject != "" {
+				return nil, errOidcNoAccount
+			}
+			if err := s.db.LinkOidc(user.Id, claims.Issuer, claims.Subject); err != nil {
+				return nil, err
+			}
+			return user, nil
+		}
+		if !errors.Is(err, repository.ErrUserNotFound) {
+			return nil, err
+		}
+	}
+
+	var username string
+	switch cfg.UsernameClaim {
+	case "email":
+		if claims.EmailVerified {
+			username = claims.Email
+		}
+	case "preferred_username":
+		username = claims.PreferredUsername
+	case "sub":
+		username = claims.Subject
+	}
+
+	if username == "" {
+		return nil, errOidcNoAccount
+	}
+
+	if !cfg.AutoProvision {
+		return nil, errOidcNoAccount
+	}
+
+	_, err = s.db.GetUserByUsername(username)
+	if err == nil {
+		return nil, errOidcNoAccount
+	}
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		return nil, err
+	}
+
+	// provisioned users can only log in through the provider
+	password, err := oidc.NewVerifier()
+	if err != nil {
+		return nil, err
+	}
+
+	user = &repository.User{
+		Username:     username,
+		Password:     password,
+		Oidcissuer:   claims.Issuer,
+		Oidcsubject:  claims.Subject,
+		Passwordless: true,
+	}
+	if claims.EmailVerified {
+		user.Email = claims.Email
+		user.Emailverified = true
+	}
+
+	if err := s.db.CreateUser(user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
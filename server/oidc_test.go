@@ -0,0 +1,189 @@
+package server
+
+import (
+	"NOTESBE/config"
+	"NOTESBE/oidc/oidctest"
+	"NOTESBE/repository"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOidcLogin(t *testing.T) {
+
+	provider := oidctest.NewProvider("notes", "s3cret")
+	defer provider.Close()
+
+	cfg := *config.Get()
+	cfg.RateLimit.Policies = nil
+	cfg.OIDC = config.OIDCConfig{
+		Enabled:       true,
+		Issuer:        provider.URL,
+		ClientID:      "notes",
+		ClientSecret:  "s3cret",
+		RedirectURL:   "http://notes.test/api/auth/oidc/callback",
+		Scopes:        []string{"openid", "email"},
+		UsernameClaim: "email",
+	}
+	config.Set(&cfg)
+	defer config.Set(nil)
+
+	s := &server{router: mux.NewRouter(), db: mockrepo}
+	r := Router(s)
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	// login runs the flow up to the callback and returns its response
+	login := func(t *testing.T, tamper func(callback *url.URL)) *httptest.ResponseRecorder {
+
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login", nil))
+		assert.Equal(t, http.StatusFound, rec.Code)
+
+		authorize, _ := url.Parse(rec.Header().Get("Location"))
+		assert.Equal(t, "S256", authorize.Query().Get("code_challenge_method"))
+		cookies := rec.Result().Cookies()
+
+		resp, err := noRedirect.Get(authorize.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+		callback, _ := url.Parse(resp.Header.Get("Location"))
+		if tamper != nil {
+			tamper(callback)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		rec = httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	t.Run("linked user", func(t *testing.T) {
+
+		provider.SetClaims(map[string]interface{}{"sub": "u-1", "email": "alice@example.com", "email_verified": true})
+		mockrepo.EXPECT().GetUserByOidc(provider.URL, "u-1").Return(&repository.User{Id: 5, Username: "alice@example.com"}, nil)
+
+		rec := login(t, nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		resp := LoginResp{}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		assert.Equal(t, uint64(5), resp.UserId)
+		assert.NotEmpty(t, resp.Token)
+	})
+
+	t.Run("verified email links an existing user", func(t *testing.T) {
+
+		provider.SetClaims(map[string]interface{}{"sub": "u-2", "email": "bob@example.com", "email_verified": true})
+		mockrepo.EXPECT().GetUserByOidc(provider.URL, "u-2").Return(nil, repository.ErrUserNotFound)
+		mockrepo.EXPECT().GetUserByEmail("bob@example.com").Return(&repository.User{Id: 6, Username: "bob", Email: "bob@example.com", Emailverified: true}, nil)
+		mockrepo.EXPECT().LinkOidc(uint64(6), provider.URL, "u-2").Return(nil)
+
+		assert.Equal(t, http.StatusOK, login(t, nil).Code)
+	})
+
+	t.Run("username equal to the email is not linked", func(t *testing.T) {
+
+		provisioning := cfg
+		provisioning.OIDC.AutoProvision = true
+		config.Set(&provisioning)
+		defer config.Set(&cfg)
+
+		// anyone can sign up or rename themselves to the victim's email
+		provider.SetClaims(map[string]interface{}{"sub": "u-5", "email": "victim@example.com", "email_verified": true})
+		mockrepo.EXPECT().GetUserByOidc(provider.URL, "u-5").Return(nil, repository.ErrUserNotFound)
+		mockrepo.EXPECT().GetUserByEmail("victim@example.com").Return(nil, repository.ErrUserNotFound)
+		mockrepo.EXPECT().GetUserByUsername("victim@example.com").Return(&repository.User{Id: 8, Username: "victim@example.com"}, nil)
+
+		assert.Equal(t, http.StatusForbidden, login(t, nil).Code)
+	})
+
+	t.Run("unverified email is not trusted", func(t *testing.T) {
+
+		provider.SetClaims(map[string]interface{}{"sub": "u-3", "email": "bob@example.com", "email_verified": false})
+		mockrepo.EXPECT().GetUserByOidc(provider.URL, "u-3").Return(nil, repository.ErrUserNotFound)
+
+		assert.Equal(t, http.StatusForbidden, login(t, nil).Code)
+	})
+
+	t.Run("unknown identity is provisioned when enabled", func(t *testing.T) {
+
+		provider.SetClaims(map[string]interface{}{"sub": "u-4", "email": "carol@example.com", "email_verified": true})
+		mockrepo.EXPECT().GetUserByOidc(provider.URL, "u-4").Return(nil, repository.ErrUserNotFound).Times(2)
+		mockrepo.EXPECT().GetUserByEmail("carol@example.com").Return(nil, repository.ErrUserNotFound).Times(2)
+		mockrepo.EXPECT().GetUserByUsername("carol@example.com").Return(nil, repository.ErrUserNotFound)
+
+		assert.Equal(t, http.StatusForbidden, login(t, nil).Code)
+
+		provisioning := cfg
+		provisioning.OIDC.AutoProvision = true
+		config.Set(&provisioning)
+		defer config.Set(&cfg)
+
+		mockrepo.EXPECT().CreateUser(gomock.Any()).DoAndReturn(func(user *repository.User) error {
+			assert.Equal(t, "carol@example.com", user.Username)
+			assert.Equal(t, "u-4", user.Oidcsubject)
+			assert.Equal(t, "carol@example.com", user.Email)
+			assert.True(t, user.Emailverified)
+			assert.NotEmpty(t, user.Password)
+			assert.True(t, user.Passwordless)
+			user.Id = 7
+			return nil
+		})
+
+		assert.Equal(t, http.StatusOK, login(t, nil).Code)
+	})
+
+	t.Run("disabled user", func(t *testing.T) {
+
+		provider.SetClaims(map[string]interface{}{"sub": "u-1"})
+		mockrepo.EXPECT().GetUserByOidc(provider.URL, "u-1").Return(&repository.User{Id: 5, Disabled: true}, nil)
+
+		assert.Equal(t, http.StatusForbidden, login(t, nil).Code)
+	})
+
+	t.Run("state and code are checked", func(t *testing.T) {
+
+		rec := login(t, func(callback *url.URL) {
+			query := callback.Query()
+			query.Set("state", "forged")
+			callback.RawQuery = query.Encode()
+		})
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		rec = login(t, func(callback *url.URL) {
+			query := callback.Query()
+			query.Set("code", "forged")
+			callback.RawQuery = query.Encode()
+		})
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+
+		disabled := cfg
+		disabled.OIDC.Enabled = false
+		config.Set(&disabled)
+		defer config.Set(&cfg)
+
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
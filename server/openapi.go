@@ -0,0 +1,823 @@
+package server
+
+import (
+	"NOTESBE/config"
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// The Redoc bundle served by Docs is embedded so that the docs page loads no
+// third-party script. docs/redoc.lock pins its version and checksum, go
+// generate fetches it after the version changes.
+//
+//go:generate go run redoc_fetch.go
+
+//go:embed docs
+var docsFiles embed.FS
+
+// redocLock returns the Redoc version and SHA-256 pinned in docs/redoc.lock.
+func redocLock() (version, sum string) {
+
+	lock, _ := docsFiles.ReadFile("docs/redoc.lock")
+
+	for _, line := range strings.Split(string(lock), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "version":
+			version = fields[1]
+		case "sha256":
+			sum = fields[1]
+		}
+	}
+
+	return version, sum
+}
+
+type apiParam struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+// apiOperation documents a single method + path pair registered in Router.
+// Request and Response hold zero values of the types sent over the wire and
+// are turned into JSON schemas by reflection.
+type apiOperation struct {
+	Summary string
+	Tag     string
+	Auth    bool
+	// Scope is the personal access token scope the route requires, empty
+	// when only login tokens are accepted.
+	Scope       string
+	Admin       bool
+	Query       []apiParam
+	Request     interface{}
+	Response    interface{}
+	ContentType string
+	// Alternatives are further media types of the response, chosen with
+	// the Accept header.
+	Alternatives []string
+	Status       int
+}
+
+// noteAlternatives are the media types notes are sent as besides JSON.
+var noteAlternatives = []string{mediaMarkdown, mediaText, mediaHTML, mediaPDF}
+
+var renderParam = apiParam{Name: "render", Description: "json, markdown, text, html or pdf, overrides the Accept header"}
+
+var userIdParam = apiParam{Name: "userid", Description: "Id of the authenticated user", Required: true}
+
+// apiDocs must contain an entry for every route registered in Router,
+// TestOpenAPIDocumentsAllRoutes fails otherwise.
+var apiDocs = map[string]apiOperation{
+	"GET /ping": {
+		Summary:     "Health check",
+		Tag:         "system",
+		ContentType: "text/plain",
+		Status:      http.StatusOK,
+	},
+	"GET /api/openapi.json": {
+		Summary: "OpenAPI description of this API",
+		Tag:     "system",
+		Status:  http.StatusOK,
+	},
+	"GET /api/docs": {
+		Summary:     "Interactive API documentation",
+		Tag:         "system",
+		ContentType: "text/html",
+		Status:      http.StatusOK,
+	},
+	"GET /api/docs/redoc.standalone.js": {
+		Summary:     "Redoc bundle used by the documentation page",
+		Tag:         "system",
+		ContentType: "application/javascript",
+		Status:      http.StatusOK,
+	},
+	"GET /.well-known/jwks.json": {
+		Summary:  "Public keys verifying tokens (JSON Web Key Set)",
+		Tag:      "system",
+		Response: JWKSResp{},
+		Status:   http.StatusOK,
+	},
+	"POST /api/auth/signup": {
+		Summary:     "Create a user account",
+		Tag:         "auth",
+		Request:     UserReq{},
+		ContentType: "text/plain",
+		Status:      http.StatusCreated,
+	},
+	"POST /api/auth/login": {
+		Summary:  "Log in and obtain a token. Repeated failures are answered with 429 and Retry-After",
+		Tag:      "auth",
+		Request:  UserReq{},
+		Response: LoginResp{},
+		Status:   http.StatusOK,
+	},
+	"POST /api/auth/2fa/setup": {
+		Summary:  "Start two-factor enrollment: returns a TOTP secret, otpauth URI and QR code PNG",
+		Tag:      "auth",
+		Auth:     true,
+		Query:    []apiParam{userIdParam},
+		Response: TwoFactorSetupResp{},
+		Status:   http.StatusOK,
+	},
+	"POST /api/auth/2fa/confirm": {
+		Summary:  "Enable two-factor authentication with a first code and get recovery codes",
+		Tag:      "auth",
+		Auth:     true,
+		Query:    []apiParam{userIdParam},
+		Request:  TwoFactorCodeReq{},
+		Response: RecoveryCodesResp{},
+		Status:   http.StatusOK,
+	},
+	"POST /api/auth/2fa/verify": {
+		Summary:  "Second login step: exchange the login challenge and a TOTP or recovery code for a token",
+		Tag:      "auth",
+		Request:  TwoFactorVerifyReq{},
+		Response: LoginResp{},
+		Status:   http.StatusOK,
+	},
+	"POST /api/auth/password/forgot": {
+		Summary:     "Mail a password reset link to a verified email address",
+		Tag:         "auth",
+		Request:     ForgotPasswordReq{},
+		ContentType: "text/plain",
+		Status:      http.StatusAccepted,
+	},
+	"POST /api/auth/password/reset": {
+		Summary:     "Set a new password with the token from a reset link",
+		Tag:         "auth",
+		Request:     ResetPasswordReq{},
+		ContentType: "text/plain",
+		Status:      http.StatusOK,
+	},
+	"POST /api/auth/password/change": {
+		Summary:     "Change the password of the authenticated user",
+		Tag:         "auth",
+		Auth:        true,
+		Query:       []apiParam{userIdParam},
+		Request:     ChangePasswordReq{},
+		ContentType: "text/plain",
+		Status:      http.StatusOK,
+	},
+	"POST /api/auth/email": {
+		Summary:     "Change the email address and mail a verification link to it",
+		Tag:         "auth",
+		Auth:        true,
+		Query:       []apiParam{userIdParam},
+		Request:     EmailReq{},
+		ContentType: "text/plain",
+		Status:      http.StatusAccepted,
+	},
+	"POST /api/auth/email/verify": {
+		Summary:     "Verify an email address with the token from a verification link",
+		Tag:         "auth",
+		Request:     VerifyEmailReq{},
+		ContentType: "text/plain",
+		Status:      http.StatusOK,
+	},
+	"GET /api/auth/oidc/login": {
+		Summary: "Start an OpenID Connect login: redirects to the identity provider",
+		Tag:     "auth",
+		Status:  http.StatusFound,
+	},
+	"GET /api/auth/oidc/callback": {
+		Summary: "Complete an OpenID Connect login and obtain a token",
+		Tag:     "auth",
+		Query: []apiParam{
+			{Name: "code", Description: "Authorization code issued by the provider", Required: true},
+			{Name: "state", Description: "State sent to the provider by the login redirect", Required: true},
+		},
+		Response: LoginResp{},
+		Status:   http.StatusOK,
+	},
+	"GET /api/me": {
+		Summary:  "Profile and settings of the authenticated user",
+		Tag:      "profile",
+		Auth:     true,
+		Query:    []apiParam{userIdParam},
+		Response: ProfileResp{},
+		Status:   http.StatusOK,
+	},
+	"PATCH /api/me": {
+		Summary:  "Change the username, profile or settings; omitted fields are kept",
+		Tag:      "profile",
+		Auth:     true,
+		Query:    []apiParam{userIdParam},
+		Request:  ProfileReq{},
+		Response: ProfileResp{},
+		Status:   http.StatusOK,
+	},
+	"DELETE /api/me": {
+		Summary:     "Delete the account with its notes, shares and tokens",
+		Tag:         "profile",
+		Auth:        true,
+		Query:       []apiParam{userIdParam},
+		Request:     DeleteAccountReq{},
+		ContentType: "text/plain",
+		Status:      http.StatusOK,
+	},
+	"POST /api/me/export": {
+		Summary:  "Start building an archive of all personal data; poll the Location for it",
+		Tag:      "profile",
+		Auth:     true,
+		Query:    []apiParam{userIdParam},
+		Response: ExportResp{},
+		Status:   http.StatusAccepted,
+	},
+	"GET /api/me/export/{id}": {
+		Summary:     "Download the archive (application/zip) once built, 202 with its status before",
+		Tag:         "profile",
+		Auth:        true,
+		Query:       []apiParam{userIdParam},
+		ContentType: "application/zip",
+		Status:      http.StatusOK,
+	},
+	"POST /api/notes": {
+		Summary: "Create a note, or with type checklist a checklist with its first items",
+		Tag:     "notes",
+		Auth:    true,
+		Scope:   ScopeNotesWrite,
+		Query:   []apiParam{userIdParam},
+		Request: NoteReq{},
+		Status:  http.StatusCreated,
+	},
+	"GET /api/notes": {
+		Summary:      "List owned and shared notes as JSON, Markdown, plain text, HTML or PDF by the Accept header; checklists carry their progress",
+		Tag:          "notes",
+		Auth:         true,
+		Scope:        ScopeNotesRead,
+		Query:        []apiParam{userIdParam, renderParam},
+		Response:     []NoteResp{},
+		Alternatives: noteAlternatives,
+		Status:       http.StatusOK,
+	},
+	"GET /api/notes/export": {
+		Summary:     "Download all owned notes as a zip of Markdown files (default), a Markdown stream (format=md) or JSON (format=json)",
+		Tag:         "notes",
+		Auth:        true,
+		Scope:       ScopeNotesRead,
+		Query:       []apiParam{userIdParam, {Name: "format", Description: "zip, md or json"}},
+		ContentType: "application/zip",
+		Status:      http.StatusOK,
+	},
+	"POST /api/notes/import": {
+		Summary:  "Create notes from a zip, Markdown or JSON upload, or from the files of a multipart form",
+		Tag:      "notes",
+		Auth:     true,
+		Scope:    ScopeNotesWrite,
+		Query:    []apiParam{userIdParam, {Name: "format", Description: "zip, md or json, taken from the Content-Type when omitted"}},
+		Request:  []NoteFile{},
+		Response: ImportResp{},
+		Status:   http.StatusOK,
+	},
+	"POST /api/notes/imports": {
+		Summary:  "Start importing an Evernote export (source=enex) or a Google Keep Takeout archive (source=keep); poll the Location for progress",
+		Tag:      "notes",
+		Auth:     true,
+		Scope:    ScopeNotesWrite,
+		Query:    []apiParam{userIdParam, {Name: "source", Description: "enex or keep, taken from the Content-Type when omitted"}},
+		Response: ImportJobResp{},
+		Status:   http.StatusAccepted,
+	},
+	"GET /api/notes/imports/{id}": {
+		Summary:  "Progress of an Evernote or Keep import",
+		Tag:      "notes",
+		Auth:     true,
+		Scope:    ScopeNotesWrite,
+		Query:    []apiParam{userIdParam},
+		Response: ImportJobResp{},
+		Status:   http.StatusOK,
+	},
+	"GET /api/notes/{id}": {
+		Summary:      "Get a note as JSON, Markdown with front matter, plain text, sanitized HTML or PDF by the Accept header; checklists come with their items, shown as a task list outside JSON",
+		Tag:          "notes",
+		Auth:         true,
+		Scope:        ScopeNotesRead,
+		Query:        []apiParam{userIdParam, renderParam},
+		Response:     NoteResp{},
+		Alternatives: noteAlternatives,
+		Status:       http.StatusOK,
+	},
+	"PUT /api/notes/{id}": {
+		Summary: "Update the text of a note, the description of a checklist",
+		Tag:     "notes",
+		Auth:    true,
+		Scope:   ScopeNotesWrite,
+		Query:   []apiParam{userIdParam},
+		Request: NoteReq{},
+		Status:  http.StatusOK,
+	},
+	"DELETE /api/notes/{id}": {
+		Summary: "Delete a note",
+		Tag:     "notes",
+		Auth:    true,
+		Scope:   ScopeNotesWrite,
+		Query:   []apiParam{userIdParam},
+		Status:  http.StatusOK,
+	},
+	"POST /api/notes/{id}/share": {
+		Summary: "Share an owned note with another user; the sender is the authenticated user",
+		Tag:     "sharing",
+		Auth:    true,
+		Scope:   ScopeShare,
+		Query:   []apiParam{userIdParam},
+		Request: ShareNoteReq{},
+		Status:  http.StatusOK,
+	},
+	"POST /api/notes/{id}/attachments": {
+		Summary:  "Attach the files of a multipart form to an owned note; the type is sniffed from the content, 413 over attachments.maxsize or the quota",
+		Tag:      "attachments",
+		Auth:     true,
+		Scope:    ScopeNotesWrite,
+		Query:    []apiParam{userIdParam},
+		Response: []AttachmentResp{},
+		Status:   http.StatusCreated,
+	},
+	"GET /api/notes/{id}/attachments": {
+		Summary:  "List the attachments of an owned or shared note",
+		Tag:      "attachments",
+		Auth:     true,
+		Scope:    ScopeNotesRead,
+		Query:    []apiParam{userIdParam},
+		Response: []AttachmentResp{},
+		Status:   http.StatusOK,
+	},
+	"GET /api/notes/{id}/attachments/{attachmentid}": {
+		Summary:     "Download an attachment of an owned or shared note; images, PDFs and plain text are sent inline, other types as downloads",
+		Tag:         "attachments",
+		Auth:        true,
+		Scope:       ScopeNotesRead,
+		Query:       []apiParam{userIdParam},
+		ContentType: "application/octet-stream",
+		Status:      http.StatusOK,
+	},
+	"DELETE /api/notes/{id}/attachments/{attachmentid}": {
+		Summary: "Delete an attachment of an owned note",
+		Tag:     "attachments",
+		Auth:    true,
+		Scope:   ScopeNotesWrite,
+		Query:   []apiParam{userIdParam},
+		Status:  http.StatusOK,
+	},
+	"GET /api/notes/{id}/items": {
+		Summary:  "List the items of an owned or shared checklist in order, 409 for other notes",
+		Tag:      "checklists",
+		Auth:     true,
+		Scope:    ScopeNotesRead,
+		Query:    []apiParam{userIdParam},
+		Response: []ChecklistItemResp{},
+		Status:   http.StatusOK,
+	},
+	"POST /api/notes/{id}/items": {
+		Summary:  "Add an item to an owned checklist, at the end unless a position is given",
+		Tag:      "checklists",
+		Auth:     true,
+		Scope:    ScopeNotesWrite,
+		Query:    []apiParam{userIdParam},
+		Request:  ChecklistItemReq{},
+		Response: ChecklistItemResp{},
+		Status:   http.StatusCreated,
+	},
+	"PATCH /api/notes/{id}/items/{itemid}": {
+		Summary:  "Check, uncheck, edit or move an item of an owned checklist; only the fields sent change",
+		Tag:      "checklists",
+		Auth:     true,
+		Scope:    ScopeNotesWrite,
+		Query:    []apiParam{userIdParam},
+		Request:  ChecklistItemReq{},
+		Response: ChecklistItemResp{},
+		Status:   http.StatusOK,
+	},
+	"DELETE /api/notes/{id}/items/{itemid}": {
+		Summary: "Remove an item from an owned checklist",
+		Tag:     "checklists",
+		Auth:    true,
+		Scope:   ScopeNotesWrite,
+		Query:   []apiParam{userIdParam},
+		Status:  http.StatusOK,
+	},
+	"GET /api/attachments/{id}/thumb": {
+		Summary:     "Thumbnail of an image attachment of an owned or shared note, a JPEG or PNG fitting into a square of the size",
+		Tag:         "attachments",
+		Auth:        true,
+		Scope:       ScopeNotesRead,
+		Query:       []apiParam{userIdParam, {Name: "size", Description: "128, 256 (default), 512 or 1024 pixels"}},
+		ContentType: "image/jpeg",
+		Status:      http.StatusOK,
+	},
+	"POST /api/tokens": {
+		Summary:  "Create a personal access token; the token is only returned once",
+		Tag:      "tokens",
+		Auth:     true,
+		Query:    []apiParam{userIdParam},
+		Request:  AccessTokenReq{},
+		Response: AccessTokenResp{},
+		Status:   http.StatusCreated,
+	},
+	"GET /api/tokens": {
+		Summary:  "List personal access tokens",
+		Tag:      "tokens",
+		Auth:     true,
+		Query:    []apiParam{userIdParam},
+		Response: []AccessTokenResp{},
+		Status:   http.StatusOK,
+	},
+	"DELETE /api/tokens/{id}": {
+		Summary:     "Revoke a personal access token",
+		Tag:         "tokens",
+		Auth:        true,
+		Query:       []apiParam{userIdParam},
+		ContentType: "text/plain",
+		Status:      http.StatusOK,
+	},
+	"GET /api/admin/config": {
+		Summary:  "Runtime configuration and the result of the last reload",
+		Tag:      "admin",
+		Admin:    true,
+		Response: ConfigStatusResp{},
+		Status:   http.StatusOK,
+	},
+	"POST /api/admin/config/reload": {
+		Summary:  "Reload the configuration file and environment",
+		Tag:      "admin",
+		Admin:    true,
+		Response: config.ReloadStatus{},
+		Status:   http.StatusOK,
+	},
+	"GET /api/admin/lockouts": {
+		Summary:  "Usernames and IPs currently blocked after failed logins",
+		Tag:      "admin",
+		Admin:    true,
+		Response: []LockoutResp{},
+		Status:   http.StatusOK,
+	},
+	"POST /api/admin/lockouts/unlock": {
+		Summary:     "Forget the failed logins of a username or IP",
+		Tag:         "admin",
+		Admin:       true,
+		Request:     UnlockReq{},
+		ContentType: "text/plain",
+		Status:      http.StatusOK,
+	},
+	"GET /api/admin/authevents": {
+		Summary:  "Latest failed logins and lockout changes of a username",
+		Tag:      "admin",
+		Admin:    true,
+		Query:    []apiParam{{Name: "username", Required: true}},
+		Response: []repository.Authevent{},
+		Status:   http.StatusOK,
+	},
+	"GET /api/search": {
+		Summary: "Full text search over owned and shared notes, their checklist items and the text of their attachments; matchedin tells whether the note or an attachment matched",
+		Tag:     "search",
+		Auth:    true,
+		Scope:   ScopeSearch,
+		Query: []apiParam{
+			userIdParam,
+			{Name: "query", Description: "Postgres tsquery expression", Required: true},
+			renderParam,
+		},
+		Response:     []NoteResp{},
+		Alternatives: noteAlternatives,
+		Status:       http.StatusOK,
+	},
+}
+
+// BuildOpenAPI walks the router and returns an OpenAPI 3.1 document for every
+// registered route. It fails if a route has no entry in apiDocs.
+func BuildOpenAPI(r *mux.Router) (map[string]interface{}, error) {
+
+	paths := map[string]map[string]interface{}{}
+	components := map[string]interface{}{}
+	undocumented := []string{}
+
+	err := r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		if route.GetHandler() == nil {
+			return nil
+		}
+
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			undocumented = append(undocumented, "* "+path)
+			return nil
+		}
+
+		for _, method := range methods {
+			op, found := apiDocs[method+" "+path]
+			if !found {
+				undocumented = append(undocumented, method+" "+path)
+				continue
+			}
+
+			if paths[path] == nil {
+				paths[path] = map[string]interface{}{}
+			}
+			paths[path][strings.ToLower(method)] = op.build(path, components)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(undocumented) > 0 {
+		sort.Strings(undocumented)
+		return nil, fmt.Errorf("routes missing from apiDocs: %s", strings.Join(undocumented, ", "))
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":   "Notes API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": components,
+			"securitySchemes": map[string]interface{}{
+				"Authtoken": map[string]interface{}{
+					"type": "apiKey",
+					"in":   "header",
+					"name": "Authtoken",
+				},
+				"Admintoken": map[string]interface{}{
+					"type": "apiKey",
+					"in":   "header",
+					"name": "Admintoken",
+				},
+			},
+		},
+	}
+
+	return doc, nil
+}
+
+func (op apiOperation) build(path string, components map[string]interface{}) map[string]interface{} {
+
+	out := map[string]interface{}{
+		"summary": op.Summary,
+		"tags":    []string{op.Tag},
+	}
+
+	params := []interface{}{}
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			params = append(params, map[string]interface{}{
+				"name":     strings.Trim(segment, "{}"),
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "integer", "format": "uint64"},
+			})
+		}
+	}
+	for _, q := range op.Query {
+		params = append(params, map[string]interface{}{
+			"name":        q.Name,
+			"in":          "query",
+			"description": q.Description,
+			"required":    q.Required,
+			"schema":      map[string]interface{}{"type": "string"},
+		})
+	}
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+
+	if op.Auth {
+		scopes := []string{}
+		if op.Scope != "" {
+			scopes = append(scopes, op.Scope)
+		}
+		out["security"] = []interface{}{map[string]interface{}{"Authtoken": scopes}}
+	}
+	if op.Admin {
+		out["security"] = []interface{}{map[string]interface{}{"Admintoken": []string{}}}
+	}
+
+	if op.Request != nil {
+		out["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": schemaFor(reflect.TypeOf(op.Request), components),
+				},
+			},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	if op.Response != nil {
+		success["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": schemaFor(reflect.TypeOf(op.Response), components),
+			},
+		}
+	} else if op.ContentType != "" {
+		success["content"] = map[string]interface{}{
+			op.ContentType: map[string]interface{}{
+				"schema": map[string]interface{}{"type": "string"},
+			},
+		}
+	}
+
+	if content, ok := success["content"].(map[string]interface{}); ok {
+		for _, mediaType := range op.Alternatives {
+			content[mediaType] = map[string]interface{}{
+				"schema": map[string]interface{}{"type": "string"},
+			}
+		}
+	}
+
+	errorResp := map[string]interface{}{
+		"description": "Error",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"},
+			},
+		},
+	}
+	components["Error"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"error": map[string]interface{}{"type": "string"},
+		},
+	}
+
+	responses := map[string]interface{}{
+		fmt.Sprint(status): success,
+		"400":              errorResp,
+		"500":              errorResp,
+	}
+	if len(op.Alternatives) > 0 {
+		responses["406"] = errorResp
+	}
+	if op.Auth || op.Admin {
+		responses["401"] = map[string]interface{}{"description": "Unauthorized"}
+	}
+	if op.Scope != "" {
+		responses["403"] = map[string]interface{}{"description": "Access token lacks the scope"}
+	}
+	out["responses"] = responses
+
+	return out
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor converts a Go type into a JSON schema following encoding/json
+// rules. Named structs are registered in components and referenced.
+func schemaFor(t reflect.Type, components map[string]interface{}) map[string]interface{} {
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem(), components)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem(), components)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, components)
+		}
+		if _, found := components[t.Name()]; !found {
+			// placeholder first so recursive types terminate
+			components[t.Name()] = map[string]interface{}{}
+			components[t.Name()] = structSchema(t, components)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+
+	return map[string]interface{}{}
+}
+
+func structSchema(t reflect.Type, components map[string]interface{}) map[string]interface{} {
+
+	properties := map[string]interface{}{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if tagName := strings.Split(tag, ",")[0]; tagName != "" {
+			name = tagName
+		}
+
+		properties[name] = schemaFor(field.Type, components)
+	}
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+}
+
+func (s *server) OpenAPI(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	doc, err := BuildOpenAPI(s.router)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(doc)
+}
+
+// JWKS publishes the public keys verifying tokens so that other services do
+// not need the signing secret.
+func JWKS(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	set, err := utility.JWKS()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(set)
+}
+
+func Docs(w http.ResponseWriter, r *http.Request) {
+
+	page := "docs/index.html"
+	if _, err := docsFiles.Open("docs/redoc.standalone.js"); err != nil {
+		page = "docs/missing.html"
+	}
+
+	data, _ := docsFiles.ReadFile(page)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(data)
+}
+
+// DocsBundle serves the embedded Redoc bundle.
+func DocsBundle(w http.ResponseWriter, r *http.Request) {
+
+	data, err := docsFiles.ReadFile("docs/redoc.standalone.js")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	version, _ := redocLock()
+	w.Header().Set("ETag", `"redoc-`+version+`"`)
+	w.Write(data)
+}
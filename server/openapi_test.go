@@ -0,0 +1,99 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAPIDocumentsAllRoutes(t *testing.T) {
+
+	s := &server{router: mux.NewRouter(), db: mockrepo}
+	r := Router(s)
+
+	doc, err := BuildOpenAPI(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := doc["paths"].(map[string]map[string]interface{})
+
+	err = r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		if route.GetHandler() == nil {
+			return nil
+		}
+		path, _ := route.GetPathTemplate()
+		methods, _ := route.GetMethods()
+		for _, method := range methods {
+			_, found := paths[path][strings.ToLower(method)]
+			assert.True(t, found, "undocumented route %s %s", method, path)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestOpenAPIRejectsUndocumentedRoute(t *testing.T) {
+
+	s := &server{router: mux.NewRouter(), db: mockrepo}
+	r := Router(s)
+	r.HandleFunc("/api/undocumented", Ping).Methods("GET")
+
+	_, err := BuildOpenAPI(r)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "GET /api/undocumented")
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+
+	s := &server{router: mux.NewRouter(), db: mockrepo}
+	r := Router(s)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+	rec := httptest.NewRecorder()
+
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var doc map[string]interface{}
+	err := json.NewDecoder(rec.Body).Decode(&doc)
+	assert.NoError(t, err)
+	assert.Equal(t, "3.1.0", doc["openapi"])
+
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	assert.Contains(t, schemas, "NoteResp")
+	assert.Contains(t, schemas, "LoginResp")
+}
+
+func TestDocsLoadNoThirdPartyScript(t *testing.T) {
+
+	r := Router(&server{router: mux.NewRouter(), db: mockrepo})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/docs", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "<script src=\"http")
+
+	assert.Contains(t, rec.Body.String(), `<script src="/api/docs/redoc.standalone.js">`, "the embedded UI is served")
+
+	// the bundle is committed, run go generate ./server after changing
+	// docs/redoc.lock
+	version, sum := redocLock()
+	assert.NotEmpty(t, version)
+	assert.Len(t, sum, 64, "docs/redoc.lock pins the checksum of the bundle")
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/docs/redoc.standalone.js", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"redoc-`+version+`"`, rec.Header().Get("ETag"))
+
+	digest := sha256.Sum256(rec.Body.Bytes())
+	assert.Equal(t, sum, hex.EncodeToString(digest[:]), "the bundle is the pinned release")
+}
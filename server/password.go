@@ -0,0 +1,360 @@
+package server
+
+import (
+	"NOTESBE/config"
+	"NOTESBE/mailer"
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	resetTokenLifetime  = time.Hour
+	verifyTokenLifetime = 24 * time.Hour
+
+	// mailTimeout bounds the delivery of a single mail.
+	mailTimeout = 30 * time.Second
+)
+
+// ForgotPassword mails a reset link to the verified address. It answers the
+// same whether or not the address belongs to a user.
+func (s *server) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req ForgotPasswordReq
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	email, err := parseEmail(req.Email)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	user, err := s.db.GetUserByEmail(email)
+	if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err == nil && !user.Disabled {
+		token, err := utility.CreateActionToken(utility.PurposeResetPassword, user.Id, email, resetTokenLifetime)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+
+		s.sendMail(email, "Reset your Notes password", fmt.Sprintf(
+			"Hello %s,\n\nopen the link below within an hour to choose a new password:\n\n%s\n\nIf you did not ask for this, ignore this mail.\n",
+			user.Username, mailLink("/reset-password", token)))
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("If the address belongs to an account, a reset link was sent"))
+}
+
+func (s *server) ResetPassword(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req ResetPasswordReq
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	if req.Password == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request"})
+		return
+	}
+
+	token, err := utility.ParseActionToken(utility.PurposeResetPassword, req.Token)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	user, err := s.db.GetUserById(token.UserId)
+	if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	// the link is void once the address changed
+	if err != nil || user.Disabled || user.Email != token.Email || !user.Emailverified {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid or expired link"})
+		return
+	}
+
+	if !s.useToken(w, token) {
+		return
+	}
+
+	err = s.db.UpdatePassword(user.Id, req.Password)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	s.guard.succeeded(r.Context(), user.Username)
+	s.recordAuthEvent(user.Username, utility.ClientIP(r), repository.EventPasswordReset)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Password updated"))
+}
+
+func (s *server) ChangePassword(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, err := utility.ParseUserId(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	var req ChangePasswordReq
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	if req.OldPassword == "" || req.NewPassword == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request"})
+		return
+	}
+
+	user, err := s.db.GetUserById(userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	ip := utility.ClientIP(r)
+
+	if wait := s.guard.blocked(r.Context(), user.Username, ip); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Too many failed login attempts, try again later"})
+		return
+	}
+
+	_, err = s.db.GetUser(&repository.User{Username: user.Username, Password: req.OldPassword})
+	if errors.Is(err, repository.ErrInvalidCredentials) {
+		s.loginFailed(r.Context(), user.Username, ip)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Current password is wrong"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	err = s.db.UpdatePassword(userId, req.NewPassword)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	s.recordAuthEvent(user.Username, ip, repository.EventPasswordChanged)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Password updated"))
+}
+
+// SetEmail changes the address of the user and mails a verification link to
+// it. Resets are only sent to verified addresses.
+func (s *server) SetEmail(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, err := utility.ParseUserId(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	var req EmailReq
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	email, err := parseEmail(req.Email)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	err = s.db.SetEmail(userId, email)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	err = s.sendVerification(userId, email)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("Verification link sent"))
+}
+
+func (s *server) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req VerifyEmailReq
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	token, err := utility.ParseActionToken(utility.PurposeVerifyEmail, req.Token)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	owner, err := s.db.GetUserByEmail(token.Email)
+	if err == nil && owner.Id != token.UserId {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "The address is already used by another account"})
+		return
+	}
+	if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	if !s.useToken(w, token) {
+		return
+	}
+
+	err = s.db.VerifyEmail(token.UserId, token.Email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid or expired link"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Email verified"))
+}
+
+// useToken redeems token and writes the error response when it fails.
+func (s *server) useToken(w http.ResponseWriter, token *utility.ActionToken) bool {
+
+	err := s.db.UseToken(token.Id, token.ExpiresAt)
+	if errors.Is(err, repository.ErrTokenUsed) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return false
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return false
+	}
+
+	return true
+}
+
+func (s *server) sendVerification(userId uint64, email string) error {
+
+	token, err := utility.CreateActionToken(utility.PurposeVerifyEmail, userId, email, verifyTokenLifetime)
+	if err != nil {
+		return err
+	}
+
+	s.sendMail(email, "Verify your Notes email address", fmt.Sprintf(
+		"Open the link below within a day to confirm this address for your Notes account:\n\n%s\n",
+		mailLink("/verify-email", token)))
+
+	return nil
+}
+
+// sendMail delivers the mail in the background and logs failures instead of
+// failing the request, so that neither the response nor its timing reveals
+// whether a mail was sent.
+func (s *server) sendMail(to, subject, body string) {
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+
+		err := s.mailer.Send(ctx, mailer.Message{To: to, Subject: subject, Body: body})
+		if err != nil {
+			utility.Errorln("Error in sending mail:", err)
+		}
+	}()
+}
+
+func mailLink(path, token string) string {
+	return strings.TrimRight(config.Get().Mail.BaseURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+func parseEmail(email string) (string, error) {
+
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Name != "" {
+		return "", errors.New("Invalid email address")
+	}
+
+	return strings.ToLower(address.Address), nil
+}
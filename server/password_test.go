@@ -0,0 +1,140 @@
+package server
+
+import (
+	"NOTESBE/config"
+	"NOTESBE/mailer"
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+var mailLinkPattern = regexp.MustCompile(`\?token=(\S+)`)
+
+func TestPasswordReset(t *testing.T) {
+
+	cfg := *config.Get()
+	cfg.RateLimit.Policies = nil
+	config.Set(&cfg)
+	defer config.Set(nil)
+
+	dir := t.TempDir()
+
+	s := &server{router: mux.NewRouter(), db: mockrepo, mailer: &mailer.FileMailer{Dir: dir, From: "notes@localhost"}}
+	r := Router(s)
+
+	send := func(method, path string, body interface{}, token string) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(payload))
+		req.Header.Set("Authtoken", token)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// lastMail returns the token in the newest mail and removes the mail
+	lastMail := func(t *testing.T) string {
+		// mails are sent in the background
+		var files []string
+		assert.Eventually(t, func() bool {
+			files, _ = filepath.Glob(filepath.Join(dir, "*.eml"))
+			return len(files) > 0
+		}, time.Second, 5*time.Millisecond)
+		if len(files) != 1 {
+			t.Fatalf("expected one mail, found %d", len(files))
+		}
+		data, _ := os.ReadFile(files[0])
+		os.Remove(files[0])
+
+		match := mailLinkPattern.FindSubmatch(data)
+		if match == nil {
+			t.Fatalf("no link in mail:\n%s", data)
+		}
+		token, _ := url.QueryUnescape(string(match[1]))
+		return token
+	}
+
+	user := &repository.User{Id: 4, Username: "dana", Email: "dana@example.com", Emailverified: true}
+
+	t.Run("email verification", func(t *testing.T) {
+
+		login, _ := (&utility.TokenReq{Id: 4}).CreateJwtToken()
+
+		assert.Equal(t, http.StatusBadRequest, send(http.MethodPost, "/api/auth/email?userid=4", EmailReq{Email: "not an address"}, login.Token).Code)
+
+		mockrepo.EXPECT().SetEmail(uint64(4), "dana@example.com").Return(nil)
+		assert.Equal(t, http.StatusAccepted, send(http.MethodPost, "/api/auth/email?userid=4", EmailReq{Email: "Dana@Example.com"}, login.Token).Code)
+
+		token := lastMail(t)
+
+		mockrepo.EXPECT().GetUserByEmail("dana@example.com").Return(nil, repository.ErrUserNotFound).Times(2)
+		gomock.InOrder(
+			mockrepo.EXPECT().UseToken(gomock.Any(), gomock.Any()).Return(nil),
+			mockrepo.EXPECT().UseToken(gomock.Any(), gomock.Any()).Return(repository.ErrTokenUsed),
+		)
+		mockrepo.EXPECT().VerifyEmail(uint64(4), "dana@example.com").Return(nil)
+
+		assert.Equal(t, http.StatusOK, send(http.MethodPost, "/api/auth/email/verify", VerifyEmailReq{Token: token}, "").Code)
+		assert.Equal(t, http.StatusBadRequest, send(http.MethodPost, "/api/auth/email/verify", VerifyEmailReq{Token: token}, "").Code, "links are single use")
+	})
+
+	t.Run("forgot and reset", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetUserByEmail("nobody@example.com").Return(nil, repository.ErrUserNotFound)
+		assert.Equal(t, http.StatusAccepted, send(http.MethodPost, "/api/auth/password/forgot", ForgotPasswordReq{Email: "nobody@example.com"}, "").Code)
+		files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+		assert.Empty(t, files, "unknown addresses get no mail")
+
+		mockrepo.EXPECT().GetUserByEmail("dana@example.com").Return(user, nil)
+		assert.Equal(t, http.StatusAccepted, send(http.MethodPost, "/api/auth/password/forgot", ForgotPasswordReq{Email: "dana@example.com"}, "").Code)
+
+		token := lastMail(t)
+
+		login, _ := (&utility.TokenReq{Id: 4}).CreateJwtToken()
+		assert.Equal(t, http.StatusBadRequest, send(http.MethodPost, "/api/auth/password/reset", ResetPasswordReq{Token: login.Token, Password: "new"}, "").Code, "login tokens are no reset tokens")
+
+		changed := *user
+		changed.Email = "other@example.com"
+		mockrepo.EXPECT().GetUserById(uint64(4)).Return(&changed, nil)
+		assert.Equal(t, http.StatusBadRequest, send(http.MethodPost, "/api/auth/password/reset", ResetPasswordReq{Token: token, Password: "new"}, "").Code, "changing the address voids the link")
+
+		mockrepo.EXPECT().GetUserById(uint64(4)).Return(user, nil)
+		mockrepo.EXPECT().UseToken(gomock.Any(), gomock.Any()).Return(nil)
+		mockrepo.EXPECT().UpdatePassword(uint64(4), "new").Return(nil)
+		mockrepo.EXPECT().CreateAuthEvent(gomock.Any()).Return(nil)
+		assert.Equal(t, http.StatusOK, send(http.MethodPost, "/api/auth/password/reset", ResetPasswordReq{Token: token, Password: "new"}, "").Code)
+	})
+
+	t.Run("change", func(t *testing.T) {
+
+		login, _ := (&utility.TokenReq{Id: 4}).CreateJwtToken()
+
+		mockrepo.EXPECT().GetUserById(uint64(4)).Return(user, nil).Times(2)
+		mockrepo.EXPECT().GetUser(gomock.Any()).DoAndReturn(func(req *repository.User) (uint64, error) {
+			if req.Username == "dana" && req.Password == "new" {
+				return 4, nil
+			}
+			return 0, repository.ErrInvalidCredentials
+		}).Times(2)
+		mockrepo.EXPECT().CreateAuthEvent(gomock.Any()).Return(nil).Times(2)
+
+		rec := send(http.MethodPost, "/api/auth/password/change?userid=4", ChangePasswordReq{OldPassword: "wrong", NewPassword: "newer"}, login.Token)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		mockrepo.EXPECT().UpdatePassword(uint64(4), "newer").Return(nil)
+		rec = send(http.MethodPost, "/api/auth/password/change?userid=4", ChangePasswordReq{OldPassword: "new", NewPassword: "newer"}, login.Token)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
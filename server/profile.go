@@ -0,0 +1,285 @@
+package server
+
+import (
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxUsernameLength    = 64
+	maxDisplaynameLength = 100
+	maxAvatarLength      = 2048
+)
+
+// SortOrders are the accepted values of the default sort setting.
+var SortOrders = []string{"updated_desc", "updated_asc", "created_desc", "created_asc"}
+
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+func profileResp(user *repository.User) *ProfileResp {
+	return &ProfileResp{
+		Id:            user.Id,
+		Username:      user.Username,
+		Displayname:   user.Displayname,
+		Email:         user.Email,
+		Emailverified: user.Emailverified,
+		Avatar:        user.Avatar,
+		Timezone:      user.Timezone,
+		Locale:        user.Locale,
+		Defaultsort:   user.Defaultsort,
+		TwoFactor:     user.Totpenabled,
+		Oidc:          user.Oidcsubject != "",
+	}
+}
+
+func (s *server) GetProfile(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, err := utility.ParseUserId(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	user, err := s.db.GetUserById(userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(profileResp(user))
+}
+
+// UpdateProfile changes the fields present in the request. A new email
+// address is unverified until the link mailed to it is opened.
+func (s *server) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, err := utility.ParseUserId(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	var req ProfileReq
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	user, err := s.db.GetUserById(userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	problems := []string{}
+	set := func(field *string, value *string) {
+		if value != nil {
+			*field = strings.TrimSpace(*value)
+		}
+	}
+
+	set(&user.Username, req.Username)
+	set(&user.Displayname, req.Displayname)
+	set(&user.Avatar, req.Avatar)
+	set(&user.Timezone, req.Timezone)
+	set(&user.Locale, req.Locale)
+	set(&user.Defaultsort, req.Defaultsort)
+
+	if user.Username == "" || len(user.Username) > maxUsernameLength {
+		problems = append(problems, "username must have between 1 and 64 characters")
+	}
+	if len(user.Displayname) > maxDisplaynameLength {
+		problems = append(problems, "displayname must not be longer than 100 characters")
+	}
+	if user.Avatar != "" {
+		avatar, err := url.Parse(user.Avatar)
+		if err != nil || (avatar.Scheme != "https" && avatar.Scheme != "http") || avatar.Host == "" || len(user.Avatar) > maxAvatarLength {
+			problems = append(problems, "avatar must be an http(s) URL")
+		}
+	}
+	if user.Timezone != "" {
+		if _, err := time.LoadLocation(user.Timezone); err != nil || user.Timezone == "Local" {
+			problems = append(problems, "timezone must be an IANA time zone such as Europe/Berlin")
+		}
+	}
+	if user.Locale != "" && !localePattern.MatchString(user.Locale) {
+		problems = append(problems, "locale must be a language tag such as en-US")
+	}
+	if user.Defaultsort != "" && !contains(SortOrders, user.Defaultsort) {
+		problems = append(problems, "defaultsort must be one of "+strings.Join(SortOrders, ", "))
+	}
+
+	var email string
+	if req.Email != nil {
+		if email, err = parseEmail(*req.Email); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": strings.Join(problems, "; ")})
+		return
+	}
+
+	if req.Username != nil {
+		other, err := s.db.GetUserByUsername(user.Username)
+		if err == nil && other.Id != userId {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Username is already taken"})
+			return
+		}
+		if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	err = s.db.UpdateProfile(user)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	if req.Email != nil && email != user.Email {
+		if err := s.db.SetEmail(userId, email); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		if err := s.sendVerification(userId, email); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		user.Email = email
+		user.Emailverified = false
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(profileResp(user))
+}
+
+// DeleteAccount deletes the user and everything they own. Users with a
+// password have to confirm it.
+func (s *server) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, err := utility.ParseUserId(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	var req DeleteAccountReq
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	user, err := s.db.GetUserById(userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	// users provisioned through OpenID Connect have no password to confirm
+	// until they set one; linking a provider keeps the password required
+	if !user.Passwordless {
+		ip := utility.ClientIP(r)
+
+		if wait := s.guard.blocked(r.Context(), user.Username, ip); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Too many failed login attempts, try again later"})
+			return
+		}
+
+		_, err = s.db.GetUser(&repository.User{Username: user.Username, Password: req.Password})
+		if errors.Is(err, repository.ErrInvalidCredentials) {
+			s.loginFailed(r.Context(), user.Username, ip)
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Password is wrong"})
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	exports, err := s.db.GetExports(userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	attachments, err := s.db.GetAttachmentsOfUser(userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	err = s.db.DeleteUser(userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	for _, export := range exports {
+		if export.File != "" {
+			os.Remove(export.File)
+		}
+	}
+	for _, attachment := range attachments {
+		s.deleteBlobs(r.Context(), &attachment)
+	}
+
+	s.guard.succeeded(r.Context(), user.Username)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Account deleted"))
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
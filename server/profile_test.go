@@ -0,0 +1,160 @@
+package server
+
+import (
+	"NOTESBE/config"
+	"NOTESBE/mailer"
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfile(t *testing.T) {
+
+	cfg := *config.Get()
+	cfg.RateLimit.Policies = nil
+	config.Set(&cfg)
+	defer config.Set(nil)
+
+	dir := t.TempDir()
+
+	s := &server{router: mux.NewRouter(), db: mockrepo, mailer: &mailer.FileMailer{Dir: dir, From: "notes@localhost"}}
+	r := Router(s)
+
+	login, _ := (&utility.TokenReq{Id: 8}).CreateJwtToken()
+
+	send := func(method string, body interface{}) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, "/api/me?userid=8", bytes.NewBuffer(payload))
+		req.Header.Set("Authtoken", login.Token)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	str := func(s string) *string { return &s }
+
+	stored := func() *repository.User {
+		return &repository.User{Id: 8, Username: "erin", Password: "pw", Email: "erin@example.com", Emailverified: true, Locale: "en"}
+	}
+
+	t.Run("get", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetUserById(uint64(8)).Return(stored(), nil)
+
+		rec := send(http.MethodGet, nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NotContains(t, rec.Body.String(), "pw")
+
+		resp := ProfileResp{}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		assert.Equal(t, "erin", resp.Username)
+		assert.True(t, resp.Emailverified)
+	})
+
+	t.Run("invalid settings are all reported", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetUserById(uint64(8)).Return(stored(), nil)
+
+		rec := send(http.MethodPatch, ProfileReq{Timezone: str("Mars/Olympus"), Defaultsort: str("random"), Avatar: str("javascript:alert(1)")})
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "timezone")
+		assert.Contains(t, rec.Body.String(), "defaultsort")
+		assert.Contains(t, rec.Body.String(), "avatar")
+	})
+
+	t.Run("partial update", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetUserById(uint64(8)).Return(stored(), nil)
+		mockrepo.EXPECT().UpdateProfile(gomock.Any()).DoAndReturn(func(user *repository.User) error {
+			assert.Equal(t, "Erin E.", user.Displayname)
+			assert.Equal(t, "Asia/Kolkata", user.Timezone)
+			assert.Equal(t, "en", user.Locale, "omitted fields are kept")
+			return nil
+		})
+
+		rec := send(http.MethodPatch, ProfileReq{Displayname: str("Erin E."), Timezone: str("Asia/Kolkata")})
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("username must be unique", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetUserById(uint64(8)).Return(stored(), nil)
+		mockrepo.EXPECT().GetUserByUsername("frank").Return(&repository.User{Id: 9}, nil)
+
+		assert.Equal(t, http.StatusConflict, send(http.MethodPatch, ProfileReq{Username: str("frank")}).Code)
+	})
+
+	t.Run("new email is verified again", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetUserById(uint64(8)).Return(stored(), nil)
+		mockrepo.EXPECT().UpdateProfile(gomock.Any()).Return(nil)
+		mockrepo.EXPECT().SetEmail(uint64(8), "erin@new.example").Return(nil)
+
+		rec := send(http.MethodPatch, ProfileReq{Email: str("erin@new.example")})
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		resp := ProfileResp{}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		assert.False(t, resp.Emailverified)
+
+		assert.Eventually(t, func() bool {
+			files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+			return len(files) == 1
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("delete requires the password", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetUserById(uint64(8)).Return(stored(), nil).Times(2)
+		mockrepo.EXPECT().GetUser(gomock.Any()).DoAndReturn(func(req *repository.User) (uint64, error) {
+			if req.Password == "pw" {
+				return 8, nil
+			}
+			return 0, repository.ErrInvalidCredentials
+		}).Times(2)
+		mockrepo.EXPECT().CreateAuthEvent(gomock.Any()).Return(nil)
+
+		assert.Equal(t, http.StatusUnauthorized, send(http.MethodDelete, DeleteAccountReq{Password: "guess"}).Code)
+
+		mockrepo.EXPECT().GetExports(uint64(8)).Return([]repository.Export{}, nil)
+		mockrepo.EXPECT().GetAttachmentsOfUser(uint64(8)).Return([]repository.Attachment{}, nil)
+		mockrepo.EXPECT().DeleteUser(uint64(8)).Return(nil)
+		assert.Equal(t, http.StatusOK, send(http.MethodDelete, DeleteAccountReq{Password: "pw"}).Code)
+	})
+
+	t.Run("delete of a linked account requires the password", func(t *testing.T) {
+
+		linked := stored()
+		linked.Oidcissuer, linked.Oidcsubject = "https://id.example.com", "u-8"
+
+		mockrepo.EXPECT().GetUserById(uint64(8)).Return(linked, nil)
+		mockrepo.EXPECT().GetUser(gomock.Any()).Return(uint64(0), repository.ErrInvalidCredentials)
+		mockrepo.EXPECT().CreateAuthEvent(gomock.Any()).Return(nil)
+
+		assert.Equal(t, http.StatusUnauthorized, send(http.MethodDelete, DeleteAccountReq{}).Code)
+	})
+
+	t.Run("delete of a provisioned account", func(t *testing.T) {
+
+		provisioned := stored()
+		provisioned.Oidcissuer, provisioned.Oidcsubject = "https://id.example.com", "u-8"
+		provisioned.Passwordless = true
+
+		mockrepo.EXPECT().GetUserById(uint64(8)).Return(provisioned, nil)
+		mockrepo.EXPECT().GetExports(uint64(8)).Return([]repository.Export{}, nil)
+		mockrepo.EXPECT().GetAttachmentsOfUser(uint64(8)).Return([]repository.Attachment{}, nil)
+		mockrepo.EXPECT().DeleteUser(uint64(8)).Return(nil)
+
+		assert.Equal(t, http.StatusOK, send(http.MethodDelete, DeleteAccountReq{}).Code)
+	})
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"NOTESBE/config"
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitPolicies(t *testing.T) {
+
+	cfg := *config.Get()
+	cfg.RateLimit.Policies = []config.RateLimitPolicy{
+		{Name: "auth", Prefix: "/api/auth", Requests: 2, Period: time.Minute},
+		{Name: "default", Prefix: "/", Requests: 3, Period: time.Minute},
+	}
+	config.Set(&cfg)
+	defer config.Set(nil)
+
+	s := &server{router: mux.NewRouter(), db: mockrepo}
+	r := Router(s)
+
+	login := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewBufferString(`{"username":"a","password":"b"}`))
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	ping := func(userId uint64) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		if userId != 0 {
+			token, _ := (&utility.TokenReq{Id: userId}).CreateJwtToken()
+			req.Header.Set("Authtoken", token.Token)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("auth routes have a stricter budget", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetUser(gomock.Any()).Return(uint64(1), nil).Times(2)
+
+		rec := login()
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "2", rec.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, "1", rec.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, "2;w=60", rec.Header().Get("RateLimit-Policy"))
+
+		assert.Equal(t, http.StatusOK, login().Code)
+
+		rec = login()
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+		assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+		assert.Equal(t, http.StatusOK, ping(0).Code, "other route groups keep their own budget")
+	})
+
+	t.Run("authenticated users are limited separately", func(t *testing.T) {
+
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusOK, ping(7).Code)
+		}
+		assert.Equal(t, http.StatusTooManyRequests, ping(7).Code)
+
+		rec := ping(8)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "2", rec.Header().Get("RateLimit-Remaining"))
+	})
+
+	withToken := func(token, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.Header.Set("Authtoken", token)
+		req.RemoteAddr = ip + ":4000"
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("access tokens share the budget of their user", func(t *testing.T) {
+
+		plain := accessTokenPrefix + "ratelimit"
+		mockrepo.EXPECT().GetAccessTokenByHash(hashAccessToken(plain)).Return(&repository.Accesstoken{Id: 1, Userid: 9}, nil)
+
+		assert.Equal(t, http.StatusOK, ping(9).Code)
+		assert.Equal(t, http.StatusOK, withToken(plain, "10.0.3.1").Code)
+		assert.Equal(t, http.StatusOK, withToken(plain, "10.0.3.1").Code, "the token is looked up once")
+		assert.Equal(t, http.StatusTooManyRequests, ping(9).Code)
+
+		mockrepo.EXPECT().GetAccessTokenByHash(hashAccessToken(accessTokenPrefix+"other")).Return(nil, repository.ErrInvalidCredentials)
+
+		rec := withToken(accessTokenPrefix+"other", "10.0.3.1")
+		assert.Equal(t, "1", rec.Header().Get("RateLimit-Remaining"), "only the lookup was counted against the IP")
+	})
+
+	t.Run("made up tokens are limited per IP before they are looked up", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetAccessTokenByHash(gomock.Any()).Return(nil, repository.ErrInvalidCredentials).Times(3)
+
+		for i := 0; i < 3; i++ {
+			rec := withToken(fmt.Sprintf("%srandom%d", accessTokenPrefix, i), "10.0.4.1")
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, strconv.Itoa(2-i), rec.Header().Get("RateLimit-Remaining"))
+		}
+
+		rec := withToken(accessTokenPrefix+"random3", "10.0.4.1")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code, "no lookup once the budget of the IP is spent")
+	})
+}
+
+func TestPatCache(t *testing.T) {
+
+	var cache patCache
+	now := time.Now()
+
+	for i := 0; i <= patCacheSize; i++ {
+		cache.put(strconv.Itoa(i), uint64(i), now)
+		if i == 1 {
+			cache.get("0", now)
+		}
+	}
+
+	_, ok := cache.get("1", now)
+	assert.False(t, ok, "the least recently used token is dropped")
+	assert.Equal(t, patCacheSize, cache.order.Len())
+
+	_, ok = cache.get("0", now)
+	assert.True(t, ok, "a token in use is kept")
+
+	userId, ok := cache.get("5", now)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(5), userId)
+
+	_, ok = cache.get("5", now.Add(patCacheTTL+time.Second))
+	assert.False(t, ok, "entries expire")
+}
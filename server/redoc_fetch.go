@@ -0,0 +1,90 @@
+//go:build ignore
+
+// redoc_fetch downloads the Redoc release pinned in docs/redoc.lock into
+// docs/redoc.standalone.js and checks it against the pinned SHA-256. It is
+// run by go generate.
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	lockFile   = "docs/redoc.lock"
+	bundleFile = "docs/redoc.standalone.js"
+	bundleURL  = "https://cdn.jsdelivr.net/npm/redoc@%s/bundles/redoc.standalone.js"
+)
+
+func main() {
+
+	if err := fetch(); err != nil {
+		fmt.Fprintln(os.Stderr, "redoc_fetch:", err)
+		os.Exit(1)
+	}
+}
+
+func fetch() error {
+
+	lock, err := os.ReadFile(lockFile)
+	if err != nil {
+		return err
+	}
+
+	var version, sum string
+	for _, line := range strings.Split(string(lock), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		switch fields[0] {
+		case "version":
+			version = fields[len(fields)-1]
+		case "sha256":
+			if len(fields) > 1 {
+				sum = fields[1]
+			}
+		}
+	}
+	if version == "" {
+		return fmt.Errorf("%s has no version", lockFile)
+	}
+
+	resp, err := http.Get(fmt.Sprintf(bundleURL, version))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching redoc %s: %s", version, resp.Status)
+	}
+
+	bundle, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256(bundle)
+	got := hex.EncodeToString(digest[:])
+
+	if sum != "" && sum != got {
+		return fmt.Errorf("redoc %s has SHA-256 %s, %s pins %s", version, got, lockFile, sum)
+	}
+
+	if sum == "" {
+		lock = bytes.Replace(lock, []byte("\nsha256\n"), []byte("\nsha256 "+got+"\n"), 1)
+		if err := os.WriteFile(lockFile, lock, 0o644); err != nil {
+			return err
+		}
+		fmt.Printf("pinned redoc %s with SHA-256 %s\n", version, got)
+	}
+
+	return os.WriteFile(bundleFile, bundle, 0o644)
+}
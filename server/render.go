@@ -0,0 +1,265 @@
+package server
+
+import (
+	"NOTESBE/notefile"
+	"NOTESBE/render"
+	"NOTESBE/repository"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Representations of notes, the first is the default.
+const (
+	mediaJSON     = "application/json"
+	mediaMarkdown = "text/markdown"
+	mediaText     = "text/plain"
+	mediaHTML     = "text/html"
+	mediaPDF      = "application/pdf"
+)
+
+var noteMediaTypes = []string{mediaJSON, mediaMarkdown, mediaText, mediaHTML, mediaPDF}
+
+// renderNames are the values of the render query parameter, which overrides
+// the Accept header for links and browsers.
+var renderNames = map[string]string{
+	"json":     mediaJSON,
+	"markdown": mediaMarkdown,
+	"md":       mediaMarkdown,
+	"text":     mediaText,
+	"html":     mediaHTML,
+	"pdf":      mediaPDF,
+}
+
+// renderedNotePolicy keeps rendered notes from loading anything but images
+// even if a browser opens the response directly.
+const renderedNotePolicy = "default-src 'none'; img-src https: data:; style-src 'unsafe-inline'; sandbox"
+
+// negotiate picks the representation of notes for the request, from the
+// render query parameter or else the Accept header. It returns "" when none
+// is acceptable.
+func negotiate(r *http.Request) string {
+
+	if name := r.URL.Query().Get("render"); name != "" {
+		return renderNames[name]
+	}
+
+	accept := r.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return noteMediaTypes[0]
+	}
+
+	best, bestQuality := "", 0.0
+	for _, mediaType := range noteMediaTypes {
+		if q := acceptQuality(accept, mediaType); q > bestQuality {
+			best, bestQuality = mediaType, q
+		}
+	}
+
+	return best
+}
+
+// acceptQuality returns the q value the Accept header gives mediaType,
+// taken from the most specific range matching it, 0 when none does.
+func acceptQuality(accept, mediaType string) float64 {
+
+	q, specificity := 0.0, -1
+	major, _, _ := strings.Cut(mediaType, "/")
+
+	for _, entry := range strings.Split(accept, ",") {
+		name, params, err := mime.ParseMediaType(strings.TrimSpace(entry))
+		if err != nil {
+			continue
+		}
+
+		s := -1
+		switch name {
+		case mediaType:
+			s = 2
+		case major + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		}
+		if s <= specificity {
+			continue
+		}
+
+		specificity, q = s, 1.0
+		if value, ok := params["q"]; ok {
+			q, _ = strconv.ParseFloat(value, 64)
+		}
+	}
+
+	return q
+}
+
+func noteResp(note *repository.Note) NoteResp {
+
+	tags := splitTags(note.Tags)
+	if tags == nil {
+		tags = []string{}
+	}
+
+	kind := note.Kind
+	if kind == "" {
+		kind = repository.NoteText
+	}
+
+	return NoteResp{
+		Id:        note.Id,
+		Note:      note.Note,
+		Userid:    note.Userid,
+		Type:      kind,
+		Tags:      tags,
+		CreatedAt: note.Createdat,
+		UpdatedAt: note.Updatedat,
+	}
+}
+
+// searchMatch tells whether the text of a note found by a search matched,
+// or the text of its attachments.
+type searchMatch struct {
+	note        bool
+	attachments []repository.Attachment
+}
+
+func (m *searchMatch) apply(resp *NoteResp) {
+
+	if m.note {
+		resp.MatchedIn = append(resp.MatchedIn, "note")
+	}
+	if len(m.attachments) > 0 {
+		resp.MatchedIn = append(resp.MatchedIn, "attachment")
+	}
+	for i := range m.attachments {
+		resp.MatchedAttachments = append(resp.MatchedAttachments, attachmentResp(&m.attachments[i]))
+	}
+}
+
+// writeNotes sends notes in the representation the request negotiates.
+// A single note is sent on its own rather than as a list of one, with its
+// items if it is a checklist. Matches of a search are only told in JSON.
+func (s *server) writeNotes(w http.ResponseWriter, r *http.Request, single bool, matches map[uint64]*searchMatch, notes ...repository.Note) {
+
+	w.Header().Add("Vary", "Accept")
+
+	mediaType := negotiate(r)
+	if mediaType == "" {
+		w.WriteHeader(http.StatusNotAcceptable)
+		json.NewEncoder(w).Encode(map[string]string{"error": "notes are available as " + strings.Join(noteMediaTypes, ", ")})
+		return
+	}
+
+	checklists, err := s.checklistItems(notes)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	// representations other than JSON show the items as a task list
+	if mediaType != mediaJSON {
+		expandChecklists(notes, checklists)
+	}
+
+	var buf bytes.Buffer
+
+	switch mediaType {
+	case mediaJSON:
+		resp := []NoteResp{}
+		for i := range notes {
+			resp = append(resp, noteResp(&notes[i]))
+			if isChecklist(&notes[i]) {
+				items := checklists[notes[i].Id]
+				resp[i].Progress = checklistProgress(items)
+				if single {
+					for j := range items {
+						resp[i].Items = append(resp[i].Items, checklistItemResp(&items[j]))
+					}
+				}
+			}
+			if match := matches[notes[i].Id]; match != nil {
+				match.apply(&resp[i])
+			}
+		}
+		if single {
+			json.NewEncoder(&buf).Encode(resp[0])
+		} else {
+			json.NewEncoder(&buf).Encode(resp)
+		}
+
+	case mediaMarkdown:
+		for i := range notes {
+			if i > 0 {
+				buf.WriteString("\n")
+			}
+			buf.Write(notefile.Marshal(toNoteFile(&notes[i])))
+		}
+
+	case mediaText:
+		for i := range notes {
+			if i > 0 {
+				buf.WriteString("\n\n* * *\n\n")
+			}
+			buf.WriteString(render.Text(notes[i].Note))
+		}
+		buf.WriteString("\n")
+
+	case mediaHTML:
+		for _, note := range notes {
+			html, err := s.renders.Render(note.Id, note.Updatedat, note.Note)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+				return
+			}
+			if single {
+				buf.WriteString(html)
+			} else {
+				fmt.Fprintf(&buf, "<article id=\"note-%d\">\n%s</article>\n", note.Id, html)
+			}
+		}
+		w.Header().Set("Content-Security-Policy", renderedNotePolicy)
+
+	case mediaPDF:
+		docs := []render.Document{}
+		for _, note := range notes {
+			docs = append(docs, render.Document{
+				Title: fmt.Sprintf("Note %d, updated %s", note.Id, note.Updatedat.Format("2006-01-02 15:04")),
+				Text:  render.Text(note.Note),
+			})
+		}
+		missing, err := render.PDF(&buf, docs)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		// characters the font cannot show are drawn as U+FFFD, tell which
+		if len(missing) > 0 {
+			codes := make([]string, len(missing))
+			for i, r := range missing {
+				codes[i] = fmt.Sprintf("%U", r)
+			}
+			w.Header().Set("X-Missing-Characters", strings.Join(codes, ", "))
+		}
+		name := "notes.pdf"
+		if single {
+			name = fmt.Sprintf("note-%d.pdf", notes[0].Id)
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, name))
+	}
+
+	if strings.HasPrefix(mediaType, "text/") {
+		mediaType += "; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
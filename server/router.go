@@ -1,42 +1,110 @@
 package server
 
 import (
+	"NOTESBE/blobstore"
+	"NOTESBE/config"
+	"NOTESBE/mailer"
+	"NOTESBE/ratelimiter"
+	"NOTESBE/repository"
 	"NOTESBE/utility"
-	"time"
 
-	"github.com/didip/tollbooth"
-	"github.com/didip/tollbooth/limiter"
 	"github.com/gorilla/mux"
-	"github.com/juju/ratelimit"
 )
 
 func Router(s *server) *mux.Router {
 
 	r := s.router
 
-	limiter := tollbooth.NewLimiter(100, &limiter.ExpirableOptions{})
-	r.Use(utility.RateLimitMiddleware(limiter))
+	s.ApplyConfig(config.Get())
 
-	throttleLimiter := ratelimit.NewBucketWithQuantum(time.Second, 100, 100)
-	r.Use(utility.RequestThrottleMiddleware(throttleLimiter))
+	if s.limiter == nil {
+		s.limiter = ratelimiter.New(config.Get().RateLimit)
+	}
+	if s.guard.store == nil {
+		s.guard.store = ratelimiter.NewFailureStore(config.Get().RateLimit)
+	}
+	if s.mailer == nil {
+		s.mailer = mailer.New(config.Get().Mail)
+	}
+	if s.blobs == nil {
+		s.blobs = blobstore.New(config.Get().Attachments)
+	}
+	if s.indexQueue == nil {
+		s.indexQueue = make(chan repository.Attachment, indexQueueSize)
+		go s.indexWorker()
+	}
+
+	r.Use(utility.RequestLogMiddleware)
+	r.Use(utility.RateLimitMiddleware(s.limiter, s))
 
 	r.HandleFunc("/ping", Ping).Methods("GET")
 
+	// Documentation routes
+	r.HandleFunc("/api/openapi.json", s.OpenAPI).Methods("GET")
+	r.HandleFunc("/api/docs", Docs).Methods("GET")
+	r.HandleFunc("/api/docs/redoc.standalone.js", DocsBundle).Methods("GET")
+	r.HandleFunc("/.well-known/jwks.json", JWKS).Methods("GET")
+
 	// Authentication routes
 	authRouter := r.PathPrefix("/api/auth").Subrouter()
 	authRouter.HandleFunc("/signup", s.Signup).Methods("POST")
 	authRouter.HandleFunc("/login", s.Login).Methods("POST")
+	authRouter.HandleFunc("/2fa/setup", s.VerifyLogin(s.SetupTwoFactor)).Methods("POST")
+	authRouter.HandleFunc("/2fa/confirm", s.VerifyLogin(s.ConfirmTwoFactor)).Methods("POST")
+	authRouter.HandleFunc("/2fa/verify", s.VerifyTwoFactor).Methods("POST")
+	authRouter.HandleFunc("/password/forgot", s.ForgotPassword).Methods("POST")
+	authRouter.HandleFunc("/password/reset", s.ResetPassword).Methods("POST")
+	authRouter.HandleFunc("/password/change", s.VerifyLogin(s.ChangePassword)).Methods("POST")
+	authRouter.HandleFunc("/email", s.VerifyLogin(s.SetEmail)).Methods("POST")
+	authRouter.HandleFunc("/email/verify", s.VerifyEmail).Methods("POST")
+	authRouter.HandleFunc("/oidc/login", s.OidcLogin).Methods("GET")
+	authRouter.HandleFunc("/oidc/callback", s.OidcCallback).Methods("GET")
+
+	// Profile routes
+	meRouter := r.PathPrefix("/api/me").Subrouter()
+	meRouter.HandleFunc("", s.VerifyLogin(s.GetProfile)).Methods("GET")
+	meRouter.HandleFunc("", s.VerifyLogin(s.UpdateProfile)).Methods("PATCH")
+	meRouter.HandleFunc("", s.VerifyLogin(s.DeleteAccount)).Methods("DELETE")
+	meRouter.HandleFunc("/export", s.VerifyLogin(s.CreateExport)).Methods("POST")
+	meRouter.HandleFunc("/export/{id}", s.VerifyLogin(s.GetExport)).Methods("GET")
 
 	// Notes routes
 	notesRouter := r.PathPrefix("/api/notes").Subrouter()
-	notesRouter.HandleFunc("", utility.VerifyToken(s.CreateNotes)).Methods("POST")
-	notesRouter.HandleFunc("", utility.VerifyToken(s.GetNotes)).Methods("GET")
-	notesRouter.HandleFunc("/{id}", utility.VerifyToken(s.GetNotesById)).Methods("GET")
-	notesRouter.HandleFunc("/{id}", utility.VerifyToken(s.UpdateNoteById)).Methods("PUT")
-	notesRouter.HandleFunc("/{id}", utility.VerifyToken(s.DeleteNoteById)).Methods("DELETE")
-	notesRouter.HandleFunc("/{id}/share", utility.VerifyToken(s.ShareNoteById)).Methods("POST")
-
-	r.HandleFunc("/api/search", utility.VerifyToken(s.GetNoteByKey)).Methods("GET")
+	notesRouter.HandleFunc("", s.VerifyToken(ScopeNotesWrite, s.CreateNotes)).Methods("POST")
+	notesRouter.HandleFunc("", s.VerifyToken(ScopeNotesRead, s.GetNotes)).Methods("GET")
+	notesRouter.HandleFunc("/export", s.VerifyToken(ScopeNotesRead, s.ExportNotes)).Methods("GET")
+	notesRouter.HandleFunc("/import", s.VerifyToken(ScopeNotesWrite, s.ImportNotes)).Methods("POST")
+	notesRouter.HandleFunc("/imports", s.VerifyToken(ScopeNotesWrite, s.CreateImportJob)).Methods("POST")
+	notesRouter.HandleFunc("/imports/{id}", s.VerifyToken(ScopeNotesWrite, s.GetImportJob)).Methods("GET")
+	notesRouter.HandleFunc("/{id}", s.VerifyToken(ScopeNotesRead, s.GetNotesById)).Methods("GET")
+	notesRouter.HandleFunc("/{id}", s.VerifyToken(ScopeNotesWrite, s.UpdateNoteById)).Methods("PUT")
+	notesRouter.HandleFunc("/{id}", s.VerifyToken(ScopeNotesWrite, s.DeleteNoteById)).Methods("DELETE")
+	notesRouter.HandleFunc("/{id}/share", s.VerifyToken(ScopeShare, s.ShareNoteById)).Methods("POST")
+	notesRouter.HandleFunc("/{id}/attachments", s.VerifyToken(ScopeNotesWrite, s.UploadAttachments)).Methods("POST")
+	notesRouter.HandleFunc("/{id}/attachments", s.VerifyToken(ScopeNotesRead, s.GetAttachments)).Methods("GET")
+	notesRouter.HandleFunc("/{id}/attachments/{attachmentid}", s.VerifyToken(ScopeNotesRead, s.DownloadAttachment)).Methods("GET")
+	notesRouter.HandleFunc("/{id}/attachments/{attachmentid}", s.VerifyToken(ScopeNotesWrite, s.DeleteAttachment)).Methods("DELETE")
+	notesRouter.HandleFunc("/{id}/items", s.VerifyToken(ScopeNotesRead, s.GetChecklistItems)).Methods("GET")
+	notesRouter.HandleFunc("/{id}/items", s.VerifyToken(ScopeNotesWrite, s.AddChecklistItem)).Methods("POST")
+	notesRouter.HandleFunc("/{id}/items/{itemid}", s.VerifyToken(ScopeNotesWrite, s.UpdateChecklistItem)).Methods("PATCH")
+	notesRouter.HandleFunc("/{id}/items/{itemid}", s.VerifyToken(ScopeNotesWrite, s.DeleteChecklistItem)).Methods("DELETE")
+
+	r.HandleFunc("/api/attachments/{id}/thumb", s.VerifyToken(ScopeNotesRead, s.GetThumbnail)).Methods("GET")
+	r.HandleFunc("/api/search", s.VerifyToken(ScopeSearch, s.GetNoteByKey)).Methods("GET")
+
+	// Personal access tokens can only be managed with a login token
+	tokensRouter := r.PathPrefix("/api/tokens").Subrouter()
+	tokensRouter.HandleFunc("", s.VerifyLogin(s.CreateAccessToken)).Methods("POST")
+	tokensRouter.HandleFunc("", s.VerifyLogin(s.GetAccessTokens)).Methods("GET")
+	tokensRouter.HandleFunc("/{id}", s.VerifyLogin(s.DeleteAccessToken)).Methods("DELETE")
+
+	// Admin routes
+	adminRouter := r.PathPrefix("/api/admin").Subrouter()
+	adminRouter.HandleFunc("/config", utility.VerifyAdmin(ConfigStatus)).Methods("GET")
+	adminRouter.HandleFunc("/config/reload", utility.VerifyAdmin(ReloadConfig)).Methods("POST")
+	adminRouter.HandleFunc("/lockouts", utility.VerifyAdmin(s.Lockouts)).Methods("GET")
+	adminRouter.HandleFunc("/lockouts/unlock", utility.VerifyAdmin(s.Unlock)).Methods("POST")
+	adminRouter.HandleFunc("/authevents", utility.VerifyAdmin(s.AuthEvents)).Methods("GET")
 
 	return r
 }
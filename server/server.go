@@ -1,7 +1,13 @@
 package server
 
 import (
+	"NOTESBE/blobstore"
+	"NOTESBE/config"
+	"NOTESBE/mailer"
+	"NOTESBE/ratelimiter"
+	"NOTESBE/render"
 	"NOTESBE/repository"
+	"NOTESBE/utility"
 
 	"github.com/gorilla/mux"
 )
@@ -9,9 +15,19 @@ import (
 type server struct {
 	router *mux.Router
 	db     repository.Repository
+
+	limiter ratelimiter.RateLimiter
+	guard   loginGuard
+	pats    patCache
+	oidc    oidcProvider
+	mailer  mailer.Mailer
+	renders render.Cache
+	blobs   blobstore.BlobStore
+
+	indexQueue chan repository.Attachment
 }
 
-func NewServer(db *repository.Database) *server {
+func NewServer(db repository.Repository) *server {
 
 	s := &server{}
 
@@ -20,3 +36,13 @@ func NewServer(db *repository.Database) *server {
 
 	return s
 }
+
+// ApplyConfig updates the runtime settings of a running server. It is
+// registered with config.OnReload. Rate limit policies are read from the
+// current config on every request and need no action here.
+func (s *server) ApplyConfig(cfg *config.Config) {
+
+	if err := utility.SetLogLevel(cfg.Log.Level); err != nil {
+		utility.Errorln("Error in applying log level:", err)
+	}
+}
@@ -1,20 +1,295 @@
 package server
 
+import (
+	"NOTESBE/config"
+	"time"
+)
+
 type UserReq struct {
 	UserName string `json:"username"`
 	PassWord string `json:"password"`
+	// Email is optional at signup, a verification link is mailed to it.
+	Email string `json:"email,omitempty"`
+}
+
+type ForgotPasswordReq struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordReq struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type ChangePasswordReq struct {
+	OldPassword string `json:"oldpassword"`
+	NewPassword string `json:"newpassword"`
+}
+
+type EmailReq struct {
+	Email string `json:"email"`
+}
+
+// ProfileReq changes the fields that are set, see ProfileResp.
+type ProfileReq struct {
+	Username    *string `json:"username,omitempty"`
+	Displayname *string `json:"displayname,omitempty"`
+	Email       *string `json:"email,omitempty"`
+	Avatar      *string `json:"avatar,omitempty"`
+	Timezone    *string `json:"timezone,omitempty"`
+	Locale      *string `json:"locale,omitempty"`
+	Defaultsort *string `json:"defaultsort,omitempty"`
+}
+
+type ProfileResp struct {
+	Id            uint64 `json:"id"`
+	Username      string `json:"username"`
+	Displayname   string `json:"displayname"`
+	Email         string `json:"email"`
+	Emailverified bool   `json:"emailverified"`
+	// Avatar is the URL of a picture of the user.
+	Avatar string `json:"avatar"`
+	// Timezone is an IANA time zone name, Locale a language tag.
+	Timezone string `json:"timezone"`
+	Locale   string `json:"locale"`
+	// Defaultsort is one of updated_desc, updated_asc, created_desc and
+	// created_asc.
+	Defaultsort string `json:"defaultsort"`
+	TwoFactor   bool   `json:"twofactor"`
+	// Oidc is set for users linked to an OpenID Connect identity.
+	Oidc bool `json:"oidc"`
+}
+
+type DeleteAccountReq struct {
+	Password string `json:"password"`
 }
 
+type VerifyEmailReq struct {
+	Token string `json:"token"`
+}
+
+// LoginResp carries a token, or when the user has two-factor authentication
+// enabled a challenge to send with the code to /api/auth/2fa/verify.
 type LoginResp struct {
-	Token  string `json:"token"`
-	UserId uint64 `json:"userid"`
+	Token     string `json:"token"`
+	UserId    uint64 `json:"userid"`
+	Challenge string `json:"challenge,omitempty"`
+	TwoFactor bool   `json:"twofactor,omitempty"`
+}
+
+type TwoFactorSetupResp struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	// QRCode is a PNG encoding URI
+	QRCode []byte `json:"qrcode"`
+}
+
+type TwoFactorCodeReq struct {
+	Code string `json:"code"`
+}
+
+type TwoFactorVerifyReq struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
 }
 
+type RecoveryCodesResp struct {
+	Codes []string `json:"codes"`
+}
+
+// NoteReq creates a note of Type text, the default, or a checklist with
+// the Items. Updates only change the Note, which describes a checklist.
 type NoteReq struct {
-	Note string `json:"note"`
+	Note  string             `json:"note"`
+	Type  string             `json:"type,omitempty"`
+	Items []ChecklistItemReq `json:"items,omitempty"`
+}
+
+// NoteResp is a note as sent by the note endpoints as application/json.
+// Userid is the owner, which differs from the caller for shared notes.
+// Checklists carry their Progress, and when a single note is sent their
+// Items. Search results tell in MatchedIn whether the "note" or an
+// "attachment" matched, and which attachments in MatchedAttachments.
+type NoteResp struct {
+	Id                 uint64              `json:"id"`
+	Note               string              `json:"note"`
+	Userid             uint64              `json:"userid"`
+	Type               string              `json:"type"`
+	Tags               []string            `json:"tags"`
+	CreatedAt          time.Time           `json:"createdat"`
+	UpdatedAt          time.Time           `json:"updatedat"`
+	Progress           *ChecklistProgress  `json:"progress,omitempty"`
+	Items              []ChecklistItemResp `json:"items,omitempty"`
+	MatchedIn          []string            `json:"matchedin,omitempty"`
+	MatchedAttachments []AttachmentResp    `json:"matchedattachments,omitempty"`
+}
+
+// ChecklistItemReq adds an item to a checklist, or changes the fields that
+// are set. Duedate is a date like 2024-01-31; Assigneeid is the owner of
+// the note or a user it is shared with. "" and 0 clear them. Position moves
+// the item, 0 being the top.
+type ChecklistItemReq struct {
+	Text       *string `json:"text,omitempty"`
+	Checked    *bool   `json:"checked,omitempty"`
+	Duedate    *string `json:"duedate,omitempty"`
+	Assigneeid *uint64 `json:"assigneeid,omitempty"`
+	Position   *int    `json:"position,omitempty"`
+}
+
+type ChecklistItemResp struct {
+	Id         uint64    `json:"id"`
+	NoteId     uint64    `json:"noteid"`
+	Position   int       `json:"position"`
+	Text       string    `json:"text"`
+	Checked    bool      `json:"checked"`
+	Duedate    string    `json:"duedate,omitempty"`
+	Assigneeid uint64    `json:"assigneeid,omitempty"`
+	CreatedAt  time.Time `json:"createdat"`
+	UpdatedAt  time.Time `json:"updatedat"`
+}
+
+// ChecklistProgress counts the items of a checklist and those checked.
+type ChecklistProgress struct {
+	Total   int `json:"total"`
+	Checked int `json:"checked"`
+}
+
+// NoteFile is a note in the JSON format of /api/notes/export and
+// /api/notes/import. Id is ignored by imports, which always create notes.
+type NoteFile struct {
+	Id        uint64    `json:"id,omitempty"`
+	Note      string    `json:"note"`
+	Tags      []string  `json:"tags,omitempty"`
+	CreatedAt time.Time `json:"createdat,omitempty"`
+	UpdatedAt time.Time `json:"updatedat,omitempty"`
+}
+
+// ImportResult is the outcome for one file, or one entry of a JSON or
+// Markdown stream. Id is the created note, Error is set when none was.
+type ImportResult struct {
+	File  string `json:"file"`
+	Id    uint64 `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
 }
 
+type ImportResp struct {
+	Imported int            `json:"imported"`
+	Failed   int            `json:"failed"`
+	Results  []ImportResult `json:"results"`
+}
+
+// ImportJobResp is the progress of an Evernote or Keep import. Status is
+// pending, running, done or failed; Progress is the share of the upload read
+// in percent. Attachments counts the stored attachments of imported notes;
+// those that were refused, e.g. over the quota, are listed in Failures.
+type ImportJobResp struct {
+	Id          uint64    `json:"id"`
+	Source      string    `json:"source"`
+	Status      string    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	Progress    int       `json:"progress"`
+	Processed   int       `json:"processed"`
+	Imported    int       `json:"imported"`
+	Failed      int       `json:"failed"`
+	Attachments int       `json:"attachments"`
+	Failures    []string  `json:"failures,omitempty"`
+	CreatedAt   time.Time `json:"createdat"`
+	FinishedAt  time.Time `json:"finishedat,omitempty"`
+}
+
+// AttachmentResp describes a file attached to a note. Mime is the type
+// sniffed from the content; Url downloads the file and Thumbnail, set for
+// images, a preview of it.
+type AttachmentResp struct {
+	Id        uint64    `json:"id"`
+	NoteId    uint64    `json:"noteid"`
+	Name      string    `json:"name"`
+	Mime      string    `json:"mime"`
+	Size      int64     `json:"size"`
+	Sha256    string    `json:"sha256"`
+	Url       string    `json:"url"`
+	Thumbnail string    `json:"thumbnail,omitempty"`
+	CreatedAt time.Time `json:"createdat"`
+}
+
+// ShareNoteReq shares a note of the authenticated user. SenderId may be
+// left out; when given it has to be that user.
 type ShareNoteReq struct {
-	SenderId   uint64 `json:"senderid"`
+	SenderId   uint64 `json:"senderid,omitempty"`
 	RecieverId uint64 `json:"recieverid"`
 }
+
+type ConfigStatusResp struct {
+	File          string              `json:"file"`
+	Mode          string              `json:"mode"`
+	LogLevel      string              `json:"loglevel"`
+	TokenLifetime string              `json:"tokenlifetime"`
+	RateLimits    []RateLimitPolicy   `json:"ratelimits"`
+	LastReload    config.ReloadStatus `json:"lastreload"`
+}
+
+type RateLimitPolicy struct {
+	Name     string `json:"name"`
+	Prefix   string `json:"prefix"`
+	Requests int    `json:"requests"`
+	Period   string `json:"period"`
+}
+
+type LockoutResp struct {
+	UserName string    `json:"username,omitempty"`
+	Ip       string    `json:"ip,omitempty"`
+	Failures int       `json:"failures"`
+	Until    time.Time `json:"until"`
+}
+
+type UnlockReq struct {
+	UserName string `json:"username"`
+	Ip       string `json:"ip"`
+}
+
+// AccessTokenReq creates a personal access token. A zero ExpiresAt never
+// expires.
+type AccessTokenReq struct {
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expiresat"`
+}
+
+// AccessTokenResp describes a personal access token. Token is only filled in
+// the response to its creation.
+type AccessTokenResp struct {
+	Id        uint64    `json:"id"`
+	Name      string    `json:"name"`
+	Token     string    `json:"token,omitempty"`
+	Prefix    string    `json:"prefix"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expiresat"`
+	CreatedAt time.Time `json:"createdat"`
+}
+
+// ExportResp describes a personal data archive. Status is pending while it
+// is built, then done or failed; once done the archive can be downloaded
+// until ExpiresAt.
+type ExportResp struct {
+	Id        uint64    `json:"id"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Size      int64     `json:"size,omitempty"`
+	CreatedAt time.Time `json:"createdat"`
+	ExpiresAt time.Time `json:"expiresat,omitempty"`
+}
+
+// JWKSResp documents the JSON Web Key Set. RSA keys carry n and e, Ed25519
+// keys crv and x.
+type JWKSResp struct {
+	Keys []struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		Alg string `json:"alg"`
+		Use string `json:"use"`
+		N   string `json:"n,omitempty"`
+		E   string `json:"e,omitempty"`
+		Crv string `json:"crv,omitempty"`
+		X   string `json:"x,omitempty"`
+	} `json:"keys"`
+}
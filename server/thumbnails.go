@@ -0,0 +1,191 @@
+package server
+
+import (
+	"NOTESBE/blobstore"
+	"NOTESBE/imaging"
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// thumbnailSizes are the squares in pixels thumbnails fit into.
+var thumbnailSizes = []int{128, 256, 512, 1024}
+
+const defaultThumbnailSize = 256
+
+// thumbnailSlots limits how many images are scaled at the same time, a
+// large photo takes a few hundred megabytes while it is decoded.
+var thumbnailSlots = make(chan struct{}, 2)
+
+// thumbnailKey is where a thumbnail is cached, next to the attachment.
+func thumbnailKey(blobkey string, size int) string {
+	return fmt.Sprintf("%s.thumb-%d", blobkey, size)
+}
+
+// makeThumbnails scales an image attachment to the sizes and caches the
+// thumbnails in the blob store.
+func (s *server) makeThumbnails(ctx context.Context, attachment *repository.Attachment, sizes ...int) (map[int][]byte, error) {
+
+	select {
+	case thumbnailSlots <- struct{}{}:
+		defer func() { <-thumbnailSlots }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	content, err := s.blobs.Get(ctx, attachment.Blobkey)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(content)
+	content.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	thumbs, err := imaging.Thumbnails(data, sizes)
+	if err != nil {
+		return nil, err
+	}
+
+	for size, thumb := range thumbs {
+		if err := s.blobs.Put(ctx, thumbnailKey(attachment.Blobkey, size), bytes.NewReader(thumb)); err != nil {
+			utility.Errorln("Error in storing thumbnail", attachment.Id, size, err)
+		}
+	}
+
+	return thumbs, nil
+}
+
+// backgroundThumbnails makes every thumbnail of a new image, so they are
+// ready when it is first shown. Thumbnails finished after the attachment
+// was deleted are left behind in the blob store.
+func (s *server) backgroundThumbnails(attachment repository.Attachment) {
+	if _, err := s.makeThumbnails(context.Background(), &attachment, thumbnailSizes...); err != nil {
+		utility.Errorln("Error in making thumbnails of attachment", attachment.Id, err)
+	}
+}
+
+// thumbnail returns the cached thumbnail of the size, or makes it when it
+// is not cached yet.
+func (s *server) thumbnail(ctx context.Context, attachment *repository.Attachment, size int) ([]byte, error) {
+
+	content, err := s.blobs.Get(ctx, thumbnailKey(attachment.Blobkey, size))
+	if err == nil {
+		defer content.Close()
+		return io.ReadAll(content)
+	}
+	if !errors.Is(err, blobstore.ErrNotFound) {
+		return nil, err
+	}
+
+	thumbs, err := s.makeThumbnails(ctx, attachment, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return thumbs[size], nil
+}
+
+// GetThumbnail sends a thumbnail of an image attached to a note the user
+// owns or that was shared with them. A thumbnail that is not ready yet is
+// made while the client waits.
+func (s *server) GetThumbnail(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, err := utility.ParseUserId(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	attachmentId, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	size := defaultThumbnailSize
+	if value := r.URL.Query().Get("size"); value != "" {
+		size, err = strconv.Atoi(value)
+		valid := false
+		for _, thumbnailSize := range thumbnailSizes {
+			valid = valid || size == thumbnailSize
+		}
+		if err != nil || !valid {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("size must be one of %v", thumbnailSizes)})
+			return
+		}
+	}
+
+	attachment, err := s.db.GetAttachmentById(attachmentId)
+	if err == nil {
+		// attachments of notes the user cannot read are reported as
+		// missing, like notes are
+		_, err = s.db.GetReadableNote(attachment.Noteid, userId)
+		if errors.Is(err, repository.ErrNoteNotFound) {
+			err = repository.ErrAttachmentNotFound
+		}
+	}
+	if errors.Is(err, repository.ErrAttachmentNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	if !imaging.CanThumbnail(attachment.Mime) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("there are no thumbnails of %s attachments", attachment.Mime)})
+		return
+	}
+
+	etag := fmt.Sprintf(`"%s-%d"`, attachment.Sha256, size)
+	if r.Header.Get("If-None-Match") == etag {
+		w.Header().Del("Content-Type")
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	thumb, err := s.thumbnail(r.Context(), attachment, size)
+	switch {
+	case errors.Is(err, imaging.ErrFormat), errors.Is(err, imaging.ErrTooLarge):
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]string{"error": "no thumbnail can be made of this image: " + err.Error()})
+		return
+	case errors.Is(err, blobstore.ErrNotFound):
+		utility.Errorln("Error in reading attachment", attachment.Id, err)
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "the content of this attachment is missing"})
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", http.DetectContentType(thumb))
+	w.Header().Set("Content-Length", strconv.Itoa(len(thumb)))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(thumb)
+}
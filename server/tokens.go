@@ -0,0 +1,360 @@
+package server
+
+import (
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"container/list"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scopes of personal access tokens. JWTs from Login carry every scope.
+const (
+	ScopeNotesRead  = "notes:read"
+	ScopeNotesWrite = "notes:write"
+	ScopeShare      = "share"
+	ScopeSearch     = "search"
+)
+
+var allScopes = []string{ScopeNotesRead, ScopeNotesWrite, ScopeShare, ScopeSearch}
+
+// accessTokenPrefix marks personal access tokens so VerifyToken can tell them
+// apart from JWTs.
+const accessTokenPrefix = "ntk_"
+
+func hashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// patCacheTTL is how long the rate limiter remembers which user a personal
+// access token belongs to, and patCacheSize how many tokens it remembers.
+const (
+	patCacheTTL  = time.Minute
+	patCacheSize = 10000
+)
+
+// patCache remembers the users of valid personal access tokens by token
+// hash, so that rate limiting, which runs before VerifyToken, does not query
+// the database on every request. Invalid tokens are not remembered, they
+// are looked up again within the budget of the IP. The least recently used
+// tokens are dropped past patCacheSize. The zero value is ready to use.
+type patCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   list.List
+}
+
+type patEntry struct {
+	hash    string
+	userId  uint64
+	expires time.Time
+}
+
+func (c *patCache) get(hash string, now time.Time) (uint64, bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[hash]
+	if !ok {
+		return 0, false
+	}
+
+	entry := elem.Value.(*patEntry)
+	if now.After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, hash)
+		return 0, false
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.userId, true
+}
+
+func (c *patCache) put(hash string, userId uint64, now time.Time) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = map[string]*list.Element{}
+	}
+
+	entry := &patEntry{hash: hash, userId: userId, expires: now.Add(patCacheTTL)}
+	if elem, ok := c.entries[hash]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[hash] = c.order.PushFront(entry)
+
+	if c.order.Len() > patCacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*patEntry).hash)
+	}
+}
+
+// CachedTokenUser returns the user of a personal access token the rate
+// limiter has seen recently, see utility.TokenUsers. Other tokens are known
+// to be invalid without a lookup.
+func (s *server) CachedTokenUser(accessToken string) (uint64, bool, bool) {
+
+	if !strings.HasPrefix(accessToken, accessTokenPrefix) {
+		return 0, false, true
+	}
+
+	userId, ok := s.pats.get(hashAccessToken(accessToken), time.Now())
+	return userId, ok, ok
+}
+
+// LookupTokenUser resolves a personal access token to its user from the
+// database and remembers it when it is valid.
+func (s *server) LookupTokenUser(ctx context.Context, accessToken string) (uint64, bool) {
+
+	hash := hashAccessToken(accessToken)
+	now := time.Now()
+
+	token, err := s.db.GetAccessTokenByHash(hash)
+	if err != nil || (!token.Expiresat.IsZero() && !now.Before(token.Expiresat)) {
+		return 0, false
+	}
+
+	s.pats.put(hash, token.Userid, now)
+	return token.Userid, true
+}
+
+// VerifyLogin only accepts JWTs from Login whose token generation is still
+// current and whose user is not disabled, so that changing the password or
+// disabling the user logs out every session.
+func (s *server) VerifyLogin(endpoint http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		generation, err := utility.ParseLoginToken(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		userId, _ := utility.ParseUserId(r)
+
+		current, err := s.db.GetTokenGeneration(userId)
+		if errors.Is(err, repository.ErrUserNotFound) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if generation != current {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		endpoint(w, r)
+	})
+}
+
+// VerifyToken accepts either a JWT from Login or a personal access token
+// holding scope. Routes that must not be reachable with access tokens, like
+// token management itself, use VerifyLogin instead.
+func (s *server) VerifyToken(scope string, endpoint http.HandlerFunc) http.HandlerFunc {
+
+	jwtEndpoint := s.VerifyLogin(endpoint)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		accessToken := r.Header.Get("Authtoken")
+		if !strings.HasPrefix(accessToken, accessTokenPrefix) {
+			jwtEndpoint(w, r)
+			return
+		}
+
+		userId, err := utility.ParseUserId(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		token, err := s.db.GetAccessTokenByHash(hashAccessToken(accessToken))
+		if errors.Is(err, repository.ErrInvalidCredentials) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if token.Userid != userId || (!token.Expiresat.IsZero() && time.Now().After(token.Expiresat)) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if !hasScope(token.Scopes, scope) {
+			http.Error(w, "Forbidden: token lacks scope "+scope, http.StatusForbidden)
+			return
+		}
+
+		endpoint(w, r)
+	})
+}
+
+func hasScope(scopes, scope string) bool {
+	for _, s := range strings.Split(scopes, ",") {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *server) CreateAccessToken(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, err := utility.ParseUserId(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	var req AccessTokenReq
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	if req.Name == "" || len(req.Scopes) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request"})
+		return
+	}
+
+	for _, scope := range req.Scopes {
+		if !hasScope(strings.Join(allScopes, ","), scope) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Unknown scope " + scope})
+			return
+		}
+	}
+
+	if !req.ExpiresAt.IsZero() && req.ExpiresAt.Before(time.Now()) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "expiresat is in the past"})
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	plain := accessTokenPrefix + hex.EncodeToString(secret)
+
+	token := &repository.Accesstoken{
+		Userid:    userId,
+		Name:      req.Name,
+		Tokenhash: hashAccessToken(plain),
+		Prefix:    plain[:len(accessTokenPrefix)+6],
+		Scopes:    strings.Join(req.Scopes, ","),
+		Expiresat: req.ExpiresAt,
+	}
+
+	err = s.db.CreateAccessToken(token)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	resp := accessTokenResp(token)
+	resp.Token = plain
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *server) GetAccessTokens(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, err := utility.ParseUserId(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	tokens, err := s.db.GetAccessTokens(userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	resp := []AccessTokenResp{}
+	for i := range tokens {
+		resp = append(resp, accessTokenResp(&tokens[i]))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *server) DeleteAccessToken(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, err := utility.ParseUserId(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	tokenId, err := utility.ParseNoteId(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	err = s.db.DeleteAccessToken(tokenId, userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Token revoked"))
+}
+
+func accessTokenResp(token *repository.Accesstoken) AccessTokenResp {
+	return AccessTokenResp{
+		Id:        token.Id,
+		Name:      token.Name,
+		Prefix:    token.Prefix,
+		Scopes:    strings.Split(token.Scopes, ","),
+		ExpiresAt: token.Expiresat,
+		CreatedAt: token.Createdat,
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"NOTESBE/config"
+	"NOTESBE/repository"
+	repomock "NOTESBE/repository/mocks"
+	"NOTESBE/utility"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessTokens(t *testing.T) {
+
+	// rate limiting looks tokens up too, see TestRateLimitPolicies
+	cfg := *config.Get()
+	cfg.RateLimit.Policies = nil
+	config.Set(&cfg)
+	defer config.Set(nil)
+
+	s := &server{router: mux.NewRouter(), db: mockrepo}
+	r := Router(s)
+
+	send := func(method, path string, body interface{}, token string) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(payload))
+		req.Header.Set("Authtoken", token)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	login, _ := (&utility.TokenReq{Id: 3}).CreateJwtToken()
+
+	var stored *repository.Accesstoken
+	var plain string
+
+	t.Run("create", func(t *testing.T) {
+
+		rec := send(http.MethodPost, "/api/tokens?userid=3", AccessTokenReq{Name: "backup", Scopes: []string{"notes:admin"}}, login.Token)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		mockrepo.EXPECT().CreateAccessToken(gomock.Any()).DoAndReturn(func(token *repository.Accesstoken) error {
+			token.Id = 1
+			stored = token
+			return nil
+		})
+
+		rec = send(http.MethodPost, "/api/tokens?userid=3", AccessTokenReq{Name: "backup", Scopes: []string{ScopeNotesRead, ScopeSearch}}, login.Token)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		resp := AccessTokenResp{}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		plain = resp.Token
+
+		assert.True(t, strings.HasPrefix(plain, "ntk_"))
+		assert.True(t, strings.HasPrefix(plain, resp.Prefix))
+		assert.Equal(t, hashAccessToken(plain), stored.Tokenhash, "only the hash is stored")
+		assert.Equal(t, "notes:read,search", stored.Scopes)
+		assert.Equal(t, uint64(3), stored.Userid)
+	})
+
+	t.Run("scopes are enforced", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetAccessTokenByHash(hashAccessToken(plain)).Return(stored, nil).Times(3)
+		mockrepo.EXPECT().GetNotesOfUser(uint64(3)).Return([]repository.Note{}, nil)
+
+		assert.Equal(t, http.StatusOK, send(http.MethodGet, "/api/notes?userid=3", nil, plain).Code)
+		assert.Equal(t, http.StatusForbidden, send(http.MethodPost, "/api/notes?userid=3", NoteReq{Note: "x"}, plain).Code)
+		assert.Equal(t, http.StatusUnauthorized, send(http.MethodGet, "/api/notes?userid=4", nil, plain).Code, "tokens only act as their owner")
+	})
+
+	t.Run("access tokens cannot manage tokens", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, send(http.MethodGet, "/api/tokens?userid=3", nil, plain).Code)
+	})
+
+	t.Run("expired and revoked tokens", func(t *testing.T) {
+
+		expired := *stored
+		expired.Expiresat = time.Now().Add(-time.Minute)
+		mockrepo.EXPECT().GetAccessTokenByHash(gomock.Any()).Return(&expired, nil)
+		assert.Equal(t, http.StatusUnauthorized, send(http.MethodGet, "/api/notes?userid=3", nil, plain).Code)
+
+		mockrepo.EXPECT().DeleteAccessToken(uint64(1), uint64(3)).Return(nil)
+		assert.Equal(t, http.StatusOK, send(http.MethodDelete, "/api/tokens/1?userid=3", nil, login.Token).Code)
+
+		mockrepo.EXPECT().GetAccessTokenByHash(gomock.Any()).Return(nil, repository.ErrInvalidCredentials)
+		assert.Equal(t, http.StatusUnauthorized, send(http.MethodGet, "/api/notes?userid=3", nil, plain).Code)
+	})
+
+	t.Run("list", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetAccessTokens(uint64(3)).Return([]repository.Accesstoken{*stored}, nil)
+
+		rec := send(http.MethodGet, "/api/tokens?userid=3", nil, login.Token)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NotContains(t, rec.Body.String(), stored.Tokenhash)
+		assert.NotContains(t, rec.Body.String(), plain)
+	})
+}
+
+func TestRevokedLogin(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	db := repomock.NewMockRepository(ctrl)
+	r := Router(&server{router: mux.NewRouter(), db: db})
+
+	send := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/tokens?userid=3", nil)
+		req.Header.Set("Authtoken", token)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	before, _ := (&utility.TokenReq{Id: 3}).CreateJwtToken()
+	after, _ := (&utility.TokenReq{Id: 3, Generation: 1}).CreateJwtToken()
+
+	// the password was changed once since the first token was issued
+	db.EXPECT().GetTokenGeneration(uint64(3)).Return(1, nil).Times(2)
+	db.EXPECT().GetAccessTokens(uint64(3)).Return(nil, nil)
+
+	assert.Equal(t, http.StatusUnauthorized, send(before.Token))
+	assert.Equal(t, http.StatusOK, send(after.Token))
+
+	db.EXPECT().GetTokenGeneration(uint64(3)).Return(0, repository.ErrUserNotFound)
+	assert.Equal(t, http.StatusUnauthorized, send(before.Token), "deleted and disabled users are logged out")
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	totpIssuer        = "Notes"
+	recoveryCodeCount = 10
+	twoFactorQRSize   = 256
+)
+
+func (s *server) SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, err := utility.ParseUserId(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	user, err := s.db.GetUserById(userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	if user.Totpenabled {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := utility.GenerateTotpSecret()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	uri := utility.TotpURI(totpIssuer, user.Username, secret)
+
+	png, err := qrcode.Encode(uri, qrcode.Medium, twoFactorQRSize)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	err = s.db.SetTotpSecret(userId, secret)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	resp := &TwoFactorSetupResp{
+		Secret: secret,
+		URI:    uri,
+		QRCode: png,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *server) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, err := utility.ParseUserId(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	var req TwoFactorCodeReq
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	user, err := s.db.GetUserById(userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	if user.Totpenabled {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	if user.Totpsecret == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Call /api/auth/2fa/setup first"})
+		return
+	}
+
+	step, ok := utility.ValidateTotp(user.Totpsecret, req.Code, time.Now(), user.Totplaststep)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid code"})
+		return
+	}
+
+	codes, err := utility.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	hashes := []string{}
+	for _, code := range codes {
+		hashes = append(hashes, utility.HashRecoveryCode(code))
+	}
+
+	err = s.db.EnableTotp(userId, step, hashes)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&RecoveryCodesResp{Codes: codes})
+}
+
+// VerifyTwoFactor is the second login step. It exchanges the challenge
+// returned by Login and a TOTP or recovery code for a token.
+func (s *server) VerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req TwoFactorVerifyReq
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	userId, username, err := utility.ParseChallengeToken(req.Challenge)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	ip := utility.ClientIP(r)
+
+	if wait := s.guard.blocked(r.Context(), username, ip); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Too many failed login attempts, try again later"})
+		return
+	}
+
+	user, err := s.db.GetUserById(userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	err = s.checkSecondFactor(user, req.Code)
+	if errors.Is(err, repository.ErrInvalidCredentials) {
+		s.loginFailed(r.Context(), username, ip)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid code"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	s.guard.succeeded(r.Context(), username)
+
+	tokenReq := &utility.TokenReq{
+		Id:         userId,
+		Generation: user.Tokengeneration,
+	}
+
+	token, err := tokenReq.CreateJwtToken()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	resp := &LoginResp{
+		Token:  token.Token,
+		UserId: userId,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// checkSecondFactor accepts a current TOTP code that was not used before or
+// an unused recovery code (xxxxx-xxxxx). Either is consumed.
+func (s *server) checkSecondFactor(user *repository.User, code string) error {
+
+	if !user.Totpenabled || user.Disabled {
+		return repository.ErrInvalidCredentials
+	}
+
+	if strings.Contains(code, "-") {
+		return s.db.UseRecoveryCode(user.Id, utility.HashRecoveryCode(code))
+	}
+
+	step, ok := utility.ValidateTotp(user.Totpsecret, code, time.Now(), user.Totplaststep)
+	if !ok {
+		return repository.ErrInvalidCredentials
+	}
+
+	return s.db.UseTotpStep(user.Id, step)
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"NOTESBE/repository"
+	"NOTESBE/utility"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTotpCode(t *testing.T) {
+
+	// RFC 6238 test vectors truncated to six digits, secret "12345678901234567890"
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	code, err := utility.TotpCode(secret, time.Unix(59, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, "287082", code)
+
+	code, _ = utility.TotpCode(secret, time.Unix(1111111109, 0))
+	assert.Equal(t, "081804", code)
+
+	step, ok := utility.ValidateTotp(secret, "081804", time.Unix(1111111109+30, 0), 0)
+	assert.True(t, ok, "one step of clock drift is tolerated")
+	assert.Equal(t, int64(1111111109/30), step)
+	_, ok = utility.ValidateTotp(secret, "081804", time.Unix(1111111109+90, 0), 0)
+	assert.False(t, ok)
+	_, ok = utility.ValidateTotp(secret, "081804", time.Unix(1111111109, 0), step)
+	assert.False(t, ok, "a code is accepted once")
+}
+
+func TestTwoFactor(t *testing.T) {
+
+	s := &server{router: mux.NewRouter(), db: mockrepo}
+	r := Router(s)
+
+	secret, _ := utility.GenerateTotpSecret()
+	user := &repository.User{Id: 5, Username: "alice", Totpsecret: secret}
+
+	send := func(method, path string, body interface{}, token string) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(payload))
+		req.Header.Set("Authtoken", token)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	token, _ := (&utility.TokenReq{Id: 5}).CreateJwtToken()
+
+	t.Run("setup and confirm", func(t *testing.T) {
+
+		mockrepo.EXPECT().GetUserById(uint64(5)).Return(&repository.User{Id: 5, Username: "alice"}, nil)
+		mockrepo.EXPECT().SetTotpSecret(uint64(5), gomock.Any()).Return(nil)
+
+		rec := send(http.MethodPost, "/api/auth/2fa/setup?userid=5", nil, token.Token)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		setup := TwoFactorSetupResp{}
+		json.NewDecoder(rec.Body).Decode(&setup)
+		assert.True(t, strings.HasPrefix(setup.URI, "otpauth://totp/Notes:alice?"))
+		assert.Contains(t, setup.URI, "secret="+setup.Secret)
+		assert.Equal(t, []byte("\x89PNG"), setup.QRCode[:4])
+
+		mockrepo.EXPECT().GetUserById(uint64(5)).Return(user, nil).Times(2)
+
+		rec = send(http.MethodPost, "/api/auth/2fa/confirm?userid=5", TwoFactorCodeReq{Code: "000000"}, token.Token)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		now := time.Now()
+		mockrepo.EXPECT().EnableTotp(uint64(5), now.Unix()/30, gomock.Len(recoveryCodeCount)).Return(nil)
+
+		code, _ := utility.TotpCode(secret, now)
+		rec = send(http.MethodPost, "/api/auth/2fa/confirm?userid=5", TwoFactorCodeReq{Code: code}, token.Token)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		codes := RecoveryCodesResp{}
+		json.NewDecoder(rec.Body).Decode(&codes)
+		assert.Len(t, codes.Codes, recoveryCodeCount)
+	})
+
+	user.Totpenabled = true
+
+	login := func() LoginResp {
+		mockrepo.EXPECT().GetUser(gomock.Any()).DoAndReturn(func(req *repository.User) (uint64, error) {
+			*req = *user
+			return user.Id, nil
+		})
+
+		rec := send(http.MethodPost, "/api/auth/login", UserReq{UserName: "alice", PassWord: "pass"}, "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		resp := LoginResp{}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp
+	}
+
+	t.Run("login requires the second factor", func(t *testing.T) {
+
+		resp := login()
+		assert.True(t, resp.TwoFactor)
+		assert.Empty(t, resp.Token)
+		assert.NotEmpty(t, resp.Challenge)
+
+		rec := send(http.MethodGet, "/api/notes?userid=5", nil, resp.Challenge)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, "the challenge is not an access token")
+
+		mockrepo.EXPECT().GetUserById(uint64(5)).Return(user, nil).Times(2)
+		mockrepo.EXPECT().CreateAuthEvent(gomock.Any()).Return(nil)
+
+		rec = send(http.MethodPost, "/api/auth/2fa/verify", TwoFactorVerifyReq{Challenge: resp.Challenge, Code: "000000"}, "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		now := time.Now()
+		mockrepo.EXPECT().UseTotpStep(uint64(5), now.Unix()/30).Return(nil)
+
+		code, _ := utility.TotpCode(secret, now)
+		rec = send(http.MethodPost, "/api/auth/2fa/verify", TwoFactorVerifyReq{Challenge: resp.Challenge, Code: code}, "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		final := LoginResp{}
+		json.NewDecoder(rec.Body).Decode(&final)
+		assert.Equal(t, uint64(5), final.UserId)
+
+		mockrepo.EXPECT().GetNotesOfUser(uint64(5)).Return([]repository.Note{}, nil)
+		rec = send(http.MethodGet, "/api/notes?userid=5", nil, final.Token)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("codes cannot be replayed", func(t *testing.T) {
+
+		resp := login()
+		now := time.Now()
+		code, _ := utility.TotpCode(secret, now)
+
+		used := *user
+		used.Totplaststep = now.Unix() / 30
+		mockrepo.EXPECT().GetUserById(uint64(5)).Return(&used, nil)
+		mockrepo.EXPECT().CreateAuthEvent(gomock.Any()).Return(nil)
+
+		rec := send(http.MethodPost, "/api/auth/2fa/verify", TwoFactorVerifyReq{Challenge: resp.Challenge, Code: code}, "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		// another login used the code in the meantime
+		mockrepo.EXPECT().GetUserById(uint64(5)).Return(user, nil)
+		mockrepo.EXPECT().UseTotpStep(uint64(5), now.Unix()/30).Return(repository.ErrInvalidCredentials)
+		mockrepo.EXPECT().CreateAuthEvent(gomock.Any()).Return(nil)
+
+		rec = send(http.MethodPost, "/api/auth/2fa/verify", TwoFactorVerifyReq{Challenge: resp.Challenge, Code: code}, "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("recovery codes", func(t *testing.T) {
+
+		resp := login()
+
+		mockrepo.EXPECT().GetUserById(uint64(5)).Return(user, nil)
+		mockrepo.EXPECT().UseRecoveryCode(uint64(5), utility.HashRecoveryCode("abcde-12345")).Return(nil)
+
+		rec := send(http.MethodPost, "/api/auth/2fa/verify", TwoFactorVerifyReq{Challenge: resp.Challenge, Code: "ABCDE-12345"}, "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("tampered challenge", func(t *testing.T) {
+
+		rec := send(http.MethodPost, "/api/auth/2fa/verify", TwoFactorVerifyReq{Challenge: token.Token, Code: "123456"}, "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, "an access token is not a challenge")
+	})
+}
@@ -0,0 +1,171 @@
+package utility
+
+import (
+	"NOTESBE/config"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+type tokenKey struct {
+	config.TokenKey
+	method jwt.SigningMethod
+	signer crypto.Signer
+}
+
+// keyCache keeps the parsed keys of the last token.keys seen, so key files
+// are read again only when the configuration changes.
+var keyCache struct {
+	mu     sync.Mutex
+	source string
+	keys   []tokenKey
+}
+
+func tokenKeys() ([]tokenKey, error) {
+
+	configured := config.Get().Token.Keys
+	source := fmt.Sprint(configured)
+
+	keyCache.mu.Lock()
+	defer keyCache.mu.Unlock()
+
+	if keyCache.keys != nil && keyCache.source == source {
+		return keyCache.keys, nil
+	}
+
+	keys := []tokenKey{}
+	for _, k := range configured {
+		signer, err := k.Load()
+		if err != nil {
+			return nil, err
+		}
+
+		key := tokenKey{TokenKey: k, signer: signer}
+		switch signer.(type) {
+		case *rsa.PrivateKey:
+			key.method = jwt.SigningMethodRS256
+		case ed25519.PrivateKey:
+			key.method = jwt.SigningMethodEdDSA
+		}
+		keys = append(keys, key)
+	}
+
+	keyCache.source = source
+	keyCache.keys = keys
+
+	return keys, nil
+}
+
+// signToken signs claims with the current signing key, or with the shared
+// HS256 secret when no asymmetric key is configured or active yet.
+func signToken(claims jwt.MapClaims) (string, error) {
+
+	keys, err := tokenKeys()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	var current *tokenKey
+	for i := range keys {
+		if keys[i].Active(now) && (current == nil || keys[i].ActiveFrom.After(current.ActiveFrom)) {
+			current = &keys[i]
+		}
+	}
+
+	if current == nil {
+		secret := config.Get().Token.SecretKey
+		if secret == "" && len(keys) > 0 {
+			return "", errors.New("no token signing key is active")
+		}
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	}
+
+	token := jwt.NewWithClaims(current.method, claims)
+	token.Header["kid"] = current.Kid
+
+	return token.SignedString(current.signer)
+}
+
+// parseToken verifies a token signed by signToken. Asymmetric tokens are
+// matched to a key by kid. HS256 tokens are accepted while token.secretkey is
+// set, so tokens issued before the switch to asymmetric keys stay valid until
+// the secret is removed.
+func parseToken(tokenString string, claims jwt.MapClaims) (*jwt.Token, error) {
+
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+
+		keys, err := tokenKeys()
+		if err != nil {
+			return nil, err
+		}
+
+		if token.Method == jwt.SigningMethodHS256 {
+			secret := config.Get().Token.SecretKey
+			if secret == "" && len(keys) > 0 {
+				return nil, errors.New("HS256 tokens are not accepted")
+			}
+			return []byte(secret), nil
+		}
+
+		kid, _ := token.Header["kid"].(string)
+
+		for _, key := range keys {
+			if key.Kid == kid && key.method == token.Method && !key.Retired(time.Now()) {
+				return key.signer.Public(), nil
+			}
+		}
+
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	})
+}
+
+// JWKS returns the public keys that verify tokens, as a JSON Web Key Set.
+// Keys that are not active yet are included so that verifiers can fetch
+// them ahead of a rotation.
+func JWKS() (map[string]interface{}, error) {
+
+	keys, err := tokenKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	set := []map[string]interface{}{}
+
+	for _, key := range keys {
+		if key.Retired(now) {
+			continue
+		}
+
+		jwk := map[string]interface{}{
+			"kid": key.Kid,
+			"use": "sig",
+			"alg": key.method.Alg(),
+		}
+
+		switch public := key.signer.Public().(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(public)
+		}
+
+		set = append(set, jwk)
+	}
+
+	return map[string]interface{}{"keys": set}, nil
+}
@@ -0,0 +1,89 @@
+package utility
+
+import (
+	"NOTESBE/config"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	LevelDebug int32 = iota
+	LevelInfo
+	LevelError
+)
+
+var logLevel atomic.Int32
+
+func init() {
+	logLevel.Store(LevelInfo)
+	config.SetLogger(Infoln, Errorln)
+}
+
+// SetLogLevel changes which of Debugln and Infoln produce output. Errorln is
+// always printed.
+func SetLogLevel(level string) error {
+
+	switch level {
+	case "debug":
+		logLevel.Store(LevelDebug)
+	case "info":
+		logLevel.Store(LevelInfo)
+	case "error":
+		logLevel.Store(LevelError)
+	default:
+		return fmt.Errorf("unknown log level %q", level)
+	}
+
+	return nil
+}
+
+func Debugln(v ...interface{}) {
+	if logLevel.Load() <= LevelDebug {
+		log.Println(append([]interface{}{"DEBUG"}, v...)...)
+	}
+}
+
+func Infoln(v ...interface{}) {
+	if logLevel.Load() <= LevelInfo {
+		log.Println(v...)
+	}
+}
+
+func Errorln(v ...interface{}) {
+	log.Println(v...)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the connection.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// RequestLogMiddleware logs every request at debug level.
+func RequestLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if logLevel.Load() > LevelDebug {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		Debugln(r.Method, r.URL.Path, rec.status, time.Since(start))
+	})
+}
@@ -0,0 +1,150 @@
+package utility
+
+import (
+	"NOTESBE/config"
+	"NOTESBE/ratelimiter"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
+)
+
+// TokenUsers resolves personal access tokens to their users, so that they
+// are counted against the budget of their user.
+type TokenUsers interface {
+	// CachedTokenUser returns the user of a token that was resolved before,
+	// known is false when the token has to be looked up.
+	CachedTokenUser(token string) (userId uint64, valid, known bool)
+	// LookupTokenUser resolves a token that is not known yet.
+	LookupTokenUser(ctx context.Context, token string) (uint64, bool)
+}
+
+// RateLimitMiddleware enforces the configured rate limit policies. Budgets
+// are tracked per policy and per client, and every response carries the
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers. tokens
+// resolves personal access tokens, which are counted against their user; a
+// token that has to be looked up is first counted against the IP, so that
+// made up tokens cannot query the database without limit.
+func RateLimitMiddleware(limiter ratelimiter.RateLimiter, tokens TokenUsers) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			policy := config.Get().RateLimit.Policy(r.URL.Path)
+			if policy == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// allow counts the request against key and answers 429 when its
+			// budget is spent
+			allow := func(key string) bool {
+
+				result, err := limiter.Allow(r.Context(), policy.Name+":"+key, policy.Requests, policy.Period)
+				if err != nil {
+					// fail open, an unavailable limiter must not take the API down
+					Errorln("Error in checking rate limit:", err)
+					return true
+				}
+
+				h := w.Header()
+				h.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+				h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+				h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+				h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Requests, ceilSeconds(policy.Period)))
+
+				if !result.Allowed {
+					h.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+					http.Error(w, "Too many requests", http.StatusTooManyRequests)
+					return false
+				}
+
+				return true
+			}
+
+			key, lookup := ClientKey(r, tokens)
+			if lookup != "" {
+				if !allow(key) {
+					return
+				}
+				userId, ok := tokens.LookupTokenUser(r.Context(), lookup)
+				if !ok {
+					next.ServeHTTP(w, r)
+					return
+				}
+				key = "user:" + strconv.FormatUint(userId, 10)
+			}
+
+			if !allow(key) {
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientKey identifies the caller for rate limiting: the user id of a valid
+// login token or of a known personal access token, or the remote IP address
+// for anonymous requests. A personal access token that is not known yet is
+// returned as lookup, with the IP as key.
+func ClientKey(r *http.Request, tokens TokenUsers) (key, lookup string) {
+
+	accessToken := r.Header.Get("Authtoken")
+
+	if userId, ok := tokenUserId(accessToken); ok {
+		return "user:" + strconv.FormatUint(userId, 10), ""
+	}
+
+	if tokens != nil && accessToken != "" {
+		userId, valid, known := tokens.CachedTokenUser(accessToken)
+		if valid {
+			return "user:" + strconv.FormatUint(userId, 10), ""
+		}
+		if !known {
+			lookup = accessToken
+		}
+	}
+
+	return "ip:" + ClientIP(r), lookup
+}
+
+// ClientIP returns the remote IP address of the request.
+func ClientIP(r *http.Request) string {
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func tokenUserId(accessToken string) (uint64, bool) {
+
+	if accessToken == "" {
+		return 0, false
+	}
+
+	claims := jwt.MapClaims{}
+	token, err := parseToken(accessToken, claims)
+	if err != nil || !token.Valid {
+		return 0, false
+	}
+
+	id, ok := claims["id"].(float64)
+	if _, challenge := claims["purpose"]; !ok || challenge {
+		return 0, false
+	}
+
+	return uint64(id), true
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
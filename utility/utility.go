@@ -1,38 +1,38 @@
 package utility
 
 import (
+	"NOTESBE/config"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
-	"log"
 	"net/http"
 	"strconv"
 	"time"
 
-	"github.com/didip/tollbooth"
-	"github.com/didip/tollbooth/limiter"
 	"github.com/golang-jwt/jwt"
 	"github.com/gorilla/mux"
-	"github.com/juju/ratelimit"
-	"github.com/spf13/viper"
 )
 
+// TokenReq describes a login token. Generation is the current
+// Tokengeneration of the user.
 type TokenReq struct {
-	Id    uint64
-	Token string
+	Id         uint64
+	Generation int
+	Token      string
 }
 
 func (r *TokenReq) CreateJwtToken() (*TokenReq, error) {
 
 	claims := jwt.MapClaims{
 		"id":  r.Id,
-		"exp": time.Now().Add(time.Hour * 2).Unix(),
+		"gen": r.Generation,
+		"exp": time.Now().Add(config.Get().Token.Lifetime).Unix(),
 	}
 
-	token := jwt.New(jwt.SigningMethodHS256)
-	token.Claims = claims
-
-	tokenString, err := token.SignedString([]byte(viper.GetString("token.secretkey")))
+	tokenString, err := signToken(claims)
 	if err != nil {
-		log.Println("Error in creating JWT Token for User:", err)
+		Errorln("Error in creating JWT Token for User:", err)
 		return nil, err
 	}
 
@@ -42,69 +42,208 @@ func (r *TokenReq) CreateJwtToken() (*TokenReq, error) {
 
 }
 
-func VerifyToken(endpoint http.HandlerFunc) http.HandlerFunc {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+// challengeLifetime is how long a user has to enter the second factor after
+// the password was accepted.
+const challengeLifetime = 5 * time.Minute
 
-		userId, err := ParseUserId(r)
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
+// CreateChallengeToken returns a token proving that the password of the user
+// was accepted. It only grants access to the second login step.
+func CreateChallengeToken(id uint64, username string) (string, error) {
 
-		accessToken := r.Header.Get("Authtoken")
+	claims := jwt.MapClaims{
+		"id":       id,
+		"username": username,
+		"purpose":  "2fa",
+		"exp":      time.Now().Add(challengeLifetime).Unix(),
+	}
 
-		if accessToken == "" {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
+	tokenString, err := signToken(claims)
+	if err != nil {
+		Errorln("Error in creating challenge token for User:", err)
+		return "", err
+	}
 
-		claims := jwt.MapClaims{}
-		token, err := jwt.ParseWithClaims(accessToken, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(viper.GetString("token.secretkey")), nil
-		})
+	return tokenString, nil
+}
 
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
+// ParseChallengeToken returns the user id and username of a valid token
+// created by CreateChallengeToken.
+func ParseChallengeToken(challenge string) (uint64, string, error) {
 
-		if claims["id"].(float64) != float64(userId) {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	claims := jwt.MapClaims{}
+	token, err := parseToken(challenge, claims)
+	if err != nil || !token.Valid {
+		return 0, "", errors.New("invalid or expired challenge")
+	}
+
+	id, ok := claims["id"].(float64)
+	username, _ := claims["username"].(string)
+	if !ok || claims["purpose"] != "2fa" {
+		return 0, "", errors.New("invalid or expired challenge")
+	}
+
+	return uint64(id), username, nil
+}
+
+// oidcStateLifetime is how long a user has to log in at the OpenID provider.
+const oidcStateLifetime = 10 * time.Minute
+
+// CreateOidcState returns a token keeping the state, nonce and PKCE verifier
+// of an OpenID Connect login between the redirect to the provider and the
+// callback.
+func CreateOidcState(state, nonce, verifier string) (string, error) {
+
+	claims := jwt.MapClaims{
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"purpose":  "oidc",
+		"exp":      time.Now().Add(oidcStateLifetime).Unix(),
+	}
+
+	return signToken(claims)
+}
+
+// ParseOidcState returns the state, nonce and verifier of a valid token
+// created by CreateOidcState.
+func ParseOidcState(tokenString string) (string, string, string, error) {
+
+	claims := jwt.MapClaims{}
+	token, err := parseToken(tokenString, claims)
+	if err != nil || !token.Valid || claims["purpose"] != "oidc" {
+		return "", "", "", errors.New("invalid or expired login state")
+	}
+
+	state, _ := claims["state"].(string)
+	nonce, _ := claims["nonce"].(string)
+	verifier, _ := claims["verifier"].(string)
+
+	return state, nonce, verifier, nil
+}
+
+const (
+	PurposeVerifyEmail   = "verify_email"
+	PurposeResetPassword = "reset_password"
+)
+
+// ActionToken is a single use token sent by mail. Id identifies the token so
+// that it can be redeemed once; Email is the address it was sent to.
+type ActionToken struct {
+	Id        string
+	UserId    uint64
+	Email     string
+	ExpiresAt time.Time
+}
+
+// CreateActionToken returns a token for purpose, valid for lifetime.
+func CreateActionToken(purpose string, userId uint64, email string, lifetime time.Duration) (string, error) {
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{
+		"jti":     hex.EncodeToString(jti),
+		"id":      userId,
+		"email":   email,
+		"purpose": purpose,
+		"exp":     time.Now().Add(lifetime).Unix(),
+	}
+
+	return signToken(claims)
+}
+
+// ParseActionToken returns the content of a valid token created by
+// CreateActionToken for purpose. It does not check whether the token was
+// used already.
+func ParseActionToken(purpose, tokenString string) (*ActionToken, error) {
+
+	invalid := errors.New("invalid or expired link")
+
+	claims := jwt.MapClaims{}
+	token, err := parseToken(tokenString, claims)
+	if err != nil || !token.Valid || claims["purpose"] != purpose {
+		return nil, invalid
+	}
+
+	id, _ := claims["id"].(float64)
+	jti, _ := claims["jti"].(string)
+	email, _ := claims["email"].(string)
+	exp, _ := claims["exp"].(float64)
+	if id == 0 || jti == "" {
+		return nil, invalid
+	}
+
+	return &ActionToken{
+		Id:        jti,
+		UserId:    uint64(id),
+		Email:     email,
+		ExpiresAt: time.Unix(int64(exp), 0),
+	}, nil
+}
+
+// VerifyAdmin only lets requests through whose Admintoken header matches the
+// configured admin.token. Admin endpoints are disabled while it is empty.
+func VerifyAdmin(endpoint http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		adminToken := config.Get().Admin.Token
+		if adminToken == "" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
 
-		if !token.Valid {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Admintoken")), []byte(adminToken)) != 1 {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		} else {
-			endpoint(w, r)
+			return
 		}
 
+		endpoint(w, r)
 	})
 }
 
-func RateLimitMiddleware(l *limiter.Limiter) mux.MiddlewareFunc {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			httpError := tollbooth.LimitByRequest(l, w, r)
-			if httpError != nil {
-				http.Error(w, httpError.Message, httpError.StatusCode)
-				return
-			}
-			next.ServeHTTP(w, r)
-		})
+// ErrInvalidLogin is returned by ParseLoginToken for requests without a
+// valid login token of the user they name.
+var ErrInvalidLogin = errors.New("invalid login token")
+
+// ParseLoginToken checks the login token in the Authtoken header, which must
+// belong to the user named by the userid parameter, and returns the token
+// generation it carries. The caller compares it with the current generation
+// of the user, which the token cannot prove by itself.
+func ParseLoginToken(r *http.Request) (int, error) {
+
+	userId, err := ParseUserId(r)
+	if err != nil {
+		return 0, ErrInvalidLogin
 	}
-}
 
-func RequestThrottleMiddleware(limiter *ratelimit.Bucket) mux.MiddlewareFunc {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if limiter.TakeAvailable(1) < 1 {
-				http.Error(w, "Too many requests", http.StatusTooManyRequests)
-				return
-			}
-			next.ServeHTTP(w, r)
-		})
+	accessToken := r.Header.Get("Authtoken")
+
+	if accessToken == "" {
+		return 0, ErrInvalidLogin
 	}
+
+	claims := jwt.MapClaims{}
+	token, err := parseToken(accessToken, claims)
+
+	if err != nil || !token.Valid {
+		return 0, ErrInvalidLogin
+	}
+
+	// challenge tokens only unlock the second login step
+	if _, found := claims["purpose"]; found {
+		return 0, ErrInvalidLogin
+	}
+
+	if id, _ := claims["id"].(float64); id != float64(userId) {
+		return 0, ErrInvalidLogin
+	}
+
+	// tokens issued before generations were introduced carry none
+	generation, _ := claims["gen"].(float64)
+
+	return int(generation), nil
 }
 
 func ParseUserId(r *http.Request) (uint64, error) {